@@ -6,18 +6,24 @@ import (
 	"log"
 	"os"
 	"time"
+	_ "time/tzdata" // the alpine image has no zoneinfo, series are expanded in the clinic timezone
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/gofrs/uuid"
+	"github.com/jasonlvhit/gocron"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/tidwall/buntdb"
 
 	_ "gitlab.com/falqon/inovantapp/backend/docs" // docs is generated by Swag CLI, you have to import it.
 	"gitlab.com/falqon/inovantapp/backend/server/handler"
+	"gitlab.com/falqon/inovantapp/backend/server/middleware/ratelimit"
+	"gitlab.com/falqon/inovantapp/backend/service/actionverification"
 	"gitlab.com/falqon/inovantapp/backend/service/appconf"
+	"gitlab.com/falqon/inovantapp/backend/service/audit"
+	"gitlab.com/falqon/inovantapp/backend/service/chat"
 	"gitlab.com/falqon/inovantapp/backend/service/schedule"
 	"gitlab.com/falqon/inovantapp/backend/service/user"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/keycache"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/keyring"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth/rolecache"
 )
 
@@ -52,22 +58,84 @@ func main() {
 	}
 	defer memDB.Close()
 
+	pr := &user.PermissionResolver{DB: db}
 	rcServ := &rolecache.RoleCache{
-		DB: memDB,
-		GetUserRoles: func(userID string) ([]string, error) {
-			roles := []string{}
-			UID, err := uuid.FromString(userID)
-			if err != nil {
-				return roles, err
-			}
-			g := user.Getter{DB: db}
-
-			u, err := g.Run(UID)
-			if err != nil {
-				return roles, err
-			}
-			return u.Roles, nil
-		},
+		DB:           memDB,
+		GetUserRoles: pr.Run,
+		TTL:          appconf.Auth.RoleCacheTTL,
+	}
+
+	// key secrets the tokens of each user carry the fingerprint of
+	ukg := &user.UserKeyGetter{DB: db}
+	keys := keycache.New(ukg.Run)
+
+	// the tokens are signed with the current signing key, created before
+	// serving when there's none or it's due
+	if len(appconf.JWT.Secret) == 0 {
+		panic("JWT_SECRET is required to seal the signing keys")
+	}
+	skr := &user.SigningKeyRotator{
+		DB:          db,
+		Logger:      log.New(os.Stdout, "SigningKeyRotator: ", log.LstdFlags),
+		Secret:      appconf.JWT.Secret,
+		Alg:         appconf.JWT.Alg,
+		RotateEvery: appconf.JWT.RotateEvery,
+		// old keys verify the tokens they signed until those expire
+		VerifyFor: maxDuration(appconf.Auth.AccessTokenTTL, appconf.Auth.ImpersonationTTL) + time.Hour,
+	}
+	err = skr.Run()
+	if err != nil {
+		panic(err)
+	}
+	skl := &user.SigningKeyLoader{DB: db, Secret: appconf.JWT.Secret}
+	signingKeys := keyring.New(skl.Run)
+	err = signingKeys.Reload()
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		<-skr.Start()
+	}()
+
+	// role changes and key rotations are notified by postgres to every instance
+	rcLogger := log.New(os.Stdout, "RoleCache: ", log.LstdFlags)
+	listener := pq.NewListener(psqlInfo, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			rcLogger.Println(err)
+		}
+		// notifications may have been missed while disconnected
+		if ev == pq.ListenerEventReconnected {
+			_ = rcServ.InvalidateAll()
+			keys.InvalidateAll()
+			_ = signingKeys.Reload()
+		}
+	})
+	defer listener.Close()
+	sub, err := chat.NewSubscriber(listener)
+	if err != nil {
+		panic(err)
+	}
+	err = sub.Subscribe(rolecache.Channel, func(payload string) {
+		err := rcServ.HandleNotification(payload)
+		if err != nil {
+			rcLogger.Println("Failed to invalidate roles:", err)
+		}
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = sub.Subscribe(keycache.Channel, keys.HandleNotification)
+	if err != nil {
+		panic(err)
+	}
+	err = sub.Subscribe(keyring.Channel, func(payload string) {
+		err := signingKeys.HandleNotification(payload)
+		if err != nil {
+			skr.Logger.Println("Failed to reload signing keys:", err)
+		}
+	})
+	if err != nil {
+		panic(err)
 	}
 
 	addr := appconf.App.Address
@@ -80,19 +148,72 @@ func main() {
 		<-schedulerNotifier.Start()
 	}()
 
+	// confirmed schedules without check-in after the grace period are no-shows
+	noShowMarker := schedule.NoShowMarker{DB: db, Logger: log.New(os.Stdout, "NoShowMarker: ", log.LstdFlags)}
+	go func() {
+		<-noShowMarker.Start()
+	}()
+
+	// moves the schedules of the next days between the rooms
+	if appconf.Rebalance.Enabled {
+		scheduler := schedule.Scheduler{
+			DB:     db,
+			Logger: log.New(os.Stdout, "Scheduler: ", log.LstdFlags),
+			Days:   appconf.Rebalance.Days,
+			Every:  appconf.Rebalance.Every,
+		}
+		go func() {
+			<-scheduler.Start()
+		}()
+	}
+
+	verificationPurger := actionverification.Purger{
+		DB:        db,
+		Logger:    log.New(os.Stdout, "VerificationPurger: ", log.LstdFlags),
+		Retention: appconf.Auth.VerificationRetention,
+	}
+	go func() {
+		<-verificationPurger.Start()
+	}()
+
+	auditPurger := audit.Purger{
+		DB:        db,
+		Logger:    log.New(os.Stdout, "AuditPurger: ", log.LstdFlags),
+		Retention: appconf.Audit.Retention,
+	}
+	go func() {
+		<-auditPurger.Start()
+	}()
+
+	var limits ratelimit.Store = ratelimit.NewMemoryStore()
+	if appconf.RateLimit.Store == "postgres" {
+		pgLimits := &ratelimit.PostgresStore{DB: db}
+		limits = pgLimits
+		go func() {
+			s := gocron.NewScheduler()
+			s.Every(1).Hour().Do(pgLimits.Purge)
+			<-s.Start()
+		}()
+	}
+
 	server := handler.HTTPServer{
-		DB:    db,
-		Roles: rcServ,
+		DB:     db,
+		Roles:  rcServ,
+		Limits: limits,
+		Keys:   keys,
 		Auth: &user.Authenticator{
 			DB: db,
 			JWTConfig: user.JWTConfig{
-				Secret:          appconf.JWT.Secret,
-				HoursTillExpire: time.Hour * 24 * 7,
-				SigningMethod:   jwt.SigningMethodHS256,
+				Keys:              signingKeys,
+				HoursTillExpire:   appconf.Auth.AccessTokenTTL,
+				RefreshTillExpire: appconf.Auth.RefreshTokenTTL,
+			},
+			Lockout: user.LockoutConfig{
+				MaxAttempts: appconf.Auth.MaxFailedAttempts,
+				Duration:    appconf.Auth.LockoutDuration,
 			},
 		},
 		JWTConfig: handler.JWTConfig{
-			Secret:       appconf.JWT.Secret,
 			ClaimsCtxKey: appconf.JWT.ClaimsCtxKey,
 			RolesCtxKey:  appconf.JWT.RolesCtxKey,
 		},
@@ -104,3 +225,10 @@ func main() {
 	}
 	server.Run()
 }
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,17 @@
+-- Failed sign in tracking and account lockout
+ALTER TABLE "user"
+	ADD COLUMN failed_attempts INT NOT NULL DEFAULT 0,
+	ADD COLUMN locked_until TIMESTAMPTZ;
+
+CREATE TABLE user_lockout (
+	uslo_id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES "user" (user_id),
+	-- locked | unlocked
+	type TEXT NOT NULL,
+	-- user that unlocked the account, NULL when triggered by the system
+	actor_id UUID REFERENCES "user" (user_id),
+	locked_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX user_lockout_user_id_idx ON user_lockout (user_id, created_at DESC);
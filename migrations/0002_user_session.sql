@@ -0,0 +1,15 @@
+-- Server side sessions backing the short lived access tokens
+CREATE TABLE user_session (
+	sess_id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES "user" (user_id),
+	-- sha256 of the current refresh token secret, rotated on every refresh
+	refresh_hash TEXT NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX user_session_user_id_idx ON user_session (user_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,17 @@
+-- TOTP two factor authentication
+ALTER TABLE "user"
+	ADD COLUMN totp_secret TEXT,
+	ADD COLUMN totp_enabled_at TIMESTAMPTZ,
+	-- last accepted time step, a code can't be used twice
+	ADD COLUMN totp_last_counter BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE user_recovery_code (
+	reco_id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES "user" (user_id),
+	-- sha256 of the code
+	code_hash TEXT NOT NULL,
+	used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX user_recovery_code_user_id_idx ON user_recovery_code (user_id) WHERE used_at IS NULL;
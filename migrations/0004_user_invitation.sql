@@ -0,0 +1,17 @@
+-- Invitations, the invited account stays inactive until accepted
+CREATE TABLE user_invitation (
+	invi_id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES "user" (user_id),
+	email TEXT NOT NULL,
+	invited_by UUID REFERENCES "user" (user_id),
+	-- sha256 of the link secret, replaced on resend
+	token_hash TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	accepted_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX user_invitation_pending_idx ON user_invitation (created_at DESC)
+	WHERE accepted_at IS NULL AND revoked_at IS NULL;
@@ -0,0 +1,10 @@
+-- Expiring, single use action verifications
+ALTER TABLE action_verification
+	ADD COLUMN expires_at TIMESTAMPTZ,
+	ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+
+UPDATE action_verification SET expires_at = created_at + INTERVAL '1 hour' WHERE expires_at IS NULL;
+
+ALTER TABLE action_verification ALTER COLUMN expires_at SET NOT NULL;
+
+CREATE INDEX action_verification_user_type_idx ON action_verification (user_id, type) WHERE deleted_at IS NULL;
@@ -0,0 +1,81 @@
+-- Roles and the granular permissions they grant. The permissions of the
+-- "user" role are granted to every signed in user
+CREATE TABLE role (
+	role_id TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE role_permission (
+	role_id TEXT NOT NULL REFERENCES role (role_id) ON DELETE CASCADE,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (role_id, permission)
+);
+
+INSERT INTO role (role_id, description) VALUES
+	('admin', 'Full access'),
+	('secretary', 'Manages doctors, schedules and patients of the clinic'),
+	('config', 'Sees the schedules of every doctor'),
+	('outdoor', 'Room outdoor panels'),
+	('visualization', 'Visualization only'),
+	('stock_manager', 'Stock management'),
+	('user', 'Granted to every signed in user');
+
+INSERT INTO role_permission (role_id, permission)
+SELECT 'admin', p FROM unnest(ARRAY[
+	'user:read:any', 'user:read:own', 'user:write:any', 'user:write:own',
+	'doctor:read:any', 'doctor:read:own', 'doctor:write:any', 'doctor:write:own',
+	'schedule:read:any', 'schedule:read:own', 'schedule:write:any', 'schedule:write:own',
+	'appointment:read:any', 'appointment:read:own', 'appointment:write:any', 'appointment:write:own',
+	'patient:read:any', 'patient:read:own', 'patient:write:any', 'patient:write:own',
+	'dashboard:read:any', 'dashboard:read:own',
+	'room:read:any', 'room:write:any',
+	'specialty:read:any', 'specialty:write:any',
+	'config:read:any', 'config:write:any',
+	'verification:read:any', 'verification:write:any',
+	'invitation:write:any',
+	'outdoor:read:any',
+	'role:read:any', 'role:write:any'
+]) AS p;
+
+INSERT INTO role_permission (role_id, permission)
+SELECT 'secretary', p FROM unnest(ARRAY[
+	'user:read:any',
+	'doctor:read:any', 'doctor:write:any',
+	'schedule:read:any', 'schedule:write:any',
+	'appointment:read:any', 'appointment:write:any',
+	'patient:read:any', 'patient:write:any',
+	'dashboard:read:any',
+	'room:write:any',
+	'specialty:write:any',
+	'config:write:any'
+]) AS p;
+
+INSERT INTO role_permission (role_id, permission)
+SELECT 'config', p FROM unnest(ARRAY[
+	'user:read:any',
+	'doctor:read:any',
+	'schedule:read:any', 'schedule:write:any',
+	'appointment:read:any', 'appointment:write:any',
+	'patient:read:any', 'patient:write:any',
+	'dashboard:read:any',
+	'room:write:any',
+	'specialty:write:any'
+]) AS p;
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('outdoor', 'outdoor:read:any');
+
+INSERT INTO role_permission (role_id, permission)
+SELECT 'user', p FROM unnest(ARRAY[
+	'user:read:own', 'user:write:own',
+	'doctor:read:own', 'doctor:write:own',
+	'schedule:read:own', 'schedule:write:own',
+	'appointment:read:own', 'appointment:write:own',
+	'patient:read:own', 'patient:write:own',
+	'dashboard:read:own',
+	'room:read:any',
+	'specialty:read:any',
+	'config:read:any'
+]) AS p;
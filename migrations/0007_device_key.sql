@@ -0,0 +1,17 @@
+-- Per device API keys, only allowed to read the outdoor data of their rooms
+CREATE TABLE device_key (
+	deke_id UUID PRIMARY KEY,
+	name TEXT NOT NULL,
+	room_ids UUID[] NOT NULL,
+	key_hash TEXT NOT NULL,
+	created_by UUID REFERENCES "user" (user_id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	rotated_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	last_used_ip TEXT
+);
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('admin', 'device:read:any'),
+	('admin', 'device:write:any');
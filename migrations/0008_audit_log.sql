@@ -0,0 +1,22 @@
+-- Who changed what through the API, with the entity before and after the change
+CREATE TABLE audit_log (
+	audi_id UUID PRIMARY KEY,
+	actor_id UUID,
+	action TEXT NOT NULL,
+	method TEXT NOT NULL,
+	route TEXT NOT NULL,
+	entity_type TEXT NOT NULL,
+	entity_id TEXT,
+	before JSONB NOT NULL DEFAULT 'null',
+	after JSONB NOT NULL DEFAULT 'null',
+	diff JSONB NOT NULL DEFAULT '{}',
+	ip TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at DESC);
+CREATE INDEX audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id);
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('admin', 'audit:read:any');
@@ -0,0 +1,4 @@
+-- Users flagged by an admin must change their password before using the API
+ALTER TABLE "user"
+	ADD COLUMN password_change_required BOOLEAN NOT NULL DEFAULT false,
+	ADD COLUMN password_changed_at TIMESTAMPTZ;
@@ -0,0 +1,9 @@
+-- Fixed window counters of the rate limiter when RATE_LIMIT_STORE=postgres
+CREATE UNLOGGED TABLE rate_limit (
+	-- rule name and the limited ip, email or id
+	key TEXT PRIMARY KEY,
+	count INT NOT NULL,
+	reset_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_reset_at_idx ON rate_limit (reset_at);
@@ -0,0 +1,44 @@
+-- Clinics sharing the deployment. Every tenant row has the institution it
+-- belongs to, the rows that existed before are moved to a default one
+CREATE TABLE institution (
+	inst_id UUID PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	inactive_at TIMESTAMPTZ
+);
+
+INSERT INTO institution (inst_id, name) VALUES
+	('00000000-0000-0000-0000-000000000001', 'Inovant');
+
+DO $$
+DECLARE
+	t TEXT;
+BEGIN
+	FOREACH t IN ARRAY ARRAY[
+		'user', 'doctor', 'patient', 'room', 'specialty', 'config', 'schedule',
+		'appointment', 'user_invitation', 'device_key', 'audit_log',
+		'action_verification', 'message'
+	] LOOP
+		EXECUTE format('ALTER TABLE %I ADD COLUMN IF NOT EXISTS inst_id UUID', t);
+		EXECUTE format('UPDATE %I SET inst_id = %L WHERE inst_id IS NULL', t, '00000000-0000-0000-0000-000000000001');
+		EXECUTE format('ALTER TABLE %I ALTER COLUMN inst_id SET NOT NULL', t);
+		EXECUTE format('ALTER TABLE %I ADD FOREIGN KEY (inst_id) REFERENCES institution (inst_id)', t);
+		EXECUTE format('CREATE INDEX ON %I (inst_id)', t);
+	END LOOP;
+END $$;
+
+-- each institution has its own timezone, hours and transition time
+ALTER TABLE config DROP CONSTRAINT config_pkey;
+ALTER TABLE config ADD PRIMARY KEY (inst_id, key);
+
+-- roles are shared by every institution, only the super admin changes them
+INSERT INTO role (role_id, description) VALUES
+	('superadmin', 'Provisions institutions and manages the shared roles');
+
+DELETE FROM role_permission WHERE role_id = 'admin' AND permission = 'role:write:any';
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('superadmin', 'institution:read:any'),
+	('superadmin', 'institution:write:any'),
+	('superadmin', 'role:read:any'),
+	('superadmin', 'role:write:any');
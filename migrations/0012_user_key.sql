@@ -0,0 +1,6 @@
+-- Secret mixed into the signing key of each user's tokens, rotating it
+-- invalidates every token of the user at once
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE "user"
+	ADD COLUMN key_secret BYTEA NOT NULL DEFAULT gen_random_bytes(32);
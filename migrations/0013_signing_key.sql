@@ -0,0 +1,11 @@
+-- Keys the tokens are signed with, identified by the kid in the token header.
+-- The newest key not retired signs, retired keys verify until they expire
+CREATE TABLE signing_key (
+	kid TEXT PRIMARY KEY,
+	alg TEXT NOT NULL,
+	-- PKCS #8 private key sealed with the JWT_SECRET
+	private_key BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	retired_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ
+);
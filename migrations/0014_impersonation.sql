@@ -0,0 +1,14 @@
+-- Sessions an admin opens to act as another user. They can't be refreshed
+-- and end with the session of the admin that opened them
+ALTER TABLE user_session
+	ADD COLUMN actor_id UUID REFERENCES "user" (user_id),
+	ADD COLUMN actor_sess_id UUID REFERENCES user_session (sess_id),
+	ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+
+-- requests made while impersonating, actor_id is the admin
+ALTER TABLE audit_log ADD COLUMN impersonated_user_id UUID;
+
+CREATE INDEX audit_log_impersonated_idx ON audit_log (impersonated_user_id) WHERE impersonated_user_id IS NOT NULL;
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('admin', 'user:impersonate:any');
@@ -0,0 +1,26 @@
+-- Recurring bookings. The occurrences are schedule rows placed in a room by
+-- the same rules as a single booking, the ones that can't be placed are
+-- reported and not created
+CREATE TABLE schedule_series (
+	sers_id UUID PRIMARY KEY,
+	inst_id UUID NOT NULL REFERENCES institution (inst_id),
+	doct_id UUID NOT NULL REFERENCES doctor (doct_id),
+	-- iCalendar RRULE, always bounded by COUNT or UNTIL
+	rrule TEXT NOT NULL,
+	-- first occurrence, the others keep its time of day and length
+	start_at TIMESTAMPTZ NOT NULL,
+	end_at TIMESTAMPTZ NOT NULL,
+	plan TEXT NOT NULL,
+	info JSONB,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	cancelled_at TIMESTAMPTZ
+);
+
+CREATE INDEX ON schedule_series (inst_id);
+
+-- sers_start_at is the start the rule gave the occurrence, kept when it's edited alone
+ALTER TABLE schedule
+	ADD COLUMN sers_id UUID REFERENCES schedule_series (sers_id),
+	ADD COLUMN sers_start_at TIMESTAMPTZ;
+
+CREATE INDEX schedule_sers_idx ON schedule (sers_id) WHERE sers_id IS NOT NULL;
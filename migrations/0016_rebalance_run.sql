@@ -0,0 +1,21 @@
+-- Reports of the scheduling algorithm that moves the schedules between rooms,
+-- run by the job or by an admin, previews list the moves without applying them
+CREATE TABLE rebalance_run (
+	reru_id UUID PRIMARY KEY,
+	inst_id UUID NOT NULL REFERENCES institution (inst_id),
+	-- job or admin
+	source TEXT NOT NULL,
+	actor_id UUID REFERENCES "user" (user_id),
+	preview BOOLEAN NOT NULL,
+	from_date DATE NOT NULL,
+	to_date DATE NOT NULL,
+	moves JSONB NOT NULL DEFAULT '[]',
+	failures JSONB NOT NULL DEFAULT '[]',
+	started_at TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX ON rebalance_run (inst_id, started_at DESC);
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('admin', 'schedule:rebalance:any');
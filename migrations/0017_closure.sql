@@ -0,0 +1,26 @@
+-- Days or hours the clinic, or a room, is closed. Bookings can't be made
+-- while it is, the yearly ones repeat on the same local dates every year
+CREATE TABLE closure (
+	clos_id UUID PRIMARY KEY,
+	inst_id UUID NOT NULL REFERENCES institution (inst_id),
+	-- NULL when the whole clinic is closed
+	room_id UUID REFERENCES room (room_id),
+	label TEXT NOT NULL,
+	-- UTC, as the schedule times
+	start_at TIMESTAMP NOT NULL,
+	end_at TIMESTAMP NOT NULL,
+	yearly BOOLEAN NOT NULL DEFAULT FALSE,
+	created_by UUID REFERENCES "user" (user_id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	deleted_at TIMESTAMPTZ,
+	CHECK (end_at > start_at)
+);
+
+CREATE INDEX ON closure (inst_id, start_at) WHERE deleted_at IS NULL;
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('admin', 'closure:read:any'),
+	('admin', 'closure:write:any'),
+	('secretary', 'closure:read:any'),
+	('secretary', 'closure:write:any'),
+	('user', 'closure:read:any');
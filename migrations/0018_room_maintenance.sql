@@ -0,0 +1,17 @@
+-- Time bounded maintenance of a room, as painting on a tuesday afternoon.
+-- The room can't be booked while it lasts, unlike inactive_at it ends
+CREATE TABLE room_maintenance (
+	rmai_id UUID PRIMARY KEY,
+	inst_id UUID NOT NULL REFERENCES institution (inst_id),
+	room_id UUID NOT NULL REFERENCES room (room_id),
+	reason TEXT NOT NULL,
+	-- UTC, as the schedule times
+	start_at TIMESTAMP NOT NULL,
+	end_at TIMESTAMP NOT NULL,
+	created_by UUID REFERENCES "user" (user_id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	deleted_at TIMESTAMPTZ,
+	CHECK (end_at > start_at)
+);
+
+CREATE INDEX ON room_maintenance (room_id, start_at) WHERE deleted_at IS NULL;
@@ -0,0 +1,24 @@
+-- Cancellations of the schedules, late ones are made after the cutoff of the
+-- policy of their plan, kept in the schedule-cancellation_policy config, and
+-- charge the fee and the hour credits of the policy to the doctor
+CREATE TABLE schedule_cancellation (
+	scca_id UUID PRIMARY KEY,
+	inst_id UUID NOT NULL REFERENCES institution (inst_id),
+	sche_id UUID NOT NULL REFERENCES schedule (sche_id) ON DELETE CASCADE,
+	doct_id UUID NOT NULL REFERENCES doctor (doct_id),
+	actor_id UUID REFERENCES "user" (user_id),
+	reason TEXT NOT NULL DEFAULT '',
+	plan TEXT NOT NULL,
+	-- UTC, as the schedule times
+	start_at TIMESTAMP NOT NULL,
+	end_at TIMESTAMP NOT NULL,
+	late BOOLEAN NOT NULL,
+	-- the penalty of a late cancellation was waived by the clinic
+	waived BOOLEAN NOT NULL DEFAULT FALSE,
+	fee NUMERIC(10, 2) NOT NULL DEFAULT 0,
+	credit_minutes INT NOT NULL DEFAULT 0,
+	cancelled_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON schedule_cancellation (doct_id, cancelled_at DESC);
+CREATE INDEX ON schedule_cancellation (inst_id, cancelled_at DESC);
@@ -0,0 +1,30 @@
+-- Lifecycle of a schedule. Cancelled schedules keep deleted_at set, as before,
+-- so the room they had is free again. Doctors of the plans listed in the
+-- schedule-approval_plans config, like {"plans": ["Turn"]}, book requested
+-- schedules that wait for the approval of the clinic
+ALTER TABLE schedule
+	ADD COLUMN status TEXT NOT NULL DEFAULT 'confirmed'
+		CHECK (status IN ('requested', 'confirmed', 'in_use', 'completed', 'cancelled', 'no_show')),
+	ADD COLUMN status_at TIMESTAMPTZ;
+
+UPDATE schedule SET status = 'cancelled', status_at = deleted_at WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX schedule_requested_idx ON schedule (inst_id, start_at) WHERE status = 'requested';
+
+-- Every change of status, from_status is NULL when the schedule is created
+CREATE TABLE schedule_status_change (
+	ssch_id UUID PRIMARY KEY,
+	inst_id UUID NOT NULL REFERENCES institution (inst_id),
+	sche_id UUID NOT NULL REFERENCES schedule (sche_id) ON DELETE CASCADE,
+	from_status TEXT,
+	to_status TEXT NOT NULL,
+	actor_id UUID REFERENCES "user" (user_id),
+	note TEXT NOT NULL DEFAULT '',
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON schedule_status_change (sche_id, changed_at);
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('admin', 'schedule:approve:any'),
+	('secretary', 'schedule:approve:any');
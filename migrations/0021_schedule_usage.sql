@@ -0,0 +1,18 @@
+-- Actual use of the schedules: the check-in and check-out times, and how
+-- long the check-out ran past end_at. transition_exceeded is set when it also
+-- ran past the transition window after end_at. The schedule-usage config,
+-- like {"no_show_grace_minutes": 15, "check_in_early_minutes": 30}, sets how
+-- late a confirmed schedule without check-in is a no-show and how early the
+-- check-in opens
+ALTER TABLE schedule
+	ADD COLUMN checked_in_at TIMESTAMPTZ,
+	ADD COLUMN checked_out_at TIMESTAMPTZ,
+	ADD COLUMN overstay_minutes INT NOT NULL DEFAULT 0,
+	ADD COLUMN transition_exceeded BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX schedule_confirmed_idx ON schedule (start_at) WHERE status = 'confirmed';
+
+INSERT INTO role_permission (role_id, permission) VALUES
+	('admin', 'schedule:checkin:any'),
+	('secretary', 'schedule:checkin:any'),
+	('outdoor', 'schedule:checkin:any');
@@ -9,22 +9,25 @@ import (
 
 //ActionVerification is a representation of the table ActionVerification
 type ActionVerification struct {
+	InstID       uuid.UUID `db:"inst_id" json:"instID"`
 	AcveID       uuid.UUID `db:"acve_id" json:"acveID"`
 	UserID       uuid.UUID `db:"user_id" json:"userID"`
 	Type         string    `db:"type" json:"type"`
-	Verification string    `db:"verification" json:"verification"`
+	Verification string    `db:"verification" json:"-"`
 	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
 	DeletedAt    null.Time `db:"deleted_at" json:"deletedAt"`
+	ExpiresAt    time.Time `db:"expires_at" json:"expiresAt"`
+	// Wrong verifications sent, it's deleted once the type limit is reached
+	Attempts int `db:"attempts" json:"attempts"`
 }
 
 //FilterActionVerification to get a List of ActionVerification
 type FilterActionVerification struct {
-	AcveID       *string
-	UserID       *string
-	Type         *string
-	Verification *string
-	InitialDate  *time.Time
-	FinishDate   *time.Time
-	Limit        *int64
-	Offset       *int64
+	AcveID      *string
+	UserID      *string
+	Type        *string
+	InitialDate *time.Time
+	FinishDate  *time.Time
+	Limit       *int64
+	Offset      *int64
 }
@@ -8,6 +8,7 @@ import (
 
 //Appointment is a representation of the table Appointment
 type Appointment struct {
+	InstID    uuid.UUID `db:"inst_id" json:"instID"`
 	AppoID    uuid.UUID `db:"appo_id" json:"appoID"`
 	StartAt   time.Time `db:"start_at" json:"startAt"`
 	ScheID    uuid.UUID `db:"sche_id" json:"scheID"`
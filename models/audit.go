@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+// AuditEntry is a representation of the table audit_log
+type AuditEntry struct {
+	InstID     uuid.UUID   `db:"inst_id" json:"instID"`
+	AudiID     uuid.UUID   `db:"audi_id" json:"audiID"`
+	ActorID    *uuid.UUID  `db:"actor_id" json:"actorID"`
+	Action     string      `db:"action" json:"action"`
+	Method     string      `db:"method" json:"method"`
+	Route      string      `db:"route" json:"route"`
+	EntityType string      `db:"entity_type" json:"entityType"`
+	EntityID   null.String `db:"entity_id" json:"entityID"`
+	// Entity row before and after the change, null when it didn't exist
+	Before types.JSONText `db:"before" json:"before"`
+	After  types.JSONText `db:"after" json:"after"`
+	// Changed fields, {"field": {"before": x, "after": y}}
+	Diff      types.JSONText `db:"diff" json:"diff"`
+	IP        string         `db:"ip" json:"ip"`
+	CreatedAt time.Time      `db:"created_at" json:"createdAt"`
+	// ImpersonatedUserID is set when the actor made the request as this user
+	ImpersonatedUserID *uuid.UUID `db:"impersonated_user_id" json:"impersonatedUserID"`
+}
+
+// FilterAudit to get a List of AuditEntry
+type FilterAudit struct {
+	ActorID     *string
+	Action      *string
+	EntityType  *string
+	EntityID    *string
+	InitialDate *time.Time
+	FinishDate  *time.Time
+	Limit       *int64
+	Offset      *int64
+	// Impersonated only returns the requests made while impersonating
+	Impersonated *bool
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+//CancellationPolicy of a plan, kept by plan in the schedule-cancellation_policy config
+type CancellationPolicy struct {
+	// CutoffHours before the start a Schedule can be cancelled for free
+	CutoffHours float64 `json:"cutoff_hours"`
+	// LateFee charged for a late cancellation
+	LateFee float64 `json:"late_fee"`
+	// CreditHours deducted from the doctor for a late cancellation
+	CreditHours float64 `json:"credit_hours"`
+	// MaxLatePerMonth late cancellations of a doctor, 0 is no limit
+	MaxLatePerMonth int `json:"max_late_per_month"`
+}
+
+//ScheduleCancellation is a representation of the table schedule_cancellation
+type ScheduleCancellation struct {
+	InstID        uuid.UUID  `db:"inst_id" json:"instID"`
+	SccaID        uuid.UUID  `db:"scca_id" json:"sccaID"`
+	ScheID        uuid.UUID  `db:"sche_id" json:"scheID"`
+	DoctID        uuid.UUID  `db:"doct_id" json:"doctID"`
+	ActorID       *uuid.UUID `db:"actor_id" json:"actorID"`
+	Reason        string     `db:"reason" json:"reason"`
+	Plan          string     `db:"plan" json:"plan"`
+	StartAt       time.Time  `db:"start_at" json:"startAt"`
+	EndAt         time.Time  `db:"end_at" json:"endAt"`
+	Late          bool       `db:"late" json:"late"`
+	Waived        bool       `db:"waived" json:"waived"`
+	Fee           float64    `db:"fee" json:"fee"`
+	CreditMinutes int        `db:"credit_minutes" json:"creditMinutes"`
+	CancelledAt   time.Time  `db:"cancelled_at" json:"cancelledAt"`
+	// Schedule cancelled, only when it was just cancelled
+	Schedule *Schedule `db:"-" json:"schedule,omitempty"`
+}
+
+//CancelRequest of a Schedule
+type CancelRequest struct {
+	Reason string `json:"reason"`
+	// Waive the penalty of a late cancellation, only for the clinic
+	Waive bool `json:"waive"`
+}
+
+//FilterScheduleCancellation to get a List of ScheduleCancellation
+type FilterScheduleCancellation struct {
+	DoctID *string
+	Late   *bool
+	From   *time.Time
+	To     *time.Time
+	Limit  *int64
+	Offset *int64
+}
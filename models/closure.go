@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gopkg.in/guregu/null.v3"
+)
+
+//Closure is a representation of the table closure, the clinic or a room is
+//closed between StartAt and EndAt
+type Closure struct {
+	InstID uuid.UUID `db:"inst_id" json:"instID"`
+	ClosID uuid.UUID `db:"clos_id" json:"closID"`
+	// RoomID is nil when the whole clinic is closed
+	RoomID  *uuid.UUID `db:"room_id" json:"roomID"`
+	Label   string     `db:"label" json:"label"`
+	StartAt time.Time  `db:"start_at" json:"startAt"`
+	EndAt   time.Time  `db:"end_at" json:"endAt"`
+	// Yearly closures repeat every year on the same local dates and times
+	Yearly    bool       `db:"yearly" json:"yearly"`
+	CreatedBy *uuid.UUID `db:"created_by" json:"createdBy"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+	DeletedAt null.Time  `db:"deleted_at" json:"deletedAt"`
+}
+
+//ClosureRequest to close the clinic, or a room, for whole local days from
+//FromDate to ToDate, or between StartAt and EndAt
+type ClosureRequest struct {
+	RoomID   *uuid.UUID `json:"roomID"`
+	Label    string     `json:"label" example:"Natal"`
+	FromDate string     `json:"fromDate" example:"2026-12-25"`
+	ToDate   string     `json:"toDate" example:"2026-12-25"`
+	StartAt  *time.Time `json:"startAt"`
+	EndAt    *time.Time `json:"endAt"`
+	Yearly   bool       `json:"yearly"`
+	// Cancel the Schedules the closure affects, the penalty of the late cancellations is waived
+	Cancel bool `json:"cancel"`
+	// Notify the doctors of the Schedules the closure affects
+	Notify bool `json:"notify"`
+}
+
+//ClosureReport of the Schedules a new Closure affects, the yearly ones
+//are checked for a year
+type ClosureReport struct {
+	Closure  Closure            `json:"closure"`
+	Affected []AffectedSchedule `json:"affected"`
+}
+
+//AffectedSchedule by a Closure
+type AffectedSchedule struct {
+	ScheID    uuid.UUID  `db:"sche_id" json:"scheID"`
+	DoctID    uuid.UUID  `db:"doct_id" json:"doctID"`
+	RoomID    *uuid.UUID `db:"room_id" json:"roomID"`
+	StartAt   time.Time  `db:"start_at" json:"startAt"`
+	EndAt     time.Time  `db:"end_at" json:"endAt"`
+	Cancelled bool       `db:"-" json:"cancelled"`
+	Notified  bool       `db:"-" json:"notified"`
+}
+
+//FilterClosure to get a List of Closure
+type FilterClosure struct {
+	RoomID *string
+	// Closures that may happen between From and To, the yearly ones always
+	From   *time.Time
+	To     *time.Time
+	Limit  *int64
+	Offset *int64
+}
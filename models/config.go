@@ -1,13 +1,15 @@
 package models
 
 import (
+	"github.com/gofrs/uuid"
 	types "github.com/jmoiron/sqlx/types"
 )
 
 //Config is a representation of the table Config
 type Config struct {
-	Key   string         `db:"key" json:"key"`
-	Value types.JSONText `db:"value" json:"value"`
+	InstID uuid.UUID      `db:"inst_id" json:"instID"`
+	Key    string         `db:"key" json:"key"`
+	Value  types.JSONText `db:"value" json:"value"`
 }
 
 //FilterConfig to get a List of Config
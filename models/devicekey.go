@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+	"gopkg.in/guregu/null.v3"
+)
+
+//DeviceKey is a representation of the table device_key
+type DeviceKey struct {
+	InstID     uuid.UUID      `db:"inst_id" json:"instID"`
+	DekeID     uuid.UUID      `db:"deke_id" json:"dekeID"`
+	Name       string         `db:"name" json:"name"`
+	RoomIDs    pq.StringArray `db:"room_ids" json:"roomIDs"`
+	KeyHash    string         `db:"key_hash" json:"-"`
+	CreatedBy  *uuid.UUID     `db:"created_by" json:"createdBy"`
+	CreatedAt  time.Time      `db:"created_at" json:"createdAt"`
+	RotatedAt  null.Time      `db:"rotated_at" json:"rotatedAt"`
+	RevokedAt  null.Time      `db:"revoked_at" json:"revokedAt"`
+	LastUsedAt null.Time      `db:"last_used_at" json:"lastUsedAt"`
+	LastUsedIP null.String    `db:"last_used_ip" json:"lastUsedIP"`
+}
+
+//DeviceKeySecret is a device key with the key itself, only returned when it's created or rotated
+type DeviceKeySecret struct {
+	DeviceKey
+	Key string `json:"key"`
+}
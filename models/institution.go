@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gopkg.in/guregu/null.v3"
+)
+
+//Institution is a representation of the table institution, a clinic with its
+//own rooms, doctors, patients and config
+type Institution struct {
+	InstID     uuid.UUID `db:"inst_id" json:"instID"`
+	Name       string    `db:"name" json:"name"`
+	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
+	InactiveAt null.Time `db:"inactive_at" json:"inactiveAt"`
+}
+
+//FilterInstitution to get a List of Institution
+type FilterInstitution struct {
+	Name   *string
+	Limit  *int64
+	Offset *int64
+}
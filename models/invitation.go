@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gopkg.in/guregu/null.v3"
+)
+
+//Invitation is a representation of the table user_invitation
+type Invitation struct {
+	InstID     uuid.UUID  `db:"inst_id" json:"instID"`
+	InviID     uuid.UUID  `db:"invi_id" json:"inviID"`
+	UserID     uuid.UUID  `db:"user_id" json:"userID"`
+	Email      string     `db:"email" json:"email"`
+	InvitedBy  *uuid.UUID `db:"invited_by" json:"invitedBy"`
+	TokenHash  string     `db:"token_hash" json:"-"`
+	ExpiresAt  time.Time  `db:"expires_at" json:"expiresAt"`
+	SentAt     time.Time  `db:"sent_at" json:"sentAt"`
+	AcceptedAt null.Time  `db:"accepted_at" json:"acceptedAt"`
+	RevokedAt  null.Time  `db:"revoked_at" json:"revokedAt"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+}
@@ -21,6 +21,7 @@ type MessageRead struct {
 
 // Message model
 type Message struct {
+	InstID     uuid.UUID      `db:"inst_id" json:"instID"`
 	MessID     int64          `db:"mess_id" json:"messID"`
 	ProrID     string         `db:"pror_id" json:"prorID"`
 	Type       string         `db:"type" json:"type"`
@@ -54,6 +55,7 @@ type ActivitySnapshot struct {
 
 // FilterMessage holds values to filter messages
 type FilterMessage struct {
+	InstID   uuid.UUID
 	GroupID  uuid.UUID
 	BeforeID *int64
 	Limit    *int64
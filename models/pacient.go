@@ -10,6 +10,7 @@ import (
 
 //Patient is a representation of the table Patient
 type Patient struct {
+	InstID          uuid.UUID      `db:"inst_id" json:"instID"`
 	PatiID          uuid.UUID      `db:"pati_id" json:"patiID"`
 	DoctID          uuid.UUID      `db:"doct_id" json:"doctID"`
 	DoctName        string         `db:"doct_name" json:"doctName"`
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+//RebalanceRun is the report of a run of the scheduling algorithm, the moves of a preview aren't applied
+type RebalanceRun struct {
+	ReruID uuid.UUID `db:"reru_id" json:"reruID"`
+	InstID uuid.UUID `db:"inst_id" json:"instID"`
+	// Source is job for the periodic runs, admin for the ones asked through the API
+	Source     string            `db:"source" json:"source"`
+	ActorID    *uuid.UUID        `db:"actor_id" json:"actorID"`
+	Preview    bool              `db:"preview" json:"preview"`
+	FromDate   time.Time         `db:"from_date" json:"fromDate"`
+	ToDate     time.Time         `db:"to_date" json:"toDate"`
+	Moves      RoomMoves         `db:"moves" json:"moves"`
+	Failures   RebalanceFailures `db:"failures" json:"failures"`
+	StartedAt  time.Time         `db:"started_at" json:"startedAt"`
+	FinishedAt time.Time         `db:"finished_at" json:"finishedAt"`
+}
+
+//RoomMove of a Schedule to another room
+type RoomMove struct {
+	ScheID     uuid.UUID  `json:"scheID"`
+	DoctID     uuid.UUID  `json:"doctID"`
+	StartAt    time.Time  `json:"startAt"`
+	EndAt      time.Time  `json:"endAt"`
+	FromRoomID *uuid.UUID `json:"fromRoomID"`
+	ToRoomID   uuid.UUID  `json:"toRoomID"`
+	// Applied is false in previews, a day with a Schedule changed during the run is a failure
+	Applied bool `json:"applied"`
+	// Notified tells if the doctor was sent a push notification
+	Notified bool `json:"notified"`
+}
+
+//RoomMoves of a run
+type RoomMoves []RoomMove
+
+//RebalanceFailure of a day the algorithm couldn't place every Schedule, nothing is moved that day
+type RebalanceFailure struct {
+	Date    string `json:"date"`
+	Message string `json:"message"`
+}
+
+//RebalanceFailures of a run
+type RebalanceFailures []RebalanceFailure
+
+//RebalanceRequest to run the scheduling algorithm for the days between FromDate and ToDate
+type RebalanceRequest struct {
+	FromDate string `json:"fromDate" example:"2026-01-05"`
+	ToDate   string `json:"toDate" example:"2026-01-09"`
+	// Preview lists the moves without applying them
+	Preview bool `json:"preview"`
+}
+
+//FilterRebalanceRun to get a List of RebalanceRun
+type FilterRebalanceRun struct {
+	Source  *string
+	Preview *bool
+	Limit   *int64
+}
+
+// Value implements the driver Valuer interface.
+func (i RoomMoves) Value() (driver.Value, error) {
+	if i == nil {
+		i = RoomMoves{}
+	}
+	b, err := json.Marshal(i)
+	return driver.Value(b), err
+}
+
+// Scan implements the Scanner interface.
+func (i *RoomMoves) Scan(src interface{}) error {
+	var source []byte
+	switch src.(type) {
+	case string:
+		source = []byte(src.(string))
+	case []byte:
+		source = src.([]byte)
+	default:
+		return errors.New("Incompatible type for RoomMoves")
+	}
+	return json.Unmarshal(source, i)
+}
+
+// Value implements the driver Valuer interface.
+func (i RebalanceFailures) Value() (driver.Value, error) {
+	if i == nil {
+		i = RebalanceFailures{}
+	}
+	b, err := json.Marshal(i)
+	return driver.Value(b), err
+}
+
+// Scan implements the Scanner interface.
+func (i *RebalanceFailures) Scan(src interface{}) error {
+	var source []byte
+	switch src.(type) {
+	case string:
+		source = []byte(src.(string))
+	case []byte:
+		source = src.([]byte)
+	default:
+		return errors.New("Incompatible type for RebalanceFailures")
+	}
+	return json.Unmarshal(source, i)
+}
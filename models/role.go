@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//Role is a representation of the table role with the permissions of role_permission
+type Role struct {
+	RoleID      string         `db:"role_id" json:"roleID"`
+	Description string         `db:"description" json:"description"`
+	Permissions pq.StringArray `db:"permissions" json:"permissions"`
+	CreatedAt   time.Time      `db:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time      `db:"updated_at" json:"updatedAt"`
+}
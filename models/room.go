@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx/types"
 	"gopkg.in/guregu/null.v3"
@@ -8,6 +10,7 @@ import (
 
 //Room is a representation of the table Room
 type Room struct {
+	InstID     uuid.UUID      `db:"inst_id" json:"instID"`
 	RoomID     uuid.UUID      `db:"room_id" json:"roomID"`
 	Label      string         `db:"label" json:"label"`
 	InactiveAt null.Time      `db:"inactive_at" json:"inactiveAt"`
@@ -21,3 +24,42 @@ type FilterRoom struct {
 	Limit  *int64
 	Offset *int64
 }
+
+//RoomMaintenance is a representation of the table room_maintenance, the
+//room can't be booked between StartAt and EndAt
+type RoomMaintenance struct {
+	InstID    uuid.UUID  `db:"inst_id" json:"instID"`
+	RmaiID    uuid.UUID  `db:"rmai_id" json:"rmaiID"`
+	RoomID    uuid.UUID  `db:"room_id" json:"roomID"`
+	Reason    string     `db:"reason" json:"reason" example:"Pintura"`
+	StartAt   time.Time  `db:"start_at" json:"startAt"`
+	EndAt     time.Time  `db:"end_at" json:"endAt"`
+	CreatedBy *uuid.UUID `db:"created_by" json:"createdBy"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+	DeletedAt null.Time  `db:"deleted_at" json:"deletedAt"`
+}
+
+//RoomMaintenanceReport of a new RoomMaintenance, the Schedules within it
+//are moved to other rooms, the ones that can't be are left and listed
+type RoomMaintenanceReport struct {
+	Maintenance RoomMaintenance   `json:"maintenance"`
+	Moved       []RoomMove        `json:"moved"`
+	Unmoved     []UnmovedSchedule `json:"unmoved"`
+}
+
+//UnmovedSchedule left in a room under maintenance, Reason tells why no
+//other room could be booked
+type UnmovedSchedule struct {
+	ScheID  uuid.UUID `json:"scheID"`
+	DoctID  uuid.UUID `json:"doctID"`
+	StartAt time.Time `json:"startAt"`
+	EndAt   time.Time `json:"endAt"`
+	Reason  string    `json:"reason"`
+}
+
+//FilterRoomMaintenance to get a List of RoomMaintenance
+type FilterRoomMaintenance struct {
+	// Maintenance ending after From and starting before To
+	From *time.Time
+	To   *time.Time
+}
@@ -13,6 +13,7 @@ import (
 
 //Schedule is a representation of the table Schedule
 type Schedule struct {
+	InstID    uuid.UUID      `db:"inst_id" json:"instID"`
 	ScheID    uuid.UUID      `db:"sche_id" json:"scheID"`
 	DoctID    uuid.UUID      `db:"doct_id" json:"doctID"`
 	NameDoct  *string        `db:"name" json:"name"`
@@ -24,6 +25,85 @@ type Schedule struct {
 	Info      types.JSONText `db:"info" json:"info"`
 	CreatedAt time.Time      `db:"created_at" json:"createdAt"`
 	DeletedAt null.Time      `db:"deleted_at" json:"deletedAt"`
+	// Series the schedule is an occurrence of, SersStartAt is the start the
+	// rule gave it before any edit
+	SersID      *uuid.UUID `db:"sers_id" json:"sersID"`
+	SersStartAt null.Time  `db:"sers_start_at" json:"sersStartAt"`
+	// Status of its lifecycle, StatusAt is when it last changed
+	Status   string    `db:"status" json:"status"`
+	StatusAt null.Time `db:"status_at" json:"statusAt"`
+	// Actual use, the minutes the check-out ran past EndAt and whether it ran
+	// past the transition window too
+	CheckedInAt        null.Time `db:"checked_in_at" json:"checkedInAt"`
+	CheckedOutAt       null.Time `db:"checked_out_at" json:"checkedOutAt"`
+	OverstayMinutes    int       `db:"overstay_minutes" json:"overstayMinutes"`
+	TransitionExceeded bool      `db:"transition_exceeded" json:"transitionExceeded"`
+}
+
+//ScheduleSeries is a representation of the table schedule_series, a
+//recurring Schedule whose occurrences follow an iCalendar RRULE
+type ScheduleSeries struct {
+	InstID uuid.UUID `db:"inst_id" json:"instID"`
+	SersID uuid.UUID `db:"sers_id" json:"sersID"`
+	DoctID uuid.UUID `db:"doct_id" json:"doctID"`
+	RRule  string    `db:"rrule" json:"rrule" example:"FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10"`
+	// StartAt and EndAt of the first occurrence, the others keep its time of day and length
+	StartAt     time.Time      `db:"start_at" json:"startAt"`
+	EndAt       time.Time      `db:"end_at" json:"endAt"`
+	Plan        string         `db:"plan" json:"plan"`
+	Info        types.JSONText `db:"info" json:"info"`
+	CreatedAt   time.Time      `db:"created_at" json:"createdAt"`
+	CancelledAt null.Time      `db:"cancelled_at" json:"cancelledAt"`
+	// Status asked for the occurrences booked, requested when a doctor books them
+	Status string `db:"-" json:"-"`
+}
+
+//ScheduleQuote is the booking a Schedule would get, nothing is stored
+type ScheduleQuote struct {
+	RoomID  uuid.UUID `json:"roomID"`
+	Label   string    `json:"label"`
+	StartAt time.Time `json:"startAt"`
+	EndAt   time.Time `json:"endAt"`
+	// TransitionMinutes the room is kept free between bookings of different doctors
+	TransitionMinutes int `json:"transitionMinutes"`
+	// TransitionBefore is the transition of the previous booking in the room
+	// and TransitionAfter the one of this booking, nil when the neighbour
+	// booking is of the same doctor
+	TransitionBefore *TimeRange     `json:"transitionBefore"`
+	TransitionAfter  *TimeRange     `json:"transitionAfter"`
+	Warnings         []QuoteWarning `json:"warnings"`
+}
+
+//TimeRange is an interval of time
+type TimeRange struct {
+	StartAt time.Time `json:"startAt"`
+	EndAt   time.Time `json:"endAt"`
+}
+
+//QuoteWarning is a preference the quoted booking doesn't meet, the booking is still possible
+type QuoteWarning struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+//UnplacedOccurrence is an occurrence of a series that couldn't be booked
+type UnplacedOccurrence struct {
+	StartAt time.Time `json:"startAt"`
+	EndAt   time.Time `json:"endAt"`
+	// ScheID of the occurrence kept as it was, when an edit couldn't move it
+	ScheID *uuid.UUID `json:"scheID,omitempty"`
+	// Reason code of the rule broken, with its message and values
+	Reason  string                 `json:"reason"`
+	Message string                 `json:"message"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+}
+
+//ScheduleSeriesReport is a series with the occurrences booked and the ones
+//that couldn't be
+type ScheduleSeriesReport struct {
+	ScheduleSeries
+	Placed   []Schedule           `json:"placed"`
+	Unplaced []UnplacedOccurrence `json:"unplaced"`
 }
 
 //ScheduleNotifier is a representation to notify of last fifteen minutes schedules
@@ -48,6 +128,9 @@ type FilterSchedule struct {
 	Hour        *string
 	Limit       *int64
 	Offset      *int64
+	SersID      *string
+	// Status is a list of statuses split by comma
+	Status *string
 }
 
 //Calendar is a representation of listCalendar query
@@ -61,6 +144,8 @@ type Calendar struct {
 	StartHour       string          `db:"start_hour" json:"startHour"`
 	EndHour         string          `db:"end_hour" json:"endHour"`
 	Patient         patientCalendar `db:"patient" json:"patient"`
+	// Status of the Schedule, also given to its transition time
+	Status string `db:"status" json:"status"`
 }
 
 //FilterCalendar is a representation to filter listCalendar query
@@ -71,6 +156,8 @@ type FilterCalendar struct {
 	EndAt   *time.Time
 	Limit   *int64
 	Offset  *int64
+	// Status is a list of statuses split by comma
+	Status *string
 }
 
 //CalendarPatient is a representation of Patient on Calendar
@@ -127,3 +214,21 @@ func (i *patientCalendar) Scan(src interface{}) error {
 	}
 	return json.Unmarshal(source, i)
 }
+
+//ScheduleStatusChange is a representation of the table schedule_status_change
+type ScheduleStatusChange struct {
+	InstID     uuid.UUID  `db:"inst_id" json:"instID"`
+	SschID     uuid.UUID  `db:"ssch_id" json:"sschID"`
+	ScheID     uuid.UUID  `db:"sche_id" json:"scheID"`
+	FromStatus *string    `db:"from_status" json:"fromStatus"`
+	ToStatus   string     `db:"to_status" json:"toStatus"`
+	ActorID    *uuid.UUID `db:"actor_id" json:"actorID"`
+	Note       string     `db:"note" json:"note"`
+	ChangedAt  time.Time  `db:"changed_at" json:"changedAt"`
+}
+
+//StatusChangeRequest of a Schedule
+type StatusChangeRequest struct {
+	Status string `json:"status" example:"in_use"`
+	Note   string `json:"note"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gopkg.in/guregu/null.v3"
+)
+
+//Session is a representation of the table user_session
+type Session struct {
+	SessID      uuid.UUID `db:"sess_id" json:"sessID"`
+	UserID      uuid.UUID `db:"user_id" json:"userID"`
+	RefreshHash string    `db:"refresh_hash" json:"-"`
+	UserAgent   string    `db:"user_agent" json:"userAgent"`
+	IP          string    `db:"ip" json:"ip"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+	LastUsedAt  time.Time `db:"last_used_at" json:"lastUsedAt"`
+	ExpiresAt   time.Time `db:"expires_at" json:"expiresAt"`
+	RevokedAt   null.Time `db:"revoked_at" json:"revokedAt"`
+	// ActorID is the admin impersonating the user, set on impersonation sessions
+	ActorID *uuid.UUID `db:"actor_id" json:"actorID"`
+	// ActorSessID is the session of the admin, the impersonation ends with it
+	ActorSessID *uuid.UUID `db:"actor_sess_id" json:"-"`
+	Reason      string     `db:"reason" json:"reason"`
+}
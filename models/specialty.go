@@ -1,9 +1,13 @@
 package models
 
-import "github.com/jmoiron/sqlx/types"
+import (
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx/types"
+)
 
 //Specialty is a representation of the table Specialty
 type Specialty struct {
+	InstID      uuid.UUID      `db:"inst_id" json:"instID"`
 	SpecID      int64          `db:"spec_id" json:"specID"`
 	Name        string         `db:"name" json:"name"`
 	Description string         `db:"description" json:"description"`
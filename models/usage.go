@@ -0,0 +1,48 @@
+package models
+
+import (
+	"github.com/gofrs/uuid"
+)
+
+//UsagePolicy of the institution, kept in the schedule-usage config
+type UsagePolicy struct {
+	// NoShowGraceMinutes after the start a confirmed Schedule without check-in is a no-show
+	NoShowGraceMinutes int `json:"no_show_grace_minutes"`
+	// CheckInEarlyMinutes before the start the check-in opens
+	CheckInEarlyMinutes int `json:"check_in_early_minutes"`
+}
+
+//ScheduleUsage is the booked and the actual use of the Schedules of a doctor
+type ScheduleUsage struct {
+	DoctID  *uuid.UUID `db:"doct_id" json:"doctID"`
+	DocName string     `db:"doc_name" json:"docName"`
+	Booked  int        `db:"booked" json:"booked"`
+	Used    int        `db:"used" json:"used"`
+	InUse   int        `db:"in_use" json:"inUse"`
+	NoShows int        `db:"no_shows" json:"noShows"`
+	// Minutes booked and minutes between check-in and check-out
+	BookedMinutes int `db:"booked_minutes" json:"bookedMinutes"`
+	UsedMinutes   int `db:"used_minutes" json:"usedMinutes"`
+	// LateMinutes between the start and the check-in
+	LateMinutes        int `db:"late_minutes" json:"lateMinutes"`
+	Overstays          int `db:"overstays" json:"overstays"`
+	OverstayMinutes    int `db:"overstay_minutes" json:"overstayMinutes"`
+	TransitionExceeded int `db:"transition_exceeded" json:"transitionExceeded"`
+}
+
+//UsageReport of the Schedules starting between two days, by doctor
+type UsageReport struct {
+	FromDate string          `json:"fromDate"`
+	ToDate   string          `json:"toDate"`
+	Doctors  []ScheduleUsage `json:"doctors"`
+	Total    ScheduleUsage   `json:"total"`
+}
+
+//FilterUsage is a representation to filter the usage report
+type FilterUsage struct {
+	// FromDate and ToDate are local days like 2006-01-02, ToDate included
+	FromDate *string
+	ToDate   *string
+	DoctID   *string
+	RoomID   *string
+}
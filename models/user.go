@@ -11,6 +11,7 @@ type UserRole []string
 
 //User is a representation of the table user
 type User struct {
+	InstID     uuid.UUID `db:"inst_id" json:"instID"`
 	UserID     uuid.UUID `db:"user_id" json:"userID"`
 	Email      string    `db:"email" json:"email"`
 	Password   []byte    `db:"password" json:"-"`
@@ -18,6 +19,18 @@ type User struct {
 	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
 	InactiveAt null.Time `db:"inactive_at" json:"inactiveAt"`
 	Token      *string   `db:"push_tokens" json:"pushToken"`
+	// Consecutive failed sign in attempts since the last successful one
+	FailedAttempts int       `db:"failed_attempts" json:"failedAttempts"`
+	LockedUntil    null.Time `db:"locked_until" json:"lockedUntil"`
+	// Base32 TOTP secret, set on enrolment and used once enabled
+	TotpSecret      null.String `db:"totp_secret" json:"-"`
+	TotpEnabledAt   null.Time   `db:"totp_enabled_at" json:"totpEnabledAt"`
+	TotpLastCounter int64       `db:"totp_last_counter" json:"-"`
+	// KeySecret is mixed into the signing key of the user's tokens
+	KeySecret []byte `db:"key_secret" json:"-"`
+	// Set by an admin, the user must change the password before using the API
+	PasswordChangeRequired bool      `db:"password_change_required" json:"passwordChangeRequired"`
+	PasswordChangedAt      null.Time `db:"password_changed_at" json:"passwordChangedAt"`
 }
 
 //UserWithDoctor is a representation of the table UserWithDoctor
@@ -26,3 +39,20 @@ type UserWithDoctor struct {
 	DoctID   *uuid.UUID `db:"doct_id" json:"doctID"`
 	DoctName *string    `db:"doct_name" json:"doctName"`
 }
+
+//UserLockout is a representation of the table user_lockout
+type UserLockout struct {
+	UsloID      uuid.UUID  `db:"uslo_id" json:"usloID"`
+	UserID      uuid.UUID  `db:"user_id" json:"userID"`
+	Type        string     `db:"type" json:"type"`
+	ActorID     *uuid.UUID `db:"actor_id" json:"actorID"`
+	LockedUntil null.Time  `db:"locked_until" json:"lockedUntil"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+}
+
+//TOTPEnrollment holds what the user needs to configure an authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// otpauth:// provisioning uri, to be shown as a QR code
+	URI string `json:"uri"`
+}
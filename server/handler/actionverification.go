@@ -14,13 +14,11 @@ import (
 
 // ActionVerificationHandler service to create handler
 type ActionVerificationHandler struct {
-	rolesCtxKey  string
-	claimsCtxKey string
-	create       func(*m.ActionVerification) (*m.ActionVerification, error)
-	update       func(*m.ActionVerification) (*m.ActionVerification, error)
-	delete       func(acveID uuid.UUID) (*m.ActionVerification, error)
-	list         func(m.FilterActionVerification) ([]m.ActionVerification, error)
-	get          func(acveID uuid.UUID) (*m.ActionVerification, error)
+	create func(uuid.UUID, *m.ActionVerification) (*m.ActionVerification, error)
+	update func(uuid.UUID, *m.ActionVerification) (*m.ActionVerification, error)
+	delete func(instID, acveID uuid.UUID) (*m.ActionVerification, error)
+	list   func(uuid.UUID, m.FilterActionVerification) ([]m.ActionVerification, error)
+	get    func(instID, acveID uuid.UUID) (*m.ActionVerification, error)
 }
 
 type actionVerificationResponse struct {
@@ -73,7 +71,7 @@ func (handler *ActionVerificationHandler) Create(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	acv, err := handler.create(&req)
+	acv, err := handler.create(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to create new Action Verification")
 	}
@@ -98,6 +96,7 @@ func (handler *ActionVerificationHandler) Create(c echo.Context) error {
 // @Param ActionVerification body models.ActionVerification true "ActionVerification Update Body"
 // @Success 200 {object} handler.actionVerificationGetResponse
 // @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/actions-verification/{acveID} [put]
@@ -113,7 +112,7 @@ func (handler *ActionVerificationHandler) Update(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	acv, err := handler.update(&req)
+	acv, err := handler.update(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to update Action Verification")
 	}
@@ -137,6 +136,7 @@ func (handler *ActionVerificationHandler) Update(c echo.Context) error {
 // @Param acveID path string true "Delete ActionVerification" Format(string)
 // @Success 200 {object} handler.actionVerificationDeleteResponse
 // @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/actions-verification/{acveID} [del]
@@ -145,7 +145,7 @@ func (handler *ActionVerificationHandler) Delete(c echo.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "Error uuid format")
 	}
-	acv, err := handler.delete(acveID)
+	acv, err := handler.delete(tenantID(c), acveID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete ActionVerification")
 	}
@@ -169,6 +169,7 @@ func (handler *ActionVerificationHandler) Delete(c echo.Context) error {
 // @Param acveID query string true "Filter ActionVerifications by type [acveID]"
 // @Success 200 {object} handler.actionVerificationGetResponse
 // @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/actions-verification/{acveID} [get]
@@ -178,7 +179,7 @@ func (handler *ActionVerificationHandler) Get(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	acv, err := handler.get(acveID)
+	acv, err := handler.get(tenantID(c), acveID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of ActionVerifications")
 	}
@@ -202,11 +203,11 @@ func (handler *ActionVerificationHandler) Get(c echo.Context) error {
 // @Param acveID query string false "Filter ActionVerifications by type [acveID]"
 // @Param userID query string false "Filter ActionVerifications by type [userID]"
 // @Param type query string false "Filter ActionVerifications by type [type]"
-// @Param verification query string false "Filter ActionVerifications by type [verification]"
 // @Param createdAt[gte] query string false "Filter ActionVerifications by type [createdAt[gte]]"
 // @Param createdAt[lte] query string false "Filter ActionVerifications by type [createdAt[lte]]"
 // @Success 200 {object} handler.actionsVerificationListResponse
 // @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/actions-verification [get]
@@ -216,7 +217,7 @@ func (handler *ActionVerificationHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	acv, err := handler.list(f)
+	acv, err := handler.list(tenantID(c), f)
 	if err != nil {
 		return errors.Wrap(err, "Fail list of Actions Verification")
 	}
@@ -250,10 +251,6 @@ func buildFilterActionVerification(QueryParam func(string) string) (m.FilterActi
 	if len(types) > 0 {
 		f.Type = &types
 	}
-	verification := QueryParam("verification")
-	if len(verification) > 0 {
-		f.Verification = &verification
-	}
 	df := QueryParam("createdAt[gte]")
 	if len(df) > 0 {
 		dateFrom, err := time.Parse("2006-01-02", df)
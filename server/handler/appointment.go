@@ -10,17 +10,18 @@ import (
 	"github.com/pkg/errors"
 
 	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 )
 
 // AppointmentHandler service to create handler
 type AppointmentHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	create       func(*m.Appointment, *uuid.UUID) (*m.Appointment, error)
-	update       func(*m.Appointment, *uuid.UUID) (*m.Appointment, error)
-	delete       func(appoID uuid.UUID) (*m.Appointment, error)
-	list         func(doctID *uuid.UUID, f m.FilterAppointment) ([]m.Appointment, error)
-	get          func(doctID *uuid.UUID, appoID uuid.UUID) (*m.Appointment, error)
+	create       func(uuid.UUID, *m.Appointment, *uuid.UUID) (*m.Appointment, error)
+	update       func(uuid.UUID, *m.Appointment, *uuid.UUID) (*m.Appointment, error)
+	delete       func(instID, appoID uuid.UUID) (*m.Appointment, error)
+	list         func(instID uuid.UUID, doctID *uuid.UUID, f m.FilterAppointment) ([]m.Appointment, error)
+	get          func(instID uuid.UUID, doctID *uuid.UUID, appoID uuid.UUID) (*m.Appointment, error)
 }
 
 type appointmentResponse struct {
@@ -74,11 +75,11 @@ func (handler *AppointmentHandler) Create(c echo.Context) error {
 		return err
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.AppointmentWriteAny)
 	if err != nil {
 		return err
 	}
-	app, err := handler.create(&req, doctID)
+	app, err := handler.create(tenantID(c), &req, doctID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to create new Appointment")
 	}
@@ -113,7 +114,7 @@ func (handler *AppointmentHandler) Update(c echo.Context) error {
 		return err
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.AppointmentWriteAny)
 	if err != nil {
 		return err
 	}
@@ -123,7 +124,7 @@ func (handler *AppointmentHandler) Update(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	app, err := handler.update(&req, doctID)
+	app, err := handler.update(tenantID(c), &req, doctID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to update Appointment")
 	}
@@ -156,7 +157,7 @@ func (handler *AppointmentHandler) Delete(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	app, err := handler.delete(appoID)
+	app, err := handler.delete(tenantID(c), appoID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete Appointment")
 	}
@@ -189,12 +190,12 @@ func (handler *AppointmentHandler) Get(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.AppointmentReadAny)
 	if err != nil {
 		return err
 	}
 
-	app, err := handler.get(doctID, appoID)
+	app, err := handler.get(tenantID(c), doctID, appoID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Appointments")
 	}
@@ -235,12 +236,12 @@ func (handler *AppointmentHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.AppointmentReadAny)
 	if err != nil {
 		return err
 	}
 
-	app, err := handler.list(doctID, f)
+	app, err := handler.list(tenantID(c), doctID, f)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Appointments")
 	}
@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+
+	um "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// auditEntity tells how to find the row changed by the routes of a resource
+type auditEntity struct {
+	// Type recorded in the log
+	Type string
+	// Table and Key column to snapshot the row, empty if it can't be read by a single key
+	Table, Key string
+	// Param is the path param, and response item field, holding the entity id
+	Param string
+	// Shared tables aren't scoped to an institution
+	Shared bool
+}
+
+// auditEntities by the first path segment after /api
+var auditEntities = map[string]auditEntity{
+	"users":                {"user", "user", "user_id", "userID", false},
+	"invitations":          {"invitation", "user_invitation", "invi_id", "inviID", false},
+	"roles":                {"role", "role", "role_id", "roleID", true},
+	"institutions":         {"institution", "institution", "inst_id", "instID", true},
+	"device-keys":          {"device_key", "device_key", "deke_id", "dekeID", false},
+	"doctors":              {"doctor", "doctor", "doct_id", "doctID", false},
+	"schedules":            {"schedule", "schedule", "sche_id", "scheID", false},
+	"schedule-series":      {"schedule_series", "schedule_series", "sers_id", "sersID", false},
+	"rebalance-runs":       {"rebalance_run", "rebalance_run", "reru_id", "reruID", false},
+	"closures":             {"closure", "closure", "clos_id", "closID", false},
+	"appointments":         {"appointment", "appointment", "appo_id", "appoID", false},
+	"patients":             {"patient", "patient", "pati_id", "patiID", false},
+	"actions-verification": {"action_verification", "action_verification", "acve_id", "acveID", false},
+	"rooms":                {"room", "room", "room_id", "roomID", false},
+	"specialty":            {"specialty", "specialty", "spec_id", "specID", false},
+	"doctor-specialty":     {"doctor_specialty", "", "", "doctID", false},
+	"configs":              {"config", "config", "key", "key", false},
+}
+
+// auditReadOnly routes are POST but change nothing, they're recorded as reads
+// and only while impersonating
+var auditReadOnly = map[string]bool{
+	"/api/schedules/quote": true,
+}
+
+// AuditHandler service to read the audit log
+type AuditHandler struct {
+	list func(instID uuid.UUID, f um.FilterAudit) ([]um.AuditEntry, int64, error)
+}
+
+// List returns an echo handler
+// @Summary audit.List
+// @Description List the changes made through the API, newest first
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param actorID query string false "user that made the change" Format(uuid)
+// @Param impersonated query bool false "only the requests made, or not made, while impersonating"
+// @Param action query string false "create, update, delete or read"
+// @Param entityType query string false "entity type, e.g. schedule"
+// @Param entityID query string false "entity id"
+// @Param createdAt[gte] query string false "date from" Format(date)
+// @Param createdAt[lte] query string false "date to" Format(date)
+// @Param limit query int false "page size"
+// @Param offset query int false "entries to skip"
+// @Success 200 {object} handler.auditListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/audit [get]
+func (handler *AuditHandler) List(c echo.Context) error {
+	f, err := buildFilterAudit(c.QueryParam)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}})
+	}
+	es, total, err := handler.list(tenantID(c), f)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list audit entries")
+	}
+	data := auditEntriesResponse{
+		Kind:  "Audit list",
+		Items: es,
+		collectionItemData: collectionItemData{
+			CurrentItemCount: int64(len(es)),
+			TotalItems:       total,
+		},
+	}
+	if f.Limit != nil {
+		data.ItemsPerPage = *f.Limit
+	}
+	if f.Offset != nil {
+		data.StartIndex = *f.Offset
+	}
+	return c.JSON(http.StatusOK, auditListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: data,
+	})
+}
+
+func buildFilterAudit(QueryParam func(string) string) (um.FilterAudit, error) {
+	f := um.FilterAudit{}
+	impersonated := QueryParam("impersonated")
+	if len(impersonated) > 0 {
+		b, err := strconv.ParseBool(impersonated)
+		if err != nil {
+			return f, errors.Wrap(err, "Failed to parse impersonated")
+		}
+		f.Impersonated = &b
+	}
+	actorID := QueryParam("actorID")
+	if len(actorID) > 0 {
+		if _, err := uuid.FromString(actorID); err != nil {
+			return f, errors.Wrap(err, "Failed to parse actorID")
+		}
+		f.ActorID = &actorID
+	}
+	action := QueryParam("action")
+	if len(action) > 0 {
+		f.Action = &action
+	}
+	entityType := QueryParam("entityType")
+	if len(entityType) > 0 {
+		f.EntityType = &entityType
+	}
+	entityID := QueryParam("entityID")
+	if len(entityID) > 0 {
+		f.EntityID = &entityID
+	}
+	df := QueryParam("createdAt[gte]")
+	if len(df) > 0 {
+		dateFrom, err := time.Parse("2006-01-02", df)
+		if err != nil {
+			return f, errors.Wrap(err, "Failed to parse dateFrom")
+		}
+		f.InitialDate = &dateFrom
+	}
+	dt := QueryParam("createdAt[lte]")
+	if len(dt) > 0 {
+		dateTo, err := time.Parse("2006-01-02", dt)
+		if err != nil {
+			return f, errors.Wrap(err, "Failed to parse dateTo")
+		}
+		dateTo = dateTo.Add(24*time.Hour - time.Nanosecond)
+		f.FinishDate = &dateTo
+	}
+	l := QueryParam("limit")
+	if len(l) > 0 {
+		limit, err := strconv.ParseInt(l, 10, 64)
+		if err != nil {
+			return f, errors.Wrap(err, "Failed to parse limit: "+l)
+		}
+		f.Limit = &limit
+	}
+	s := QueryParam("offset")
+	if len(s) > 0 {
+		offset, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return f, errors.Wrap(err, "Failed to parse offset: "+s)
+		}
+		f.Offset = &offset
+	}
+	return f, nil
+}
+
+// auditMiddleware records every successful POST, PUT and DELETE of the group,
+// and every request made while impersonating. Failing to record is logged and
+// doesn't fail the request
+func auditMiddleware(
+	record func(e *um.AuditEntry) error,
+	snapshot func(instID *uuid.UUID, table, key, id string) (types.JSONText, error),
+	claimsCtxKey string,
+	logger *log.Logger,
+) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			method := c.Request().Method
+			claims, _ := auth.Extract(c.Get(claimsCtxKey))
+			impersonating := claims != nil && len(claims.Actor) > 0
+			mutation := (method == echo.POST || method == echo.PUT || method == echo.DELETE) && !auditReadOnly[c.Path()]
+			if !mutation && !impersonating {
+				return next(c)
+			}
+			seg := strings.SplitN(strings.TrimPrefix(c.Path(), "/api/"), "/", 2)[0]
+			ent, ok := auditEntities[seg]
+			if !ok {
+				ent = auditEntity{Type: seg}
+			}
+			id := ""
+			if len(ent.Param) > 0 {
+				id = c.Param(ent.Param)
+			}
+			e := &um.AuditEntry{
+				InstID:     tenantID(c),
+				Action:     "read",
+				Method:     method,
+				Route:      c.Path(),
+				EntityType: ent.Type,
+				IP:         c.RealIP(),
+			}
+			if mutation {
+				e.Action = auditAction(method, id)
+			}
+			var scope *uuid.UUID
+			if !ent.Shared {
+				scope = &e.InstID
+			}
+			snap := mutation && len(ent.Table) > 0
+			if snap && len(id) > 0 {
+				var err error
+				e.Before, err = snapshot(scope, ent.Table, ent.Key, id)
+				if err != nil {
+					logger.Println("Failed to read audit before state:", err)
+				}
+			}
+
+			res := c.Response()
+			w := &teeWriter{ResponseWriter: res.Writer}
+			res.Writer = w
+			err := next(c)
+			res.Writer = w.ResponseWriter
+			if err != nil || res.Status >= http.StatusBadRequest {
+				return err
+			}
+
+			if len(id) == 0 && len(ent.Param) > 0 && method == echo.POST && mutation {
+				id = createdID(w.body.Bytes(), ent.Param)
+			}
+			if len(id) > 0 {
+				e.EntityID = null.StringFrom(id)
+				if snap {
+					e.After, err = snapshot(scope, ent.Table, ent.Key, id)
+					if err != nil {
+						logger.Println("Failed to read audit after state:", err)
+					}
+				}
+			}
+			if claims != nil {
+				// the admin impersonating is the actor of the request
+				actor := claims.UserID
+				if impersonating {
+					actor = claims.Actor
+					if userID, err := uuid.FromString(claims.UserID); err == nil {
+						e.ImpersonatedUserID = &userID
+					}
+				}
+				if actorID, err := uuid.FromString(actor); err == nil {
+					e.ActorID = &actorID
+				}
+			}
+			if err := record(e); err != nil {
+				logger.Println("Failed to record audit entry:", err)
+			}
+			return nil
+		}
+	}
+}
+
+// auditAction names the change made by a request
+func auditAction(method, id string) string {
+	switch {
+	case method == echo.GET:
+		return "read"
+	case method == echo.DELETE:
+		return "delete"
+	case method == echo.POST && len(id) == 0:
+		return "create"
+	}
+	return "update"
+}
+
+// createdID reads the id of the created entity from the response item
+func createdID(body []byte, param string) string {
+	res := struct {
+		Data struct {
+			Item map[string]interface{} `json:"item"`
+		} `json:"data"`
+	}{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&res); err != nil {
+		return ""
+	}
+	v, ok := res.Data.Item[param]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// teeWriter keeps a copy of the response body
+type teeWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+type auditEntriesResponse struct {
+	collectionItemData
+	Items []um.AuditEntry `json:"items"`
+	Kind  string          `json:"kind"`
+}
+
+type auditListResponse struct {
+	dataResponse
+	Data auditEntriesResponse `json:"data"`
+}
@@ -9,13 +9,14 @@ import (
 	"github.com/labstack/echo"
 
 	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 )
 
 // AvaliabilityHandler service to create handler
 type AvaliabilityHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	check        func(m.FilterAvaliability) ([]m.Avaliability, error)
+	check        func(uuid.UUID, m.FilterAvaliability) ([]m.Avaliability, error)
 }
 
 type avaliabilityResponse struct {
@@ -48,7 +49,7 @@ func (handler *AvaliabilityHandler) Check(c echo.Context) error {
 		return err
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleReadAny)
 	if err != nil {
 		return err
 	}
@@ -56,7 +57,7 @@ func (handler *AvaliabilityHandler) Check(c echo.Context) error {
 		f.DoctID = doctID
 	}
 
-	ava, err := handler.check(f)
+	ava, err := handler.check(tenantID(c), f)
 	if err != nil {
 		return err
 	}
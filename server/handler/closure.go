@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// ClosureHandler service to create handler
+type ClosureHandler struct {
+	claimsCtxKey string
+	create       func(instID uuid.UUID, actorID *uuid.UUID, req m.ClosureRequest) (*m.ClosureReport, error)
+	list         func(uuid.UUID, m.FilterClosure) ([]m.Closure, error)
+	get          func(instID, closID uuid.UUID) (*m.Closure, error)
+	delete       func(instID, closID uuid.UUID) (*m.Closure, error)
+}
+
+type closureReportResponse struct {
+	Item *m.ClosureReport `json:"item"`
+	Kind string           `json:"kind"`
+}
+
+type closureCreateResponse struct {
+	dataResponse
+	Data closureReportResponse `json:"data"`
+}
+
+type closureResponse struct {
+	Item *m.Closure `json:"item"`
+	Kind string     `json:"kind"`
+}
+
+type closureGetResponse struct {
+	dataResponse
+	Data closureResponse `json:"data"`
+}
+
+type closuresResponse struct {
+	collectionItemData
+	Items []m.Closure `json:"items"`
+	Kind  string      `json:"kind"`
+}
+
+type closuresListResponse struct {
+	dataResponse
+	Data closuresResponse `json:"data"`
+}
+
+// Create Closure returns an echo handler
+// @Summary Closure.Create
+// @Description Close the clinic, or a room, for whole days or between two times. Returns the upcoming Schedules it affects, cancelled and their doctors notified when asked
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param Closure body models.ClosureRequest true "Create new Closure"
+// @Success 200 {object} handler.closureCreateResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/closures [post]
+func (handler *ClosureHandler) Create(c echo.Context) error {
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	req := m.ClosureRequest{}
+	err = c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	report, err := handler.create(tenantID(c), &actorID, req)
+	if err != nil {
+		return handler.errorResponse(c, err, "Fail to create new Closure")
+	}
+	return c.JSON(http.StatusOK, closureCreateResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: closureReportResponse{
+			Kind: "Closure created",
+			Item: report,
+		},
+	})
+}
+
+// List Closure returns an echo handler
+// @Summary Closure.List
+// @Description List the Closures, the yearly ones are always listed
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roomID query string false "only the closures of a room"
+// @Param from query string false "closures ending after, like 2006-01-02"
+// @Param to query string false "closures starting before, like 2006-01-02"
+// @Param limit query int false "page size"
+// @Param offset query int false "items to skip"
+// @Success 200 {object} handler.closuresListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/closures [get]
+func (handler *ClosureHandler) List(c echo.Context) error {
+	f := m.FilterClosure{}
+	if roomID := c.QueryParam("roomID"); len(roomID) > 0 {
+		f.RoomID = &roomID
+	}
+	if from := c.QueryParam("from"); len(from) > 0 {
+		d, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse from")
+		}
+		f.From = &d
+	}
+	if to := c.QueryParam("to"); len(to) > 0 {
+		d, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse to")
+		}
+		f.To = &d
+	}
+	if limit := c.QueryParam("limit"); len(limit) > 0 {
+		l, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse limit")
+		}
+		f.Limit = &l
+	}
+	if offset := c.QueryParam("offset"); len(offset) > 0 {
+		o, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse offset")
+		}
+		f.Offset = &o
+	}
+
+	clos, err := handler.list(tenantID(c), f)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list Closures")
+	}
+	return c.JSON(http.StatusOK, closuresListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: closuresResponse{
+			Kind:  "Closure list",
+			Items: clos,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(clos)),
+				TotalItems:       int64(len(clos)),
+			},
+		},
+	})
+}
+
+// Get Closure returns an echo handler
+// @Summary Closure.Get
+// @Description Get a Closure
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param closID path string true "Closure ID" Format(uuid)
+// @Success 200 {object} handler.closureGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/closures/{closID} [get]
+func (handler *ClosureHandler) Get(c echo.Context) error {
+	closID, err := uuid.FromString(c.Param("closID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	clo, err := handler.get(tenantID(c), closID)
+	if err != nil {
+		return handler.errorResponse(c, err, "Fail to get Closure")
+	}
+	return c.JSON(http.StatusOK, closureGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: closureResponse{
+			Kind: "Closure get",
+			Item: clo,
+		},
+	})
+}
+
+// Delete Closure returns an echo handler
+// @Summary Closure.Delete
+// @Description Delete a Closure, the Schedules it cancelled stay cancelled
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param closID path string true "Closure ID" Format(uuid)
+// @Success 200 {object} handler.closureGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/closures/{closID} [delete]
+func (handler *ClosureHandler) Delete(c echo.Context) error {
+	closID, err := uuid.FromString(c.Param("closID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	clo, err := handler.delete(tenantID(c), closID)
+	if err != nil {
+		return handler.errorResponse(c, err, "Fail to delete Closure")
+	}
+	return c.JSON(http.StatusOK, closureGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: closureResponse{
+			Kind: "Closure deleted",
+			Item: clo,
+		},
+	})
+}
+
+func (handler *ClosureHandler) errorResponse(c echo.Context, err error, msg string) error {
+	if schedule.InvalidClosure(err) {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Errors: []detailError{{
+				Domain:  "closure",
+				Reason:  "invalid",
+				Message: err.Error(),
+			}},
+		}})
+	}
+	return errors.Wrap(err, msg)
+}
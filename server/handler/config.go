@@ -4,23 +4,20 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/gofrs/uuid"
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
-	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
-	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 
 	m "gitlab.com/falqon/inovantapp/backend/models"
 )
 
 // ConfigHandler service to create handler
 type ConfigHandler struct {
-	rolesCtxKey  string
-	claimsCtxKey string
-	create       func(*m.Config) (*m.Config, error)
-	update       func(*m.Config) (*m.Config, error)
-	delete       func(key string) (*m.Config, error)
-	list         func(m.FilterConfig) ([]m.Config, error)
-	get          func(key string) (*m.Config, error)
+	create func(uuid.UUID, *m.Config) (*m.Config, error)
+	update func(uuid.UUID, *m.Config) (*m.Config, error)
+	delete func(instID uuid.UUID, key string) (*m.Config, error)
+	list   func(uuid.UUID, m.FilterConfig) ([]m.Config, error)
+	get    func(instID uuid.UUID, key string) (*m.Config, error)
 }
 
 type configResponse struct {
@@ -70,24 +67,11 @@ type configsListResponse struct {
 func (handler *ConfigHandler) Create(c echo.Context) error {
 	req := m.Config{}
 
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	if !p.Can(perm.Admin) && !p.Can(perm.Secretary) {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
-
-	err = c.Bind(&req)
+	err := c.Bind(&req)
 	if err != nil {
 		return err
 	}
-	con, err := handler.create(&req)
+	con, err := handler.create(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to create new Config")
 	}
@@ -118,25 +102,12 @@ func (handler *ConfigHandler) Create(c echo.Context) error {
 func (handler *ConfigHandler) Update(c echo.Context) error {
 	req := m.Config{}
 
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	if !p.Can(perm.Admin) && !p.Can(perm.Secretary) {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
-
-	err = c.Bind(&req)
+	err := c.Bind(&req)
 	if err != nil {
 		return err
 	}
 	req.Key = c.Param("key")
-	con, err := handler.update(&req)
+	con, err := handler.update(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to update Config")
 	}
@@ -165,7 +136,7 @@ func (handler *ConfigHandler) Update(c echo.Context) error {
 // @Router /api/configs/{key} [del]
 func (handler *ConfigHandler) Delete(c echo.Context) error {
 	key := c.Param("key")
-	con, err := handler.delete(key)
+	con, err := handler.delete(tenantID(c), key)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete Config")
 	}
@@ -194,7 +165,7 @@ func (handler *ConfigHandler) Delete(c echo.Context) error {
 // @Router /api/configs/{key} [get]
 func (handler *ConfigHandler) Get(c echo.Context) error {
 	key := c.Param("key")
-	con, err := handler.get(key)
+	con, err := handler.get(tenantID(c), key)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Configs")
 	}
@@ -227,7 +198,7 @@ func (handler *ConfigHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	con, err := handler.list(f)
+	con, err := handler.list(tenantID(c), f)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Configs")
 	}
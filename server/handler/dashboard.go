@@ -4,17 +4,19 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/jinzhu/now"
 	"github.com/labstack/echo"
 
 	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 )
 
 // DashboardHandler service to create handler
 type DashboardHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	view         func(m.FilterDashboard) ([]m.Dashboard, error)
+	view         func(uuid.UUID, m.FilterDashboard) ([]m.Dashboard, error)
 }
 
 type dashboardResponse struct {
@@ -47,13 +49,13 @@ func (handler *DashboardHandler) View(c echo.Context) error {
 		return err
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.DashboardReadAny)
 	if err != nil {
 		return err
 	}
 	f.DoctID = *doctID
 
-	das, err := handler.view(f)
+	das, err := handler.view(tenantID(c), f)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	um "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// DeviceKeyHandler service to manage the API keys of room displays
+type DeviceKeyHandler struct {
+	claimsCtxKey string
+	create       func(instID uuid.UUID, k *um.DeviceKey, actorID uuid.UUID) (*um.DeviceKeySecret, error)
+	rotate       func(instID, dekeID uuid.UUID) (*um.DeviceKeySecret, error)
+	revoke       func(instID, dekeID uuid.UUID) (*um.DeviceKey, error)
+	list         func(instID uuid.UUID) ([]um.DeviceKey, error)
+}
+
+// Create returns an echo handler
+// @Summary deviceKeys.Create
+// @Description Create a key for a display, it can only read the outdoor data of its rooms. The key is only returned once
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param deviceKey body handler.deviceKeyForm true "Device key data"
+// @Success 200 {object} handler.deviceKeySecretResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/device-keys [post]
+func (handler *DeviceKeyHandler) Create(c echo.Context) error {
+	req := deviceKeyForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return errors.Wrap(err, "Wrong device key parameters")
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	k, err := handler.create(tenantID(c), &um.DeviceKey{
+		Name:    req.Name,
+		RoomIDs: req.RoomIDs,
+	}, uuid.FromStringOrNil(claims.UserID))
+	if err != nil {
+		if e, ok := deviceKeyError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to create device key")
+	}
+	return c.JSON(http.StatusOK, deviceKeySecretResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: deviceKeySecretOut{
+			Kind: "Device key created",
+			Item: k,
+		},
+	})
+}
+
+// Rotate returns an echo handler
+// @Summary deviceKeys.Rotate
+// @Description Replace the key of a display, the old key stops working
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param dekeID path string true "device key id" Format(uuid)
+// @Success 200 {object} handler.deviceKeySecretResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/device-keys/{dekeID}/rotate [post]
+func (handler *DeviceKeyHandler) Rotate(c echo.Context) error {
+	dekeID, err := uuid.FromString(c.Param("dekeID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	k, err := handler.rotate(tenantID(c), dekeID)
+	if err != nil {
+		if e, ok := deviceKeyError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to rotate device key")
+	}
+	return c.JSON(http.StatusOK, deviceKeySecretResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: deviceKeySecretOut{
+			Kind: "Device key rotated",
+			Item: k,
+		},
+	})
+}
+
+// Revoke returns an echo handler
+// @Summary deviceKeys.Revoke
+// @Description Disable the key of a display
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param dekeID path string true "device key id" Format(uuid)
+// @Success 200 {object} handler.deviceKeyGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/device-keys/{dekeID} [delete]
+func (handler *DeviceKeyHandler) Revoke(c echo.Context) error {
+	dekeID, err := uuid.FromString(c.Param("dekeID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	k, err := handler.revoke(tenantID(c), dekeID)
+	if err != nil {
+		if e, ok := deviceKeyError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to revoke device key")
+	}
+	return c.JSON(http.StatusOK, deviceKeyGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: deviceKeyResponse{
+			Kind: "Device key revoked",
+			Item: k,
+		},
+	})
+}
+
+// List returns an echo handler
+// @Summary deviceKeys.List
+// @Description List the device keys and when they were last used
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Success 200 {object} handler.deviceKeyListResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/device-keys [get]
+func (handler *DeviceKeyHandler) List(c echo.Context) error {
+	ks, err := handler.list(tenantID(c))
+	if err != nil {
+		return errors.Wrap(err, "Fail to list device keys")
+	}
+	return c.JSON(http.StatusOK, deviceKeyListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: deviceKeysResponse{
+			Kind:  "Device key list",
+			Items: ks,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(ks)),
+				TotalItems:       int64(len(ks)),
+			},
+		},
+	})
+}
+
+// deviceKeyError maps validation errors to a bad request and unknown keys to not found
+func deviceKeyError(err error) (generalError, bool) {
+	switch e := errors.Cause(err).(type) {
+	case *auth.DeviceKeyInvalidError:
+		return generalError{
+			Code:    http.StatusNotFound,
+			Message: e.Error(),
+			Errors: []detailError{{
+				Domain:  "deviceKey",
+				Reason:  "invalidDeviceKey",
+				Message: e.Error(),
+			}},
+		}, true
+	case *auth.ValidationError:
+		ge := generalError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid device key",
+		}
+		for k, v := range e.Messages {
+			ge.Errors = append(ge.Errors, detailError{
+				Domain:  "deviceKey",
+				Reason:  k,
+				Message: v,
+			})
+		}
+		return ge, true
+	}
+	return generalError{}, false
+}
+
+// deviceKeyDenied answers requests with a missing, invalid or out of scope device key
+func deviceKeyDenied(c echo.Context, err error) error {
+	if err != nil {
+		if _, ok := errors.Cause(err).(*auth.DeviceKeyInvalidError); !ok {
+			return err
+		}
+	}
+	return unauthorized(c)
+}
+
+type deviceKeyForm struct {
+	Name    string         `json:"name" example:"Room 1 display"`
+	RoomIDs pq.StringArray `json:"roomIDs"`
+}
+
+type deviceKeyResponse struct {
+	singleItemData
+	Item *um.DeviceKey `json:"item"`
+	Kind string        `json:"kind"`
+}
+
+type deviceKeyGetResponse struct {
+	dataResponse
+	Data deviceKeyResponse `json:"data"`
+}
+
+type deviceKeySecretOut struct {
+	singleItemData
+	Item *um.DeviceKeySecret `json:"item"`
+	Kind string              `json:"kind"`
+}
+
+type deviceKeySecretResponse struct {
+	dataResponse
+	Data deviceKeySecretOut `json:"data"`
+}
+
+type deviceKeysResponse struct {
+	collectionItemData
+	Items []um.DeviceKey `json:"items"`
+	Kind  string         `json:"kind"`
+}
+
+type deviceKeyListResponse struct {
+	dataResponse
+	Data deviceKeysResponse `json:"data"`
+}
@@ -10,7 +10,6 @@ import (
 
 	m "gitlab.com/falqon/inovantapp/backend/models"
 
-	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 )
 
@@ -18,11 +17,11 @@ import (
 type DoctorHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	create       func(*m.Doctor) (*m.Doctor, error)
-	update       func(*m.Doctor) (*m.Doctor, error)
-	delete       func(doctID uuid.UUID) (*m.Doctor, error)
-	list         func(doctID *uuid.UUID, f m.FilterDoctor) ([]m.Doctor, error)
-	get          func(doctID uuid.UUID) (*m.Doctor, error)
+	create       func(uuid.UUID, *m.Doctor) (*m.Doctor, error)
+	update       func(uuid.UUID, *m.Doctor) (*m.Doctor, error)
+	delete       func(instID, doctID uuid.UUID) (*m.Doctor, error)
+	list         func(instID uuid.UUID, doctID *uuid.UUID, f m.FilterDoctor) ([]m.Doctor, error)
+	get          func(instID, doctID uuid.UUID) (*m.Doctor, error)
 }
 
 type doctorResponse struct {
@@ -79,23 +78,12 @@ func (handler *DoctorHandler) Create(c echo.Context) error {
 		return err
 	}
 
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	// User can create new user
-	if !p.Can(perm.Admin) && !p.Can(perm.Secretary) {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
-
 	req.Doctor.Password = []byte(req.Password)
-	doc, err := handler.create(&req.Doctor)
+	doc, err := handler.create(tenantID(c), &req.Doctor)
 	if err != nil {
+		if e, ok := passwordError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
 		return errors.Wrap(err, "Fail to create new Doctor")
 	}
 	return c.JSON(http.StatusOK, doctorGetResponse{
@@ -129,33 +117,12 @@ func (handler *DoctorHandler) Update(c echo.Context) error {
 		return errors.Wrap(err, "parse body")
 	}
 
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse token")
-	}
-	claimsDoctID := uuid.FromStringOrNil(claims.DoctID)
-
-	if !p.Can(perm.Admin) && !p.Can(perm.Secretary) {
-		if claimsDoctID != req.DoctID {
-			return c.JSON(http.StatusUnauthorized, errorResponse{
-				Error: generalError{
-					Code:    http.StatusUnauthorized,
-					Message: "Unauthorized",
-				},
-			})
-		}
-	}
-
 	req.DoctID, err = uuid.FromString(c.Param("doctID"))
 	if err != nil {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.DoctorWriteAny)
 	if err != nil {
 		return err
 	}
@@ -164,7 +131,7 @@ func (handler *DoctorHandler) Update(c echo.Context) error {
 		req.DoctID = *doctID
 	}
 
-	doc, err := handler.update(&req)
+	doc, err := handler.update(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to update Doctor")
 	}
@@ -197,21 +164,7 @@ func (handler *DoctorHandler) Delete(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	// User can create new user
-	if !p.Can(perm.Admin) && !p.Can(perm.Secretary) {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
-
-	doc, err := handler.delete(doctID)
+	doc, err := handler.delete(tenantID(c), doctID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete Doctor")
 	}
@@ -244,7 +197,7 @@ func (handler *DoctorHandler) Get(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	claimsdoctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	claimsdoctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.DoctorReadAny)
 	if err != nil {
 		return err
 	}
@@ -252,7 +205,7 @@ func (handler *DoctorHandler) Get(c echo.Context) error {
 		doctID = *claimsdoctID
 	}
 
-	doc, err := handler.get(doctID)
+	doc, err := handler.get(tenantID(c), doctID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Doctors")
 	}
@@ -287,12 +240,12 @@ func (handler *DoctorHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.DoctorReadAny)
 	if err != nil {
 		return err
 	}
 
-	doc, err := handler.list(doctID, f)
+	doc, err := handler.list(tenantID(c), doctID, f)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Doctor")
 	}
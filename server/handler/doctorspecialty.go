@@ -15,11 +15,11 @@ import (
 type DoctorSpecialtyHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	create       func(*m.DoctorSpecialty) (*m.DoctorSpecialty, error)
-	update       func(*m.DoctorSpecialty) (*m.DoctorSpecialty, error)
-	delete       func(doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error)
-	list         func(m.FilterDoctorSpecialty) ([]m.DoctorSpecialty, error)
-	get          func(doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error)
+	create       func(uuid.UUID, *m.DoctorSpecialty) (*m.DoctorSpecialty, error)
+	update       func(uuid.UUID, *m.DoctorSpecialty) (*m.DoctorSpecialty, error)
+	delete       func(instID, doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error)
+	list         func(uuid.UUID, m.FilterDoctorSpecialty) ([]m.DoctorSpecialty, error)
+	get          func(instID, doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error)
 }
 
 type doctorSpecialtyResponse struct {
@@ -72,7 +72,7 @@ func (handler *DoctorSpecialtyHandler) Create(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	spe, err := handler.create(&req)
+	spe, err := handler.create(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to create new DoctorSpecialty")
 	}
@@ -112,7 +112,7 @@ func (handler *DoctorSpecialtyHandler) Update(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	spe, err := handler.update(&req)
+	spe, err := handler.update(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to update DoctorSpecialty")
 	}
@@ -148,7 +148,7 @@ func (handler *DoctorSpecialtyHandler) Delete(c echo.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "Error int64 format")
 	}
-	spe, err := handler.delete(doctID, specID)
+	spe, err := handler.delete(tenantID(c), doctID, specID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete DoctorSpecialty")
 	}
@@ -185,7 +185,7 @@ func (handler *DoctorSpecialtyHandler) Get(c echo.Context) error {
 		return errors.Wrap(err, "Error int64 format")
 	}
 
-	spe, err := handler.get(doctID, specID)
+	spe, err := handler.get(tenantID(c), doctID, specID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Specialty")
 	}
@@ -219,7 +219,7 @@ func (handler *DoctorSpecialtyHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	spe, err := handler.list(f)
+	spe, err := handler.list(tenantID(c), f)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of DoctorSpecialty")
 	}
@@ -1,14 +1,16 @@
 package handler
 
 import (
+	"crypto/subtle"
 	"log"
 	"net/http"
 	"os"
 
-	"github.com/gofrs/uuid"
+	"github.com/dgrijalva/jwt-go"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo"
 	"github.com/pindamonhangaba/hermes"
+	"github.com/pkg/errors"
 	"github.com/sendgrid/sendgrid-go"
 
 	"gitlab.com/falqon/inovantapp/backend/service"
@@ -17,14 +19,18 @@ import (
 	"gitlab.com/falqon/inovantapp/backend/service/messaging"
 	"gitlab.com/falqon/inovantapp/backend/service/user"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/keycache"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth/rolecache"
 
 	"gitlab.com/falqon/inovantapp/backend/service/actionverification"
 	"gitlab.com/falqon/inovantapp/backend/service/appointment"
+	"gitlab.com/falqon/inovantapp/backend/service/audit"
 	"gitlab.com/falqon/inovantapp/backend/service/avaliability"
 	"gitlab.com/falqon/inovantapp/backend/service/config"
 	"gitlab.com/falqon/inovantapp/backend/service/dashboard"
 	"gitlab.com/falqon/inovantapp/backend/service/doctorspecialty"
+	"gitlab.com/falqon/inovantapp/backend/service/institution"
 	"gitlab.com/falqon/inovantapp/backend/service/patient"
 	"gitlab.com/falqon/inovantapp/backend/service/room"
 	"gitlab.com/falqon/inovantapp/backend/service/schedule"
@@ -33,6 +39,8 @@ import (
 	mw "github.com/labstack/echo/middleware"
 	echoSwagger "github.com/pindamonhangaba/echo-swagger"
 	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/server/middleware/ratelimit"
+	"gitlab.com/falqon/inovantapp/backend/server/middleware/tokenauth"
 	appconf "gitlab.com/falqon/inovantapp/backend/service/appconf"
 	fileman "gitlab.com/falqon/inovantapp/backend/service/filemanager"
 	amw "gitlab.com/falqon/inovantapp/backend/service/user/auth/rolecache/mw"
@@ -59,6 +67,8 @@ type detailError struct {
 	LocationType *string `json:"locationType,omitempty"`
 	ExtendedHelp *string `json:"extendedHelp,omitempty"`
 	SendReport   *string `json:"sendReport,omitempty"`
+	// Values that caused the error, by name
+	Values map[string]interface{} `json:"values,omitempty"`
 }
 
 type dataResponse struct {
@@ -135,7 +145,6 @@ func handleHome(c echo.Context) (err error) {
 
 // JWTConfig holds configuration for JWT context
 type JWTConfig struct {
-	Secret,
 	ClaimsCtxKey,
 	RolesCtxKey string
 }
@@ -157,25 +166,17 @@ type HTTPServer struct {
 	JWTConfig  JWTConfig
 	ServerConf ServerConf
 	Mailer     *mailer.Mailer
+	// Limits counts the requests to the public auth routes, in memory when nil
+	Limits ratelimit.Store
+	// Keys caches the key secret of each user the tokens are signed with
+	Keys *keycache.KeyCache
 }
 
 // Run create a new echo server
 func (h *HTTPServer) Run() {
-	// configure rolecache
-	h.Roles.GetUserRoles = func(userID string) ([]string, error) {
-		roles := []string{}
-		UID, err := uuid.FromString(userID)
-		if err != nil {
-			return roles, err
-		}
-		g := user.Getter{DB: h.DB}
-
-		usr, err := g.Run(UID)
-		if err != nil {
-			return roles, err
-		}
-		return usr.Roles, nil
-	}
+	// configure rolecache, it holds the roles and granted permissions of each user
+	pr := &user.PermissionResolver{DB: h.DB}
+	h.Roles.GetUserRoles = pr.Run
 
 	// Echo instance
 	e := echo.New()
@@ -195,27 +196,102 @@ func (h *HTTPServer) Run() {
 	e.GET("/", handleHome)
 
 	gAPI := e.Group("/api")
-	jwtConfig := mw.JWTConfig{
-		Claims:     &auth.Claims{},
-		SigningKey: []byte(h.JWTConfig.Secret),
-		ContextKey: h.JWTConfig.ClaimsCtxKey,
+	if h.Keys == nil {
+		ukg := &user.UserKeyGetter{DB: h.DB}
+		h.Keys = keycache.New(ukg.Run)
 	}
-	gAPI.Use(mw.JWTWithConfig(jwtConfig))
-	gAPI.Use(amw.EchoMiddleware(h.Roles, amw.JWTConfig{
+	gAPI.Use(tokenauth.JWT(
+		func() jwt.Claims { return &auth.Claims{} },
+		userKeyFunc(h.Auth.JWTConfig, h.Keys),
+		h.JWTConfig.ClaimsCtxKey,
+	))
+	sc := &user.SessionChecker{DB: h.DB}
+	gAPI.Use(sessionMiddleware(sc.Run, h.JWTConfig.ClaimsCtxKey))
+	gAPI.Use(tenantMiddleware(h.JWTConfig.ClaimsCtxKey))
+	gAPI.Use(passwordChangeMiddleware(h.JWTConfig.ClaimsCtxKey,
+		"/api/me/password", "/api/sessions", "/api/sessions/:sessID", "/api/auth/logout-all"))
+	// the account of the impersonated user can't be changed, nor chat in its name
+	gAPI.Use(impersonationMiddleware(h.JWTConfig.ClaimsCtxKey,
+		"/api/me/password", "/api/me/2fa/enroll", "/api/me/2fa/activate", "/api/me/2fa/disable",
+		"/api/me/2fa/recovery-codes", "/api/sessions", "/api/sessions/:sessID", "/api/auth/logout-all",
+		"/api/users/:userID/impersonate", "/api/users/:userID/push-tokens", "/api/users/:userID/rotate-key",
+		"/api/connect"))
+	amwConfig := amw.JWTConfig{
 		RolesCtxKey: h.JWTConfig.RolesCtxKey,
 		TokenCtxKey: h.JWTConfig.ClaimsCtxKey,
-	}))
+	}
+	gAPI.Use(amw.EchoMiddleware(h.Roles, amwConfig))
+	ar := &audit.Recorder{DB: h.DB}
+	as := &audit.Snapshotter{DB: h.DB}
+	gAPI.Use(auditMiddleware(ar.Run, as.Run, h.JWTConfig.ClaimsCtxKey, log.New(os.Stderr, "audit: ", log.Lshortfile)))
+	guard := &amw.Guard{
+		Roles:  h.Roles,
+		Config: amwConfig,
+		Denied: unauthorized,
+	}
 
-	PublicRoutes(h.DB, e, h.Auth)
-	PrivateRoutes(h.DB, gAPI, h.JWTConfig)
+	if h.Limits == nil {
+		h.Limits = ratelimit.NewMemoryStore()
+	}
+	PublicRoutes(h.DB, e, h.Auth, h.Limits)
+	PrivateRoutes(h.DB, gAPI, h.JWTConfig, guard, h.Auth.JWTConfig)
 
 	e.Logger.Fatal(e.Start(h.ServerConf.Address))
 }
 
+// userKeyFunc returns the public key of the kid the token is signed with,
+// once the token is checked to carry the current key secret of the user
+func userKeyFunc(cfg user.JWTConfig, keys *keycache.KeyCache) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		claims, ok := t.Claims.(*auth.Claims)
+		if !ok {
+			return nil, errors.New("No claims in token")
+		}
+		key, err := keys.Get(claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare([]byte(claims.KeyFingerprint), []byte(auth.UserKeyFingerprint(key))) != 1 {
+			return nil, errors.New("User key rotated")
+		}
+		return cfg.Keys.Keyfunc(t)
+	}
+}
+
+// passwordPolicy is the policy every new password must follow
+func passwordPolicy() auth.PasswordPolicy {
+	return auth.PasswordPolicy{
+		MinLength:  appconf.Auth.PasswordMinLength,
+		MinClasses: appconf.Auth.PasswordMinClasses,
+	}
+}
+
+var limitLogger = log.New(os.Stderr, "ratelimit: ", log.Lshortfile)
+
+// authLimit throttles an auth route per ip and, when account is set, per
+// email or link the requests target
+func authLimit(limits ratelimit.Store, name string, account func(c echo.Context) string) echo.MiddlewareFunc {
+	rules := []ratelimit.Rule{{
+		Name:   name + ":ip",
+		Limit:  appconf.RateLimit.PerIP,
+		Window: appconf.RateLimit.Window,
+		Key:    ratelimit.ByIP,
+	}}
+	if account != nil {
+		rules = append(rules, ratelimit.Rule{
+			Name:   name + ":account",
+			Limit:  appconf.RateLimit.PerAccount,
+			Window: appconf.RateLimit.Window,
+			Key:    account,
+		})
+	}
+	return ratelimit.Middleware(limits, func(err error) { limitLogger.Println(err) }, rules...)
+}
+
 /*
  * public routes
  */
-func PublicRoutes(db *sqlx.DB, e *echo.Echo, ua *user.Authenticator) error {
+func PublicRoutes(db *sqlx.DB, e *echo.Echo, ua *user.Authenticator, limits ratelimit.Store) error {
 	mm := mailer.Mailer{
 		Mailer: sendgrid.NewSendClient(appconf.SMTP.Password),
 		Config: &mailer.Config{},
@@ -240,16 +316,64 @@ func PublicRoutes(db *sqlx.DB, e *echo.Echo, ua *user.Authenticator) error {
 	pr := user.PwdReseter{
 		DB:     db,
 		Mailer: &mm,
+		Policy: passwordPolicy(),
+	}
+
+	rf := user.Refresher{
+		DB:        db,
+		JWTConfig: ua.JWTConfig,
+	}
+	lo := user.Logouter{DB: db}
+	mv := user.MFAVerifier{
+		DB:        db,
+		JWTConfig: ua.JWTConfig,
+		Lockout:   ua.Lockout,
+	}
+	me := user.MFAEnroller{
+		DB:        db,
+		JWTConfig: ua.JWTConfig,
+		Issuer:    appconf.Auth.TOTPIssuer,
+	}
+	ma := user.MFAActivator{
+		DB:        db,
+		JWTConfig: ua.JWTConfig,
 	}
 
 	ah := &AuthHandler{
-		signin:     ua.Run,
-		pwdReset:   pr.Run,
-		pwdRecover: pv.Run,
+		signin:      ua.Run,
+		refresh:     rf.Run,
+		logout:      lo.Run,
+		mfaVerify:   mv.Run,
+		mfaEnroll:   me.Run,
+		mfaActivate: ma.Run,
+		pwdReset:    pr.Run,
+		pwdRecover:  pv.Run,
+		jwks:        ua.JWTConfig.Keys.JWKS,
 	}
-	e.POST("/auth/signin", ah.EmailLogin)
-	e.POST("/auth/password-recover", ah.PasswordRecover)
-	e.POST("/auth/password-reset/:resetID/:verification", ah.PasswordReset)
+	e.POST("/auth/signin", ah.EmailLogin, authLimit(limits, "signin", ratelimit.ByJSONField("email")))
+	e.POST("/auth/refresh", ah.Refresh)
+	e.POST("/auth/logout", ah.Logout)
+	e.POST("/auth/2fa/verify", ah.MFAVerify, authLimit(limits, "mfa", nil))
+	e.POST("/auth/2fa/enroll", ah.MFAEnroll)
+	e.POST("/auth/2fa/activate", ah.MFAActivate)
+	e.GET("/.well-known/jwks.json", ah.JWKS)
+
+	ia := &user.InvitationAccepter{DB: db, Policy: passwordPolicy()}
+	ih := &InvitationHandler{accept: ia.Run}
+	e.POST("/auth/invitation/:inviID/:secret", ih.Accept)
+	e.POST("/auth/password-recover", ah.PasswordRecover, authLimit(limits, "recover", ratelimit.ByJSONField("email")))
+	e.POST("/auth/password-reset/:resetID/:verification", ah.PasswordReset, authLimit(limits, "reset", ratelimit.ByParam("resetID")))
+
+	// Room displays read their outdoor data with a device key
+	dkc := &user.DeviceKeyChecker{DB: db}
+	dout := &schedule.Outdoor{DB: db}
+	dci := &schedule.RoomCheckIn{DB: db}
+	dco := &schedule.RoomCheckOut{DB: db}
+	dh := &ScheduleHandler{outdoor: dout.Run, roomCheckIn: dci.Run, roomCheckOut: dco.Run}
+	deviceKey := tokenauth.DeviceKey(dkc.Run, tenantCtxKey, deviceKeyDenied)
+	e.GET("/device/outdoor/:roomID", dh.Outdoor, deviceKey)
+	e.POST("/device/outdoor/:roomID/check-in", dh.RoomCheckIn, deviceKey)
+	e.POST("/device/outdoor/:roomID/check-out", dh.RoomCheckOut, deviceKey)
 
 	uf := &fileman.Uploader{AccessURL: appconf.App.AccessURL}
 	fh := &FileHandler{upload: uf.Run}
@@ -262,8 +386,9 @@ func PublicRoutes(db *sqlx.DB, e *echo.Echo, ua *user.Authenticator) error {
 /*
  * private routes
  */
-// PrivateRoutes create routes to private access
-func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
+// PrivateRoutes create routes to private access, each route declares the
+// permissions the guard requires
+func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig, guard *amw.Guard, tokenConfig user.JWTConfig) error {
 	mm := mailer.Mailer{
 		Mailer: sendgrid.NewSendClient(appconf.SMTP.Password),
 		Config: &mailer.Config{},
@@ -319,12 +444,17 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 
 	// User routes
 	uc := &user.Lister{DB: db}
-	u := &user.Creator{DB: db, Mailer: &mm, Config: servconf}
+	u := &user.Creator{DB: db, Mailer: &mm, Config: servconf, Policy: passwordPolicy()}
 	up := &user.Updater{DB: db}
 	ug := &user.Getter{DB: db}
 	ui := &user.Inactiver{DB: db}
 	uac := &user.Activer{DB: db}
 	upt := &user.PushTokenSetter{DB: db}
+	uul := &user.Unlocker{DB: db}
+	ulo := &user.LockoutLister{DB: db}
+	upc := &user.PasswordChanger{DB: db, JWTConfig: tokenConfig, Policy: passwordPolicy()}
+	upr := &user.PasswordChangeRequirer{DB: db}
+	urk := &user.UserKeyRotator{DB: db}
 	uh := &UserHandler{
 		create:       u.Run,
 		update:       up.Run,
@@ -333,19 +463,146 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		active:       uac.Run,
 		list:         uc.Run,
 		setPushToken: upt.Run,
+		unlock:       uul.Run,
+		listLockouts: ulo.Run,
 		rolesCtxKey:  JWTConfig.RolesCtxKey,
 		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+
+		changePassword:        upc.Run,
+		requirePasswordChange: upr.Run,
+		rotateKey:             urk.Run,
 	}
-	gAPI.GET("/users/:userID", uh.Get)
-	gAPI.PUT("/users/:userID", uh.Update)
-	gAPI.GET("/users", uh.List)
-	gAPI.POST("/users", uh.Create)
-	gAPI.DELETE("/users/:userID", uh.Inactive)
-	gAPI.PUT("/users/active/:userID", uh.Active)
+	gAPI.GET("/users/:userID", uh.Get, guard.RequireOwn(perm.UserReadAny, perm.UserReadOwn, ownUser))
+	gAPI.PUT("/users/:userID", uh.Update, guard.RequireOwn(perm.UserWriteAny, perm.UserWriteOwn, ownUser))
+	gAPI.GET("/users", uh.List, guard.Require(perm.UserReadAny))
+	gAPI.POST("/users", uh.Create, guard.Require(perm.UserWriteAny))
+	gAPI.DELETE("/users/:userID", uh.Inactive, guard.RequireOwn(perm.UserWriteAny, perm.UserWriteOwn, ownUser))
+	gAPI.PUT("/users/active/:userID", uh.Active, guard.RequireOwn(perm.UserWriteAny, perm.UserWriteOwn, ownUser))
 	gAPI.POST("/users/:userID/push-tokens", uh.SetPushToken)
+	gAPI.PUT("/users/:userID/unlock", uh.Unlock, guard.Require(perm.UserWriteAny))
+	gAPI.GET("/users/:userID/lockouts", uh.Lockouts, guard.Require(perm.UserReadAny))
+	gAPI.PUT("/users/:userID/require-password-change", uh.RequirePasswordChange, guard.Require(perm.UserWriteAny))
+	gAPI.PUT("/users/:userID/rotate-key", uh.RotateKey, guard.Require(perm.UserWriteAny))
+	gAPI.PUT("/me/password", uh.ChangePassword)
+
+	// Session routes
+	sl := &user.SessionLister{DB: db}
+	sr := &user.SessionRevoker{DB: db}
+	sla := &user.LogoutAller{DB: db}
+	sh := &SessionHandler{
+		list:         sl.Run,
+		revoke:       sr.Run,
+		logoutAll:    sla.Run,
+		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+	}
+	gAPI.GET("/sessions", sh.List)
+	gAPI.DELETE("/sessions/:sessID", sh.Revoke)
+	gAPI.POST("/auth/logout-all", sh.LogoutAll)
+
+	// Impersonation routes
+	imp := &user.Impersonator{DB: db, JWTConfig: tokenConfig, TTL: appconf.Auth.ImpersonationTTL}
+	imH := &ImpersonationHandler{
+		start:        imp.Run,
+		end:          sr.Run,
+		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+	}
+	gAPI.POST("/users/:userID/impersonate", imH.Start, guard.Require(perm.UserImpersonate))
+	gAPI.DELETE("/impersonation", imH.End)
+
+	// Two factor routes
+	tfe := &user.TwoFactorEnroller{DB: db, Issuer: appconf.Auth.TOTPIssuer}
+	tfa := &user.TwoFactorActivator{DB: db}
+	tfd := &user.TwoFactorDisabler{DB: db}
+	tfr := &user.RecoveryCodesRenewer{DB: db}
+	tfh := &TwoFactorHandler{
+		enroll:       tfe.Run,
+		activate:     tfa.Run,
+		disable:      tfd.Run,
+		renewCodes:   tfr.Run,
+		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+	}
+	gAPI.POST("/me/2fa/enroll", tfh.Enroll)
+	gAPI.POST("/me/2fa/activate", tfh.Activate)
+	gAPI.POST("/me/2fa/disable", tfh.Disable)
+	gAPI.POST("/me/2fa/recovery-codes", tfh.RecoveryCodes)
+
+	// Invitation routes
+	inv := &user.Inviter{DB: db, Mailer: &mm, Config: servconf, TTL: appconf.Auth.InvitationTTL}
+	invD := &user.DoctorInviter{DB: db, Mailer: &mm, Config: servconf, TTL: appconf.Auth.InvitationTTL}
+	invL := &user.InvitationLister{DB: db}
+	invS := &user.InvitationResender{DB: db, Mailer: &mm, Config: servconf, TTL: appconf.Auth.InvitationTTL}
+	invR := &user.InvitationRevoker{DB: db}
+	invH := &InvitationHandler{
+		invite:       inv.Run,
+		inviteDoctor: invD.Run,
+		list:         invL.Run,
+		resend:       invS.Run,
+		revoke:       invR.Run,
+		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+	}
+	gAPI.POST("/invitations", invH.Create, guard.Require(perm.InvitationWrite))
+	gAPI.GET("/invitations", invH.List, guard.Require(perm.InvitationWrite))
+	gAPI.POST("/invitations/:inviID/resend", invH.Resend, guard.Require(perm.InvitationWrite))
+	gAPI.DELETE("/invitations/:inviID", invH.Revoke, guard.Require(perm.InvitationWrite))
+
+	// Role routes
+	roleL := &user.RoleLister{DB: db}
+	roleG := &user.RoleGetter{DB: db}
+	roleS := &user.RoleSaver{DB: db}
+	roleD := &user.RoleDeleter{DB: db}
+	roleH := &RoleHandler{
+		list:   roleL.Run,
+		get:    roleG.Run,
+		save:   roleS.Run,
+		delete: roleD.Run,
+	}
+	gAPI.GET("/roles", roleH.List, guard.Require(perm.RoleRead))
+	gAPI.GET("/roles/:roleID", roleH.Get, guard.Require(perm.RoleRead))
+	gAPI.PUT("/roles/:roleID", roleH.Save, guard.Require(perm.RoleWrite))
+	gAPI.DELETE("/roles/:roleID", roleH.Delete, guard.Require(perm.RoleWrite))
+	gAPI.GET("/permissions", roleH.Permissions, guard.Require(perm.RoleRead))
+
+	// Device key routes
+	dkCr := &user.DeviceKeyCreator{DB: db}
+	dkRo := &user.DeviceKeyRotator{DB: db}
+	dkRe := &user.DeviceKeyRevoker{DB: db}
+	dkLi := &user.DeviceKeyLister{DB: db}
+	dkH := &DeviceKeyHandler{
+		create:       dkCr.Run,
+		rotate:       dkRo.Run,
+		revoke:       dkRe.Run,
+		list:         dkLi.Run,
+		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+	}
+	gAPI.POST("/device-keys", dkH.Create, guard.Require(perm.DeviceWrite))
+	gAPI.GET("/device-keys", dkH.List, guard.Require(perm.DeviceRead))
+	gAPI.POST("/device-keys/:dekeID/rotate", dkH.Rotate, guard.Require(perm.DeviceWrite))
+	gAPI.DELETE("/device-keys/:dekeID", dkH.Revoke, guard.Require(perm.DeviceWrite))
+
+	// Audit routes
+	audL := &audit.Lister{DB: db}
+	audH := &AuditHandler{list: audL.Run}
+	gAPI.GET("/audit", audH.List, guard.Require(perm.AuditRead))
+
+	// Institution routes, only the super admin provisions institutions
+	instC := &institution.Creator{DB: db, Invite: inv.Run}
+	instU := &institution.Updater{DB: db}
+	instL := &institution.Lister{DB: db}
+	instG := &institution.Getter{DB: db}
+	instH := &InstitutionHandler{
+		create:       instC.Run,
+		update:       instU.Run,
+		list:         instL.Run,
+		get:          instG.Run,
+		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+	}
+	gAPI.POST("/institutions", instH.Create, guard.Require(perm.InstitutionWrite))
+	gAPI.PUT("/institutions/:instID", instH.Update, guard.Require(perm.InstitutionWrite))
+	gAPI.GET("/institutions", instH.List, guard.Require(perm.InstitutionRead))
+	gAPI.GET("/institutions/:instID", instH.Get, guard.Require(perm.InstitutionRead))
 
 	//Doctor routes
-	doctC := &user.DoctorCreator{DB: db, Mailer: &mm, Config: servconf}
+	doctC := &user.DoctorCreator{DB: db, Mailer: &mm, Config: servconf, Policy: passwordPolicy()}
 	doctU := &user.DoctorUpdater{DB: db}
 	doctD := &user.DoctorDeleter{DB: db}
 	doctL := &user.DoctorLister{DB: db}
@@ -359,42 +616,51 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		rolesCtxKey:  JWTConfig.RolesCtxKey,
 		claimsCtxKey: JWTConfig.ClaimsCtxKey,
 	}
-	gAPI.POST("/doctors", doctH.Create)
-	gAPI.PUT("/doctors/:doctID", doctH.Update)
-	gAPI.DELETE("/doctors/:doctID", doctH.Delete)
-	gAPI.GET("/doctors", doctH.List)
-	gAPI.GET("/doctors/:doctID", doctH.Get)
+	gAPI.POST("/doctors", doctH.Create, guard.Require(perm.DoctorWriteAny))
+	gAPI.PUT("/doctors/:doctID", doctH.Update, guard.Require(perm.DoctorWriteAny, perm.DoctorWriteOwn))
+	gAPI.DELETE("/doctors/:doctID", doctH.Delete, guard.Require(perm.DoctorWriteAny))
+	gAPI.GET("/doctors", doctH.List, guard.Require(perm.DoctorReadAny, perm.DoctorReadOwn))
+	gAPI.GET("/doctors/:doctID", doctH.Get, guard.Require(perm.DoctorReadAny, perm.DoctorReadOwn))
 
 	//Schedule routes
 	scheC := &schedule.Creator{DB: db}
 	scheU := &schedule.Updater{DB: db}
-	scheD := &schedule.Deleter{DB: db}
-	scheUd := &schedule.UpdateDeleter{DB: db}
+	scheCn := &schedule.Canceller{DB: db}
+	scheCl := &schedule.CancellationLister{DB: db}
 	scheUs := &schedule.UpdateSchedule{DB: db}
 	scheL := &schedule.Lister{DB: db}
 	scheG := &schedule.Getter{DB: db}
 	scheCa := &schedule.Calendar{DB: db}
 	scheOut := &schedule.Outdoor{DB: db}
+	scheQ := &schedule.Quoter{DB: db}
+	scheSc := &schedule.StatusChanger{DB: db}
+	scheAp := &schedule.Approver{DB: db, Logger: log.New(os.Stderr, "approval: ", log.Lshortfile)}
+	scheAq := &schedule.ApprovalQueue{DB: db}
+	scheSh := &schedule.StatusHistory{DB: db}
+	scheCi := &schedule.CheckIn{DB: db}
+	scheCo := &schedule.CheckOut{DB: db}
+	scheUr := &schedule.UsageReporter{DB: db}
 	scheH := &ScheduleHandler{
 		create:         scheC.Run,
 		update:         scheU.Run,
-		delete:         scheD.Run,
-		updateDelete:   scheUd.Run,
+		cancel:         scheCn.Run,
+		cancellations:  scheCl.Run,
 		updateSchedule: scheUs.Run,
 		list:           scheL.Run,
 		get:            scheG.Run,
 		calendar:       scheCa.Run,
 		outdoor:        scheOut.Run,
+		quote:          scheQ.Run,
+		changeStatus:   scheSc.Run,
+		approve:        scheAp.Run,
+		approvalQueue:  scheAq.Run,
+		statusHistory:  scheSh.Run,
+		checkIn:        scheCi.Run,
+		checkOut:       scheCo.Run,
+		usage:          scheUr.Run,
 		rolesCtxKey:    JWTConfig.RolesCtxKey,
 		claimsCtxKey:   JWTConfig.ClaimsCtxKey,
 		getErrorMessage: func(err error) generalError {
-			if schedule.ScheduleUnavailable(err) {
-				return generalError{
-					Code: 002,
-					//Message: "Schedule unavailable: " + err.Error(),
-					Message: err.Error(),
-				}
-			}
 			return generalError{
 				Code: 001,
 				//Message: "Unspecified error " + err.Error(),
@@ -402,15 +668,82 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 			}
 		},
 	}
-	gAPI.POST("/schedules", scheH.Create)
-	gAPI.PUT("/schedules/:scheID", scheH.Update)
-	gAPI.PUT("/schedules/:scheID/schedule", scheH.UpdateSchedule)
-	gAPI.PUT("/schedules/:scheID/deletedAt", scheH.UpdateDeleter)
-	gAPI.DELETE("/schedules/:scheID", scheH.Delete)
-	gAPI.GET("/schedules", scheH.List)
-	gAPI.GET("/schedules/:scheID", scheH.Get)
-	gAPI.GET("/calendar", scheH.Calendar)
-	gAPI.GET("/outdoor/:roomID", scheH.Outdoor)
+	scheRead := guard.Require(perm.ScheduleReadAny, perm.ScheduleReadOwn)
+	scheWrite := guard.Require(perm.ScheduleWriteAny, perm.ScheduleWriteOwn)
+	gAPI.POST("/schedules", scheH.Create, scheWrite)
+	gAPI.POST("/schedules/quote", scheH.Quote, scheWrite)
+	gAPI.PUT("/schedules/:scheID", scheH.Update, scheWrite)
+	gAPI.PUT("/schedules/:scheID/schedule", scheH.UpdateSchedule, scheWrite)
+	gAPI.PUT("/schedules/:scheID/deletedAt", scheH.UpdateDeleter, scheWrite)
+	gAPI.DELETE("/schedules/:scheID", scheH.Delete, scheWrite)
+	gAPI.POST("/schedules/:scheID/cancel", scheH.Cancel, scheWrite)
+	gAPI.GET("/schedule-cancellations", scheH.Cancellations, scheRead)
+	gAPI.PUT("/schedules/:scheID/status", scheH.ChangeStatus, guard.Require(perm.ScheduleWriteAny))
+	gAPI.GET("/schedules/:scheID/status-history", scheH.StatusHistory, scheRead)
+	gAPI.GET("/schedule-approvals", scheH.ApprovalQueue, guard.Require(perm.ScheduleApprove))
+	gAPI.POST("/schedules/:scheID/approve", scheH.Approve, guard.Require(perm.ScheduleApprove))
+	gAPI.POST("/schedules/:scheID/reject", scheH.Reject, guard.Require(perm.ScheduleApprove))
+	scheCheck := guard.Require(perm.ScheduleCheckIn, perm.ScheduleWriteOwn)
+	gAPI.POST("/schedules/:scheID/check-in", scheH.CheckIn, scheCheck)
+	gAPI.POST("/schedules/:scheID/check-out", scheH.CheckOut, scheCheck)
+	gAPI.GET("/schedule-usage", scheH.Usage, scheRead)
+	gAPI.GET("/schedules", scheH.List, scheRead)
+	gAPI.GET("/schedules/:scheID", scheH.Get, scheRead)
+	gAPI.GET("/calendar", scheH.Calendar, scheRead)
+	gAPI.GET("/outdoor/:roomID", scheH.Outdoor, guard.Require(perm.OutdoorRead))
+
+	//Schedule Series routes
+	sersC := &schedule.SeriesCreator{DB: db}
+	sersU := &schedule.SeriesUpdater{DB: db}
+	sersCa := &schedule.SeriesCanceller{DB: db}
+	sersG := &schedule.SeriesGetter{DB: db}
+	sersH := &ScheduleSeriesHandler{
+		create:          sersC.Run,
+		update:          sersU.Run,
+		cancel:          sersCa.Run,
+		get:             sersG.Run,
+		rolesCtxKey:     JWTConfig.RolesCtxKey,
+		claimsCtxKey:    JWTConfig.ClaimsCtxKey,
+		getErrorMessage: scheH.getErrorMessage,
+	}
+	gAPI.POST("/schedule-series", sersH.Create, scheWrite)
+	gAPI.GET("/schedule-series/:sersID", sersH.Get, scheRead)
+	gAPI.PUT("/schedule-series/:sersID/occurrences/:scheID", sersH.Update, scheWrite)
+	gAPI.DELETE("/schedule-series/:sersID", sersH.Cancel, scheWrite)
+
+	//Rebalance routes
+	rebR := &schedule.Rebalancer{DB: db, Logger: log.New(os.Stderr, "rebalancer: ", log.Lshortfile)}
+	rebL := &schedule.RebalanceLister{DB: db}
+	rebG := &schedule.RebalanceGetter{DB: db}
+	rebH := &RebalanceHandler{
+		run:          rebR.Run,
+		list:         rebL.Run,
+		get:          rebG.Run,
+		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+	}
+	rebPerm := guard.Require(perm.ScheduleRebalance)
+	gAPI.POST("/rebalance-runs", rebH.Run, rebPerm)
+	gAPI.GET("/rebalance-runs", rebH.List, rebPerm)
+	gAPI.GET("/rebalance-runs/:reruID", rebH.Get, rebPerm)
+
+	//Closure routes
+	closC := &schedule.ClosureCreator{DB: db, Logger: log.New(os.Stderr, "closure: ", log.Lshortfile)}
+	closL := &schedule.ClosureLister{DB: db}
+	closG := &schedule.ClosureGetter{DB: db}
+	closD := &schedule.ClosureDeleter{DB: db}
+	closH := &ClosureHandler{
+		create:       closC.Run,
+		list:         closL.Run,
+		get:          closG.Run,
+		delete:       closD.Run,
+		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+	}
+	closRead := guard.Require(perm.ClosureRead)
+	closWrite := guard.Require(perm.ClosureWrite)
+	gAPI.POST("/closures", closH.Create, closWrite)
+	gAPI.GET("/closures", closH.List, closRead)
+	gAPI.GET("/closures/:closID", closH.Get, closRead)
+	gAPI.DELETE("/closures/:closID", closH.Delete, closWrite)
 
 	//Appointment routes
 	appoC := &appointment.Creator{DB: db}
@@ -427,11 +760,13 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		rolesCtxKey:  JWTConfig.RolesCtxKey,
 		claimsCtxKey: JWTConfig.ClaimsCtxKey,
 	}
-	gAPI.POST("/appointments", appoH.Create)
-	gAPI.PUT("/appointments/:appoID", appoH.Update)
-	gAPI.DELETE("/appointments/:appoID", appoH.Delete)
-	gAPI.GET("/appointments", appoH.List)
-	gAPI.GET("/appointments/:appoID", appoH.Get)
+	appoRead := guard.Require(perm.AppointmentReadAny, perm.AppointmentReadOwn)
+	appoWrite := guard.Require(perm.AppointmentWriteAny, perm.AppointmentWriteOwn)
+	gAPI.POST("/appointments", appoH.Create, appoWrite)
+	gAPI.PUT("/appointments/:appoID", appoH.Update, appoWrite)
+	gAPI.DELETE("/appointments/:appoID", appoH.Delete, appoWrite)
+	gAPI.GET("/appointments", appoH.List, appoRead)
+	gAPI.GET("/appointments/:appoID", appoH.Get, appoRead)
 
 	//Patient routes
 	patiC := &patient.Creator{DB: db}
@@ -448,11 +783,13 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		rolesCtxKey:  JWTConfig.RolesCtxKey,
 		claimsCtxKey: JWTConfig.ClaimsCtxKey,
 	}
-	gAPI.POST("/patients", patiH.Create)
-	gAPI.PUT("/patients/:patiID", patiH.Update)
-	gAPI.DELETE("/patients/:patiID", patiH.Delete)
-	gAPI.GET("/patients", patiH.List)
-	gAPI.GET("/patients/:patiID", patiH.Get)
+	patiRead := guard.Require(perm.PatientReadAny, perm.PatientReadOwn)
+	patiWrite := guard.Require(perm.PatientWriteAny, perm.PatientWriteOwn)
+	gAPI.POST("/patients", patiH.Create, patiWrite)
+	gAPI.PUT("/patients/:patiID", patiH.Update, patiWrite)
+	gAPI.DELETE("/patients/:patiID", patiH.Delete, patiWrite)
+	gAPI.GET("/patients", patiH.List, patiRead)
+	gAPI.GET("/patients/:patiID", patiH.Get, patiRead)
 
 	//ActionVerification routes
 	acveC := &actionverification.Creator{DB: db}
@@ -467,11 +804,11 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		list:   acveL.Run,
 		get:    acveG.Run,
 	}
-	gAPI.POST("/actions-verification", acveH.Create)
-	gAPI.PUT("/actions-verification/:acveID", acveH.Update)
-	gAPI.DELETE("/actions-verification/:acveID", acveH.Delete)
-	gAPI.GET("/actions-verification", acveH.List)
-	gAPI.GET("/actions-verification/:acveID", acveH.Get)
+	gAPI.POST("/actions-verification", acveH.Create, guard.Require(perm.VerificationWrite))
+	gAPI.PUT("/actions-verification/:acveID", acveH.Update, guard.Require(perm.VerificationWrite))
+	gAPI.DELETE("/actions-verification/:acveID", acveH.Delete, guard.Require(perm.VerificationWrite))
+	gAPI.GET("/actions-verification", acveH.List, guard.Require(perm.VerificationRead))
+	gAPI.GET("/actions-verification/:acveID", acveH.Get, guard.Require(perm.VerificationRead))
 
 	//Room routes
 	roomC := &room.Creator{DB: db}
@@ -479,18 +816,28 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 	roomD := &room.Deleter{DB: db}
 	roomL := &room.Lister{DB: db}
 	roomG := &room.Getter{DB: db}
+	maiC := &schedule.MaintenanceCreator{DB: db, Logger: log.New(os.Stderr, "maintenance: ", log.Lshortfile)}
+	maiL := &schedule.MaintenanceLister{DB: db}
+	maiD := &schedule.MaintenanceDeleter{DB: db}
 	roomH := &RoomHandler{
-		create: roomC.Run,
-		update: roomU.Run,
-		delete: roomD.Run,
-		list:   roomL.Run,
-		get:    roomG.Run,
-	}
-	gAPI.POST("/rooms", roomH.Create)
-	gAPI.PUT("/rooms/:roomID", roomH.Update)
-	gAPI.DELETE("/rooms/:roomID", roomH.Delete)
-	gAPI.GET("/rooms", roomH.List)
-	gAPI.GET("/rooms/:roomID", roomH.Get)
+		create:            roomC.Run,
+		update:            roomU.Run,
+		delete:            roomD.Run,
+		list:              roomL.Run,
+		get:               roomG.Run,
+		createMaintenance: maiC.Run,
+		listMaintenance:   maiL.Run,
+		deleteMaintenance: maiD.Run,
+		claimsCtxKey:      JWTConfig.ClaimsCtxKey,
+	}
+	gAPI.POST("/rooms", roomH.Create, guard.Require(perm.RoomWrite))
+	gAPI.PUT("/rooms/:roomID", roomH.Update, guard.Require(perm.RoomWrite))
+	gAPI.DELETE("/rooms/:roomID", roomH.Delete, guard.Require(perm.RoomWrite))
+	gAPI.GET("/rooms", roomH.List, guard.Require(perm.RoomRead))
+	gAPI.GET("/rooms/:roomID", roomH.Get, guard.Require(perm.RoomRead))
+	gAPI.POST("/rooms/:roomID/maintenance", roomH.CreateMaintenance, guard.Require(perm.RoomWrite))
+	gAPI.GET("/rooms/:roomID/maintenance", roomH.ListMaintenance, guard.Require(perm.RoomRead))
+	gAPI.DELETE("/rooms/:roomID/maintenance/:rmaiID", roomH.DeleteMaintenance, guard.Require(perm.RoomWrite))
 
 	//Avaliability routes
 	avalC := &avaliability.Checker{DB: db}
@@ -499,7 +846,7 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		rolesCtxKey:  JWTConfig.RolesCtxKey,
 		claimsCtxKey: JWTConfig.ClaimsCtxKey,
 	}
-	gAPI.GET("/avaliability", avalH.Check)
+	gAPI.GET("/avaliability", avalH.Check, scheRead)
 
 	//Specialty routes
 	specialtyC := &specialty.Creator{DB: db}
@@ -514,11 +861,11 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		list:   specialtyL.Run,
 		get:    specialtyG.Run,
 	}
-	gAPI.POST("/specialty", specialtyH.Create)
-	gAPI.PUT("/specialty/:specID", specialtyH.Update)
-	gAPI.DELETE("/specialty/:specID", specialtyH.Delete)
-	gAPI.GET("/specialty", specialtyH.List)
-	gAPI.GET("/specialty/:specID", specialtyH.Get)
+	gAPI.POST("/specialty", specialtyH.Create, guard.Require(perm.SpecialtyWrite))
+	gAPI.PUT("/specialty/:specID", specialtyH.Update, guard.Require(perm.SpecialtyWrite))
+	gAPI.DELETE("/specialty/:specID", specialtyH.Delete, guard.Require(perm.SpecialtyWrite))
+	gAPI.GET("/specialty", specialtyH.List, guard.Require(perm.SpecialtyRead))
+	gAPI.GET("/specialty/:specID", specialtyH.Get, guard.Require(perm.SpecialtyRead))
 
 	//DoctorSpecialty routes
 	doctorspecialtyC := &doctorspecialty.Creator{DB: db}
@@ -533,11 +880,11 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		list:   doctorspecialtyL.Run,
 		get:    doctorspecialtyG.Run,
 	}
-	gAPI.POST("/doctor-specialty", doctorspecialtyH.Create)
-	gAPI.PUT("/doctor-specialty/:doctID", doctorspecialtyH.Update)
-	gAPI.DELETE("/doctor-specialty/:doctID/:specID", doctorspecialtyH.Delete)
-	gAPI.GET("/doctor-specialty", doctorspecialtyH.List)
-	gAPI.GET("/doctor-specialty/:doctID/:specID", doctorspecialtyH.Get)
+	gAPI.POST("/doctor-specialty", doctorspecialtyH.Create, guard.Require(perm.DoctorWriteAny))
+	gAPI.PUT("/doctor-specialty/:doctID", doctorspecialtyH.Update, guard.Require(perm.DoctorWriteAny))
+	gAPI.DELETE("/doctor-specialty/:doctID/:specID", doctorspecialtyH.Delete, guard.Require(perm.DoctorWriteAny))
+	gAPI.GET("/doctor-specialty", doctorspecialtyH.List, guard.Require(perm.DoctorReadAny, perm.DoctorReadOwn))
+	gAPI.GET("/doctor-specialty/:doctID/:specID", doctorspecialtyH.Get, guard.Require(perm.DoctorReadAny, perm.DoctorReadOwn))
 
 	//Config routes
 	configC := &config.Creator{DB: db}
@@ -546,19 +893,17 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 	configL := &config.Lister{DB: db}
 	configG := &config.Getter{DB: db}
 	configH := &ConfigHandler{
-		create:       configC.Run,
-		update:       configU.Run,
-		delete:       configD.Run,
-		list:         configL.Run,
-		get:          configG.Run,
-		rolesCtxKey:  JWTConfig.RolesCtxKey,
-		claimsCtxKey: JWTConfig.ClaimsCtxKey,
+		create: configC.Run,
+		update: configU.Run,
+		delete: configD.Run,
+		list:   configL.Run,
+		get:    configG.Run,
 	}
-	gAPI.POST("/configs", configH.Create)
-	gAPI.PUT("/configs/:key", configH.Update)
-	gAPI.DELETE("/configs/:key", configH.Delete)
-	gAPI.GET("/configs", configH.List)
-	gAPI.GET("/configs/:key", configH.Get)
+	gAPI.POST("/configs", configH.Create, guard.Require(perm.ConfigWrite))
+	gAPI.PUT("/configs/:key", configH.Update, guard.Require(perm.ConfigWrite))
+	gAPI.DELETE("/configs/:key", configH.Delete, guard.Require(perm.ConfigWrite))
+	gAPI.GET("/configs", configH.List, guard.Require(perm.ConfigRead))
+	gAPI.GET("/configs/:key", configH.Get, guard.Require(perm.ConfigRead))
 
 	//Dashboard routes
 	dashboardV := &dashboard.Viewer{DB: db}
@@ -567,7 +912,7 @@ func PrivateRoutes(db *sqlx.DB, gAPI *echo.Group, JWTConfig JWTConfig) error {
 		rolesCtxKey:  JWTConfig.RolesCtxKey,
 		claimsCtxKey: JWTConfig.ClaimsCtxKey,
 	}
-	gAPI.GET("/dashboard", dashboardH.View)
+	gAPI.GET("/dashboard", dashboardH.View, guard.Require(perm.DashboardReadAny, perm.DashboardReadOwn))
 
 	return nil
 }
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// ImpersonationHandler service to act as another user
+type ImpersonationHandler struct {
+	claimsCtxKey string
+	start        func(r user.ImpersonationRequest) (*user.Impersonation, error)
+	end          func(userID, sessID uuid.UUID) error
+}
+
+type impersonationForm struct {
+	// Why the user is being impersonated, kept with the session
+	Reason string `json:"reason" example:"Check the calendar the doctor sees"`
+}
+
+type impersonationToken struct {
+	// User being impersonated
+	User m.User `json:"user"`
+	// JWT to send while impersonating, it can't be refreshed
+	JWT       string    `json:"jwt"`
+	ActorID   uuid.UUID `json:"actorID"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type impersonationOut struct {
+	singleItemData
+	Item impersonationToken `json:"item"`
+	Kind string             `json:"kind"`
+}
+
+type impersonationResponse struct {
+	dataResponse
+	Data impersonationOut `json:"data"`
+}
+
+// Start returns an echo handler
+// @Summary impersonation.Start
+// @Description Open a time limited session as an user of the institution, every request made with it is audited
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param userID path string true "user to impersonate" Format(uuid)
+// @Param reason body handler.impersonationForm true "Reason"
+// @Success 200 {object} handler.impersonationResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/users/{userID}/impersonate [post]
+func (handler *ImpersonationHandler) Start(c echo.Context) error {
+	req := impersonationForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	userID, err := uuid.FromString(c.Param("userID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	imp, err := handler.start(user.ImpersonationRequest{
+		InstID:      tenantID(c),
+		ActorID:     uuid.FromStringOrNil(claims.UserID),
+		ActorSessID: uuid.FromStringOrNil(claims.SessID),
+		UserID:      userID,
+		Reason:      req.Reason,
+		Device:      deviceFromRequest(c),
+	})
+	if err != nil {
+		switch e := errors.Cause(err).(type) {
+		case *auth.UserNotFoundError:
+			return c.JSON(http.StatusNotFound, errorResponse{Error: generalError{
+				Code:    http.StatusNotFound,
+				Message: e.Error(),
+			}})
+		case *auth.ValidationError:
+			ge := generalError{
+				Code:    http.StatusBadRequest,
+				Message: "Can't impersonate the user",
+			}
+			for k, v := range e.Messages {
+				ge.Errors = append(ge.Errors, detailError{
+					Domain:  "impersonation",
+					Reason:  k,
+					Message: v,
+				})
+			}
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: ge})
+		}
+		return errors.Wrap(err, "Fail to impersonate user")
+	}
+	return c.JSON(http.StatusOK, impersonationResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: impersonationOut{
+			Kind: "impersonation",
+			Item: impersonationToken{
+				User:      imp.User,
+				JWT:       imp.Jwt,
+				ActorID:   imp.ActorID,
+				ExpiresAt: imp.ExpiresAt,
+			},
+		},
+	})
+}
+
+// End returns an echo handler
+// @Summary impersonation.End
+// @Description End the impersonation session of the token
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Success 200 {object} handler.authResetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/impersonation [delete]
+func (handler *ImpersonationHandler) End(c echo.Context) error {
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	if len(claims.Actor) == 0 {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: "The token isn't impersonating an user",
+		}})
+	}
+	err = handler.end(uuid.FromStringOrNil(claims.UserID), uuid.FromStringOrNil(claims.SessID))
+	if err != nil {
+		return errors.Wrap(err, "Fail to end impersonation")
+	}
+	return c.JSON(http.StatusOK, authResetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: recoverResponse{
+			Kind: "empty",
+		},
+	})
+}
+
+// impersonationMiddleware marks the responses to impersonation tokens with
+// the admin acting and keeps them from the blocked routes
+func impersonationMiddleware(claimsCtxKey string, blocked ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, err := auth.Extract(c.Get(claimsCtxKey))
+			if err != nil || len(claims.Actor) == 0 {
+				return next(c)
+			}
+			c.Response().Header().Set("X-Impersonated-By", claims.Actor)
+			for _, p := range blocked {
+				if c.Path() == p {
+					return c.JSON(http.StatusForbidden, errorResponse{Error: generalError{
+						Code:    http.StatusForbidden,
+						Message: "Not allowed while impersonating",
+						Errors: []detailError{{
+							Domain:  "auth",
+							Reason:  "impersonating",
+							Message: "The route can't be used while impersonating an user",
+						}},
+					}})
+				}
+			}
+			return next(c)
+		}
+	}
+}
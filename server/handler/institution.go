@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// InstitutionHandler service to provision and manage the institutions
+type InstitutionHandler struct {
+	claimsCtxKey string
+	create       func(fromInstID uuid.UUID, inst *m.Institution, adminEmail string, actorID uuid.UUID) (*m.Institution, error)
+	update       func(*m.Institution) (*m.Institution, error)
+	list         func(m.FilterInstitution) ([]m.Institution, error)
+	get          func(instID uuid.UUID) (*m.Institution, error)
+}
+
+type institutionForm struct {
+	Name string `json:"name" example:"Inovant Salvador"`
+	// AdminEmail is invited as the admin of the new institution
+	AdminEmail string `json:"adminEmail" example:"admin@clinic.com"`
+}
+
+type institutionResponse struct {
+	Item *m.Institution `json:"item"`
+	Kind string         `json:"kind"`
+}
+
+type institutionGetResponse struct {
+	dataResponse
+	Data institutionResponse `json:"data"`
+}
+
+type institutionsResponse struct {
+	collectionItemData
+	Items []m.Institution `json:"items"`
+	Kind  string          `json:"kind"`
+}
+
+type institutionsListResponse struct {
+	dataResponse
+	Data institutionsResponse `json:"data"`
+}
+
+// Create Institution returns an echo handler
+// @Summary Institution.Create
+// @Description Provision an institution with the config of the current one and invite its admin
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param Institution body handler.institutionForm true "Create new Institution"
+// @Success 200 {object} handler.institutionGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/institutions [post]
+func (handler *InstitutionHandler) Create(c echo.Context) error {
+	req := institutionForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.AdminEmail = strings.TrimSpace(req.AdminEmail)
+	if len(req.Name) == 0 || len(req.AdminEmail) == 0 {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: "Institution name and admin email are required",
+		}})
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	inst, err := handler.create(tenantID(c), &m.Institution{Name: req.Name}, req.AdminEmail, uuid.FromStringOrNil(claims.UserID))
+	if err != nil {
+		return errors.Wrap(err, "Fail to create new Institution")
+	}
+	return c.JSON(http.StatusOK, institutionGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: institutionResponse{
+			Kind: "Institution",
+			Item: inst,
+		},
+	})
+}
+
+// Update returns an echo handler
+// @Summary Institution.Update
+// @Description Rename an institution, setting inactiveAt signs out its users and revokes its device keys
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param instID path string true "Institution ID" Format(uuid)
+// @Param Institution body models.Institution true "Institution Update Body"
+// @Success 200 {object} handler.institutionGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/institutions/{instID} [put]
+func (handler *InstitutionHandler) Update(c echo.Context) error {
+	req := m.Institution{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	req.InstID, err = uuid.FromString(c.Param("instID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	if req.InstID == tenantID(c) && req.InactiveAt.Valid {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: "The institution of the signed in user can't be inactivated",
+		}})
+	}
+
+	inst, err := handler.update(&req)
+	if err != nil {
+		return errors.Wrap(err, "Fail to update Institution")
+	}
+	return c.JSON(http.StatusOK, institutionGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: institutionResponse{
+			Kind: "Institution update",
+			Item: inst,
+		},
+	})
+}
+
+// Get returns an echo handler
+// @Summary Institution.Get
+// @Description Get an Institution
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param instID path string true "Institution ID" Format(uuid)
+// @Success 200 {object} handler.institutionGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/institutions/{instID} [get]
+func (handler *InstitutionHandler) Get(c echo.Context) error {
+	instID, err := uuid.FromString(c.Param("instID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+
+	inst, err := handler.get(instID)
+	if err != nil {
+		return errors.Wrap(err, "Fail to get Institution")
+	}
+	return c.JSON(http.StatusOK, institutionGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: institutionResponse{
+			Kind: "Institution get",
+			Item: inst,
+		},
+	})
+}
+
+// List returns an echo handler
+// @Summary Institution.List
+// @Description Get Institution list
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param name query string false "Filter Institutions by name"
+// @Param limit query int false "page size"
+// @Param offset query int false "entries to skip"
+// @Success 200 {object} handler.institutionsListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/institutions [get]
+func (handler *InstitutionHandler) List(c echo.Context) error {
+	f, err := buildFilterInstitution(c.QueryParam)
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse filter queries")
+	}
+
+	inst, err := handler.list(f)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list of Institutions")
+	}
+	return c.JSON(http.StatusOK, institutionsListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: institutionsResponse{
+			Kind:  "Institution list",
+			Items: inst,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(inst)),
+				TotalItems:       int64(len(inst)),
+			},
+		},
+	})
+}
+
+/* buildFilterInstitution - Verifying params to method List */
+func buildFilterInstitution(QueryParam func(string) string) (m.FilterInstitution, error) {
+	f := m.FilterInstitution{}
+	name := QueryParam("name")
+	if len(name) > 0 {
+		f.Name = &name
+	}
+	l := QueryParam("limit")
+	if len(l) > 0 {
+		limit, err := strconv.ParseInt(l, 10, 64)
+		if err != nil {
+			return f, errors.Wrap(err, "Failed to parse limit: "+l)
+		}
+		f.Limit = &limit
+	}
+	s := QueryParam("offset")
+	if len(s) > 0 {
+		offset, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return f, errors.Wrap(err, "Failed to parse offset: "+s)
+		}
+		f.Offset = &offset
+	}
+	return f, nil
+}
@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/labstack/echo"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	um "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// InvitationHandler service to invite users and doctors
+type InvitationHandler struct {
+	claimsCtxKey string
+	invite       func(instID uuid.UUID, u *um.User, actorID uuid.UUID) (*um.Invitation, error)
+	inviteDoctor func(instID uuid.UUID, doc *um.Doctor, actorID uuid.UUID) (*um.Invitation, error)
+	list         func(instID uuid.UUID) ([]um.Invitation, error)
+	resend       func(instID, inviID uuid.UUID) (*um.Invitation, error)
+	revoke       func(instID, inviID uuid.UUID) (*um.Invitation, error)
+	accept       func(inviID uuid.UUID, secret, password string) (*um.User, error)
+}
+
+// Create returns an echo handler
+// @Summary invitations.Create
+// @Description Invite an user, or a doctor when doctor data is sent, by email
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param invitation body handler.invitationForm true "Invitation data"
+// @Success 200 {object} handler.invitationGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/invitations [post]
+func (handler *InvitationHandler) Create(c echo.Context) error {
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	req := invitationForm{}
+	err = c.Bind(&req)
+	if err != nil {
+		return errors.Wrap(err, "Wrong invitation parameters")
+	}
+	if len(strings.TrimSpace(req.Email)) == 0 {
+		return c.JSON(http.StatusBadRequest, errorResponse{
+			Error: generalError{
+				Code:    http.StatusBadRequest,
+				Message: "Email cannot be empty",
+			},
+		})
+	}
+	u := um.User{
+		Email: strings.TrimSpace(req.Email),
+		Roles: req.Roles,
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	var inv *um.Invitation
+	if req.Doctor != nil {
+		inv, err = handler.inviteDoctor(tenantID(c), &um.Doctor{
+			User:        u,
+			Name:        req.Doctor.Name,
+			Info:        req.Doctor.Info,
+			Specialties: req.Doctor.Specialties,
+		}, actorID)
+	} else {
+		inv, err = handler.invite(tenantID(c), &u, actorID)
+	}
+	if err != nil {
+		if e, ok := roleError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to invite user")
+	}
+	return c.JSON(http.StatusOK, invitationGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: invitationResponse{
+			Kind: "Invitation created",
+			Item: inv,
+		},
+	})
+}
+
+// List returns an echo handler
+// @Summary invitations.List
+// @Description List the pending invitations
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Success 200 {object} handler.invitationListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/invitations [get]
+func (handler *InvitationHandler) List(c echo.Context) error {
+	inv, err := handler.list(tenantID(c))
+	if err != nil {
+		return errors.Wrap(err, "Fail to list invitations")
+	}
+	return c.JSON(http.StatusOK, invitationListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: invitationsResponse{
+			Kind:  "Invitation list",
+			Items: inv,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(inv)),
+				TotalItems:       int64(len(inv)),
+			},
+		},
+	})
+}
+
+// Resend returns an echo handler
+// @Summary invitations.Resend
+// @Description Send a pending invitation again with a new link
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param inviID path string true "invitation id" Format(uuid)
+// @Success 200 {object} handler.invitationGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/invitations/{inviID}/resend [post]
+func (handler *InvitationHandler) Resend(c echo.Context) error {
+	return handler.change(c, handler.resend, "Invitation resent")
+}
+
+// Revoke returns an echo handler
+// @Summary invitations.Revoke
+// @Description Cancel a pending invitation
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param inviID path string true "invitation id" Format(uuid)
+// @Success 200 {object} handler.invitationGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/invitations/{inviID} [delete]
+func (handler *InvitationHandler) Revoke(c echo.Context) error {
+	return handler.change(c, handler.revoke, "Invitation revoked")
+}
+
+// Accept returns an echo handler
+// @Summary invitations.Accept
+// @Description Set the password of an invited account and activate it
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param inviID path string true "invitation id" Format(uuid)
+// @Param secret path string true "invitation link secret"
+// @Param password body handler.invitationAcceptForm true "Password of the account"
+// @Success 200 {object} handler.userGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /auth/invitation/{inviID}/{secret} [post]
+func (handler *InvitationHandler) Accept(c echo.Context) error {
+	inviID, err := uuid.FromString(c.Param("inviID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	req := invitationAcceptForm{}
+	err = c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(req.Password)) == 0 {
+		return c.JSON(http.StatusBadRequest, errorResponse{
+			Error: generalError{
+				Code:    http.StatusBadRequest,
+				Message: "Password cannot be empty",
+			},
+		})
+	}
+	u, err := handler.accept(inviID, c.Param("secret"), req.Password)
+	if err != nil {
+		if e, ok := invitationError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		if e, ok := passwordError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to accept invitation")
+	}
+	return c.JSON(http.StatusOK, userGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: userResponse{
+			Kind: "User activated",
+			Item: u,
+		},
+	})
+}
+
+func (handler *InvitationHandler) change(c echo.Context, fn func(instID, inviID uuid.UUID) (*um.Invitation, error), kind string) error {
+	inviID, err := uuid.FromString(c.Param("inviID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	inv, err := fn(tenantID(c), inviID)
+	if err != nil {
+		if e, ok := invitationError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to update invitation")
+	}
+	return c.JSON(http.StatusOK, invitationGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: invitationResponse{
+			Kind: kind,
+			Item: inv,
+		},
+	})
+}
+
+func invitationError(err error) (generalError, bool) {
+	e, ok := errors.Cause(err).(*auth.InvitationInvalidError)
+	if !ok {
+		return generalError{}, false
+	}
+	return generalError{
+		Code:    http.StatusNotFound,
+		Message: e.Error(),
+		Errors: []detailError{{
+			Domain:  "invitation",
+			Reason:  "invalidInvitation",
+			Message: e.Error(),
+		}},
+	}, true
+}
+
+type invitationDoctorForm struct {
+	Name        string          `json:"name"`
+	Info        types.JSONText  `json:"info"`
+	Specialties *pq.StringArray `json:"specialties"`
+}
+
+type invitationForm struct {
+	Email string   `json:"email" example:"user@example.com"`
+	Roles []string `json:"roles"`
+	// Set to invite a doctor
+	Doctor *invitationDoctorForm `json:"doctor"`
+}
+
+type invitationAcceptForm struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type invitationResponse struct {
+	singleItemData
+	Item *um.Invitation `json:"item"`
+	Kind string         `json:"kind"`
+}
+
+type invitationGetResponse struct {
+	dataResponse
+	Data invitationResponse `json:"data"`
+}
+
+type invitationsResponse struct {
+	collectionItemData
+	Items []um.Invitation `json:"items"`
+	Kind  string          `json:"kind"`
+}
+
+type invitationListResponse struct {
+	dataResponse
+	Data invitationsResponse `json:"data"`
+}
@@ -10,17 +10,18 @@ import (
 	"github.com/pkg/errors"
 
 	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 )
 
 // PatientHandler service to create handler
 type PatientHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	create       func(*m.Patient) (*m.Patient, error)
-	update       func(*m.Patient) (*m.Patient, error)
-	delete       func(doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error)
-	list         func(doctID *uuid.UUID, f m.FilterPatient) ([]m.Patient, error)
-	get          func(doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error)
+	create       func(uuid.UUID, *m.Patient) (*m.Patient, error)
+	update       func(uuid.UUID, *m.Patient) (*m.Patient, error)
+	delete       func(instID uuid.UUID, doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error)
+	list         func(instID uuid.UUID, doctID *uuid.UUID, f m.FilterPatient) ([]m.Patient, error)
+	get          func(instID uuid.UUID, doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error)
 }
 
 type patientResponse struct {
@@ -74,14 +75,14 @@ func (handler *PatientHandler) Create(c echo.Context) error {
 		return err
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.PatientWriteAny)
 	if err != nil {
 		return err
 	}
 	if doctID != nil {
 		req.DoctID = *doctID
 	}
-	pat, err := handler.create(&req)
+	pat, err := handler.create(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to create new Patient")
 	}
@@ -116,7 +117,7 @@ func (handler *PatientHandler) Update(c echo.Context) error {
 		return err
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.PatientWriteAny)
 	if err != nil {
 		return err
 	}
@@ -129,7 +130,7 @@ func (handler *PatientHandler) Update(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	pat, err := handler.update(&req)
+	pat, err := handler.update(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to update Patient")
 	}
@@ -162,12 +163,12 @@ func (handler *PatientHandler) Delete(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.PatientWriteAny)
 	if err != nil {
 		return err
 	}
 
-	pat, err := handler.delete(doctID, patiID)
+	pat, err := handler.delete(tenantID(c), doctID, patiID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete Patient")
 	}
@@ -200,12 +201,12 @@ func (handler *PatientHandler) Get(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.PatientReadAny)
 	if err != nil {
 		return err
 	}
 
-	pat, err := handler.get(doctID, patiID)
+	pat, err := handler.get(tenantID(c), doctID, patiID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Patients")
 	}
@@ -243,12 +244,12 @@ func (handler *PatientHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.PatientReadAny)
 	if err != nil {
 		return err
 	}
 
-	pat, err := handler.list(doctID, f)
+	pat, err := handler.list(tenantID(c), doctID, f)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Patients")
 	}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// RebalanceHandler service to run the scheduling algorithm and read its reports
+type RebalanceHandler struct {
+	claimsCtxKey string
+	run          func(instID uuid.UUID, actorID *uuid.UUID, req m.RebalanceRequest) (*m.RebalanceRun, error)
+	list         func(instID uuid.UUID, f m.FilterRebalanceRun) ([]m.RebalanceRun, error)
+	get          func(instID, reruID uuid.UUID) (*m.RebalanceRun, error)
+}
+
+type rebalanceRunResponse struct {
+	Item *m.RebalanceRun `json:"item"`
+	Kind string          `json:"kind"`
+}
+
+type rebalanceRunGetResponse struct {
+	dataResponse
+	Data rebalanceRunResponse `json:"data"`
+}
+
+type rebalanceRunsResponse struct {
+	collectionItemData
+	Items []m.RebalanceRun `json:"items"`
+	Kind  string           `json:"kind"`
+}
+
+type rebalanceRunListResponse struct {
+	dataResponse
+	Data rebalanceRunsResponse `json:"data"`
+}
+
+// Run returns an echo handler
+// @Summary Rebalance.Run
+// @Description Run the scheduling algorithm that moves the Schedules between rooms for some days. A preview lists the moves without applying them, otherwise the doctors whose room changed are notified. The report is saved either way
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param request body models.RebalanceRequest true "Days to rebalance"
+// @Success 200 {object} handler.rebalanceRunGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/rebalance-runs [post]
+func (handler *RebalanceHandler) Run(c echo.Context) error {
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	req := m.RebalanceRequest{}
+	err = c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	run, err := handler.run(tenantID(c), &actorID, req)
+	if err != nil {
+		return handler.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, rebalanceRunGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: rebalanceRunResponse{
+			Kind: "Rebalance run",
+			Item: run,
+		},
+	})
+}
+
+// List returns an echo handler
+// @Summary Rebalance.List
+// @Description List the reports of the scheduling algorithm runs, newest first
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param source query string false "job or admin"
+// @Param preview query bool false "only the previews, or only the runs applied"
+// @Param limit query int false "page size, 50 by default"
+// @Success 200 {object} handler.rebalanceRunListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/rebalance-runs [get]
+func (handler *RebalanceHandler) List(c echo.Context) error {
+	f := m.FilterRebalanceRun{}
+	if source := c.QueryParam("source"); len(source) > 0 {
+		f.Source = &source
+	}
+	if preview := c.QueryParam("preview"); len(preview) > 0 {
+		b, err := strconv.ParseBool(preview)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse preview")
+		}
+		f.Preview = &b
+	}
+	if limit := c.QueryParam("limit"); len(limit) > 0 {
+		l, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse limit")
+		}
+		f.Limit = &l
+	}
+
+	runs, err := handler.list(tenantID(c), f)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list rebalance runs")
+	}
+	return c.JSON(http.StatusOK, rebalanceRunListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: rebalanceRunsResponse{
+			Kind:  "Rebalance run list",
+			Items: runs,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(runs)),
+				TotalItems:       int64(len(runs)),
+			},
+		},
+	})
+}
+
+// Get returns an echo handler
+// @Summary Rebalance.Get
+// @Description Get the report of a scheduling algorithm run
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param reruID path string true "Rebalance run ID" Format(uuid)
+// @Success 200 {object} handler.rebalanceRunGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/rebalance-runs/{reruID} [get]
+func (handler *RebalanceHandler) Get(c echo.Context) error {
+	reruID, err := uuid.FromString(c.Param("reruID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+
+	run, err := handler.get(tenantID(c), reruID)
+	if err != nil {
+		return handler.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, rebalanceRunGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: rebalanceRunResponse{
+			Kind: "Rebalance run get",
+			Item: run,
+		},
+	})
+}
+
+func (handler *RebalanceHandler) errorResponse(c echo.Context, err error) error {
+	if schedule.InvalidRebalance(err) {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Errors: []detailError{{
+				Domain:  "rebalance",
+				Reason:  "invalid",
+				Message: err.Error(),
+			}},
+		}})
+	}
+	return errors.Wrap(err, "Fail on rebalance run")
+}
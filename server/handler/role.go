@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	um "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
+)
+
+// RoleHandler service to manage roles and the permissions they grant
+type RoleHandler struct {
+	list   func() ([]um.Role, error)
+	get    func(roleID string) (*um.Role, error)
+	save   func(r *um.Role) (*um.Role, error)
+	delete func(roleID string) (*um.Role, error)
+}
+
+// List returns an echo handler
+// @Summary roles.List
+// @Description List the roles and their permissions
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Success 200 {object} handler.roleListResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/roles [get]
+func (handler *RoleHandler) List(c echo.Context) error {
+	rs, err := handler.list()
+	if err != nil {
+		return errors.Wrap(err, "Fail to list roles")
+	}
+	return c.JSON(http.StatusOK, roleListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: rolesResponse{
+			Kind:  "Role list",
+			Items: rs,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(rs)),
+				TotalItems:       int64(len(rs)),
+			},
+		},
+	})
+}
+
+// Get returns an echo handler
+// @Summary roles.Get
+// @Description Get a role and its permissions
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roleID path string true "role id"
+// @Success 200 {object} handler.roleGetResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/roles/{roleID} [get]
+func (handler *RoleHandler) Get(c echo.Context) error {
+	r, err := handler.get(c.Param("roleID"))
+	if err != nil {
+		if e, ok := roleError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to get role")
+	}
+	return c.JSON(http.StatusOK, roleGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: roleResponse{
+			Kind: "Role get",
+			Item: r,
+		},
+	})
+}
+
+// Save returns an echo handler
+// @Summary roles.Save
+// @Description Create a role or replace its description and permissions
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roleID path string true "role id"
+// @Param role body handler.roleForm true "Role data"
+// @Success 200 {object} handler.roleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/roles/{roleID} [put]
+func (handler *RoleHandler) Save(c echo.Context) error {
+	req := roleForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return errors.Wrap(err, "Wrong role parameters")
+	}
+	r, err := handler.save(&um.Role{
+		RoleID:      c.Param("roleID"),
+		Description: req.Description,
+		Permissions: req.Permissions,
+	})
+	if err != nil {
+		if e, ok := roleError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to save role")
+	}
+	return c.JSON(http.StatusOK, roleGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: roleResponse{
+			Kind: "Role saved",
+			Item: r,
+		},
+	})
+}
+
+// Delete returns an echo handler
+// @Summary roles.Delete
+// @Description Delete a role no user has
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roleID path string true "role id"
+// @Success 200 {object} handler.roleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/roles/{roleID} [delete]
+func (handler *RoleHandler) Delete(c echo.Context) error {
+	r, err := handler.delete(c.Param("roleID"))
+	if err != nil {
+		if e, ok := roleError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to delete role")
+	}
+	return c.JSON(http.StatusOK, roleGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: roleResponse{
+			Kind: "Role deleted",
+			Item: r,
+		},
+	})
+}
+
+// Permissions returns an echo handler
+// @Summary roles.Permissions
+// @Description List the permissions a role can be given
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Success 200 {object} handler.permissionListResponse
+// @Failure 401 {object} handler.errorResponse
+// @Router /api/permissions [get]
+func (handler *RoleHandler) Permissions(c echo.Context) error {
+	return c.JSON(http.StatusOK, permissionListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: permissionsResponse{
+			Kind:  "Permission list",
+			Items: perm.All,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(perm.All)),
+				TotalItems:       int64(len(perm.All)),
+			},
+		},
+	})
+}
+
+// roleError maps the validation errors, a missing role is a not found
+func roleError(err error) (generalError, bool) {
+	e, ok := errors.Cause(err).(*auth.ValidationError)
+	if !ok {
+		return generalError{}, false
+	}
+	ge := generalError{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid role",
+	}
+	for k, v := range e.Messages {
+		if k == "roleNotFound" {
+			ge.Code = http.StatusNotFound
+		}
+		ge.Errors = append(ge.Errors, detailError{
+			Domain:  "role",
+			Reason:  k,
+			Message: v,
+		})
+	}
+	return ge, true
+}
+
+// unauthorized is the response of routes whose permission is missing
+func unauthorized(c echo.Context) error {
+	return c.JSON(http.StatusUnauthorized, errorResponse{
+		Error: generalError{
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized",
+		},
+	})
+}
+
+type roleForm struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" example:"schedule:read:own"`
+}
+
+type roleResponse struct {
+	singleItemData
+	Item *um.Role `json:"item"`
+	Kind string   `json:"kind"`
+}
+
+type roleGetResponse struct {
+	dataResponse
+	Data roleResponse `json:"data"`
+}
+
+type rolesResponse struct {
+	collectionItemData
+	Items []um.Role `json:"items"`
+	Kind  string    `json:"kind"`
+}
+
+type roleListResponse struct {
+	dataResponse
+	Data rolesResponse `json:"data"`
+}
+
+type permissionsResponse struct {
+	collectionItemData
+	Items []string `json:"items"`
+	Kind  string   `json:"kind"`
+}
+
+type permissionListResponse struct {
+	dataResponse
+	Data permissionsResponse `json:"data"`
+}
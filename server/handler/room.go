@@ -15,11 +15,15 @@ import (
 type RoomHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	create       func(*m.Room) (*m.Room, error)
-	update       func(*m.Room) (*m.Room, error)
-	delete       func(roomID uuid.UUID) (*m.Room, error)
-	list         func(m.FilterRoom) ([]m.Room, error)
-	get          func(roomID uuid.UUID) (*m.Room, error)
+	create       func(uuid.UUID, *m.Room) (*m.Room, error)
+	update       func(uuid.UUID, *m.Room) (*m.Room, error)
+	delete       func(instID, roomID uuid.UUID) (*m.Room, error)
+	list         func(uuid.UUID, m.FilterRoom) ([]m.Room, error)
+	get          func(instID, roomID uuid.UUID) (*m.Room, error)
+	// maintenance windows of a room
+	createMaintenance func(instID, roomID uuid.UUID, actorID *uuid.UUID, mai *m.RoomMaintenance) (*m.RoomMaintenanceReport, error)
+	listMaintenance   func(instID, roomID uuid.UUID, f m.FilterRoomMaintenance) ([]m.RoomMaintenance, error)
+	deleteMaintenance func(instID, roomID, rmaiID uuid.UUID) (*m.RoomMaintenance, error)
 }
 
 type roomResponse struct {
@@ -72,7 +76,7 @@ func (handler *RoomHandler) Create(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	rom, err := handler.create(&req)
+	rom, err := handler.create(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to create new Room")
 	}
@@ -112,7 +116,7 @@ func (handler *RoomHandler) Update(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	rom, err := handler.update(&req)
+	rom, err := handler.update(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to update Room")
 	}
@@ -144,7 +148,7 @@ func (handler *RoomHandler) Delete(c echo.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "Error uuid format")
 	}
-	rom, err := handler.delete(roomID)
+	rom, err := handler.delete(tenantID(c), roomID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete Room")
 	}
@@ -177,7 +181,7 @@ func (handler *RoomHandler) Get(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	rom, err := handler.get(roomID)
+	rom, err := handler.get(tenantID(c), roomID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Rooms")
 	}
@@ -211,7 +215,7 @@ func (handler *RoomHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	rom, err := handler.list(f)
+	rom, err := handler.list(tenantID(c), f)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Rooms")
 	}
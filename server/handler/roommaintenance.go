@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+type roomMaintenanceReportResponse struct {
+	Item *m.RoomMaintenanceReport `json:"item"`
+	Kind string                   `json:"kind"`
+}
+
+type roomMaintenanceCreateResponse struct {
+	dataResponse
+	Data roomMaintenanceReportResponse `json:"data"`
+}
+
+type roomMaintenanceResponse struct {
+	Item *m.RoomMaintenance `json:"item"`
+	Kind string             `json:"kind"`
+}
+
+type roomMaintenanceDeleteResponse struct {
+	dataResponse
+	Data roomMaintenanceResponse `json:"data"`
+}
+
+type roomMaintenancesResponse struct {
+	collectionItemData
+	Items []m.RoomMaintenance `json:"items"`
+	Kind  string              `json:"kind"`
+}
+
+type roomMaintenanceListResponse struct {
+	dataResponse
+	Data roomMaintenancesResponse `json:"data"`
+}
+
+// CreateMaintenance returns an echo handler
+// @Summary Room.CreateMaintenance
+// @Description Block a Room for maintenance between two times. The Schedules within it are moved to other rooms and their doctors notified, the ones that can't be moved are listed
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roomID path string true "Room ID" Format(uuid)
+// @Param maintenance body models.RoomMaintenance true "reason, startAt and endAt of the maintenance"
+// @Success 200 {object} handler.roomMaintenanceCreateResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/rooms/{roomID}/maintenance [post]
+func (handler *RoomHandler) CreateMaintenance(c echo.Context) error {
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	roomID, err := uuid.FromString(c.Param("roomID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	req := m.RoomMaintenance{}
+	err = c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	report, err := handler.createMaintenance(tenantID(c), roomID, &actorID, &req)
+	if err != nil {
+		return maintenanceErrorResponse(c, err, "Fail to create Room maintenance")
+	}
+	return c.JSON(http.StatusOK, roomMaintenanceCreateResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: roomMaintenanceReportResponse{
+			Kind: "Room maintenance created",
+			Item: report,
+		},
+	})
+}
+
+// ListMaintenance returns an echo handler
+// @Summary Room.ListMaintenance
+// @Description List the maintenance of a Room
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roomID path string true "Room ID" Format(uuid)
+// @Param from query string false "maintenance ending after, like 2006-01-02"
+// @Param to query string false "maintenance starting before, like 2006-01-02"
+// @Success 200 {object} handler.roomMaintenanceListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/rooms/{roomID}/maintenance [get]
+func (handler *RoomHandler) ListMaintenance(c echo.Context) error {
+	roomID, err := uuid.FromString(c.Param("roomID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	f := m.FilterRoomMaintenance{}
+	if from := c.QueryParam("from"); len(from) > 0 {
+		d, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse from")
+		}
+		f.From = &d
+	}
+	if to := c.QueryParam("to"); len(to) > 0 {
+		d, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse to")
+		}
+		f.To = &d
+	}
+
+	mais, err := handler.listMaintenance(tenantID(c), roomID, f)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list Room maintenance")
+	}
+	return c.JSON(http.StatusOK, roomMaintenanceListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: roomMaintenancesResponse{
+			Kind:  "Room maintenance list",
+			Items: mais,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(mais)),
+				TotalItems:       int64(len(mais)),
+			},
+		},
+	})
+}
+
+// DeleteMaintenance returns an echo handler
+// @Summary Room.DeleteMaintenance
+// @Description End the maintenance of a Room, the Schedules it moved stay in their new rooms
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roomID path string true "Room ID" Format(uuid)
+// @Param rmaiID path string true "Room maintenance ID" Format(uuid)
+// @Success 200 {object} handler.roomMaintenanceDeleteResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/rooms/{roomID}/maintenance/{rmaiID} [delete]
+func (handler *RoomHandler) DeleteMaintenance(c echo.Context) error {
+	roomID, err := uuid.FromString(c.Param("roomID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	rmaiID, err := uuid.FromString(c.Param("rmaiID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	mai, err := handler.deleteMaintenance(tenantID(c), roomID, rmaiID)
+	if err != nil {
+		return maintenanceErrorResponse(c, err, "Fail to delete Room maintenance")
+	}
+	return c.JSON(http.StatusOK, roomMaintenanceDeleteResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: roomMaintenanceResponse{
+			Kind: "Room maintenance deleted",
+			Item: mai,
+		},
+	})
+}
+
+func maintenanceErrorResponse(c echo.Context, err error, msg string) error {
+	if schedule.InvalidMaintenance(err) {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Errors: []detailError{{
+				Domain:  "maintenance",
+				Reason:  "invalid",
+				Message: err.Error(),
+			}},
+		}})
+	}
+	return errors.Wrap(err, msg)
+}
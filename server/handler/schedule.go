@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 
 	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule"
 
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
@@ -19,16 +20,29 @@ import (
 type ScheduleHandler struct {
 	rolesCtxKey     string
 	claimsCtxKey    string
-	create          func(*m.Schedule) (*m.Schedule, error)
-	update          func(*m.Schedule) (*m.Schedule, error)
-	updateSchedule  func(*m.Schedule) (*m.Schedule, error)
-	delete          func(scheID uuid.UUID, doctID *uuid.UUID) (*m.Schedule, error)
-	updateDelete    func(scheID uuid.UUID) (*m.Schedule, error)
-	list            func(doctID *uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error)
-	get             func(doctID *uuid.UUID, scheID uuid.UUID) (*m.Schedule, error)
-	calendar        func(doctID *uuid.UUID, f m.FilterCalendar) ([]m.Calendar, error)
-	outdoor         func(roomID uuid.UUID) (*m.Outdoor, error)
+	create          func(uuid.UUID, *m.Schedule) (*m.Schedule, error)
+	update          func(uuid.UUID, *m.Schedule, *uuid.UUID) (*m.Schedule, error)
+	updateSchedule  func(uuid.UUID, *m.Schedule, *uuid.UUID) (*m.Schedule, error)
+	cancel          func(instID, scheID uuid.UUID, doctID, actorID *uuid.UUID, req m.CancelRequest) (*m.ScheduleCancellation, error)
+	cancellations   func(instID uuid.UUID, doctID *uuid.UUID, f m.FilterScheduleCancellation) ([]m.ScheduleCancellation, error)
+	list            func(instID uuid.UUID, doctID *uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error)
+	get             func(instID uuid.UUID, doctID *uuid.UUID, scheID uuid.UUID) (*m.Schedule, error)
+	calendar        func(instID uuid.UUID, doctID *uuid.UUID, f m.FilterCalendar) ([]m.Calendar, error)
+	outdoor         func(instID, roomID uuid.UUID) (*m.Outdoor, error)
 	getErrorMessage func(error) generalError
+	// dry-run of create
+	quote func(uuid.UUID, *m.Schedule) (*m.ScheduleQuote, error)
+	// lifecycle of a Schedule
+	changeStatus  func(instID, scheID uuid.UUID, actorID *uuid.UUID, req m.StatusChangeRequest) (*m.Schedule, error)
+	approve       func(instID, scheID uuid.UUID, actorID *uuid.UUID, approve bool, note string) (*m.Schedule, error)
+	approvalQueue func(instID uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error)
+	statusHistory func(instID uuid.UUID, doctID *uuid.UUID, scheID uuid.UUID) ([]m.ScheduleStatusChange, error)
+	// actual use of a Schedule
+	checkIn      func(instID, scheID uuid.UUID, doctID, actorID *uuid.UUID) (*m.Schedule, error)
+	checkOut     func(instID, scheID uuid.UUID, doctID, actorID *uuid.UUID) (*m.Schedule, error)
+	roomCheckIn  func(instID, roomID uuid.UUID) (*m.Schedule, error)
+	roomCheckOut func(instID, roomID uuid.UUID) (*m.Schedule, error)
+	usage        func(instID uuid.UUID, doctID *uuid.UUID, f m.FilterUsage) (*m.UsageReport, error)
 }
 
 type scheduleResponse struct {
@@ -40,6 +54,37 @@ type scheduleGetResponse struct {
 	dataResponse
 	Data scheduleResponse `json:"data"`
 }
+
+type scheduleCancellationResponse struct {
+	Item *m.ScheduleCancellation `json:"item"`
+	Kind string                  `json:"kind"`
+}
+
+type scheduleCancellationGetResponse struct {
+	dataResponse
+	Data scheduleCancellationResponse `json:"data"`
+}
+
+type scheduleCancellationsResponse struct {
+	collectionItemData
+	Items []m.ScheduleCancellation `json:"items"`
+	Kind  string                   `json:"kind"`
+}
+
+type scheduleCancellationListResponse struct {
+	dataResponse
+	Data scheduleCancellationsResponse `json:"data"`
+}
+
+type scheduleQuoteResponse struct {
+	Item *m.ScheduleQuote `json:"item"`
+	Kind string           `json:"kind"`
+}
+
+type scheduleQuoteGetResponse struct {
+	dataResponse
+	Data scheduleQuoteResponse `json:"data"`
+}
 type outdoorResponse struct {
 	Item *m.Outdoor `json:"item"`
 	Kind string     `json:"kind"`
@@ -93,6 +138,7 @@ type calendarListResponse struct {
 // @Failure 400 {object} handler.errorResponse
 // @Failure 401 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/schedules [post]
 func (handler *ScheduleHandler) Create(c echo.Context) error {
@@ -101,16 +147,22 @@ func (handler *ScheduleHandler) Create(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleWriteAny)
 	if err != nil {
 		return err
 	}
+	// a doctor requests the Schedule, it waits for approval when its plan needs it
+	req.Status = ""
 	if doctID != nil {
 		req.DoctID = *doctID
+		req.Status = schedule.StatusRequested
 	}
 
-	sch, err := handler.create(&req)
+	sch, err := handler.create(tenantID(c), &req)
 	if err != nil {
+		if e := schedule.RuleBroken(err); e != nil {
+			return ruleErrorResponse(c, e)
+		}
 		return c.JSON(http.StatusInternalServerError, errorResponse{
 			Error: handler.getErrorMessage(err),
 		})
@@ -126,6 +178,53 @@ func (handler *ScheduleHandler) Create(c echo.Context) error {
 	})
 }
 
+// Quote returns an echo handler
+// @Summary Schedule.Quote
+// @Description Run the rules and the room choice of Schedule.Create without booking, returning the room, the transition times around it and the preferences that weren't met
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param Schedule body models.Schedule true "Schedule to quote"
+// @Success 200 {object} handler.scheduleQuoteGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedules/quote [post]
+func (handler *ScheduleHandler) Quote(c echo.Context) error {
+	req := m.Schedule{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleWriteAny)
+	if err != nil {
+		return err
+	}
+	if doctID != nil {
+		req.DoctID = *doctID
+	}
+
+	q, err := handler.quote(tenantID(c), &req)
+	if err != nil {
+		if e := schedule.RuleBroken(err); e != nil {
+			return ruleErrorResponse(c, e)
+		}
+		return c.JSON(http.StatusInternalServerError, errorResponse{
+			Error: handler.getErrorMessage(err),
+		})
+	}
+	return c.JSON(http.StatusOK, scheduleQuoteGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleQuoteResponse{
+			Kind: "Schedule quote",
+			Item: q,
+		},
+	})
+}
+
 // Update returns an echo handler
 // @Summary Schedule.Update
 // @Description Update Schedule
@@ -137,6 +236,7 @@ func (handler *ScheduleHandler) Create(c echo.Context) error {
 // @Success 200 {object} handler.scheduleGetResponse
 // @Failure 400 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/schedules/{scheID} [put]
 func (handler *ScheduleHandler) Update(c echo.Context) error {
@@ -146,7 +246,7 @@ func (handler *ScheduleHandler) Update(c echo.Context) error {
 		return err
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleWriteAny)
 	if err != nil {
 		return err
 	}
@@ -159,8 +259,11 @@ func (handler *ScheduleHandler) Update(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	doc, err := handler.update(&req)
+	doc, err := handler.update(tenantID(c), &req, doctID)
 	if err != nil {
+		if e := schedule.RuleBroken(err); e != nil {
+			return ruleErrorResponse(c, e)
+		}
 		return errors.Wrap(err, "Fail to update Schedule")
 	}
 	return c.JSON(http.StatusOK, scheduleGetResponse{
@@ -176,7 +279,7 @@ func (handler *ScheduleHandler) Update(c echo.Context) error {
 
 // UpdateSchedule returns an echo handler
 // @Summary Schedule.UpdateSchedule
-// @Description UpdateSchedule Schedule
+// @Description UpdateSchedule Schedule, deletedAt is ignored as a Schedule is cancelled only through Schedule.Cancel
 // @Accept  json
 // @Produce  json
 // @Param context query string false "Context to return"
@@ -185,6 +288,7 @@ func (handler *ScheduleHandler) Update(c echo.Context) error {
 // @Success 200 {object} handler.scheduleGetResponse
 // @Failure 400 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/schedules/{scheID}/schedule [put]
 func (handler *ScheduleHandler) UpdateSchedule(c echo.Context) error {
@@ -193,7 +297,7 @@ func (handler *ScheduleHandler) UpdateSchedule(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleWriteAny)
 	if err != nil {
 		return err
 	}
@@ -206,8 +310,11 @@ func (handler *ScheduleHandler) UpdateSchedule(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	doc, err := handler.updateSchedule(&req)
+	doc, err := handler.updateSchedule(tenantID(c), &req, doctID)
 	if err != nil {
+		if e := schedule.RuleBroken(err); e != nil {
+			return ruleErrorResponse(c, e)
+		}
 		return errors.Wrap(err, "Fail to update Schedule")
 	}
 	return c.JSON(http.StatusOK, scheduleGetResponse{
@@ -223,7 +330,7 @@ func (handler *ScheduleHandler) UpdateSchedule(c echo.Context) error {
 
 // Delete Schedule returns an echo handler
 // @Summary Schedule.Delete
-// @Description delete Schedule
+// @Description Cancel a Schedule following the cancellation policy of its plan, as Schedule.Cancel without a reason
 // @Accept  json
 // @Produce  json
 // @Param context query string false "Context to return"
@@ -231,22 +338,16 @@ func (handler *ScheduleHandler) UpdateSchedule(c echo.Context) error {
 // @Success 200 {object} handler.scheduleDeleteResponse
 // @Failure 400 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/schedules/{scheID} [del]
 func (handler *ScheduleHandler) Delete(c echo.Context) error {
-	scheID, err := uuid.FromString(c.Param("scheID"))
-	if err != nil {
-		return errors.Wrap(err, "Error uuid format")
-	}
-
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	canc, err := handler.cancelSchedule(c, m.CancelRequest{})
 	if err != nil {
 		return err
 	}
-
-	doc, err := handler.delete(scheID, doctID)
-	if err != nil {
-		return errors.Wrap(err, "Fail to delete Schedule")
+	if canc == nil {
+		return nil
 	}
 	return c.JSON(http.StatusOK, scheduleDeleteResponse{
 		dataResponse: dataResponse{
@@ -254,14 +355,14 @@ func (handler *ScheduleHandler) Delete(c echo.Context) error {
 		},
 		Data: scheduleDelResponse{
 			Kind: "Schedule deleted",
-			Item: doc,
+			Item: canc.Schedule,
 		},
 	})
 }
 
 // UpdateDeleter Schedule returns an echo handler
 // @Summary Schedule.UpdateDelete
-// @Description updateDelete Schedule
+// @Description Cancel a Schedule following the cancellation policy of its plan, as Schedule.Cancel without a reason
 // @Accept  json
 // @Produce  json
 // @Param context query string false "Context to return"
@@ -269,25 +370,153 @@ func (handler *ScheduleHandler) Delete(c echo.Context) error {
 // @Success 200 {object} handler.scheduleDeleteResponse
 // @Failure 400 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/schedules/{scheID}/deletedAt [put]
 func (handler *ScheduleHandler) UpdateDeleter(c echo.Context) error {
+	return handler.Delete(c)
+}
+
+// Cancel Schedule returns an echo handler
+// @Summary Schedule.Cancel
+// @Description Cancel a Schedule. Cancelling after the cutoff of the policy of its plan, kept in the schedule-cancellation_policy config, is late: it's charged the fee and the hour credits of the policy, and refused once the doctor reached the late cancellations of the month. Only the clinic can waive the penalty
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param scheID path string true "Schedule ID" Format(uuid)
+// @Param request body models.CancelRequest true "reason of the cancellation"
+// @Success 200 {object} handler.scheduleCancellationGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedules/{scheID}/cancel [post]
+func (handler *ScheduleHandler) Cancel(c echo.Context) error {
+	req := m.CancelRequest{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	canc, err := handler.cancelSchedule(c, req)
+	if err != nil {
+		return err
+	}
+	if canc == nil {
+		return nil
+	}
+	return c.JSON(http.StatusOK, scheduleCancellationGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleCancellationResponse{
+			Kind: "Schedule cancelled",
+			Item: canc,
+		},
+	})
+}
+
+// cancelSchedule cancels the Schedule of the path, a nil cancellation means
+// the rule broken was already answered
+func (handler *ScheduleHandler) cancelSchedule(c echo.Context, req m.CancelRequest) (*m.ScheduleCancellation, error) {
 	scheID, err := uuid.FromString(c.Param("scheID"))
 	if err != nil {
-		return errors.Wrap(err, "Error uuid format")
+		return nil, errors.Wrap(err, "Error uuid format")
+	}
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleWriteAny)
+	if err != nil {
+		return nil, err
 	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't parse token")
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
 
-	doc, err := handler.updateDelete(scheID)
+	canc, err := handler.cancel(tenantID(c), scheID, doctID, &actorID, req)
 	if err != nil {
-		return errors.Wrap(err, "Fail to delete Schedule")
+		if e := schedule.RuleBroken(err); e != nil {
+			return nil, ruleErrorResponse(c, e)
+		}
+		return nil, errors.Wrap(err, "Fail to cancel Schedule")
 	}
-	return c.JSON(http.StatusOK, scheduleDeleteResponse{
+	return canc, nil
+}
+
+// Cancellations returns an echo handler
+// @Summary Schedule.Cancellations
+// @Description List the cancellations of the Schedules, newest first. A doctor sees only its own
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param doctID query string false "only the cancellations of a doctor"
+// @Param late query bool false "only the late cancellations, or only the free ones"
+// @Param from query string false "cancelled since, like 2006-01-02"
+// @Param to query string false "cancelled before, like 2006-01-02"
+// @Param limit query int false "page size, 50 by default"
+// @Param offset query int false "items to skip"
+// @Success 200 {object} handler.scheduleCancellationListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedule-cancellations [get]
+func (handler *ScheduleHandler) Cancellations(c echo.Context) error {
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleReadAny)
+	if err != nil {
+		return err
+	}
+	f := m.FilterScheduleCancellation{}
+	if d := c.QueryParam("doctID"); len(d) > 0 {
+		f.DoctID = &d
+	}
+	if late := c.QueryParam("late"); len(late) > 0 {
+		b, err := strconv.ParseBool(late)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse late")
+		}
+		f.Late = &b
+	}
+	if from := c.QueryParam("from"); len(from) > 0 {
+		d, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse from")
+		}
+		f.From = &d
+	}
+	if to := c.QueryParam("to"); len(to) > 0 {
+		d, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse to")
+		}
+		f.To = &d
+	}
+	if limit := c.QueryParam("limit"); len(limit) > 0 {
+		l, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse limit")
+		}
+		f.Limit = &l
+	}
+	if offset := c.QueryParam("offset"); len(offset) > 0 {
+		o, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse offset")
+		}
+		f.Offset = &o
+	}
+
+	cancs, err := handler.cancellations(tenantID(c), doctID, f)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list cancellations")
+	}
+	return c.JSON(http.StatusOK, scheduleCancellationListResponse{
 		dataResponse: dataResponse{
 			Context: c.QueryParam("context"),
 		},
-		Data: scheduleDelResponse{
-			Kind: "Schedule deleted",
-			Item: doc,
+		Data: scheduleCancellationsResponse{
+			Kind:  "Schedule cancellation list",
+			Items: cancs,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(cancs)),
+				TotalItems:       int64(len(cancs)),
+			},
 		},
 	})
 }
@@ -310,12 +539,12 @@ func (handler *ScheduleHandler) Get(c echo.Context) error {
 		return errors.Wrap(err, "Error uuid format")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleReadAny)
 	if err != nil {
 		return err
 	}
 
-	doc, err := handler.get(doctID, scheID)
+	doc, err := handler.get(tenantID(c), doctID, scheID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Schedules")
 	}
@@ -342,6 +571,8 @@ func (handler *ScheduleHandler) Get(c echo.Context) error {
 // @Param startAt query string false "Filter Schedules by type [startAt]"
 // @Param endAt query string false "Filter Schedules by type [endAt]"
 // @Param plan query string false "Filter Schedules by type [plan]"
+// @Param sersID query string false "Filter Schedules by type [sersID]"
+// @Param status query string false "statuses split by comma, the cancelled Schedules are left out when it's not sent"
 // @Success 200 {object} handler.schedulesListResponse
 // @Failure 400 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
@@ -353,14 +584,14 @@ func (handler *ScheduleHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleReadAny)
 	if err != nil {
 		return err
 	}
 
-	sch, err := handler.list(doctID, f)
+	sch, err := handler.list(tenantID(c), doctID, f)
 	if err != nil {
-		return errors.Wrap(err, "Fail to list of Schedule")
+		return statusErrorResponse(c, err, "Fail to list of Schedule")
 	}
 	return c.JSON(http.StatusOK, schedulesListResponse{
 		dataResponse: dataResponse{
@@ -383,6 +614,7 @@ func (handler *ScheduleHandler) List(c echo.Context) error {
 // @Accept  json
 // @Produce  json
 // @Param context query string false "Context to return"
+// @Param status query string false "statuses split by comma, the cancelled Schedules are left out when it's not sent"
 // @Success 200 {object} handler.calendarListResponse
 // @Failure 400 {object} handler.errorResponse
 // @Failure 404 {object} handler.errorResponse
@@ -393,13 +625,13 @@ func (handler *ScheduleHandler) Calendar(c echo.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
-	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey)
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleReadAny)
 	if err != nil {
 		return err
 	}
-	cal, err := handler.calendar(doctID, f)
+	cal, err := handler.calendar(tenantID(c), doctID, f)
 	if err != nil {
-		return errors.Wrap(err, "Fail to list of Schedule Calendar")
+		return statusErrorResponse(c, err, "Fail to list of Schedule Calendar")
 	}
 	return c.JSON(http.StatusOK, calendarListResponse{
 		dataResponse: dataResponse{
@@ -433,21 +665,8 @@ func (handler *ScheduleHandler) Outdoor(c echo.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "Couldn't parse token")
 	}*/
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	// User can get his own data
-	if !p.Can(perm.Outdoor) {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
 
-	i, err := handler.outdoor(roomID)
+	i, err := handler.outdoor(tenantID(c), roomID)
 	if err != nil {
 		return errors.Wrap(err, "Failed to get user")
 	}
@@ -462,6 +681,25 @@ func (handler *ScheduleHandler) Outdoor(c echo.Context) error {
 	})
 }
 
+// ruleErrorResponse answers the scheduling rule broken with its reason and
+// values, collisions with other schedules are a conflict
+func ruleErrorResponse(c echo.Context, e *schedule.RuleError) error {
+	status := http.StatusBadRequest
+	if e.Conflict() {
+		status = http.StatusConflict
+	}
+	return c.JSON(status, errorResponse{Error: generalError{
+		Code:    int64(status),
+		Message: e.Error(),
+		Errors: []detailError{{
+			Domain:  "schedule",
+			Reason:  e.Reason,
+			Message: e.Message,
+			Values:  e.Values,
+		}},
+	}})
+}
+
 /* buildFilterSchedule - Verifying params to method List */
 func buildFilterSchedule(QueryParam func(string) string) (m.FilterSchedule, error) {
 	f := m.FilterSchedule{}
@@ -477,6 +715,14 @@ func buildFilterSchedule(QueryParam func(string) string) (m.FilterSchedule, erro
 	if len(roomID) > 0 {
 		f.RoomID = &roomID
 	}
+	sersID := QueryParam("sersID")
+	if len(sersID) > 0 {
+		f.SersID = &sersID
+	}
+	status := QueryParam("status")
+	if len(status) > 0 {
+		f.Status = &status
+	}
 	ds := QueryParam("startAt")
 	if len(ds) > 0 {
 		dateFrom, err := time.Parse("2006-01-02", ds)
@@ -576,6 +822,10 @@ func buildFilterCalendar(QueryParam func(string) string) (m.FilterCalendar, erro
 	if len(patiID) > 0 {
 		f.PatiID = &patiID
 	}
+	status := QueryParam("status")
+	if len(status) > 0 {
+		f.Status = &status
+	}
 	l := QueryParam("limit")
 	if len(l) > 0 {
 		limit, err := strconv.ParseInt(l, 10, 64)
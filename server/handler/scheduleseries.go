@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
+)
+
+// ScheduleSeriesHandler service to create handler
+type ScheduleSeriesHandler struct {
+	rolesCtxKey     string
+	claimsCtxKey    string
+	create          func(uuid.UUID, *m.ScheduleSeries) (*m.ScheduleSeriesReport, error)
+	update          func(instID uuid.UUID, doctID *uuid.UUID, ch schedule.SeriesChange) (*m.ScheduleSeriesReport, error)
+	cancel          func(instID uuid.UUID, doctID, actorID *uuid.UUID, sersID uuid.UUID, req m.CancelRequest) (*m.ScheduleSeriesReport, error)
+	get             func(instID uuid.UUID, doctID *uuid.UUID, sersID uuid.UUID) (*m.ScheduleSeries, error)
+	getErrorMessage func(error) generalError
+}
+
+type seriesChangeForm struct {
+	// Scope of the change: this, following or all
+	Scope string `json:"scope" example:"following"`
+	// New times of the occurrence, the others move by the same amount
+	StartAt time.Time `json:"startAt"`
+	EndAt   time.Time `json:"endAt"`
+	// New rule, only for the following and all scopes
+	RRule *string        `json:"rrule" example:"FREQ=WEEKLY;BYDAY=TU;UNTIL=20261231"`
+	Plan  *string        `json:"plan"`
+	Info  types.JSONText `json:"info"`
+	// Waive the penalty of the occurrences the change cancels late, only for the clinic
+	Waive bool `json:"waive"`
+}
+
+type scheduleSeriesResponse struct {
+	Item *m.ScheduleSeries `json:"item"`
+	Kind string            `json:"kind"`
+}
+
+type scheduleSeriesGetResponse struct {
+	dataResponse
+	Data scheduleSeriesResponse `json:"data"`
+}
+
+type scheduleSeriesReportResponse struct {
+	Item *m.ScheduleSeriesReport `json:"item"`
+	Kind string                  `json:"kind"`
+}
+
+type scheduleSeriesReportGetResponse struct {
+	dataResponse
+	Data scheduleSeriesReportResponse `json:"data"`
+}
+
+// Create returns an echo handler
+// @Summary ScheduleSeries.Create
+// @Description Create a recurring Schedule, each occurrence of the rule gets a room like a single Schedule and the ones that can't are listed in unplaced
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param ScheduleSeries body models.ScheduleSeries true "Create new Schedule Series"
+// @Success 200 {object} handler.scheduleSeriesReportGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedule-series [post]
+func (handler *ScheduleSeriesHandler) Create(c echo.Context) error {
+	req := m.ScheduleSeries{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleWriteAny)
+	if err != nil {
+		return err
+	}
+	// a doctor requests the occurrences, they wait for approval when its plan needs it
+	req.Status = ""
+	if doctID != nil {
+		req.DoctID = *doctID
+		req.Status = schedule.StatusRequested
+	}
+
+	rep, err := handler.create(tenantID(c), &req)
+	if err != nil {
+		return handler.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, scheduleSeriesReportGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleSeriesReportResponse{
+			Kind: "Schedule Series",
+			Item: rep,
+		},
+	})
+}
+
+// Update returns an echo handler
+// @Summary ScheduleSeries.Update
+// @Description Edit an occurrence of the series, the occurrence and the following ones, or every occurrence not started yet. The occurrences that can't be moved are kept and listed in unplaced
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param sersID path string true "Schedule Series ID" Format(uuid)
+// @Param scheID path string true "Schedule ID of the occurrence" Format(uuid)
+// @Param change body handler.seriesChangeForm true "Schedule Series change"
+// @Success 200 {object} handler.scheduleSeriesReportGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedule-series/{sersID}/occurrences/{scheID} [put]
+func (handler *ScheduleSeriesHandler) Update(c echo.Context) error {
+	req := seriesChangeForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	sersID, err := uuid.FromString(c.Param("sersID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	scheID, err := uuid.FromString(c.Param("scheID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleWriteAny)
+	if err != nil {
+		return err
+	}
+
+	status := ""
+	if doctID != nil {
+		status = schedule.StatusRequested
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	rep, err := handler.update(tenantID(c), doctID, schedule.SeriesChange{
+		SersID:  sersID,
+		ScheID:  scheID,
+		Scope:   req.Scope,
+		StartAt: req.StartAt,
+		EndAt:   req.EndAt,
+		RRule:   req.RRule,
+		Plan:    req.Plan,
+		Info:    req.Info,
+		Status:  status,
+		ActorID: &actorID,
+		Waive:   req.Waive,
+	})
+	if err != nil {
+		return handler.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, scheduleSeriesReportGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleSeriesReportResponse{
+			Kind: "Schedule Series update",
+			Item: rep,
+		},
+	})
+}
+
+// Cancel returns an echo handler
+// @Summary ScheduleSeries.Cancel
+// @Description Cancel the series, the occurrences not started yet are cancelled following the cancellation policy of their plan, as Schedule.Cancel, and listed in placed
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param sersID path string true "Schedule Series ID" Format(uuid)
+// @Param request body models.CancelRequest false "reason of the cancellation"
+// @Success 200 {object} handler.scheduleSeriesReportGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedule-series/{sersID} [delete]
+func (handler *ScheduleSeriesHandler) Cancel(c echo.Context) error {
+	sersID, err := uuid.FromString(c.Param("sersID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	// the reason is optional, so is the body
+	req := m.CancelRequest{}
+	if c.Request().ContentLength != 0 {
+		err = c.Bind(&req)
+		if err != nil {
+			return err
+		}
+	}
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleWriteAny)
+	if err != nil {
+		return err
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	rep, err := handler.cancel(tenantID(c), doctID, &actorID, sersID, req)
+	if err != nil {
+		return handler.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, scheduleSeriesReportGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleSeriesReportResponse{
+			Kind: "Schedule Series cancelled",
+			Item: rep,
+		},
+	})
+}
+
+// Get returns an echo handler
+// @Summary ScheduleSeries.Get
+// @Description Get a Schedule Series, its occurrences are listed by /api/schedules?sersID=
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param sersID path string true "Schedule Series ID" Format(uuid)
+// @Success 200 {object} handler.scheduleSeriesGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedule-series/{sersID} [get]
+func (handler *ScheduleSeriesHandler) Get(c echo.Context) error {
+	sersID, err := uuid.FromString(c.Param("sersID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleReadAny)
+	if err != nil {
+		return err
+	}
+
+	ser, err := handler.get(tenantID(c), doctID, sersID)
+	if err != nil {
+		return handler.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, scheduleSeriesGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleSeriesResponse{
+			Kind: "Schedule Series get",
+			Item: ser,
+		},
+	})
+}
+
+func (handler *ScheduleSeriesHandler) errorResponse(c echo.Context, err error) error {
+	if e := schedule.RuleBroken(err); e != nil {
+		return ruleErrorResponse(c, e)
+	}
+	if schedule.InvalidSeries(err) {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Errors: []detailError{{
+				Domain:  "schedule-series",
+				Reason:  "invalid",
+				Message: err.Error(),
+			}},
+		}})
+	}
+	return c.JSON(http.StatusInternalServerError, errorResponse{
+		Error: handler.getErrorMessage(err),
+	})
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
+)
+
+type scheduleStatusChangesResponse struct {
+	collectionItemData
+	Items []m.ScheduleStatusChange `json:"items"`
+	Kind  string                   `json:"kind"`
+}
+
+type scheduleStatusChangeListResponse struct {
+	dataResponse
+	Data scheduleStatusChangesResponse `json:"data"`
+}
+
+// ChangeStatus returns an echo handler
+// @Summary Schedule.ChangeStatus
+// @Description Move a Schedule through its lifecycle: a confirmed Schedule goes in_use or no_show, and an in_use one completed. Cancelling follows Schedule.Cancel and approving the approval queue
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param scheID path string true "Schedule ID" Format(uuid)
+// @Param request body models.StatusChangeRequest true "status and note of the change"
+// @Success 200 {object} handler.scheduleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedules/{scheID}/status [put]
+func (handler *ScheduleHandler) ChangeStatus(c echo.Context) error {
+	scheID, err := uuid.FromString(c.Param("scheID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	req := m.StatusChangeRequest{}
+	err = c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	sch, err := handler.changeStatus(tenantID(c), scheID, &actorID, req)
+	if err != nil {
+		return statusErrorResponse(c, err, "Fail to change Schedule status")
+	}
+	return c.JSON(http.StatusOK, scheduleGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleResponse{
+			Kind: "Schedule status changed",
+			Item: sch,
+		},
+	})
+}
+
+// ApprovalQueue returns an echo handler
+// @Summary Schedule.ApprovalQueue
+// @Description List the requested Schedules waiting for approval that haven't started, soonest first. Doctors of the plans in the schedule-approval_plans config request their Schedules
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param doctID query string false "only the Schedules of a doctor"
+// @Param limit query int false "page size"
+// @Param offset query int false "items to skip"
+// @Success 200 {object} handler.schedulesListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedule-approvals [get]
+func (handler *ScheduleHandler) ApprovalQueue(c echo.Context) error {
+	f := m.FilterSchedule{}
+	if d := c.QueryParam("doctID"); len(d) > 0 {
+		f.DoctID = &d
+	}
+	if limit := c.QueryParam("limit"); len(limit) > 0 {
+		l, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse limit")
+		}
+		f.Limit = &l
+	}
+	if offset := c.QueryParam("offset"); len(offset) > 0 {
+		o, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "Failed to parse offset")
+		}
+		f.Offset = &o
+	}
+
+	sch, err := handler.approvalQueue(tenantID(c), f)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list approval queue")
+	}
+	return c.JSON(http.StatusOK, schedulesListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: schedulesResponse{
+			Kind:  "Schedule approval queue",
+			Items: sch,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(sch)),
+				TotalItems:       int64(len(sch)),
+			},
+		},
+	})
+}
+
+// Approve returns an echo handler
+// @Summary Schedule.Approve
+// @Description Confirm a requested Schedule and notify its doctor
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param scheID path string true "Schedule ID" Format(uuid)
+// @Param request body models.StatusChangeRequest false "note to the doctor"
+// @Success 200 {object} handler.scheduleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedules/{scheID}/approve [post]
+func (handler *ScheduleHandler) Approve(c echo.Context) error {
+	return handler.decide(c, true)
+}
+
+// Reject returns an echo handler
+// @Summary Schedule.Reject
+// @Description Cancel a requested Schedule, freeing its room, and notify its doctor
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param scheID path string true "Schedule ID" Format(uuid)
+// @Param request body models.StatusChangeRequest false "note to the doctor"
+// @Success 200 {object} handler.scheduleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedules/{scheID}/reject [post]
+func (handler *ScheduleHandler) Reject(c echo.Context) error {
+	return handler.decide(c, false)
+}
+
+// decide approves or rejects the requested Schedule of the path
+func (handler *ScheduleHandler) decide(c echo.Context, approve bool) error {
+	scheID, err := uuid.FromString(c.Param("scheID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	// the note is optional, so is the body
+	req := m.StatusChangeRequest{}
+	if c.Request().ContentLength != 0 {
+		err = c.Bind(&req)
+		if err != nil {
+			return err
+		}
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	sch, err := handler.approve(tenantID(c), scheID, &actorID, approve, req.Note)
+	if err != nil {
+		return statusErrorResponse(c, err, "Fail to decide Schedule request")
+	}
+	kind := "Schedule rejected"
+	if approve {
+		kind = "Schedule approved"
+	}
+	return c.JSON(http.StatusOK, scheduleGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleResponse{
+			Kind: kind,
+			Item: sch,
+		},
+	})
+}
+
+// StatusHistory returns an echo handler
+// @Summary Schedule.StatusHistory
+// @Description List the status changes of a Schedule, oldest first
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param scheID path string true "Schedule ID" Format(uuid)
+// @Success 200 {object} handler.scheduleStatusChangeListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedules/{scheID}/status-history [get]
+func (handler *ScheduleHandler) StatusHistory(c echo.Context) error {
+	scheID, err := uuid.FromString(c.Param("scheID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleReadAny)
+	if err != nil {
+		return err
+	}
+
+	changes, err := handler.statusHistory(tenantID(c), doctID, scheID)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list Schedule status history")
+	}
+	return c.JSON(http.StatusOK, scheduleStatusChangeListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleStatusChangesResponse{
+			Kind:  "Schedule status history",
+			Items: changes,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(changes)),
+				TotalItems:       int64(len(changes)),
+			},
+		},
+	})
+}
+
+// statusErrorResponse answers an unknown status as a bad request and a
+// transition not allowed as a rule broken
+func statusErrorResponse(c echo.Context, err error, msg string) error {
+	if schedule.InvalidStatus(err) {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Errors: []detailError{{
+				Domain:  "schedule",
+				Reason:  "invalid_status",
+				Message: err.Error(),
+			}},
+		}})
+	}
+	if e := schedule.RuleBroken(err); e != nil {
+		return ruleErrorResponse(c, e)
+	}
+	return errors.Wrap(err, msg)
+}
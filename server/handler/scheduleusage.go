@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
+)
+
+type scheduleUsageResponse struct {
+	Item *m.UsageReport `json:"item"`
+	Kind string         `json:"kind"`
+}
+
+type scheduleUsageGetResponse struct {
+	dataResponse
+	Data scheduleUsageResponse `json:"data"`
+}
+
+// CheckIn returns an echo handler
+// @Summary Schedule.CheckIn
+// @Description Start the use of a Schedule, saving the actual start. The check-in opens before the start by the check_in_early_minutes of the schedule-usage config and closes at the end, a doctor arriving after being marked as a no-show still checks in. A doctor checks in only its own Schedules
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param scheID path string true "Schedule ID" Format(uuid)
+// @Success 200 {object} handler.scheduleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedules/{scheID}/check-in [post]
+func (handler *ScheduleHandler) CheckIn(c echo.Context) error {
+	return handler.check(c, handler.checkIn, "Schedule checked in")
+}
+
+// CheckOut returns an echo handler
+// @Summary Schedule.CheckOut
+// @Description End the use of a Schedule, saving the actual end. A check-out after the end is an overstay, flagged as transitionExceeded when it also runs past the transition window. A doctor checks out only its own Schedules
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param scheID path string true "Schedule ID" Format(uuid)
+// @Success 200 {object} handler.scheduleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedules/{scheID}/check-out [post]
+func (handler *ScheduleHandler) CheckOut(c echo.Context) error {
+	return handler.check(c, handler.checkOut, "Schedule checked out")
+}
+
+// check runs the check-in or the check-out of the Schedule of the path
+func (handler *ScheduleHandler) check(c echo.Context, run func(instID, scheID uuid.UUID, doctID, actorID *uuid.UUID) (*m.Schedule, error), kind string) error {
+	scheID, err := uuid.FromString(c.Param("scheID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleCheckIn)
+	if err != nil {
+		return err
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	actorID := uuid.FromStringOrNil(claims.UserID)
+
+	sch, err := run(tenantID(c), scheID, doctID, &actorID)
+	if err != nil {
+		return statusErrorResponse(c, err, "Fail to check Schedule")
+	}
+	return c.JSON(http.StatusOK, scheduleGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleResponse{
+			Kind: kind,
+			Item: sch,
+		},
+	})
+}
+
+// RoomCheckIn returns an echo handler
+// @Summary Schedule.RoomCheckIn
+// @Description Check in, from the display of a room, the Schedule of the room whose check-in is open
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roomID path string true "Room ID" Format(uuid)
+// @Success 200 {object} handler.scheduleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /device/outdoor/{roomID}/check-in [post]
+func (handler *ScheduleHandler) RoomCheckIn(c echo.Context) error {
+	return handler.roomCheck(c, handler.roomCheckIn, "Schedule checked in")
+}
+
+// RoomCheckOut returns an echo handler
+// @Summary Schedule.RoomCheckOut
+// @Description Check out, from the display of a room, the Schedule in use in the room
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param roomID path string true "Room ID" Format(uuid)
+// @Success 200 {object} handler.scheduleGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 409 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /device/outdoor/{roomID}/check-out [post]
+func (handler *ScheduleHandler) RoomCheckOut(c echo.Context) error {
+	return handler.roomCheck(c, handler.roomCheckOut, "Schedule checked out")
+}
+
+// roomCheck runs the check-in or the check-out of the room of the path
+func (handler *ScheduleHandler) roomCheck(c echo.Context, run func(instID, roomID uuid.UUID) (*m.Schedule, error), kind string) error {
+	roomID, err := uuid.FromString(c.Param("roomID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	sch, err := run(tenantID(c), roomID)
+	if err != nil {
+		return statusErrorResponse(c, err, "Fail to check room Schedule")
+	}
+	return c.JSON(http.StatusOK, scheduleGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleResponse{
+			Kind: kind,
+			Item: sch,
+		},
+	})
+}
+
+// Usage returns an echo handler
+// @Summary Schedule.Usage
+// @Description Compare by doctor the booked and the actual use of the Schedules starting between two local days: the Schedules used, in use and no-shows, the minutes booked and used, the minutes late to check in and the overstays. A doctor sees only its own
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param fromDate query string false "first day, like 2006-01-02, the first of the month by default"
+// @Param toDate query string false "last day, like 2006-01-02, a month from fromDate by default"
+// @Param doctID query string false "only the Schedules of a doctor"
+// @Param roomID query string false "only the Schedules of a room"
+// @Success 200 {object} handler.scheduleUsageGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/schedule-usage [get]
+func (handler *ScheduleHandler) Usage(c echo.Context) error {
+	doctID, err := doctIDOrNil(c, handler.claimsCtxKey, handler.rolesCtxKey, perm.ScheduleReadAny)
+	if err != nil {
+		return err
+	}
+	f := m.FilterUsage{}
+	if d := c.QueryParam("fromDate"); len(d) > 0 {
+		f.FromDate = &d
+	}
+	if d := c.QueryParam("toDate"); len(d) > 0 {
+		f.ToDate = &d
+	}
+	if d := c.QueryParam("doctID"); len(d) > 0 {
+		f.DoctID = &d
+	}
+	if r := c.QueryParam("roomID"); len(r) > 0 {
+		f.RoomID = &r
+	}
+
+	report, err := handler.usage(tenantID(c), doctID, f)
+	if err != nil {
+		if schedule.InvalidUsage(err) {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: generalError{
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+				Errors: []detailError{{
+					Domain:  "usage",
+					Reason:  "invalid",
+					Message: err.Error(),
+				}},
+			}})
+		}
+		return errors.Wrap(err, "Fail to report Schedule usage")
+	}
+	return c.JSON(http.StatusOK, scheduleUsageGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: scheduleUsageResponse{
+			Kind: "Schedule usage",
+			Item: report,
+		},
+	})
+}
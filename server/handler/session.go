@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	um "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// SessionHandler service to handle the sessions of the logged user
+type SessionHandler struct {
+	claimsCtxKey string
+	list         func(userID uuid.UUID) ([]um.Session, error)
+	revoke       func(userID, sessID uuid.UUID) error
+	logoutAll    func(userID uuid.UUID) error
+}
+
+// List returns an echo handler
+// @Summary sessions.List
+// @Description List the active sessions of the logged user
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Success 200 {object} handler.sessionListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/sessions [get]
+func (handler *SessionHandler) List(c echo.Context) error {
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	s, err := handler.list(uuid.FromStringOrNil(claims.UserID))
+	if err != nil {
+		return errors.Wrap(err, "Fail to list sessions")
+	}
+	items := make([]sessionItem, len(s))
+	for i := range s {
+		items[i] = sessionItem{Session: s[i], Current: s[i].SessID.String() == claims.SessID}
+	}
+	return c.JSON(http.StatusOK, sessionListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: sessionsResponse{
+			Kind:  "Session list",
+			Items: items,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(items)),
+				TotalItems:       int64(len(items)),
+			},
+		},
+	})
+}
+
+// Revoke returns an echo handler
+// @Summary sessions.Revoke
+// @Description Revoke a session of the logged user
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param sessID path string true "session to revoke" Format(uuid)
+// @Success 200 {object} handler.authResetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/sessions/{sessID} [delete]
+func (handler *SessionHandler) Revoke(c echo.Context) error {
+	sessID, err := uuid.FromString(c.Param("sessID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	err = handler.revoke(uuid.FromStringOrNil(claims.UserID), sessID)
+	if err != nil {
+		if e, ok := signinError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to revoke session")
+	}
+	return c.JSON(http.StatusOK, authResetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: recoverResponse{
+			Kind: "empty",
+		},
+	})
+}
+
+// LogoutAll returns an echo handler
+// @Summary auth.logoutAll
+// @Description Revoke every session of the logged user
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Success 200 {object} handler.authResetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/auth/logout-all [post]
+func (handler *SessionHandler) LogoutAll(c echo.Context) error {
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	err = handler.logoutAll(uuid.FromStringOrNil(claims.UserID))
+	if err != nil {
+		return errors.Wrap(err, "Fail to logout sessions")
+	}
+	return c.JSON(http.StatusOK, authResetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: recoverResponse{
+			Kind: "empty",
+		},
+	})
+}
+
+// sessionMiddleware rejects tokens whose session was revoked or expired
+func sessionMiddleware(check func(userID, sessID string) error, claimsCtxKey string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, err := auth.Extract(c.Get(claimsCtxKey))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token")
+			}
+			err = check(claims.UserID, claims.SessID)
+			if err != nil {
+				if e, ok := signinError(err); ok {
+					return c.JSON(int(e.Code), errorResponse{Error: e})
+				}
+				return errors.Wrap(err, "Fail to check session")
+			}
+			return next(c)
+		}
+	}
+}
+
+// passwordChangeMiddleware only lets users that must change their password
+// reach the allowed routes
+func passwordChangeMiddleware(claimsCtxKey string, allowed ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, err := auth.Extract(c.Get(claimsCtxKey))
+			if err != nil || !claims.PasswordChange {
+				return next(c)
+			}
+			for _, p := range allowed {
+				if c.Path() == p {
+					return next(c)
+				}
+			}
+			return c.JSON(http.StatusForbidden, errorResponse{Error: generalError{
+				Code:    http.StatusForbidden,
+				Message: "Password change required",
+				Errors: []detailError{{
+					Domain:  "auth",
+					Reason:  "passwordChangeRequired",
+					Message: "The password must be changed before using the API",
+				}},
+			}})
+		}
+	}
+}
+
+type sessionItem struct {
+	um.Session
+	// Session of the token used in the request
+	Current bool `json:"current"`
+}
+
+type sessionsResponse struct {
+	collectionItemData
+	Items []sessionItem `json:"items"`
+	Kind  string        `json:"kind"`
+}
+
+type sessionListResponse struct {
+	dataResponse
+	Data sessionsResponse `json:"data"`
+}
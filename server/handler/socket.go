@@ -28,6 +28,6 @@ func (handler *ChatHandler) Chat(c echo.Context) error {
 		return errors.Wrap(err, "Couldn't parse token")
 	}
 
-	chat.ServeWs(handler.hub, claims.UserID, c.Response(), c.Request())
+	chat.ServeWs(handler.hub, claims.UserID, claims.InstID, c.Response(), c.Request())
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/gofrs/uuid"
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
 
@@ -14,11 +15,11 @@ import (
 type SpecialtyHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	create       func(*m.Specialty) (*m.Specialty, error)
-	update       func(*m.Specialty) (*m.Specialty, error)
-	delete       func(specID int64) (*m.Specialty, error)
-	list         func(m.FilterSpecialty) ([]m.Specialty, error)
-	get          func(specID int64) (*m.Specialty, error)
+	create       func(uuid.UUID, *m.Specialty) (*m.Specialty, error)
+	update       func(uuid.UUID, *m.Specialty) (*m.Specialty, error)
+	delete       func(instID uuid.UUID, specID int64) (*m.Specialty, error)
+	list         func(uuid.UUID, m.FilterSpecialty) ([]m.Specialty, error)
+	get          func(instID uuid.UUID, specID int64) (*m.Specialty, error)
 }
 
 type specialtyResponse struct {
@@ -71,7 +72,7 @@ func (handler *SpecialtyHandler) Create(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	spe, err := handler.create(&req)
+	spe, err := handler.create(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to create new Specialty")
 	}
@@ -111,7 +112,7 @@ func (handler *SpecialtyHandler) Update(c echo.Context) error {
 		return errors.Wrap(err, "Error int64 format")
 	}
 
-	spe, err := handler.update(&req)
+	spe, err := handler.update(tenantID(c), &req)
 	if err != nil {
 		return errors.Wrap(err, "Fail to update Specialty")
 	}
@@ -143,7 +144,7 @@ func (handler *SpecialtyHandler) Delete(c echo.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "Error int64 format")
 	}
-	spe, err := handler.delete(specID)
+	spe, err := handler.delete(tenantID(c), specID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete Specialty")
 	}
@@ -176,7 +177,7 @@ func (handler *SpecialtyHandler) Get(c echo.Context) error {
 		return errors.Wrap(err, "Error int64 format")
 	}
 
-	spe, err := handler.get(specID)
+	spe, err := handler.get(tenantID(c), specID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Specialty")
 	}
@@ -210,7 +211,7 @@ func (handler *SpecialtyHandler) List(c echo.Context) error {
 		return errors.Wrap(err, "Failed to parse filter queries")
 	}
 
-	spe, err := handler.list(f)
+	spe, err := handler.list(tenantID(c), f)
 	if err != nil {
 		return errors.Wrap(err, "Fail to list of Specialtys")
 	}
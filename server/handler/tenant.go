@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// tenantCtxKey holds the institution the request is scoped to
+const tenantCtxKey = "tenant"
+
+// tenantMiddleware scopes the request to the institution of the token,
+// tokens without one are rejected
+func tenantMiddleware(claimsCtxKey string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, err := auth.Extract(c.Get(claimsCtxKey))
+			if err != nil {
+				return unauthorized(c)
+			}
+			instID, err := uuid.FromString(claims.InstID)
+			if err != nil || instID == uuid.Nil {
+				return unauthorized(c)
+			}
+			c.Set(tenantCtxKey, instID)
+			return next(c)
+		}
+	}
+}
+
+// tenantID returns the institution the request is scoped to
+func tenantID(c echo.Context) uuid.UUID {
+	instID, _ := c.Get(tenantCtxKey).(uuid.UUID)
+	return instID
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+
+	um "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+)
+
+// TwoFactorHandler service to manage the two factor authentication of the logged user
+type TwoFactorHandler struct {
+	claimsCtxKey string
+	enroll       func(userID uuid.UUID) (*um.TOTPEnrollment, error)
+	activate     func(userID uuid.UUID, code string) ([]string, error)
+	disable      func(userID uuid.UUID, code string) error
+	renewCodes   func(userID uuid.UUID, code string) ([]string, error)
+}
+
+// Enroll returns an echo handler
+// @Summary twoFactor.Enroll
+// @Description Start TOTP enrolment, returns the secret and provisioning uri
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Success 200 {object} handler.totpEnrollmentResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/me/2fa/enroll [post]
+func (handler *TwoFactorHandler) Enroll(c echo.Context) error {
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	en, err := handler.enroll(uuid.FromStringOrNil(claims.UserID))
+	if err != nil {
+		if e, ok := twoFactorError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to enroll two factor")
+	}
+	return c.JSON(http.StatusOK, totpEnrollmentResponse{
+		dataResponse: dataResponse{Context: c.QueryParam("context")},
+		Data: totpEnrollmentOut{
+			Kind: "TOTP enrollment",
+			Item: en,
+		},
+	})
+}
+
+// Activate returns an echo handler
+// @Summary twoFactor.Activate
+// @Description Enable TOTP with a code from the authenticator, returns the recovery codes
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param code body handler.totpCodeForm true "TOTP code"
+// @Success 200 {object} handler.recoveryCodesResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/me/2fa/activate [post]
+func (handler *TwoFactorHandler) Activate(c echo.Context) error {
+	req := totpCodeForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	codes, err := handler.activate(uuid.FromStringOrNil(claims.UserID), req.Code)
+	if err != nil {
+		if e, ok := twoFactorError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to activate two factor")
+	}
+	return c.JSON(http.StatusOK, recoveryCodesResponse{
+		dataResponse: dataResponse{Context: c.QueryParam("context")},
+		Data: recoveryCodesOut{
+			Kind: "Recovery codes",
+			Item: codes,
+		},
+	})
+}
+
+// Disable returns an echo handler
+// @Summary twoFactor.Disable
+// @Description Disable TOTP, not allowed for roles that require it
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param code body handler.totpCodeForm true "TOTP or recovery code"
+// @Success 200 {object} handler.authResetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/me/2fa/disable [post]
+func (handler *TwoFactorHandler) Disable(c echo.Context) error {
+	req := totpCodeForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	err = handler.disable(uuid.FromStringOrNil(claims.UserID), req.Code)
+	if err != nil {
+		if e, ok := twoFactorError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to disable two factor")
+	}
+	return c.JSON(http.StatusOK, authResetResponse{
+		dataResponse: dataResponse{Context: c.QueryParam("context")},
+		Data: recoverResponse{
+			Kind: "empty",
+		},
+	})
+}
+
+// RecoveryCodes returns an echo handler
+// @Summary twoFactor.RecoveryCodes
+// @Description Replace the recovery codes, the old ones stop working
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param code body handler.totpCodeForm true "TOTP code"
+// @Success 200 {object} handler.recoveryCodesResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/me/2fa/recovery-codes [post]
+func (handler *TwoFactorHandler) RecoveryCodes(c echo.Context) error {
+	req := totpCodeForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	codes, err := handler.renewCodes(uuid.FromStringOrNil(claims.UserID), req.Code)
+	if err != nil {
+		if e, ok := twoFactorError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to renew recovery codes")
+	}
+	return c.JSON(http.StatusOK, recoveryCodesResponse{
+		dataResponse: dataResponse{Context: c.QueryParam("context")},
+		Data: recoveryCodesOut{
+			Kind: "Recovery codes",
+			Item: codes,
+		},
+	})
+}
+
+// twoFactorError maps the validation errors to a bad request
+func twoFactorError(err error) (generalError, bool) {
+	e, ok := errors.Cause(err).(*auth.ValidationError)
+	if !ok {
+		return generalError{}, false
+	}
+	ge := generalError{
+		Code:    http.StatusBadRequest,
+		Message: "Two factor authentication error",
+	}
+	for k, v := range e.Messages {
+		ge.Errors = append(ge.Errors, detailError{
+			Domain:  "twoFactor",
+			Reason:  k,
+			Message: v,
+		})
+	}
+	return ge, true
+}
+
+type totpCodeForm struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+type recoveryCodesOut struct {
+	singleItemData
+	Item []string `json:"item"`
+	Kind string   `json:"kind"`
+}
+
+type recoveryCodesResponse struct {
+	dataResponse
+	Data recoveryCodesOut `json:"data"`
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
 	um "gitlab.com/falqon/inovantapp/backend/models"
+	"gitlab.com/falqon/inovantapp/backend/service/user"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 )
@@ -15,13 +16,19 @@ import (
 type UserHandler struct {
 	rolesCtxKey  string
 	claimsCtxKey string
-	list         func() ([]um.User, error)
-	get          func(uuid.UUID) (*um.User, error)
-	update       func(*um.User) (*um.User, error)
-	create       func(*um.User, string) (*um.User, error)
-	inactive     func(userID uuid.UUID) (*um.User, error)
-	active       func(userID uuid.UUID) (*um.User, error)
+	list         func(instID uuid.UUID) ([]um.User, error)
+	get          func(uuid.UUID, uuid.UUID) (*um.User, error)
+	update       func(uuid.UUID, *um.User) (*um.User, error)
+	create       func(uuid.UUID, *um.User, string) (*um.User, error)
+	inactive     func(instID, userID uuid.UUID) (*um.User, error)
+	active       func(instID, userID uuid.UUID) (*um.User, error)
 	setPushToken func(userID uuid.UUID, token string) error
+	unlock       func(instID, userID, actorID uuid.UUID) (*um.User, error)
+	listLockouts func(instID, userID uuid.UUID) ([]um.UserLockout, error)
+
+	changePassword        func(userID, sessID uuid.UUID, current, password string) (*user.AuthResponse, error)
+	requirePasswordChange func(instID, userID uuid.UUID) (*um.User, error)
+	rotateKey             func(instID, userID uuid.UUID) error
 }
 
 type UserCreateModel struct {
@@ -42,7 +49,7 @@ type UserCreateModel struct {
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/users [get]
 func (handler *UserHandler) List(c echo.Context) error {
-	u, err := handler.list()
+	u, err := handler.list(tenantID(c))
 	if err != nil {
 		return errors.Wrap(err, "Fail to list Users")
 	}
@@ -75,26 +82,7 @@ func (handler *UserHandler) List(c echo.Context) error {
 // @Router /api/users/{userID} [get]
 func (handler *UserHandler) Get(c echo.Context) error {
 	userID := uuid.FromStringOrNil(c.Param("userID"))
-	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse token")
-	}
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	// User can get his own data
-	isOwnData := claims.UserID == userID.String()
-	if !p.Can(perm.Admin) && !isOwnData {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
-
-	i, err := handler.get(userID)
+	i, err := handler.get(tenantID(c), userID)
 	if err != nil {
 		return errors.Wrap(err, "Failed to get user")
 	}
@@ -128,29 +116,25 @@ func (handler *UserHandler) Update(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	userID := uuid.FromStringOrNil(c.Param("userID"))
-	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse token")
-	}
+	req.UserID = uuid.FromStringOrNil(c.Param("userID"))
 	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
 	if err != nil {
 		return errors.Wrap(err, "Couldn't parse permissions")
 	}
-
-	// User can get his own data
-	isOwnData := claims.UserID == userID.String()
-	if !p.Can(perm.Admin) && !isOwnData {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
+	// Users changing their own data can't change their roles
+	if !p.Can(perm.UserWriteAny) {
+		cur, err := handler.get(tenantID(c), req.UserID)
+		if err != nil {
+			return errors.Wrap(err, "Failed to get user")
+		}
+		req.Roles = cur.Roles
 	}
 
-	i, err := handler.update(&req)
+	i, err := handler.update(tenantID(c), &req)
 	if err != nil {
+		if e, ok := roleError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
 		return errors.Wrap(err, "Fail to update user")
 	}
 	return c.JSON(http.StatusOK, userGetResponse{
@@ -178,26 +162,8 @@ func (handler *UserHandler) Update(c echo.Context) error {
 // @Failure 500 {object} handler.errorResponse
 // @Router /api/users [post]
 func (handler *UserHandler) Create(c echo.Context) error {
-	_, err := auth.Extract(c.Get("user"))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse token")
-	}
-
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	if !p.Can(perm.Admin) {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
-
 	req := UserCreateModel{}
-	err = c.Bind(&req)
+	err := c.Bind(&req)
 	user := um.User{
 		Email:    req.Email,
 		Password: []byte(req.Password),
@@ -207,8 +173,14 @@ func (handler *UserHandler) Create(c echo.Context) error {
 		return err
 	}
 
-	u, err := handler.create(&user, string(req.Password))
+	u, err := handler.create(tenantID(c), &user, string(req.Password))
 	if err != nil {
+		if e, ok := roleError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		if e, ok := passwordError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
 		return errors.Wrap(err, "Fail to create new user")
 	}
 	return c.JSON(http.StatusOK, userGetResponse{
@@ -236,26 +208,7 @@ func (handler *UserHandler) Create(c echo.Context) error {
 // @Router /api/users/{userID} [del]
 func (handler *UserHandler) Inactive(c echo.Context) error {
 	userID := uuid.FromStringOrNil(c.Param("userID"))
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse token")
-	}
-	// User can create new user
-	isOwnData := claims.UserID == userID.String()
-	if !p.Can(perm.Admin) && !isOwnData {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
-
-	u, err := handler.inactive(userID)
+	u, err := handler.inactive(tenantID(c), userID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete user")
 	}
@@ -284,26 +237,7 @@ func (handler *UserHandler) Inactive(c echo.Context) error {
 // @Router /api/users/active/{userID} [put]
 func (handler *UserHandler) Active(c echo.Context) error {
 	userID := uuid.FromStringOrNil(c.Param("userID"))
-	p, err := auth.ExtractPermissions(c.Get(handler.rolesCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse permissions")
-	}
-	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
-	if err != nil {
-		return errors.Wrap(err, "Couldn't parse token")
-	}
-	// User can create new user
-	isOwnData := claims.UserID == userID.String()
-	if !p.Can(perm.Admin) && !isOwnData {
-		return c.JSON(http.StatusUnauthorized, errorResponse{
-			Error: generalError{
-				Code:    http.StatusUnauthorized,
-				Message: "Unauthorized",
-			},
-		})
-	}
-
-	u, err := handler.active(userID)
+	u, err := handler.active(tenantID(c), userID)
 	if err != nil {
 		return errors.Wrap(err, "Fail to delete user")
 	}
@@ -357,6 +291,193 @@ func (handler *UserHandler) SetPushToken(c echo.Context) error {
 	})
 }
 
+// Unlock user returns an echo handler
+// @Summary users.Unlock
+// @Description Unlock an user account locked by failed sign ins
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param userID path string true "user to unlock" Format(uuid)
+// @Success 200 {object} handler.userGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/users/{userID}/unlock [put]
+func (handler *UserHandler) Unlock(c echo.Context) error {
+	userID, err := uuid.FromString(c.Param("userID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	u, err := handler.unlock(tenantID(c), userID, uuid.FromStringOrNil(claims.UserID))
+	if err != nil {
+		return errors.Wrap(err, "Fail to unlock user")
+	}
+	return c.JSON(http.StatusOK, userGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: userResponse{
+			Kind: "User unlocked",
+			Item: u,
+		},
+	})
+}
+
+// RotateKey returns an echo handler
+// @Summary users.RotateKey
+// @Description Rotate the signing key of an user, every token of the user stops working at once
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param userID path string true "user" Format(uuid)
+// @Success 200 {object} handler.authResetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/users/{userID}/rotate-key [put]
+func (handler *UserHandler) RotateKey(c echo.Context) error {
+	userID, err := uuid.FromString(c.Param("userID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	err = handler.rotateKey(tenantID(c), userID)
+	if err != nil {
+		if e, ok := errors.Cause(err).(*auth.UserNotFoundError); ok {
+			return c.JSON(http.StatusNotFound, errorResponse{Error: generalError{
+				Code:    http.StatusNotFound,
+				Message: e.Error(),
+			}})
+		}
+		return errors.Wrap(err, "Fail to rotate user key")
+	}
+	return c.JSON(http.StatusOK, authResetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: recoverResponse{
+			Kind: "empty",
+		},
+	})
+}
+
+// ChangePassword returns an echo handler
+// @Summary users.ChangePassword
+// @Description Change the password of the logged user, the other sessions are signed out
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param password body handler.passwordChangeForm true "Current and new password"
+// @Success 200 {object} handler.loginResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/me/password [put]
+func (handler *UserHandler) ChangePassword(c echo.Context) error {
+	req := passwordChangeForm{}
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	claims, err := auth.Extract(c.Get(handler.claimsCtxKey))
+	if err != nil {
+		return errors.Wrap(err, "Couldn't parse token")
+	}
+	r, err := handler.changePassword(
+		uuid.FromStringOrNil(claims.UserID),
+		uuid.FromStringOrNil(claims.SessID),
+		req.CurrentPassword,
+		req.Password,
+	)
+	if err != nil {
+		if e, ok := passwordError(err); ok {
+			return c.JSON(int(e.Code), errorResponse{Error: e})
+		}
+		return errors.Wrap(err, "Fail to change password")
+	}
+	return c.JSON(http.StatusOK, authTokenOut(c, r))
+}
+
+// RequirePasswordChange returns an echo handler
+// @Summary users.RequirePasswordChange
+// @Description Make the user change the password at next sign in
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param userID path string true "user" Format(uuid)
+// @Success 200 {object} handler.userGetResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 404 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/users/{userID}/require-password-change [put]
+func (handler *UserHandler) RequirePasswordChange(c echo.Context) error {
+	userID, err := uuid.FromString(c.Param("userID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	u, err := handler.requirePasswordChange(tenantID(c), userID)
+	if err != nil {
+		if e, ok := errors.Cause(err).(*auth.UserNotFoundError); ok {
+			return c.JSON(http.StatusNotFound, errorResponse{Error: generalError{
+				Code:    http.StatusNotFound,
+				Message: e.Error(),
+			}})
+		}
+		return errors.Wrap(err, "Fail to require password change")
+	}
+	return c.JSON(http.StatusOK, userGetResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: userResponse{
+			Kind: "User must change password",
+			Item: u,
+		},
+	})
+}
+
+// Lockouts returns an echo handler
+// @Summary users.Lockouts
+// @Description List the lock and unlock events of an user account
+// @Accept  json
+// @Produce  json
+// @Param context query string false "Context to return"
+// @Param userID path string true "user" Format(uuid)
+// @Success 200 {object} handler.userLockoutListResponse
+// @Failure 400 {object} handler.errorResponse
+// @Failure 401 {object} handler.errorResponse
+// @Failure 500 {object} handler.errorResponse
+// @Router /api/users/{userID}/lockouts [get]
+func (handler *UserHandler) Lockouts(c echo.Context) error {
+	userID, err := uuid.FromString(c.Param("userID"))
+	if err != nil {
+		return errors.Wrap(err, "Error uuid format")
+	}
+	lo, err := handler.listLockouts(tenantID(c), userID)
+	if err != nil {
+		return errors.Wrap(err, "Fail to list user lockouts")
+	}
+	return c.JSON(http.StatusOK, userLockoutListResponse{
+		dataResponse: dataResponse{
+			Context: c.QueryParam("context"),
+		},
+		Data: userLockoutsResponse{
+			Kind:  "User lockout list",
+			Items: lo,
+			collectionItemData: collectionItemData{
+				CurrentItemCount: int64(len(lo)),
+				TotalItems:       int64(len(lo)),
+			},
+		},
+	})
+}
+
 type pushTokenBody struct {
 	Token string `json:"token"`
 }
@@ -393,3 +514,24 @@ type userListResponse struct {
 	dataResponse
 	Data usersResponse `json:"data"`
 }
+
+type userLockoutsResponse struct {
+	collectionItemData
+	Items []um.UserLockout `json:"items"`
+	Kind  string           `json:"kind"`
+}
+
+type userLockoutListResponse struct {
+	dataResponse
+	Data userLockoutsResponse `json:"data"`
+}
+
+// ownUser tells if the route userID is the signed in user
+func ownUser(c echo.Context, claims *auth.Claims) bool {
+	return claims.UserID == uuid.FromStringOrNil(c.Param("userID")).String()
+}
+
+type passwordChangeForm struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+}
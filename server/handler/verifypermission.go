@@ -6,18 +6,16 @@ import (
 	"github.com/pkg/errors"
 
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
-	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 )
 
-func doctIDOrNil(c echo.Context, claimsCtxKey, rolesCtxKey string) (*uuid.UUID, error) {
+// doctIDOrNil returns the doctor of the signed in user, users with anyPerm
+// and no doctor get nil and see the data of every doctor
+func doctIDOrNil(c echo.Context, claimsCtxKey, rolesCtxKey, anyPerm string) (*uuid.UUID, error) {
 	p, err := auth.ExtractPermissions(c.Get(rolesCtxKey))
 	if err != nil {
 		return nil, errors.Wrap(err, "Couldn't parse permissions")
 	}
-	isSuperAdmin := false
-	if p.Can(perm.Admin) || p.Can(perm.Secretary) || p.Can(perm.Config) {
-		isSuperAdmin = true
-	}
+	isSuperAdmin := p.Can(anyPerm)
 	claims, err := auth.Extract(c.Get(claimsCtxKey))
 	if err != nil {
 		return nil, errors.Wrap(err, "Couldn't parse token")
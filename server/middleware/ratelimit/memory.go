@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the counters in the process, each instance counts apart
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	lastGC   time.Time
+	now      func() time.Time
+}
+
+type counter struct {
+	count int
+	reset time.Time
+}
+
+// NewMemoryStore returns an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: map[string]*counter{}, now: time.Now}
+}
+
+// Hit implements Store
+func (s *MemoryStore) Hit(key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.gc(now)
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.reset) {
+		c = &counter{reset: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.count++
+	return c.count, c.reset, nil
+}
+
+// gc drops the ended windows once a minute
+func (s *MemoryStore) gc(now time.Time) {
+	if now.Sub(s.lastGC) < time.Minute {
+		return
+	}
+	s.lastGC = now
+	for k, c := range s.counters {
+		if !now.Before(c.reset) {
+			delete(s.counters, k)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	for i := 1; i <= 3; i++ {
+		n, reset, _ := s.Hit("a", time.Minute)
+		if n != i {
+			t.Errorf("hit %d counted %d", i, n)
+		}
+		if !reset.Equal(now.Add(time.Minute)) {
+			t.Errorf("window ends at %v", reset)
+		}
+	}
+	if n, _, _ := s.Hit("b", time.Minute); n != 1 {
+		t.Errorf("keys share counters, got %d", n)
+	}
+
+	now = now.Add(time.Minute)
+	if n, _, _ := s.Hit("a", time.Minute); n != 1 {
+		t.Errorf("new window counted %d", n)
+	}
+	now = now.Add(2 * time.Minute)
+	s.Hit("c", time.Minute)
+	if _, ok := s.counters["b"]; ok {
+		t.Error("ended window not collected")
+	}
+}
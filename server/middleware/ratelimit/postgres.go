@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// PostgresStore keeps the counters in the rate_limit table, shared by every
+// instance of the api
+type PostgresStore struct {
+	DB *sqlx.DB
+}
+
+// Hit implements Store
+func (s *PostgresStore) Hit(key string, window time.Duration) (int, time.Time, error) {
+	row := struct {
+		Count   int       `db:"count"`
+		ResetAt time.Time `db:"reset_at"`
+	}{}
+	now := time.Now()
+	err := s.DB.Get(&row, `INSERT INTO rate_limit (key, count, reset_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limit.reset_at <= $3 THEN 1 ELSE rate_limit.count + 1 END,
+			reset_at = CASE WHEN rate_limit.reset_at <= $3 THEN EXCLUDED.reset_at ELSE rate_limit.reset_at END
+		RETURNING count, reset_at`, key, now.Add(window), now)
+	if err != nil {
+		return 0, time.Time{}, errors.Wrap(err, "Error counting rate limit hit")
+	}
+	return row.Count, row.ResetAt, nil
+}
+
+// Purge deletes the ended windows
+func (s *PostgresStore) Purge() (int64, error) {
+	res, err := s.DB.Exec(`DELETE FROM rate_limit WHERE reset_at <= $1`, time.Now())
+	if err != nil {
+		return 0, errors.Wrap(err, "Error purging rate limits")
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,102 @@
+// Package ratelimit throttles requests with fixed window counters kept in a
+// pluggable store
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// HeaderRetryAfter tells limited clients how many seconds to wait
+const HeaderRetryAfter = "Retry-After"
+
+// Store counts the hits of a key inside a window
+type Store interface {
+	// Hit adds one to the key counter and returns it with the time the
+	// window ends, a new window starts when the last one ended
+	Hit(key string, window time.Duration) (count int, reset time.Time, err error)
+}
+
+// Rule limits the requests sharing a key
+type Rule struct {
+	// Name prefixes the key, rules of different routes don't share counters
+	Name   string
+	Limit  int
+	Window time.Duration
+	// Key of the request, empty keys aren't limited
+	Key func(c echo.Context) string
+}
+
+// ByIP keys requests by client ip
+func ByIP(c echo.Context) string {
+	return c.RealIP()
+}
+
+// ByParam keys requests by a path param
+func ByParam(name string) func(c echo.Context) string {
+	return func(c echo.Context) string {
+		return c.Param(name)
+	}
+}
+
+// ByJSONField keys requests by a string field of the json body, case
+// insensitive. The body is restored for the handler
+func ByJSONField(field string) func(c echo.Context) string {
+	return func(c echo.Context) string {
+		req := c.Request()
+		if req.Body == nil {
+			return ""
+		}
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if err != nil {
+			return ""
+		}
+		body := map[string]interface{}{}
+		if json.Unmarshal(b, &body) != nil {
+			return ""
+		}
+		v, _ := body[field].(string)
+		return strings.ToLower(strings.TrimSpace(v))
+	}
+}
+
+// Middleware rejects the request with 429 when any rule is over its limit.
+// Store failures let the request through, they are reported to onError
+func Middleware(s Store, onError func(err error), rules ...Rule) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			for _, r := range rules {
+				key := r.Key(c)
+				if len(key) == 0 {
+					continue
+				}
+				count, reset, err := s.Hit(r.Name+":"+key, r.Window)
+				if err != nil {
+					if onError != nil {
+						onError(err)
+					}
+					continue
+				}
+				if count > r.Limit {
+					wait := math.Ceil(time.Until(reset).Seconds())
+					if wait < 1 {
+						wait = 1
+					}
+					c.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(int(wait)))
+					return echo.NewHTTPError(http.StatusTooManyRequests, "Too many requests, try again later")
+				}
+			}
+			return next(c)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package tokenauth
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
 	"github.com/labstack/echo"
 )
 
@@ -19,3 +22,57 @@ func TokenAuth(token string) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// DeviceKeyHeader is the header devices send their key in
+const DeviceKeyHeader = "X-Device-Key"
+
+//DeviceKey checks the device key of the request, check returns the
+//institution and rooms the key is bound to and the route roomID must be one
+//of them. The institution is set in the context under tenantCtxKey
+func DeviceKey(check func(key, ip string) (uuid.UUID, []string, error), tenantCtxKey string, denied func(c echo.Context, err error) error) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(DeviceKeyHeader)
+			if len(key) == 0 {
+				return denied(c, nil)
+			}
+			instID, rooms, err := check(key, c.RealIP())
+			if err != nil {
+				return denied(c, err)
+			}
+			roomID := c.Param("roomID")
+			for _, r := range rooms {
+				if strings.EqualFold(r, roomID) {
+					c.Set(tenantCtxKey, instID)
+					return next(c)
+				}
+			}
+			return denied(c, nil)
+		}
+	}
+}
+
+//JWT verifies the bearer token of the request with the key keyFunc returns
+//for it, the token is parsed into the claims newClaims creates and set in
+//the context under ctxKey
+func JWT(newClaims func() jwt.Claims, keyFunc jwt.Keyfunc, ctxKey string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			h := c.Request().Header.Get(echo.HeaderAuthorization)
+			scheme := "Bearer "
+			if len(h) <= len(scheme) || !strings.EqualFold(h[:len(scheme)], scheme) {
+				return echo.NewHTTPError(http.StatusBadRequest, "missing or malformed jwt")
+			}
+			token, err := jwt.ParseWithClaims(h[len(scheme):], newClaims(), keyFunc)
+			if err != nil || !token.Valid {
+				return &echo.HTTPError{
+					Code:     http.StatusUnauthorized,
+					Message:  "invalid or expired jwt",
+					Internal: err,
+				}
+			}
+			c.Set(ctxKey, token)
+			return next(c)
+		}
+	}
+}
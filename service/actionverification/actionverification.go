@@ -21,12 +21,16 @@ type Creator struct {
 }
 
 //Run create new ActionVerification
-func (c *Creator) Run(acv *m.ActionVerification) (*m.ActionVerification, error) {
+func (c *Creator) Run(instID uuid.UUID, acv *m.ActionVerification) (*m.ActionVerification, error) {
 	acveID, err := uuid.NewV4()
 	if err != nil {
 		return nil, errors.Wrap(err, "Error generating ActionVerification uuid")
 	}
 	acv.AcveID = acveID
+	acv.InstID = instID
+	if acv.ExpiresAt.IsZero() {
+		acv.ExpiresAt = time.Now().Add(time.Hour)
+	}
 	u, err := createActionVerification(c.DB, acv)
 	return u, err
 }
@@ -37,8 +41,8 @@ type Lister struct {
 }
 
 //Run return a list of ActionVerification by Filter
-func (l *Lister) Run(f m.FilterActionVerification) ([]m.ActionVerification, error) {
-	u, err := listActionVerification(l.DB, f)
+func (l *Lister) Run(instID uuid.UUID, f m.FilterActionVerification) ([]m.ActionVerification, error) {
+	u, err := listActionVerification(l.DB, instID, f)
 	return u, err
 }
 
@@ -48,8 +52,8 @@ type Getter struct {
 }
 
 //Run return a ActionVerification by sche_id
-func (g *Getter) Run(acveID uuid.UUID) (*m.ActionVerification, error) {
-	u, err := getActionVerification(g.DB, acveID)
+func (g *Getter) Run(instID, acveID uuid.UUID) (*m.ActionVerification, error) {
+	u, err := getActionVerification(g.DB, instID, acveID)
 	return u, err
 }
 
@@ -59,7 +63,8 @@ type Updater struct {
 }
 
 //Run update ActionVerification data
-func (g *Updater) Run(app *m.ActionVerification) (*m.ActionVerification, error) {
+func (g *Updater) Run(instID uuid.UUID, app *m.ActionVerification) (*m.ActionVerification, error) {
+	app.InstID = instID
 	u, err := updateActionVerification(g.DB, app)
 	return u, err
 }
@@ -70,24 +75,20 @@ type Deleter struct {
 }
 
 //Run soft delete ActionVerification by acve_id
-func (d *Deleter) Run(acveID uuid.UUID) (*m.ActionVerification, error) {
-	u, err := deleteActionVerification(d.DB, acveID)
+func (d *Deleter) Run(instID, acveID uuid.UUID) (*m.ActionVerification, error) {
+	u, err := deleteActionVerification(d.DB, instID, acveID)
 	return u, err
 }
 
-/* Create a new ActionVerification to database */
+/* Create a new ActionVerification to database, the user must belong to the institution */
 func createActionVerification(db service.DB, acv *m.ActionVerification) (*m.ActionVerification, error) {
-	query := psql.Insert("action_verification").
-		Columns("acve_id", "user_id", "type", "verification").
-		Values(acv.AcveID, acv.UserID, acv.Type, acv.Verification).
-		Suffix("RETURNING *")
-
-	qSQL, args, err := query.ToSql()
-	if err != nil {
-		return nil, errors.Wrap(err, "Error generating Action Verification sql")
-	}
+	qSQL := `INSERT INTO action_verification (acve_id, user_id, type, verification, expires_at, inst_id)
+		SELECT $1, user_id, $3, $4, $5, inst_id
+		FROM "user"
+		WHERE user_id = $2 AND inst_id = $6
+		RETURNING *`
 
-	err = db.Get(acv, qSQL, args...)
+	err := db.Get(acv, qSQL, acv.AcveID, acv.UserID, acv.Type, acv.Verification, acv.ExpiresAt, acv.InstID)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error inserting Action Verification in database")
 	}
@@ -95,11 +96,12 @@ func createActionVerification(db service.DB, acv *m.ActionVerification) (*m.Acti
 }
 
 /* Return a list of ActionVerification by filters */
-func listActionVerification(db service.DB, f m.FilterActionVerification) ([]m.ActionVerification, error) {
+func listActionVerification(db service.DB, instID uuid.UUID, f m.FilterActionVerification) ([]m.ActionVerification, error) {
 	pat := []m.ActionVerification{}
-	query := psql.Select("acve_id", "user_id", "type", "verification", "created_at", "deleted_at").
+	query := psql.Select("acve_id", "inst_id", "user_id", "type", "created_at", "deleted_at", "expires_at", "attempts").
 		From("action_verification").
-		Where("deleted_at IS NULL")
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"inst_id": instID})
 
 	if f.AcveID != nil {
 		query = query.Where(`acve_id = ?`, f.AcveID)
@@ -110,9 +112,6 @@ func listActionVerification(db service.DB, f m.FilterActionVerification) ([]m.Ac
 	if f.Type != nil {
 		query = query.Where(`type ILIKE ?`, `%`+*f.Type+`%`)
 	}
-	if f.Verification != nil {
-		query = query.Where(`verification ILIKE ?`, `%`+*f.Verification+`%`)
-	}
 	if f.InitialDate != nil {
 		query = query.Where(sq.GtOrEq{"created_at": f.InitialDate})
 	}
@@ -141,11 +140,11 @@ func listActionVerification(db service.DB, f m.FilterActionVerification) ([]m.Ac
 }
 
 /* Return a ActionVerification by acve_id */
-func getActionVerification(db service.DB, acveID uuid.UUID) (*m.ActionVerification, error) {
+func getActionVerification(db service.DB, instID, acveID uuid.UUID) (*m.ActionVerification, error) {
 	acv := m.ActionVerification{}
-	query := psql.Select("acve_id", "user_id", "type", "verification", "created_at", "deleted_at").
+	query := psql.Select("acve_id", "inst_id", "user_id", "type", "created_at", "deleted_at", "expires_at", "attempts").
 		From("action_verification").
-		Where(sq.Eq{"acve_id": acveID})
+		Where(sq.Eq{"acve_id": acveID, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -166,9 +165,12 @@ func updateActionVerification(db service.DB, acv *m.ActionVerification) (*m.Acti
 	query := psql.Update("action_verification").
 		Set("user_id", acv.UserID).
 		Set("type", acv.Type).
-		Set("verification", acv.Verification).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"acve_id": acv.AcveID})
+		Where(sq.Eq{"acve_id": acv.AcveID, "inst_id": acv.InstID}).
+		Where(`EXISTS (SELECT 1 FROM "user" WHERE user_id = ? AND inst_id = ?)`, acv.UserID, acv.InstID)
+	if !acv.ExpiresAt.IsZero() {
+		query = query.Set("expires_at", acv.ExpiresAt)
+	}
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -184,12 +186,12 @@ func updateActionVerification(db service.DB, acv *m.ActionVerification) (*m.Acti
 }
 
 /* Delete ActionVerification to database by acve_id */
-func deleteActionVerification(db service.DB, acveID uuid.UUID) (*m.ActionVerification, error) {
+func deleteActionVerification(db service.DB, instID, acveID uuid.UUID) (*m.ActionVerification, error) {
 	acv := m.ActionVerification{}
 	query := psql.Update(`action_verification`).
 		Set("deleted_at", time.Now()).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"acve_id": acveID})
+		Where(sq.Eq{"acve_id": acveID, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
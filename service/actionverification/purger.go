@@ -0,0 +1,62 @@
+package actionverification
+
+import (
+	"log"
+	"time"
+
+	"github.com/jasonlvhit/gocron"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	sq "github.com/elgris/sqrl"
+)
+
+//Purger service to delete expired and used ActionVerification
+type Purger struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+	// Retention keeps expired or used rows around for this long before deleting them
+	Retention time.Duration
+}
+
+// Start runs the purge every hour
+func (p *Purger) Start() chan bool {
+	p.Run()
+	s := gocron.NewScheduler()
+	s.Every(1).Hour().Do(p.Run)
+	return s.Start()
+}
+
+//Run deletes the expired and used ActionVerification
+func (p *Purger) Run() error {
+	n, err := purgeActionVerification(p.DB, time.Now().Add(-p.Retention))
+	if err != nil {
+		if p.Logger != nil {
+			p.Logger.Println(err)
+		}
+		return err
+	}
+	if p.Logger != nil && n > 0 {
+		p.Logger.Printf("purged %d action verifications", n)
+	}
+	return nil
+}
+
+/* Delete ActionVerification expired or deleted before the given time */
+func purgeActionVerification(db *sqlx.DB, before time.Time) (int64, error) {
+	query := psql.Delete("action_verification").
+		Where(sq.Or{
+			sq.Lt{"expires_at": before},
+			sq.Lt{"deleted_at": before},
+		})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error generating purge Action Verification sql")
+	}
+	res, err := db.Exec(qSQL, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error purging Action Verification")
+	}
+	return res.RowsAffected()
+}
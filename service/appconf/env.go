@@ -3,6 +3,7 @@ package appconf
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 var (
@@ -14,6 +15,8 @@ var (
 
 	logPath   string
 	jwtSecret string
+	jwtAlg    string
+	jwtDays   string
 
 	smtpHost string
 	smtpPort string
@@ -32,6 +35,29 @@ var (
 	uploadLimit string
 
 	accessURL string
+
+	authMaxFailedAttempts string
+	authLockoutMinutes    string
+	authAccessMinutes     string
+	authRefreshDays       string
+	authTOTPIssuer        string
+	authInvitationHours   string
+	authVerificationDays  string
+	authRoleCacheMinutes  string
+	authPasswordMinLength string
+	authPasswordClasses   string
+	authImpersonationMins string
+
+	auditRetentionDays string
+
+	rebalanceEnabled string
+	rebalanceMinutes string
+	rebalanceDays    string
+
+	rateLimitStore   string
+	rateLimitWindow  string
+	rateLimitIP      string
+	rateLimitAccount string
 )
 
 // SMTP holds env. configuration for SMTP connection
@@ -80,7 +106,24 @@ func init() {
 	portDB = os.Getenv("DB_PORT")
 
 	logPath = os.Getenv("LOGPATH")
-	jwtSecret = os.Getenv("JWT_SCECRET")
+	jwtSecret = os.Getenv("JWT_SECRET")
+	if len(jwtSecret) == 0 {
+		// the misspelled name older deployments were configured with
+		jwtSecret = os.Getenv("JWT_SCECRET")
+	}
+	JWT.Secret = jwtSecret
+	jwtAlg = os.Getenv("JWT_ALG")
+	if len(jwtAlg) > 0 {
+		JWT.Alg = jwtAlg
+	}
+	jwtDays = os.Getenv("JWT_KEY_ROTATION_DAYS")
+	if len(jwtDays) > 0 {
+		days, err := strconv.Atoi(jwtDays)
+		if err != nil {
+			panic(err)
+		}
+		JWT.RotateEvery = time.Duration(days) * 24 * time.Hour
+	}
 
 	smtpHost = os.Getenv("SMTP_HOST")
 	smtpPort = os.Getenv("SMTP_PORT")
@@ -99,6 +142,151 @@ func init() {
 	uploadLimit = os.Getenv("UPLOAD_LIMIT")
 
 	accessURL = os.Getenv("APP_ACCESSURL")
+
+	authMaxFailedAttempts = os.Getenv("AUTH_MAX_FAILED_ATTEMPTS")
+	authLockoutMinutes = os.Getenv("AUTH_LOCKOUT_MINUTES")
+	if len(authMaxFailedAttempts) > 0 {
+		attempts, err := strconv.Atoi(authMaxFailedAttempts)
+		if err != nil {
+			panic(err)
+		}
+		Auth.MaxFailedAttempts = attempts
+	}
+	if len(authLockoutMinutes) > 0 {
+		minutes, err := strconv.Atoi(authLockoutMinutes)
+		if err != nil {
+			panic(err)
+		}
+		Auth.LockoutDuration = time.Duration(minutes) * time.Minute
+	}
+	authAccessMinutes = os.Getenv("AUTH_ACCESS_TOKEN_MINUTES")
+	authRefreshDays = os.Getenv("AUTH_REFRESH_TOKEN_DAYS")
+	authInvitationHours = os.Getenv("AUTH_INVITATION_HOURS")
+	if len(authInvitationHours) > 0 {
+		hours, err := strconv.Atoi(authInvitationHours)
+		if err != nil {
+			panic(err)
+		}
+		Auth.InvitationTTL = time.Duration(hours) * time.Hour
+	}
+	authVerificationDays = os.Getenv("AUTH_VERIFICATION_RETENTION_DAYS")
+	if len(authVerificationDays) > 0 {
+		days, err := strconv.Atoi(authVerificationDays)
+		if err != nil {
+			panic(err)
+		}
+		Auth.VerificationRetention = time.Duration(days) * 24 * time.Hour
+	}
+	authRoleCacheMinutes = os.Getenv("AUTH_ROLE_CACHE_MINUTES")
+	if len(authRoleCacheMinutes) > 0 {
+		minutes, err := strconv.Atoi(authRoleCacheMinutes)
+		if err != nil {
+			panic(err)
+		}
+		Auth.RoleCacheTTL = time.Duration(minutes) * time.Minute
+	}
+	authPasswordMinLength = os.Getenv("AUTH_PASSWORD_MIN_LENGTH")
+	if len(authPasswordMinLength) > 0 {
+		length, err := strconv.Atoi(authPasswordMinLength)
+		if err != nil {
+			panic(err)
+		}
+		Auth.PasswordMinLength = length
+	}
+	authPasswordClasses = os.Getenv("AUTH_PASSWORD_MIN_CLASSES")
+	if len(authPasswordClasses) > 0 {
+		classes, err := strconv.Atoi(authPasswordClasses)
+		if err != nil {
+			panic(err)
+		}
+		Auth.PasswordMinClasses = classes
+	}
+	authImpersonationMins = os.Getenv("AUTH_IMPERSONATION_MINUTES")
+	if len(authImpersonationMins) > 0 {
+		minutes, err := strconv.Atoi(authImpersonationMins)
+		if err != nil {
+			panic(err)
+		}
+		Auth.ImpersonationTTL = time.Duration(minutes) * time.Minute
+	}
+	auditRetentionDays = os.Getenv("AUDIT_RETENTION_DAYS")
+	if len(auditRetentionDays) > 0 {
+		days, err := strconv.Atoi(auditRetentionDays)
+		if err != nil {
+			panic(err)
+		}
+		Audit.Retention = time.Duration(days) * 24 * time.Hour
+	}
+	rebalanceEnabled = os.Getenv("REBALANCE_ENABLED")
+	if len(rebalanceEnabled) > 0 {
+		enabled, err := strconv.ParseBool(rebalanceEnabled)
+		if err != nil {
+			panic(err)
+		}
+		Rebalance.Enabled = enabled
+	}
+	rebalanceMinutes = os.Getenv("REBALANCE_EVERY_MINUTES")
+	if len(rebalanceMinutes) > 0 {
+		minutes, err := strconv.Atoi(rebalanceMinutes)
+		if err != nil {
+			panic(err)
+		}
+		Rebalance.Every = time.Duration(minutes) * time.Minute
+	}
+	rebalanceDays = os.Getenv("REBALANCE_DAYS")
+	if len(rebalanceDays) > 0 {
+		days, err := strconv.Atoi(rebalanceDays)
+		if err != nil {
+			panic(err)
+		}
+		Rebalance.Days = days
+	}
+	rateLimitStore = os.Getenv("RATE_LIMIT_STORE")
+	if len(rateLimitStore) > 0 {
+		RateLimit.Store = rateLimitStore
+	}
+	rateLimitWindow = os.Getenv("RATE_LIMIT_WINDOW_MINUTES")
+	if len(rateLimitWindow) > 0 {
+		minutes, err := strconv.Atoi(rateLimitWindow)
+		if err != nil {
+			panic(err)
+		}
+		RateLimit.Window = time.Duration(minutes) * time.Minute
+	}
+	rateLimitIP = os.Getenv("RATE_LIMIT_PER_IP")
+	if len(rateLimitIP) > 0 {
+		limit, err := strconv.Atoi(rateLimitIP)
+		if err != nil {
+			panic(err)
+		}
+		RateLimit.PerIP = limit
+	}
+	rateLimitAccount = os.Getenv("RATE_LIMIT_PER_ACCOUNT")
+	if len(rateLimitAccount) > 0 {
+		limit, err := strconv.Atoi(rateLimitAccount)
+		if err != nil {
+			panic(err)
+		}
+		RateLimit.PerAccount = limit
+	}
+	authTOTPIssuer = os.Getenv("AUTH_TOTP_ISSUER")
+	if len(authTOTPIssuer) > 0 {
+		Auth.TOTPIssuer = authTOTPIssuer
+	}
+	if len(authAccessMinutes) > 0 {
+		minutes, err := strconv.Atoi(authAccessMinutes)
+		if err != nil {
+			panic(err)
+		}
+		Auth.AccessTokenTTL = time.Duration(minutes) * time.Minute
+	}
+	if len(authRefreshDays) > 0 {
+		days, err := strconv.Atoi(authRefreshDays)
+		if err != nil {
+			panic(err)
+		}
+		Auth.RefreshTokenTTL = time.Duration(days) * 24 * time.Hour
+	}
 	if len(smtpHost) > 0 {
 		port, err := strconv.Atoi(smtpPort)
 		if err != nil {
@@ -120,12 +308,66 @@ func init() {
 	Log.LogDir = logPath
 }
 
+// Auth holds env. configuration for user authentication
+var Auth = struct {
+	MaxFailedAttempts int
+	LockoutDuration   time.Duration
+	AccessTokenTTL    time.Duration
+	RefreshTokenTTL   time.Duration
+	// Name shown by the authenticator apps
+	TOTPIssuer string
+	// How long an invitation link is valid
+	InvitationTTL time.Duration
+	// How long expired or used action verifications are kept
+	VerificationRetention time.Duration
+	// How long the roles of an user are cached, changes are also
+	// notified to every instance
+	RoleCacheTTL time.Duration
+	// Password policy, minimum length and how many of lower case, upper
+	// case, digits and symbols must be mixed
+	PasswordMinLength  int
+	PasswordMinClasses int
+	// How long an admin can act as another user before starting over
+	ImpersonationTTL time.Duration
+}{5, 15 * time.Minute, 15 * time.Minute, 30 * 24 * time.Hour, "Inovant", 72 * time.Hour, 7 * 24 * time.Hour, 10 * time.Minute, 8, 3, 30 * time.Minute}
+
+// Audit holds env. configuration for the audit log
+var Audit = struct {
+	// How long audit entries are kept, 0 keeps them forever
+	Retention time.Duration
+}{365 * 24 * time.Hour}
+
+// Rebalance holds env. configuration for the job moving the schedules between rooms
+var Rebalance = struct {
+	// The job is off unless enabled, admins can still run it for some days
+	Enabled bool
+	Every   time.Duration
+	// Days from today each run covers
+	Days int
+}{false, time.Hour, 30}
+
+// RateLimit holds env. configuration for the throttling of the public auth routes
+var RateLimit = struct {
+	// memory or postgres, postgres shares the counters between instances
+	Store  string
+	Window time.Duration
+	// Requests allowed in a window from an ip
+	PerIP int
+	// Requests allowed in a window for an email or reset link
+	PerAccount int
+}{"memory", 15 * time.Minute, 30, 5}
+
 // JWT holds env. configuration for the JWT authentication
 var JWT = struct {
+	// Secret seals the signing keys stored in the database
 	Secret,
+	// Alg new signing keys are created with, RS256 or EdDSA
+	Alg,
 	RolesCtxKey,
 	ClaimsCtxKey string
-}{jwtSecret, "roles", "user"}
+	// How long a signing key is used before being replaced
+	RotateEvery time.Duration
+}{"", "RS256", "roles", "user", 30 * 24 * time.Hour}
 
 // Server holds env. configuration for the webserver
 var Server = struct {
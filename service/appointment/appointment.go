@@ -20,12 +20,13 @@ type Creator struct {
 }
 
 //Run create new Appointment
-func (c *Creator) Run(app *m.Appointment, doctID *uuid.UUID) (*m.Appointment, error) {
+func (c *Creator) Run(instID uuid.UUID, app *m.Appointment, doctID *uuid.UUID) (*m.Appointment, error) {
 	appoID, err := uuid.NewV4()
 	if err != nil {
 		return nil, errors.Wrap(err, "Error generating Appointment uuid")
 	}
 	app.AppoID = appoID
+	app.InstID = instID
 	u, err := createAppointment(c.DB, app, doctID)
 	return u, err
 }
@@ -36,8 +37,8 @@ type Lister struct {
 }
 
 //Run return a list of Appointment by Filter
-func (l *Lister) Run(doctID *uuid.UUID, f m.FilterAppointment) ([]m.Appointment, error) {
-	u, err := listAppointment(l.DB, doctID, f)
+func (l *Lister) Run(instID uuid.UUID, doctID *uuid.UUID, f m.FilterAppointment) ([]m.Appointment, error) {
+	u, err := listAppointment(l.DB, instID, doctID, f)
 	return u, err
 }
 
@@ -47,8 +48,8 @@ type Getter struct {
 }
 
 //Run return a Appointment by sche_id
-func (g *Getter) Run(doctID *uuid.UUID, appoID uuid.UUID) (*m.Appointment, error) {
-	u, err := getAppointment(g.DB, doctID, appoID)
+func (g *Getter) Run(instID uuid.UUID, doctID *uuid.UUID, appoID uuid.UUID) (*m.Appointment, error) {
+	u, err := getAppointment(g.DB, instID, doctID, appoID)
 	return u, err
 }
 
@@ -58,7 +59,8 @@ type Updater struct {
 }
 
 //Run update Appointment data
-func (g *Updater) Run(app *m.Appointment, doctID *uuid.UUID) (*m.Appointment, error) {
+func (g *Updater) Run(instID uuid.UUID, app *m.Appointment, doctID *uuid.UUID) (*m.Appointment, error) {
+	app.InstID = instID
 	u, err := updateAppointment(g.DB, app, doctID)
 	return u, err
 }
@@ -69,31 +71,31 @@ type Deleter struct {
 }
 
 //Run soft delete Appointment by sche_id
-func (d *Deleter) Run(appoID uuid.UUID) (*m.Appointment, error) {
-	u, err := deleteAppointment(d.DB, appoID)
+func (d *Deleter) Run(instID, appoID uuid.UUID) (*m.Appointment, error) {
+	u, err := deleteAppointment(d.DB, instID, appoID)
 	return u, err
 }
 
 /* Create a new Appointment to database */
 func createAppointment(db service.DB, app *m.Appointment, doctID *uuid.UUID) (*m.Appointment, error) {
-	args := []interface{}{app.AppoID, app.StartAt, app.ScheID, app.PatiID, app.Type, app.Status}
+	args := []interface{}{app.AppoID, app.StartAt, app.ScheID, app.PatiID, app.Type, app.Status, app.InstID}
 	filter := ""
 
 	if doctID != nil {
 		args = append(args, doctID)
-		filter = ` AND doct_id = $7`
+		filter = ` AND doct_id = $8`
 	}
 
 	query := `
 			WITH results AS (
-				SELECT $1::UUID, $2::TIMESTAMP, sche_id, pati_id, $5::TEXT, $6::TEXT, doct_id
+				SELECT $1::UUID, $2::TIMESTAMP, sche_id, pati_id, $5::TEXT, $6::TEXT, doct_id, schedule.inst_id
 				FROM schedule
 				JOIN patient USING (doct_id)
-				WHERE sche_id = $3 AND pati_id = $4` + filter + `
+				WHERE sche_id = $3 AND pati_id = $4 AND schedule.inst_id = $7` + filter + `
 			)
 
-			INSERT INTO appointment(appo_id, start_at, sche_id, pati_id, type, status)
-			SELECT $1, $2, sche_id, pati_id, $5, $6
+			INSERT INTO appointment(appo_id, start_at, sche_id, pati_id, type, status, inst_id)
+			SELECT $1, $2, sche_id, pati_id, $5, $6, inst_id
 			FROM results
 			RETURNING *
 			`
@@ -108,12 +110,13 @@ func createAppointment(db service.DB, app *m.Appointment, doctID *uuid.UUID) (*m
 }
 
 /* Return a list of Appointment by filters */
-func listAppointment(db service.DB, doctID *uuid.UUID, f m.FilterAppointment) ([]m.Appointment, error) {
+func listAppointment(db service.DB, instID uuid.UUID, doctID *uuid.UUID, f m.FilterAppointment) ([]m.Appointment, error) {
 	sch := []m.Appointment{}
-	query := psql.Select("app.appo_id", "app.start_at", "app.sche_id", "app.pati_id", "pat.name as pati_name", "app.type", "app.status", "app.created_at").
+	query := psql.Select("app.appo_id", "app.inst_id", "app.start_at", "app.sche_id", "app.pati_id", "pat.name as pati_name", "app.type", "app.status", "app.created_at").
 		From("appointment app").
 		LeftJoin("schedule sch USING (sche_id)").
-		LeftJoin("patient pat USING (pati_id)")
+		LeftJoin("patient pat USING (pati_id)").
+		Where(sq.Eq{"app.inst_id": instID})
 
 	if doctID != nil {
 		query = query.Where(`sch.doct_id = ?`, doctID)
@@ -174,13 +177,13 @@ func listAppointment(db service.DB, doctID *uuid.UUID, f m.FilterAppointment) ([
 }
 
 /* Return a Appointment by appo_id */
-func getAppointment(db service.DB, doctID *uuid.UUID, appoID uuid.UUID) (*m.Appointment, error) {
+func getAppointment(db service.DB, instID uuid.UUID, doctID *uuid.UUID, appoID uuid.UUID) (*m.Appointment, error) {
 	sch := m.Appointment{}
-	query := psql.Select("app.appo_id", "app.start_at", "app.sche_id", "app.pati_id", "pat.name as pati_name", "app.type", "app.status", "app.created_at").
+	query := psql.Select("app.appo_id", "app.inst_id", "app.start_at", "app.sche_id", "app.pati_id", "pat.name as pati_name", "app.type", "app.status", "app.created_at").
 		From("appointment app").
 		LeftJoin("schedule sch USING (sche_id)").
 		LeftJoin("patient pat USING (pati_id)").
-		Where(sq.Eq{"appo_id": appoID})
+		Where(sq.Eq{"appo_id": appoID, "app.inst_id": instID})
 
 	if doctID != nil {
 		query = query.Where(`sch.doct_id = ?`, doctID)
@@ -209,7 +212,8 @@ func updateAppointment(db service.DB, app *m.Appointment, doctID *uuid.UUID) (*m
 		Set("type", app.Type).
 		Set("status", app.Status).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"appo_id": app.AppoID})
+		Where(sq.Eq{"appo_id": app.AppoID, "inst_id": app.InstID}).
+		Where(`EXISTS (SELECT sche_id FROM schedule WHERE inst_id = ? AND sche_id = ?)`, app.InstID, app.ScheID)
 
 	if doctID != nil {
 		query = query.Where(`EXISTS (SELECT sche_id FROM schedule WHERE doct_id = ? AND sche_id = ?)`, doctID, app.ScheID)
@@ -229,11 +233,11 @@ func updateAppointment(db service.DB, app *m.Appointment, doctID *uuid.UUID) (*m
 }
 
 /* Delete Appointment to database by appo_id */
-func deleteAppointment(db service.DB, appoID uuid.UUID) (*m.Appointment, error) {
+func deleteAppointment(db service.DB, instID, appoID uuid.UUID) (*m.Appointment, error) {
 	app := m.Appointment{}
 	query := psql.Delete("appointment").
 		Suffix("RETURNING *").
-		Where(sq.Eq{"appo_id": appoID})
+		Where(sq.Eq{"appo_id": appoID, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
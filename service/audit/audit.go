@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+var nullJSON = types.JSONText("null")
+
+// fields never written to the log
+var sensitive = map[string]bool{
+	"password":     true,
+	"totp_secret":  true,
+	"totpSecret":   true,
+	"key_secret":   true,
+	"key_hash":     true,
+	"token_hash":   true,
+	"refresh_hash": true,
+	"verification": true,
+}
+
+// Recorder service saves an audit entry, the diff is computed from before and after
+type Recorder struct {
+	DB *sqlx.DB
+}
+
+// Snapshotter service returns an entity row as json
+type Snapshotter struct {
+	DB *sqlx.DB
+}
+
+// Lister service returns a page of the audit log
+type Lister struct {
+	DB *sqlx.DB
+}
+
+// Run saves the entry
+func (r *Recorder) Run(e *m.AuditEntry) error {
+	var err error
+	e.AudiID, err = uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	e.Before, err = redact(e.Before)
+	if err != nil {
+		return err
+	}
+	e.After, err = redact(e.After)
+	if err != nil {
+		return err
+	}
+	e.Diff, err = Diff(e.Before, e.After)
+	if err != nil {
+		return err
+	}
+	e.CreatedAt = time.Now()
+	return createEntry(r.DB, e)
+}
+
+// Run returns the row of table whose key column is id, null if there's none.
+// Rows of tables shared by the institutions are read with a nil instID
+func (s *Snapshotter) Run(instID *uuid.UUID, table, key, id string) (types.JSONText, error) {
+	return snapshot(s.DB, instID, table, key, id)
+}
+
+// Run returns the entries matching the filter, newest first, and how many match
+func (l *Lister) Run(instID uuid.UUID, f m.FilterAudit) ([]m.AuditEntry, int64, error) {
+	return listEntries(l.DB, instID, f)
+}
+
+/* createEntry inserts an audit entry */
+func createEntry(db service.DB, e *m.AuditEntry) error {
+	query := psql.Insert("audit_log").
+		Columns("audi_id", "inst_id", "actor_id", "impersonated_user_id", "action", "method", "route", "entity_type", "entity_id", "before", "after", "diff", "ip", "created_at").
+		Values(e.AudiID, e.InstID, e.ActorID, e.ImpersonatedUserID, e.Action, e.Method, e.Route, e.EntityType, e.EntityID, e.Before, e.After, e.Diff, e.IP, e.CreatedAt)
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating audit entry insert sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error saving audit entry")
+	}
+	return nil
+}
+
+/* snapshot reads a row as json, table and key come from code never from requests */
+func snapshot(db service.DB, instID *uuid.UUID, table, key, id string) (types.JSONText, error) {
+	row := types.JSONText{}
+	qSQL := fmt.Sprintf("SELECT row_to_json(t) FROM %s t WHERE t.%s::text = $1",
+		pq.QuoteIdentifier(table), pq.QuoteIdentifier(key))
+	args := []interface{}{id}
+	if instID != nil {
+		qSQL += " AND t.inst_id = $2"
+		args = append(args, *instID)
+	}
+	rows, err := db.Query(qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting "+table+" snapshot")
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nullJSON, rows.Err()
+	}
+	err = rows.Scan(&row)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading "+table+" snapshot")
+	}
+	return row, nil
+}
+
+/* listEntries returns a page of entries and the total matching the filter */
+func listEntries(db service.DB, instID uuid.UUID, f m.FilterAudit) ([]m.AuditEntry, int64, error) {
+	es := []m.AuditEntry{}
+	query := psql.Select("*, count(*) OVER () AS total").
+		From("audit_log").
+		Where(sq.Eq{"inst_id": instID}).
+		OrderBy("created_at DESC")
+
+	if f.ActorID != nil {
+		query = query.Where(sq.Eq{"actor_id": f.ActorID})
+	}
+	if f.Impersonated != nil {
+		if *f.Impersonated {
+			query = query.Where("impersonated_user_id IS NOT NULL")
+		} else {
+			query = query.Where("impersonated_user_id IS NULL")
+		}
+	}
+	if f.Action != nil {
+		query = query.Where(sq.Eq{"action": f.Action})
+	}
+	if f.EntityType != nil {
+		query = query.Where(sq.Eq{"entity_type": f.EntityType})
+	}
+	if f.EntityID != nil {
+		query = query.Where(sq.Eq{"entity_id": f.EntityID})
+	}
+	if f.InitialDate != nil {
+		query = query.Where(sq.GtOrEq{"created_at": f.InitialDate})
+	}
+	if f.FinishDate != nil {
+		query = query.Where(sq.LtOrEq{"created_at": f.FinishDate})
+	}
+	if f.Limit != nil {
+		query = query.Limit(uint64(*f.Limit))
+	}
+	if f.Offset != nil {
+		query = query.Offset(uint64(*f.Offset))
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Error generating audit list sql")
+	}
+	rows := []struct {
+		m.AuditEntry
+		Total int64 `db:"total"`
+	}{}
+	err = db.Select(&rows, qSQL, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Error listing audit entries")
+	}
+	var total int64
+	for _, r := range rows {
+		es = append(es, r.AuditEntry)
+		total = r.Total
+	}
+	return es, total, nil
+}
+
+// redact removes the sensitive fields of a json object
+func redact(j types.JSONText) (types.JSONText, error) {
+	if len(j) == 0 {
+		return nullJSON, nil
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(j, &obj); err != nil {
+		// not an object, nothing to hide
+		return j, nil
+	}
+	found := false
+	for k := range obj {
+		if sensitive[k] {
+			delete(obj, k)
+			found = true
+		}
+	}
+	if !found {
+		return j, nil
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error redacting audit data")
+	}
+	return types.JSONText(b), nil
+}
@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/pkg/errors"
+)
+
+// Change is the before and after value of a changed field
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff returns the fields that differ between two json objects. A missing
+// object, on create or delete, has every field of the other one changed
+func Diff(before, after types.JSONText) (types.JSONText, error) {
+	b, err := object(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := object(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]Change{}
+	for k, bv := range b {
+		av, ok := a[k]
+		if !ok || !reflect.DeepEqual(bv, av) {
+			changes[k] = Change{Before: bv, After: av}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{After: av}
+		}
+	}
+	d, err := json.Marshal(changes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error encoding audit diff")
+	}
+	return types.JSONText(d), nil
+}
+
+// object decodes a json object, null or empty is an empty object
+func object(j types.JSONText) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+	if len(j) == 0 {
+		return obj, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(j, &v); err != nil {
+		return nil, errors.Wrap(err, "Invalid audit json")
+	}
+	if o, ok := v.(map[string]interface{}); ok {
+		return o, nil
+	}
+	return obj, nil
+}
@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		name          string
+		before, after string
+		want          map[string]Change
+	}{
+		{"create", `null`, `{"id":1,"name":"a"}`, map[string]Change{
+			"id":   {After: 1.0},
+			"name": {After: "a"},
+		}},
+		{"delete", `{"id":1}`, `null`, map[string]Change{
+			"id": {Before: 1.0},
+		}},
+		{"update", `{"id":1,"name":"a","tags":["x"]}`, `{"id":1,"name":"b","tags":["x"]}`, map[string]Change{
+			"name": {Before: "a", After: "b"},
+		}},
+		{"nested", `{"info":{"a":1}}`, `{"info":{"a":2}}`, map[string]Change{
+			"info": {Before: map[string]interface{}{"a": 1.0}, After: map[string]interface{}{"a": 2.0}},
+		}},
+		{"unchanged", `{"id":1}`, `{"id":1}`, map[string]Change{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := Diff(types.JSONText(c.before), types.JSONText(c.after))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]Change{}
+			if err := json.Unmarshal(d, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Diff(%s, %s) = %v, want %v", c.before, c.after, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r, err := redact(types.JSONText(`{"user_id":"u","password":"x","totp_secret":"s"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(r, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["user_id"] != "u" {
+		t.Errorf("redact left %v", got)
+	}
+}
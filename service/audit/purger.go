@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"log"
+	"time"
+
+	"github.com/jasonlvhit/gocron"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	sq "github.com/elgris/sqrl"
+)
+
+//Purger service to delete audit entries older than the retention
+type Purger struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+	// Retention is how long entries are kept, zero keeps them forever
+	Retention time.Duration
+}
+
+// Start runs the purge every day
+func (p *Purger) Start() chan bool {
+	p.Run()
+	s := gocron.NewScheduler()
+	s.Every(1).Day().Do(p.Run)
+	return s.Start()
+}
+
+//Run deletes the entries older than the retention
+func (p *Purger) Run() error {
+	if p.Retention <= 0 {
+		return nil
+	}
+	n, err := purgeEntries(p.DB, time.Now().Add(-p.Retention))
+	if err != nil {
+		if p.Logger != nil {
+			p.Logger.Println(err)
+		}
+		return err
+	}
+	if p.Logger != nil && n > 0 {
+		p.Logger.Printf("purged %d audit entries", n)
+	}
+	return nil
+}
+
+/* Delete audit entries created before the given time */
+func purgeEntries(db *sqlx.DB, before time.Time) (int64, error) {
+	query := psql.Delete("audit_log").
+		Where(sq.Lt{"created_at": before})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error generating purge audit sql")
+	}
+	res, err := db.Exec(qSQL, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error purging audit entries")
+	}
+	return res.RowsAffected()
+}
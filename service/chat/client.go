@@ -39,6 +39,7 @@ var upgrader = websocket.Upgrader{
 type Client struct {
 	hub        *Hub
 	identifier string
+	instID     string
 
 	// The websocket connection.
 	conn *websocket.Conn
@@ -136,14 +137,15 @@ func (c *Client) writePump() {
 	}
 }
 
-// ServeWs handles websocket requests from the peer.
-func ServeWs(hub *Hub, id string, w http.ResponseWriter, r *http.Request) {
+// ServeWs handles websocket requests from the peer, instID is the
+// institution the peer belongs to.
+func ServeWs(hub *Hub, id, instID string, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		hub.logger.Println(err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), identifier: id}
+	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), identifier: id, instID: instID}
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
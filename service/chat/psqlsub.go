@@ -3,6 +3,7 @@ package chat
 import (
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/lib/pq"
@@ -18,12 +19,15 @@ type pgnotification struct {
 type Subscriber struct {
 	Logger   *log.Logger
 	Listener *pq.Listener
+
+	mu       sync.RWMutex
+	handlers map[string]func(payload string)
 }
 
 // NewSubscriber returns a new Subscriber
 func NewSubscriber(l *pq.Listener) (*Subscriber, error) {
 	// Create a Subscriber and start handling connections
-	pb := &Subscriber{Listener: l}
+	pb := &Subscriber{Listener: l, handlers: map[string]func(string){}}
 	go pb.handleIncomingNotifications()
 
 	// Return the pgBroadcaster
@@ -36,6 +40,15 @@ func (pb *Subscriber) Listen(pgchannel string) error {
 	return pb.Listener.Listen(pgchannel)
 }
 
+// Subscribe listens to the channel and calls fn with the payload of each
+// notification sent to it
+func (pb *Subscriber) Subscribe(pgchannel string, fn func(payload string)) error {
+	pb.mu.Lock()
+	pb.handlers[pgchannel] = fn
+	pb.mu.Unlock()
+	return pb.Listen(pgchannel)
+}
+
 func (pb *Subscriber) handleIncomingNotifications() {
 	for {
 		select {
@@ -45,6 +58,13 @@ func (pb *Subscriber) handleIncomingNotifications() {
 			if n == nil {
 				continue
 			}
+			pb.mu.RLock()
+			fn, ok := pb.handlers[n.Channel]
+			pb.mu.RUnlock()
+			if ok {
+				fn(n.Extra)
+				continue
+			}
 			// Unmarshal JSON in pgnotification struct
 			var pgn pgnotification
 			_ = json.Unmarshal([]byte(n.Extra), &pgn)
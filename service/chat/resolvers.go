@@ -47,8 +47,8 @@ func getClientsStatusResolver(d *incomming) error {
 
 	activeClients := map[string]bool{}
 	for _, id := range in.Clients {
-		_, ok := d.client.hub.clients[id]
-		activeClients[id] = ok
+		c, ok := d.client.hub.clients[id]
+		activeClients[id] = ok && c.instID == d.client.instID
 	}
 	p, err := json.Marshal(activeClients)
 	if err != nil {
@@ -95,6 +95,7 @@ func sendMessageResolver(d *incomming) error {
 	receiverGroup := in.Groups[0]
 
 	m := &m.Message{
+		InstID:     uuid.FromStringOrNil(d.client.instID),
 		FromUserID: uuid.FromStringOrNil(sender),
 		ProrID:     receiverGroup,
 		Type:       in.Message.Type,
@@ -185,6 +186,7 @@ func listMessagesResolver(d *incomming) error {
 	}
 
 	f := m.FilterMessage{
+		InstID:   uuid.FromStringOrNil(d.client.instID),
 		Limit:    in.Limit,
 		BeforeID: in.BeforeID,
 		GroupID:  in.GroupID,
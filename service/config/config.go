@@ -3,6 +3,7 @@ package config
 import (
 	"database/sql"
 
+	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"gitlab.com/falqon/inovantapp/backend/service"
@@ -19,7 +20,8 @@ type Creator struct {
 }
 
 //Run create new Config
-func (c *Creator) Run(con *m.Config) (*m.Config, error) {
+func (c *Creator) Run(instID uuid.UUID, con *m.Config) (*m.Config, error) {
+	con.InstID = instID
 	u, err := createConfig(c.DB, con)
 	return u, err
 }
@@ -30,8 +32,8 @@ type Lister struct {
 }
 
 //Run return a list of Config by Filter
-func (l *Lister) Run(f m.FilterConfig) ([]m.Config, error) {
-	u, err := listConfig(l.DB, f)
+func (l *Lister) Run(instID uuid.UUID, f m.FilterConfig) ([]m.Config, error) {
+	u, err := listConfig(l.DB, instID, f)
 	return u, err
 }
 
@@ -41,8 +43,8 @@ type Getter struct {
 }
 
 //Run return a Config by key
-func (g *Getter) Run(key string) (*m.Config, error) {
-	u, err := getConfig(g.DB, key)
+func (g *Getter) Run(instID uuid.UUID, key string) (*m.Config, error) {
+	u, err := getConfig(g.DB, instID, key)
 	return u, err
 }
 
@@ -52,7 +54,8 @@ type Updater struct {
 }
 
 //Run update Config data
-func (g *Updater) Run(con *m.Config) (*m.Config, error) {
+func (g *Updater) Run(instID uuid.UUID, con *m.Config) (*m.Config, error) {
+	con.InstID = instID
 	u, err := updateConfig(g.DB, con)
 	return u, err
 }
@@ -63,16 +66,16 @@ type Deleter struct {
 }
 
 //Run soft delete Config by key
-func (d *Deleter) Run(key string) (*m.Config, error) {
-	u, err := deleteConfig(d.DB, key)
+func (d *Deleter) Run(instID uuid.UUID, key string) (*m.Config, error) {
+	u, err := deleteConfig(d.DB, instID, key)
 	return u, err
 }
 
 /* Create a new Config to database */
 func createConfig(db service.DB, con *m.Config) (*m.Config, error) {
 	query := psql.Insert("config").
-		Columns("key", "value").
-		Values(con.Key, con.Value).
+		Columns("inst_id", "key", "value").
+		Values(con.InstID, con.Key, con.Value).
 		Suffix("RETURNING *")
 
 	qSQL, args, err := query.ToSql()
@@ -88,10 +91,11 @@ func createConfig(db service.DB, con *m.Config) (*m.Config, error) {
 }
 
 /* Return a list of Config by filters */
-func listConfig(db service.DB, f m.FilterConfig) ([]m.Config, error) {
+func listConfig(db service.DB, instID uuid.UUID, f m.FilterConfig) ([]m.Config, error) {
 	con := []m.Config{}
-	query := psql.Select("key", "value").
-		From("config")
+	query := psql.Select("inst_id", "key", "value").
+		From("config").
+		Where(sq.Eq{"inst_id": instID})
 
 	if f.Key != nil {
 		query = query.Where(`key = ?`, f.Key)
@@ -118,11 +122,11 @@ func listConfig(db service.DB, f m.FilterConfig) ([]m.Config, error) {
 }
 
 /* Return a Config by key */
-func getConfig(db service.DB, key string) (*m.Config, error) {
+func getConfig(db service.DB, instID uuid.UUID, key string) (*m.Config, error) {
 	con := m.Config{}
-	query := psql.Select("key", "value").
+	query := psql.Select("inst_id", "key", "value").
 		From("config").
-		Where(sq.Eq{"key": key})
+		Where(sq.Eq{"key": key, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -143,7 +147,7 @@ func updateConfig(db service.DB, con *m.Config) (*m.Config, error) {
 	query := psql.Update("config").
 		Set("label", con.Value).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"key": con.Key})
+		Where(sq.Eq{"key": con.Key, "inst_id": con.InstID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -159,11 +163,11 @@ func updateConfig(db service.DB, con *m.Config) (*m.Config, error) {
 }
 
 /* Delete Config to database by key */
-func deleteConfig(db service.DB, key string) (*m.Config, error) {
+func deleteConfig(db service.DB, instID uuid.UUID, key string) (*m.Config, error) {
 	con := m.Config{}
 	query := psql.Delete("config").
 		Suffix("RETURNING *").
-		Where(sq.Eq{"key": key})
+		Where(sq.Eq{"key": key, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
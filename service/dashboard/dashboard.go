@@ -3,6 +3,7 @@ package dashboard
 import (
 	"database/sql"
 
+	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"gitlab.com/falqon/inovantapp/backend/service"
@@ -19,21 +20,22 @@ type Viewer struct {
 }
 
 //Run Dashboard
-func (v *Viewer) Run(fDashboard m.FilterDashboard) ([]m.Dashboard, error) {
-	u, err := checkDashboard(v.DB, fDashboard)
+func (v *Viewer) Run(instID uuid.UUID, fDashboard m.FilterDashboard) ([]m.Dashboard, error) {
+	u, err := checkDashboard(v.DB, instID, fDashboard)
 	return u, err
 }
 
 /* Query to view dashboard */
-func checkDashboard(db service.DB, f m.FilterDashboard) ([]m.Dashboard, error) {
+func checkDashboard(db service.DB, instID uuid.UUID, f m.FilterDashboard) ([]m.Dashboard, error) {
 	ava := []m.Dashboard{}
-	args := []interface{}{f.DoctID, f.StartDate, f.EndDate}
+	args := []interface{}{f.DoctID, f.StartDate, f.EndDate, instID}
 	query :=
 		`SELECT doct_id, start_at, end_at, plan
 		FROM schedule
 		WHERE start_at >= $2::TIMESTAMP
 		AND end_at <= $3::TIMESTAMP
 		AND doct_id = $1
+		AND inst_id = $4
 		AND deleted_at IS NULL`
 	err := db.Select(&ava, query, args...)
 	if err != nil {
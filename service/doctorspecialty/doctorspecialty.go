@@ -22,8 +22,8 @@ type Creator struct {
 }
 
 //Run create new DoctorSpecialty
-func (c *Creator) Run(doc *m.DoctorSpecialty) (*m.DoctorSpecialty, error) {
-	u, err := createDoctorSpecialty(c.DB, doc)
+func (c *Creator) Run(instID uuid.UUID, doc *m.DoctorSpecialty) (*m.DoctorSpecialty, error) {
+	u, err := createDoctorSpecialty(c.DB, instID, doc)
 	return u, err
 }
 
@@ -33,8 +33,8 @@ type Lister struct {
 }
 
 //Run return a list of Production Orders by Filter
-func (l *Lister) Run(f m.FilterDoctorSpecialty) ([]m.DoctorSpecialty, error) {
-	u, err := listDoctorSpecialty(l.DB, f)
+func (l *Lister) Run(instID uuid.UUID, f m.FilterDoctorSpecialty) ([]m.DoctorSpecialty, error) {
+	u, err := listDoctorSpecialty(l.DB, instID, f)
 	return u, err
 }
 
@@ -44,8 +44,8 @@ type Getter struct {
 }
 
 //Run return a doctorSpecialty of Production Orders by doct_id
-func (g *Getter) Run(doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error) {
-	u, err := getDoctorSpecialty(g.DB, doctID, specID)
+func (g *Getter) Run(instID, doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error) {
+	u, err := getDoctorSpecialty(g.DB, instID, doctID, specID)
 	return u, err
 }
 
@@ -55,8 +55,8 @@ type Updater struct {
 }
 
 //Run update DoctorSpecialty data
-func (g *Updater) Run(po *m.DoctorSpecialty) (*m.DoctorSpecialty, error) {
-	u, err := updateDoctorSpecialty(g.DB, po)
+func (g *Updater) Run(instID uuid.UUID, po *m.DoctorSpecialty) (*m.DoctorSpecialty, error) {
+	u, err := updateDoctorSpecialty(g.DB, instID, po)
 	return u, err
 }
 
@@ -66,24 +66,21 @@ type Deleter struct {
 }
 
 //Run soft delete DoctorSpecialty by doct_id
-func (d *Deleter) Run(doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error) {
-	u, err := deleteDoctorSpecialty(d.DB, doctID, specID)
+func (d *Deleter) Run(instID, doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error) {
+	u, err := deleteDoctorSpecialty(d.DB, instID, doctID, specID)
 	return u, err
 }
 
-/* Create a new DoctorSpecialty to database */
-func createDoctorSpecialty(db service.DB, doc *m.DoctorSpecialty) (*m.DoctorSpecialty, error) {
-	query := psql.Insert("doctor_specialty").
-		Columns("doct_id", "spec_id").
-		Values(doc.DoctID, doc.SpecID).
-		Suffix("RETURNING *")
+/* Create a new DoctorSpecialty to database, doctor and specialty must belong to the institution */
+func createDoctorSpecialty(db service.DB, instID uuid.UUID, doc *m.DoctorSpecialty) (*m.DoctorSpecialty, error) {
+	qSQL := `INSERT INTO doctor_specialty (doct_id, spec_id)
+		SELECT d.doct_id, s.spec_id
+		FROM doctor d
+		JOIN specialty s ON s.spec_id = $2 AND s.inst_id = d.inst_id
+		WHERE d.doct_id = $1 AND d.inst_id = $3
+		RETURNING *`
 
-	qSQL, args, err := query.ToSql()
-	if err != nil {
-		return nil, errors.Wrap(err, "Error generating DoctorSpecialty sql")
-	}
-
-	err = db.Get(doc, qSQL, args...)
+	err := db.Get(doc, qSQL, doc.DoctID, doc.SpecID, instID)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error inserting DoctorSpecialty in database")
 	}
@@ -91,10 +88,11 @@ func createDoctorSpecialty(db service.DB, doc *m.DoctorSpecialty) (*m.DoctorSpec
 }
 
 /* Return a list of DoctorSpecialty by filters */
-func listDoctorSpecialty(db service.DB, f m.FilterDoctorSpecialty) ([]m.DoctorSpecialty, error) {
+func listDoctorSpecialty(db service.DB, instID uuid.UUID, f m.FilterDoctorSpecialty) ([]m.DoctorSpecialty, error) {
 	doc := []m.DoctorSpecialty{}
 	query := psql.Select("doct_id", "spec_id", "created_at").
-		From("doctor_specialty")
+		From("doctor_specialty").
+		Where(`doct_id IN (SELECT doct_id FROM doctor WHERE inst_id = ?)`, instID)
 
 	if f.DoctID != nil {
 		query = query.Where(`doct_id = ?`, f.DoctID)
@@ -124,11 +122,12 @@ func listDoctorSpecialty(db service.DB, f m.FilterDoctorSpecialty) ([]m.DoctorSp
 }
 
 /* Return a DoctorSpecialty by doct_id */
-func getDoctorSpecialty(db service.DB, doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error) {
+func getDoctorSpecialty(db service.DB, instID, doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error) {
 	doc := m.DoctorSpecialty{}
 	query := psql.Select("doct_id", "spec_id", "created_at").
 		From("doctor_specialty").
-		Where(sq.Eq{"doct_id": doctID, "spec_id": specID})
+		Where(sq.Eq{"doct_id": doctID, "spec_id": specID}).
+		Where(`doct_id IN (SELECT doct_id FROM doctor WHERE inst_id = ?)`, instID)
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -145,12 +144,14 @@ func getDoctorSpecialty(db service.DB, doctID uuid.UUID, specID int64) (*m.Docto
 }
 
 /* Update DoctorSpecialty to database by doct_id */
-func updateDoctorSpecialty(db service.DB, doc *m.DoctorSpecialty) (*m.DoctorSpecialty, error) {
+func updateDoctorSpecialty(db service.DB, instID uuid.UUID, doc *m.DoctorSpecialty) (*m.DoctorSpecialty, error) {
 	query := psql.Update("doctor_specialty").
 		Set("doct_id", doc.DoctID).
 		Set("spec_id", doc.SpecID).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"doct_id": doc.DoctID})
+		Where(sq.Eq{"doct_id": doc.DoctID}).
+		Where(`doct_id IN (SELECT doct_id FROM doctor WHERE inst_id = ?)`, instID).
+		Where(`EXISTS (SELECT 1 FROM specialty WHERE spec_id = ? AND inst_id = ?)`, doc.SpecID, instID)
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -166,11 +167,12 @@ func updateDoctorSpecialty(db service.DB, doc *m.DoctorSpecialty) (*m.DoctorSpec
 }
 
 /* Delete DoctorSpecialty to database by doct_id */
-func deleteDoctorSpecialty(db service.DB, doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error) {
+func deleteDoctorSpecialty(db service.DB, instID, doctID uuid.UUID, specID int64) (*m.DoctorSpecialty, error) {
 	spe := m.DoctorSpecialty{}
 	query := psql.Delete("doctor_specialty").
 		Suffix("RETURNING *").
-		Where(sq.Eq{"doct_id": doctID, "spec_id": specID})
+		Where(sq.Eq{"doct_id": doctID, "spec_id": specID}).
+		Where(`doct_id IN (SELECT doct_id FROM doctor WHERE inst_id = ?)`, instID)
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
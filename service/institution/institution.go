@@ -0,0 +1,252 @@
+package institution
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+// InviteFunc invites a user into an institution, actorID is the one inviting
+type InviteFunc func(instID uuid.UUID, u *m.User, actorID uuid.UUID) (*m.Invitation, error)
+
+//Creator service to provision a new Institution
+type Creator struct {
+	DB *sqlx.DB
+	// Invite sends the invitation of the first admin of the institution
+	Invite InviteFunc
+}
+
+//Run create new Institution with the config of the institution fromInstID
+//and invites adminEmail as its admin
+func (c *Creator) Run(fromInstID uuid.UUID, inst *m.Institution, adminEmail string, actorID uuid.UUID) (*m.Institution, error) {
+	instID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating Institution uuid")
+	}
+	inst.InstID = instID
+
+	tx, err := c.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	i, err := createInstitution(tx, inst)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = copyConfig(tx, fromInstID, instID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit Institution")
+	}
+
+	// the invitation has its own transaction, undo the institution if it fails
+	_, err = c.Invite(instID, &m.User{Email: adminEmail, Roles: []string{"admin"}}, actorID)
+	if err != nil {
+		if derr := dropInstitution(c.DB, instID); derr != nil {
+			return nil, errors.Wrap(derr, err.Error())
+		}
+		return nil, err
+	}
+	return i, nil
+}
+
+//Lister service to return Institution
+type Lister struct {
+	DB *sqlx.DB
+}
+
+//Run return a list of Institution by Filter
+func (l *Lister) Run(f m.FilterInstitution) ([]m.Institution, error) {
+	return listInstitution(l.DB, f)
+}
+
+//Getter service to return Institution
+type Getter struct {
+	DB *sqlx.DB
+}
+
+//Run return a Institution by inst_id
+func (g *Getter) Run(instID uuid.UUID) (*m.Institution, error) {
+	return getInstitution(g.DB, instID)
+}
+
+//Updater service to update Institution
+type Updater struct {
+	DB *sqlx.DB
+}
+
+//Run update Institution data, inactivating it revokes the sessions of its
+//users and its device keys
+func (u *Updater) Run(inst *m.Institution) (*m.Institution, error) {
+	tx, err := u.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	i, err := updateInstitution(tx, inst)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if i.InactiveAt.Valid {
+		err = revokeAccess(tx, i.InstID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit Institution")
+	}
+	return i, nil
+}
+
+/* Create a new Institution to database */
+func createInstitution(db service.DB, inst *m.Institution) (*m.Institution, error) {
+	query := psql.Insert("institution").
+		Columns("inst_id", "name").
+		Values(inst.InstID, inst.Name).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating Institution sql")
+	}
+
+	err = db.Get(inst, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error inserting Institution in database")
+	}
+	return inst, nil
+}
+
+/* Copy the config keys of an institution to another */
+func copyConfig(db service.DB, fromInstID, toInstID uuid.UUID) error {
+	qSQL := `INSERT INTO config (inst_id, key, value)
+		SELECT $1, key, value FROM config WHERE inst_id = $2`
+	_, err := db.Exec(qSQL, toInstID, fromInstID)
+	if err != nil {
+		return errors.Wrap(err, "Error copying Institution config")
+	}
+	return nil
+}
+
+/* Remove an Institution that failed to be provisioned */
+func dropInstitution(db *sqlx.DB, instID uuid.UUID) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	for _, qSQL := range []string{
+		`DELETE FROM config WHERE inst_id = $1`,
+		`DELETE FROM institution WHERE inst_id = $1`,
+	} {
+		_, err = tx.Exec(qSQL, instID)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "Error removing Institution")
+		}
+	}
+	return tx.Commit()
+}
+
+/* Return a list of Institution by filters */
+func listInstitution(db service.DB, f m.FilterInstitution) ([]m.Institution, error) {
+	inst := []m.Institution{}
+	query := psql.Select("inst_id", "name", "created_at", "inactive_at").
+		From("institution").
+		OrderBy("name")
+
+	if f.Name != nil {
+		query = query.Where(`name ILIKE ?`, `%`+*f.Name+`%`)
+	}
+	if f.Limit != nil {
+		query = query.Limit(uint64(*f.Limit))
+	}
+	if f.Offset != nil {
+		query = query.Offset(uint64(*f.Offset))
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list of Institutions sql")
+	}
+	err = db.Select(&inst, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error list of Institutions sql")
+		}
+		return nil, nil
+	}
+	return inst, nil
+}
+
+/* Return a Institution by inst_id */
+func getInstitution(db service.DB, instID uuid.UUID) (*m.Institution, error) {
+	inst := m.Institution{}
+	query := psql.Select("inst_id", "name", "created_at", "inactive_at").
+		From("institution").
+		Where(sq.Eq{"inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get Institution sql")
+	}
+	err = db.Get(&inst, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error get Institution sql")
+	}
+	return &inst, nil
+}
+
+/* Update Institution by inst_id */
+func updateInstitution(db service.DB, inst *m.Institution) (*m.Institution, error) {
+	query := psql.Update("institution").
+		Set("name", inst.Name).
+		Set("inactive_at", inst.InactiveAt).
+		Where(sq.Eq{"inst_id": inst.InstID}).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating update Institution sql")
+	}
+	err = db.Get(inst, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error update Institution sql")
+	}
+	return inst, nil
+}
+
+/* Revoke the sessions and device keys of an Institution */
+func revokeAccess(db service.DB, instID uuid.UUID) error {
+	now := time.Now()
+	qSQL := `UPDATE user_session SET revoked_at = $1
+		WHERE revoked_at IS NULL
+		AND user_id IN (SELECT user_id FROM "user" WHERE inst_id = $2)`
+	_, err := db.Exec(qSQL, now, instID)
+	if err != nil {
+		return errors.Wrap(err, "Error revoking Institution sessions")
+	}
+	qSQL = `UPDATE device_key SET revoked_at = $1
+		WHERE revoked_at IS NULL AND inst_id = $2`
+	_, err = db.Exec(qSQL, now, instID)
+	if err != nil {
+		return errors.Wrap(err, "Error revoking Institution device keys")
+	}
+	return nil
+}
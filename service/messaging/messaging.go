@@ -46,8 +46,8 @@ type GetUsersForMessage struct {
 // Run inserts a new auto response into the database
 func (u *MessageCreator) Run(t *m.Message) (*m.Message, error) {
 	query := psql.Insert("message").
-		Columns("pror_id", "type", "from_user_id", "value", "data").
-		Values(t.ProrID, t.Type, t.FromUserID, t.TextValue, t.Data).
+		Columns("inst_id", "pror_id", "type", "from_user_id", "value", "data").
+		Values(t.InstID, t.ProrID, t.Type, t.FromUserID, t.TextValue, t.Data).
 		Suffix("RETURNING *")
 
 	qSQL, args, err := query.ToSql()
@@ -94,7 +94,7 @@ func (u *MessageReadCreator) Run(messID []int64, targets []string) ([]string, er
 // Run return a list of messages
 func (u *MessageLister) Run(f m.FilterMessage) ([]m.ChatMessage, error) {
 	sel := []string{"fromu.name as from_user_name, coalesce(rb.readers, '[]') as read_by"}
-	sel = append(sel, "message.created_at", "data", "from_user_id", "mess_id", "type", "value")
+	sel = append(sel, "message.inst_id", "message.created_at", "data", "from_user_id", "mess_id", "type", "value")
 	query := psql.Select(sel...).
 		Prefix(`with readers as (select mess_id, json_agg(user_id) as readers from message_read group by mess_id)`).
 		From(m.Message{}.Name()).
@@ -103,6 +103,7 @@ func (u *MessageLister) Run(f m.FilterMessage) ([]m.ChatMessage, error) {
 		Where(sq.Or{
 			sq.Eq{"message.pror_id": f.GroupID},
 		}).
+		Where(sq.Eq{"message.inst_id": f.InstID}).
 		OrderBy("mess_id DESC")
 
 	if f.Limit != nil {
@@ -244,6 +245,7 @@ func (u *GetUsersForMessage) Run(messID int64) ([]string, error) {
 	query := psql.Select("array_agg(upo.user_id) as campo").
 		From("message mess").
 		LeftJoin("user_production_order upo USING (pror_id)").
+		Join(`"user" u ON u.user_id = upo.user_id AND u.inst_id = mess.inst_id`).
 		Where(sq.Eq{"mess_id": messID})
 
 	qSQL, args, err := query.ToSql()
@@ -20,12 +20,13 @@ type Creator struct {
 }
 
 //Run create new Patient
-func (c *Creator) Run(pat *m.Patient) (*m.Patient, error) {
+func (c *Creator) Run(instID uuid.UUID, pat *m.Patient) (*m.Patient, error) {
 	patiID, err := uuid.NewV4()
 	if err != nil {
 		return nil, errors.Wrap(err, "Error generating Patient uuid")
 	}
 	pat.PatiID = patiID
+	pat.InstID = instID
 	u, err := createPatient(c.DB, pat)
 	return u, err
 }
@@ -36,8 +37,8 @@ type Lister struct {
 }
 
 //Run return a list of Patient by Filter
-func (l *Lister) Run(doctID *uuid.UUID, f m.FilterPatient) ([]m.Patient, error) {
-	u, err := listPatient(l.DB, doctID, f)
+func (l *Lister) Run(instID uuid.UUID, doctID *uuid.UUID, f m.FilterPatient) ([]m.Patient, error) {
+	u, err := listPatient(l.DB, instID, doctID, f)
 	return u, err
 }
 
@@ -47,8 +48,8 @@ type Getter struct {
 }
 
 //Run return a Patient by pati_id
-func (g *Getter) Run(doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error) {
-	u, err := getPatient(g.DB, doctID, patiID)
+func (g *Getter) Run(instID uuid.UUID, doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error) {
+	u, err := getPatient(g.DB, instID, doctID, patiID)
 	return u, err
 }
 
@@ -58,7 +59,8 @@ type Updater struct {
 }
 
 //Run update Patient data
-func (g *Updater) Run(pat *m.Patient) (*m.Patient, error) {
+func (g *Updater) Run(instID uuid.UUID, pat *m.Patient) (*m.Patient, error) {
+	pat.InstID = instID
 	u, err := updatePatient(g.DB, pat)
 	return u, err
 }
@@ -69,24 +71,20 @@ type Deleter struct {
 }
 
 //Run soft delete Patient by pati_id
-func (d *Deleter) Run(doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error) {
-	u, err := deletePatient(d.DB, doctID, patiID)
+func (d *Deleter) Run(instID uuid.UUID, doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error) {
+	u, err := deletePatient(d.DB, instID, doctID, patiID)
 	return u, err
 }
 
-/* Create a new Patient to database */
+/* Create a new Patient to database, the doctor must belong to the same institution */
 func createPatient(db service.DB, pat *m.Patient) (*m.Patient, error) {
-	query := psql.Insert("patient").
-		Columns("pati_id", "doct_id", "name", "email", "info").
-		Values(pat.PatiID, pat.DoctID, pat.Name, pat.Email, pat.Info).
-		Suffix("RETURNING *")
+	qSQL := `INSERT INTO patient (pati_id, doct_id, name, email, info, inst_id)
+		SELECT $1, doct_id, $3, $4, $5, inst_id
+		FROM doctor
+		WHERE doct_id = $2 AND inst_id = $6
+		RETURNING *`
 
-	qSQL, args, err := query.ToSql()
-	if err != nil {
-		return nil, errors.Wrap(err, "Error generating Patient sql")
-	}
-
-	err = db.Get(pat, qSQL, args...)
+	err := db.Get(pat, qSQL, pat.PatiID, pat.DoctID, pat.Name, pat.Email, pat.Info, pat.InstID)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error inserting Patient in database")
 	}
@@ -94,19 +92,20 @@ func createPatient(db service.DB, pat *m.Patient) (*m.Patient, error) {
 }
 
 /* Return a list of Patient by filters */
-func listPatient(db service.DB, doctID *uuid.UUID, f m.FilterPatient) ([]m.Patient, error) {
+func listPatient(db service.DB, instID uuid.UUID, doctID *uuid.UUID, f m.FilterPatient) ([]m.Patient, error) {
 	pat := []m.Patient{}
-	query := psql.Select("pati_id", "doct_id", "pa.name as name", "email", "pa.info", "pa.created_at", "updated_at", "start_at AS last_appointment", "doc.name AS doct_name").
+	query := psql.Select("pati_id", "pa.inst_id", "doct_id", "pa.name as name", "email", "pa.info", "pa.created_at", "updated_at", "start_at AS last_appointment", "doc.name AS doct_name").
 		From("patient_appointment pa").
 		Join("doctor doc USING (doct_id)").
 		Where(sq.Eq{"ord_number": 1}).
 		OrderBy("name").
 		Prefix(
 			`WITH patient AS (
-				SELECT pati_id, doct_id, "name", email, info, pat.created_at, updated_at, app.start_at,
+				SELECT pati_id, pat.inst_id, doct_id, "name", email, info, pat.created_at, updated_at, app.start_at,
 				row_number() OVER(PARTITION BY pati_id ORDER BY app.start_at DESC) AS ord_number
 				FROM patient pat
 				LEFT JOIN appointment app USING (pati_id)
+				WHERE pat.inst_id = ?
 			),
 			available_appointments AS (
 				SELECT *
@@ -114,11 +113,11 @@ func listPatient(db service.DB, doctID *uuid.UUID, f m.FilterPatient) ([]m.Patie
 				WHERE start_at <= NOW() AND status = 'confirmed'
 			),
 			patient_appointment AS (
-				SELECT pati_id, doct_id, "name", email, info, pat.created_at, updated_at, app.start_at, app.status,
+				SELECT pati_id, pat.inst_id, doct_id, "name", email, info, pat.created_at, updated_at, app.start_at, app.status,
 				row_number() OVER(PARTITION BY pati_id ORDER BY app.start_at DESC) AS ord_number
 				FROM patient pat
 				LEFT JOIN available_appointments app USING (pati_id)
-			)`,
+			)`, instID,
 		)
 
 	if doctID != nil {
@@ -164,11 +163,11 @@ func listPatient(db service.DB, doctID *uuid.UUID, f m.FilterPatient) ([]m.Patie
 }
 
 /* Return a Patient by pati_id */
-func getPatient(db service.DB, doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error) {
+func getPatient(db service.DB, instID uuid.UUID, doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error) {
 	pat := m.Patient{}
-	query := psql.Select("pati_id", "doct_id", "name", "email", "info", "created_at", "updated_at").
+	query := psql.Select("pati_id", "inst_id", "doct_id", "name", "email", "info", "created_at", "updated_at").
 		From("patient").
-		Where(sq.Eq{"pati_id": patiID})
+		Where(sq.Eq{"pati_id": patiID, "inst_id": instID})
 
 	if doctID != nil {
 		query = query.Where(`doct_id = ?`, doctID)
@@ -196,7 +195,8 @@ func updatePatient(db service.DB, pat *m.Patient) (*m.Patient, error) {
 		Set("email", pat.Email).
 		Set("info", pat.Info).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"pati_id": pat.PatiID})
+		Where(sq.Eq{"pati_id": pat.PatiID, "inst_id": pat.InstID}).
+		Where(`EXISTS (SELECT 1 FROM doctor WHERE doct_id = ? AND inst_id = ?)`, pat.DoctID, pat.InstID)
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -212,11 +212,11 @@ func updatePatient(db service.DB, pat *m.Patient) (*m.Patient, error) {
 }
 
 /* Delete Patient to database by pati_id */
-func deletePatient(db service.DB, doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error) {
+func deletePatient(db service.DB, instID uuid.UUID, doctID *uuid.UUID, patiID uuid.UUID) (*m.Patient, error) {
 	pat := m.Patient{}
 	query := psql.Delete("patient").
 		Suffix("RETURNING *").
-		Where(sq.Eq{"pati_id": patiID})
+		Where(sq.Eq{"pati_id": patiID, "inst_id": instID})
 	if doctID != nil {
 		query = query.Where(`doct_id = ?`, doctID)
 	}
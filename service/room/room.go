@@ -21,12 +21,13 @@ type Creator struct {
 }
 
 //Run create new Room
-func (c *Creator) Run(rom *m.Room) (*m.Room, error) {
+func (c *Creator) Run(instID uuid.UUID, rom *m.Room) (*m.Room, error) {
 	roomID, err := uuid.NewV4()
 	if err != nil {
 		return nil, errors.Wrap(err, "Error generating Room uuid")
 	}
 	rom.RoomID = roomID
+	rom.InstID = instID
 	u, err := createRoom(c.DB, rom)
 	return u, err
 }
@@ -37,8 +38,8 @@ type Lister struct {
 }
 
 //Run return a list of Room by Filter
-func (l *Lister) Run(f m.FilterRoom) ([]m.Room, error) {
-	u, err := listRoom(l.DB, f)
+func (l *Lister) Run(instID uuid.UUID, f m.FilterRoom) ([]m.Room, error) {
+	u, err := listRoom(l.DB, instID, f)
 	return u, err
 }
 
@@ -48,8 +49,8 @@ type Getter struct {
 }
 
 //Run return a Room by room_id
-func (g *Getter) Run(roomID uuid.UUID) (*m.Room, error) {
-	u, err := getRoom(g.DB, roomID)
+func (g *Getter) Run(instID, roomID uuid.UUID) (*m.Room, error) {
+	u, err := getRoom(g.DB, instID, roomID)
 	return u, err
 }
 
@@ -59,7 +60,8 @@ type Updater struct {
 }
 
 //Run update Room data
-func (g *Updater) Run(rom *m.Room) (*m.Room, error) {
+func (g *Updater) Run(instID uuid.UUID, rom *m.Room) (*m.Room, error) {
+	rom.InstID = instID
 	u, err := updateRoom(g.DB, rom)
 	return u, err
 }
@@ -70,16 +72,16 @@ type Deleter struct {
 }
 
 //Run soft delete Room by room_id
-func (d *Deleter) Run(roomID uuid.UUID) (*m.Room, error) {
-	u, err := deleteRoom(d.DB, roomID)
+func (d *Deleter) Run(instID, roomID uuid.UUID) (*m.Room, error) {
+	u, err := deleteRoom(d.DB, instID, roomID)
 	return u, err
 }
 
 /* Create a new Room to database */
 func createRoom(db service.DB, rom *m.Room) (*m.Room, error) {
 	query := psql.Insert("room").
-		Columns("room_id", "label", "inactive_at", "info").
-		Values(rom.RoomID, rom.Label, rom.InactiveAt, rom.Info).
+		Columns("room_id", "inst_id", "label", "inactive_at", "info").
+		Values(rom.RoomID, rom.InstID, rom.Label, rom.InactiveAt, rom.Info).
 		Suffix("RETURNING *")
 
 	qSQL, args, err := query.ToSql()
@@ -95,10 +97,11 @@ func createRoom(db service.DB, rom *m.Room) (*m.Room, error) {
 }
 
 /* Return a list of Room by filters */
-func listRoom(db service.DB, f m.FilterRoom) ([]m.Room, error) {
+func listRoom(db service.DB, instID uuid.UUID, f m.FilterRoom) ([]m.Room, error) {
 	rom := []m.Room{}
-	query := psql.Select("room_id", "label", "inactive_at", "info").
-		From("room")
+	query := psql.Select("room_id", "inst_id", "label", "inactive_at", "info").
+		From("room").
+		Where(sq.Eq{"inst_id": instID})
 
 	if f.RoomID != nil {
 		query = query.Where(`room_id = ?`, f.RoomID)
@@ -128,11 +131,11 @@ func listRoom(db service.DB, f m.FilterRoom) ([]m.Room, error) {
 }
 
 /* Return a Room by room_id */
-func getRoom(db service.DB, roomID uuid.UUID) (*m.Room, error) {
+func getRoom(db service.DB, instID, roomID uuid.UUID) (*m.Room, error) {
 	rom := m.Room{}
-	query := psql.Select("room_id", "label", "inactive_at", "info").
+	query := psql.Select("room_id", "inst_id", "label", "inactive_at", "info").
 		From("room").
-		Where(sq.Eq{"room_id": roomID})
+		Where(sq.Eq{"room_id": roomID, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -155,7 +158,7 @@ func updateRoom(db service.DB, rom *m.Room) (*m.Room, error) {
 		Set("inactive_at", rom.InactiveAt).
 		Set("info", rom.Info).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"room_id": rom.RoomID})
+		Where(sq.Eq{"room_id": rom.RoomID, "inst_id": rom.InstID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -171,7 +174,7 @@ func updateRoom(db service.DB, rom *m.Room) (*m.Room, error) {
 }
 
 /* Delete Room to database by room_id */
-func deleteRoom(db service.DB, roomID uuid.UUID) (*m.Room, error) {
+func deleteRoom(db service.DB, instID, roomID uuid.UUID) (*m.Room, error) {
 	err := verifyRoomsToInactive(db, roomID)
 	if err != nil {
 		return nil, err
@@ -180,7 +183,7 @@ func deleteRoom(db service.DB, roomID uuid.UUID) (*m.Room, error) {
 	query := psql.Update("room").
 		Set("inactive_at", time.Now()).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"room_id": roomID})
+		Where(sq.Eq{"room_id": roomID, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -0,0 +1,349 @@
+// Package allocation picks the room of a booking from the rooms of an
+// institution, its opening hours, the bookings already made and its config.
+// The engine reads nothing by itself, Load gathers its Input from the database
+package allocation
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// Reasons no room could be allocated
+var (
+	// ErrTransition is returned when a room is free only without the transition time between doctors
+	ErrTransition = errors.New("The free rooms are within the transition time of another booking")
+	// ErrNoFeatures is returned when only rooms without the features the doctor needs are free
+	ErrNoFeatures = errors.New("No room with the features needed is free")
+	// ErrNoRoom is returned when every room is taken or closed
+	ErrNoRoom = errors.New("No room is free")
+	// ErrClosed is returned when the clinic is closed during the booking
+	ErrClosed = errors.New("The clinic is closed")
+)
+
+// Bathroom tells how the need of a bathroom by the doctor's specialties is treated
+type Bathroom int
+
+// Bathroom treatments
+const (
+	// BathroomIgnored rooms without a bathroom are chosen first, to keep the others free
+	BathroomIgnored Bathroom = iota
+	// BathroomPreferred rooms with a bathroom are chosen first
+	BathroomPreferred
+	// BathroomRequired only rooms with a bathroom are chosen
+	BathroomRequired
+)
+
+// Span is a time of day range, as durations since midnight
+type Span struct {
+	Start, End time.Duration
+}
+
+// Interval is a range of time
+type Interval struct {
+	StartAt time.Time
+	EndAt   time.Time
+}
+
+// Room that may be booked
+type Room struct {
+	ID          uuid.UUID
+	HasBathroom bool
+}
+
+// Booking already made in a room
+type Booking struct {
+	ScheID  uuid.UUID
+	DoctID  uuid.UUID
+	RoomID  uuid.UUID
+	StartAt time.Time
+	EndAt   time.Time
+}
+
+// Closure of the clinic, or of a room, between StartAt and EndAt
+type Closure struct {
+	// RoomID of the room closed, nil when the whole clinic is
+	RoomID  *uuid.UUID
+	StartAt time.Time
+	EndAt   time.Time
+	// Yearly closures repeat every year on the same local dates and times
+	Yearly bool
+}
+
+// Config of the institution
+type Config struct {
+	// Location of the institution, the days and opening hours are in it. Nil is UTC
+	Location *time.Location
+	// Opening spans by weekday. They are times of day in UTC, as kept in the
+	// schedule-hour_config_flex config, moved to the local time of each day
+	Opening map[time.Weekday][]Span
+	// Transition kept free in a room between the bookings of different doctors
+	Transition time.Duration
+	// Bathroom treatment for the doctor
+	Bathroom Bathroom
+}
+
+// Input of the engine for the bookings of a doctor
+type Input struct {
+	Config
+	DoctID uuid.UUID
+	// Rooms in the order they are chosen when nothing else tells them apart
+	Rooms  []Room
+	Booked []Booking
+	// Closures of the clinic and of the rooms
+	Closures []Closure
+}
+
+// Allocate returns the room to book for the doctor between startAt and endAt,
+// or why there is none
+func (in *Input) Allocate(startAt, endAt time.Time) (*Room, error) {
+	if !endAt.After(startAt) {
+		return nil, ErrNoRoom
+	}
+	if len(in.Closed(nil, startAt, endAt)) > 0 {
+		return nil, ErrClosed
+	}
+	rooms := in.candidates(startAt)
+	if r := in.first(rooms, startAt, endAt, in.Transition, true); r != nil {
+		return r, nil
+	}
+	if in.Transition > 0 && in.first(rooms, startAt, endAt, 0, true) != nil {
+		return nil, ErrTransition
+	}
+	if in.Bathroom == BathroomRequired && in.first(rooms, startAt, endAt, in.Transition, false) != nil {
+		return nil, ErrNoFeatures
+	}
+	return nil, ErrNoRoom
+}
+
+// Free returns the intervals the doctor may book on the local day of day,
+// each one free in at least a room. They are sorted and not repeated, the
+// ones of different rooms may overlap
+func (in *Input) Free(day time.Time) []Interval {
+	free := []Interval{}
+	open := in.opening(day)
+	for _, r := range in.Rooms {
+		if in.Bathroom == BathroomRequired && !r.HasBathroom {
+			continue
+		}
+		for _, o := range open {
+			free = append(free, in.freeIn(r.ID, o)...)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool {
+		if !free[i].StartAt.Equal(free[j].StartAt) {
+			return free[i].StartAt.Before(free[j].StartAt)
+		}
+		return free[i].EndAt.Before(free[j].EndAt)
+	})
+	unique := []Interval{}
+	for i, f := range free {
+		if i > 0 && f.StartAt.Equal(free[i-1].StartAt) && f.EndAt.Equal(free[i-1].EndAt) {
+			continue
+		}
+		unique = append(unique, f)
+	}
+	return unique
+}
+
+// Day returns the local midnight of the day of t
+func (in *Input) Day(t time.Time) time.Time {
+	y, mo, d := t.In(in.location()).Date()
+	return time.Date(y, mo, d, 0, 0, 0, 0, in.location())
+}
+
+func (in *Input) location() *time.Location {
+	if in.Location == nil {
+		return time.UTC
+	}
+	return in.Location
+}
+
+// Closed returns the closures of the room between startAt and endAt, with
+// the ones of the whole clinic. A nil roomID returns only the latter
+func (in *Input) Closed(roomID *uuid.UUID, startAt, endAt time.Time) []Interval {
+	closed := []Interval{}
+	for _, c := range in.Closures {
+		if c.RoomID != nil && (roomID == nil || *c.RoomID != *roomID) {
+			continue
+		}
+		closed = append(closed, in.occurrences(c, startAt, endAt)...)
+	}
+	return closed
+}
+
+// occurrences returns the times the closure overlaps startAt and endAt, the
+// yearly ones are moved to each year keeping their local dates and times
+func (in *Input) occurrences(c Closure, startAt, endAt time.Time) []Interval {
+	if !c.Yearly {
+		if c.StartAt.Before(endAt) && startAt.Before(c.EndAt) {
+			return []Interval{{StartAt: c.StartAt, EndAt: c.EndAt}}
+		}
+		return nil
+	}
+	first := c.StartAt.In(in.location())
+	last := c.EndAt.In(in.location())
+	// a closure may run past new year, so it starts the year before
+	years := startAt.In(in.location()).Year() - first.Year() - 1
+	found := []Interval{}
+	for {
+		iv := Interval{StartAt: first.AddDate(years, 0, 0), EndAt: last.AddDate(years, 0, 0)}
+		if !iv.StartAt.Before(endAt) {
+			return found
+		}
+		if startAt.Before(iv.EndAt) && years >= 0 {
+			found = append(found, iv)
+		}
+		years++
+	}
+}
+
+// opening returns the opening intervals of the local day of day
+func (in *Input) opening(day time.Time) []Interval {
+	midnight := in.Day(day)
+	y, mo, d := midnight.Date()
+	// the offset of noon is the one of the opening hours, even on days the clock changes
+	_, offset := midnight.Add(12 * time.Hour).Zone()
+	open := []Interval{}
+	for _, s := range in.Opening[midnight.Weekday()] {
+		start := clock(s.Start + time.Duration(offset)*time.Second)
+		end := clock(s.End + time.Duration(offset)*time.Second)
+		if end <= start {
+			continue
+		}
+		open = append(open, Interval{
+			StartAt: time.Date(y, mo, d, 0, 0, 0, int(start), in.location()),
+			EndAt:   time.Date(y, mo, d, 0, 0, 0, int(end), in.location()),
+		})
+	}
+	return open
+}
+
+// clock wraps a time of day around midnight
+func clock(d time.Duration) time.Duration {
+	day := 24 * time.Hour
+	return (d%day + day) % day
+}
+
+// candidates sorts the rooms: first the ones the doctor has booked that day,
+// closest booking first, then by the bathroom treatment
+func (in *Input) candidates(startAt time.Time) []Room {
+	day := in.Day(startAt)
+	closest := map[uuid.UUID]time.Duration{}
+	for _, b := range in.Booked {
+		if b.DoctID != in.DoctID || !in.Day(b.StartAt).Equal(day) {
+			continue
+		}
+		dist := b.StartAt.Sub(startAt)
+		if dist < 0 {
+			dist = -dist
+		}
+		if c, ok := closest[b.RoomID]; !ok || dist < c {
+			closest[b.RoomID] = dist
+		}
+	}
+	rooms := append([]Room{}, in.Rooms...)
+	sort.SliceStable(rooms, func(i, j int) bool {
+		ci, oki := closest[rooms[i].ID]
+		cj, okj := closest[rooms[j].ID]
+		if oki != okj {
+			return oki
+		}
+		if oki && ci != cj {
+			return ci < cj
+		}
+		return in.bathroomRank(rooms[i]) < in.bathroomRank(rooms[j])
+	})
+	return rooms
+}
+
+func (in *Input) bathroomRank(r Room) int {
+	switch {
+	case in.Bathroom == BathroomPreferred && !r.HasBathroom:
+		return 1
+	case in.Bathroom == BathroomIgnored && r.HasBathroom:
+		return 1
+	}
+	return 0
+}
+
+// first returns the first room free between startAt and endAt, features
+// tells if the rooms without a required bathroom are skipped
+func (in *Input) first(rooms []Room, startAt, endAt time.Time, transition time.Duration, features bool) *Room {
+	for _, r := range rooms {
+		if features && in.Bathroom == BathroomRequired && !r.HasBathroom {
+			continue
+		}
+		if in.fits(r.ID, startAt, endAt, transition) {
+			room := r
+			return &room
+		}
+	}
+	return nil
+}
+
+// fits tells if the room is open and free between startAt and endAt, keeping
+// the transition to the bookings of other doctors
+func (in *Input) fits(roomID uuid.UUID, startAt, endAt time.Time, transition time.Duration) bool {
+	open := false
+	for _, o := range in.opening(startAt) {
+		if !startAt.Before(o.StartAt) && !endAt.After(o.EndAt) {
+			open = true
+			break
+		}
+	}
+	if !open || len(in.Closed(&roomID, startAt, endAt)) > 0 {
+		return false
+	}
+	for _, b := range in.Booked {
+		if b.RoomID != roomID {
+			continue
+		}
+		gap := transition
+		if b.DoctID == in.DoctID {
+			gap = 0
+		}
+		if startAt.Before(b.EndAt.Add(gap)) && b.StartAt.Before(endAt.Add(gap)) {
+			return false
+		}
+	}
+	return true
+}
+
+// freeIn returns the free intervals of the room within the opening interval o
+func (in *Input) freeIn(roomID uuid.UUID, o Interval) []Interval {
+	blocked := []Interval{}
+	for _, b := range in.Booked {
+		if b.RoomID != roomID {
+			continue
+		}
+		gap := in.Transition
+		if b.DoctID == in.DoctID {
+			gap = 0
+		}
+		iv := Interval{StartAt: b.StartAt.Add(-gap), EndAt: b.EndAt.Add(gap)}
+		if iv.StartAt.Before(o.EndAt) && o.StartAt.Before(iv.EndAt) {
+			blocked = append(blocked, iv)
+		}
+	}
+	blocked = append(blocked, in.Closed(&roomID, o.StartAt, o.EndAt)...)
+	sort.Slice(blocked, func(i, j int) bool {
+		return blocked[i].StartAt.Before(blocked[j].StartAt)
+	})
+	free := []Interval{}
+	cur := o.StartAt
+	for _, iv := range blocked {
+		if iv.StartAt.After(cur) {
+			free = append(free, Interval{StartAt: cur, EndAt: iv.StartAt})
+		}
+		if iv.EndAt.After(cur) {
+			cur = iv.EndAt
+		}
+	}
+	if o.EndAt.After(cur) {
+		free = append(free, Interval{StartAt: cur, EndAt: o.EndAt})
+	}
+	return free
+}
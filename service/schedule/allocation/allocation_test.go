@@ -0,0 +1,305 @@
+package allocation
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+var (
+	loc    = time.FixedZone("BRT", -3*60*60)
+	doctor = uuid.FromStringOrNil("00000000-0000-0000-0000-00000000d001")
+	other  = uuid.FromStringOrNil("00000000-0000-0000-0000-00000000d002")
+	roomA  = Room{ID: uuid.FromStringOrNil("00000000-0000-0000-0000-00000000a001")}
+	roomB  = Room{ID: uuid.FromStringOrNil("00000000-0000-0000-0000-00000000a002"), HasBathroom: true}
+	// 08:00 to 12:00 and 13:00 to 18:00 local, kept in UTC
+	mondays = map[time.Weekday][]Span{
+		time.Monday: {{11 * time.Hour, 15 * time.Hour}, {16 * time.Hour, 21 * time.Hour}},
+	}
+)
+
+// at is a time of monday 2026-01-05, local
+func at(h, m int) time.Time {
+	return time.Date(2026, 1, 5, h, m, 0, 0, loc)
+}
+
+func input(bathroom Bathroom, rooms []Room, booked ...Booking) *Input {
+	return &Input{
+		Config: Config{
+			Location:   loc,
+			Opening:    mondays,
+			Transition: 30 * time.Minute,
+			Bathroom:   bathroom,
+		},
+		DoctID: doctor,
+		Rooms:  rooms,
+		Booked: booked,
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	both := []Room{roomA, roomB}
+	cases := []struct {
+		name       string
+		in         *Input
+		start, end time.Time
+		room       *Room
+		err        error
+	}{
+		{"rooms without a bathroom first", input(BathroomIgnored, both), at(8, 0), at(9, 0), &roomA, nil},
+		{"bathroom preferred", input(BathroomPreferred, both), at(8, 0), at(9, 0), &roomB, nil},
+		{"bathroom required", input(BathroomRequired, []Room{roomA}), at(8, 0), at(9, 0), nil, ErrNoFeatures},
+		{"bathroom room taken", input(BathroomRequired, both, Booking{DoctID: other, RoomID: roomB.ID, StartAt: at(8, 0), EndAt: at(9, 0)}), at(8, 0), at(9, 0), nil, ErrNoFeatures},
+		{"before opening", input(BathroomIgnored, both), at(7, 0), at(9, 0), nil, ErrNoRoom},
+		{"over lunch", input(BathroomIgnored, both), at(11, 0), at(14, 0), nil, ErrNoRoom},
+		{"last hour", input(BathroomIgnored, both), at(17, 0), at(18, 0), &roomA, nil},
+		{"closed on sunday", input(BathroomIgnored, both), at(8, 0).AddDate(0, 0, -1), at(9, 0).AddDate(0, 0, -1), nil, ErrNoRoom},
+		{"empty range", input(BathroomIgnored, both), at(9, 0), at(9, 0), nil, ErrNoRoom},
+		{"taken", input(BathroomIgnored, []Room{roomA}, Booking{DoctID: other, RoomID: roomA.ID, StartAt: at(8, 30), EndAt: at(9, 30)}), at(8, 0), at(9, 0), nil, ErrNoRoom},
+		{"other room when taken", input(BathroomIgnored, both, Booking{DoctID: other, RoomID: roomA.ID, StartAt: at(8, 30), EndAt: at(9, 30)}), at(8, 0), at(9, 0), &roomB, nil},
+		{"transition after another doctor", input(BathroomIgnored, []Room{roomA}, Booking{DoctID: other, RoomID: roomA.ID, StartAt: at(8, 0), EndAt: at(9, 0)}), at(9, 10), at(10, 0), nil, ErrTransition},
+		{"transition before another doctor", input(BathroomIgnored, []Room{roomA}, Booking{DoctID: other, RoomID: roomA.ID, StartAt: at(10, 0), EndAt: at(11, 0)}), at(9, 0), at(9, 50), nil, ErrTransition},
+		{"transition kept", input(BathroomIgnored, []Room{roomA}, Booking{DoctID: other, RoomID: roomA.ID, StartAt: at(10, 0), EndAt: at(11, 0)}), at(9, 0), at(9, 30), &roomA, nil},
+		{"no transition for the same doctor", input(BathroomIgnored, []Room{roomA}, Booking{DoctID: doctor, RoomID: roomA.ID, StartAt: at(8, 0), EndAt: at(9, 0)}), at(9, 0), at(10, 0), &roomA, nil},
+		{"room of the closest booking", input(BathroomIgnored, both,
+			Booking{DoctID: doctor, RoomID: roomB.ID, StartAt: at(8, 0), EndAt: at(9, 0)},
+			Booking{DoctID: doctor, RoomID: roomA.ID, StartAt: at(15, 0), EndAt: at(16, 0)}), at(9, 0), at(10, 0), &roomB, nil},
+		{"bookings of other days don't count", input(BathroomIgnored, both,
+			Booking{DoctID: doctor, RoomID: roomB.ID, StartAt: at(9, 0).AddDate(0, 0, -7), EndAt: at(10, 0).AddDate(0, 0, -7)}), at(9, 0), at(10, 0), &roomA, nil},
+	}
+	for _, c := range cases {
+		room, err := c.in.Allocate(c.start, c.end)
+		if err != c.err || !reflect.DeepEqual(room, c.room) {
+			t.Errorf("%s: expected %v %v, got %v %v", c.name, c.room, c.err, room, err)
+		}
+	}
+}
+
+func TestFree(t *testing.T) {
+	in := input(BathroomIgnored, []Room{roomA, roomB},
+		Booking{DoctID: other, RoomID: roomA.ID, StartAt: at(9, 0), EndAt: at(10, 0)},
+		Booking{DoctID: doctor, RoomID: roomA.ID, StartAt: at(13, 0), EndAt: at(14, 0)},
+		Booking{DoctID: other, RoomID: roomB.ID, StartAt: at(8, 0), EndAt: at(12, 0)},
+		Booking{DoctID: other, RoomID: roomB.ID, StartAt: at(13, 0), EndAt: at(18, 0)},
+	)
+	want := []Interval{
+		{at(8, 0), at(8, 30)},
+		{at(10, 30), at(12, 0)},
+		{at(14, 0), at(18, 0)},
+	}
+	got := in.Free(at(0, 0))
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if !got[i].StartAt.Equal(want[i].StartAt) || !got[i].EndAt.Equal(want[i].EndAt) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	if free := in.Free(at(0, 0).AddDate(0, 0, 1)); len(free) != 0 {
+		t.Fatalf("expected no free hours on tuesday, got %v", free)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	both := []Room{roomA, roomB}
+	closed := func(roomID *uuid.UUID, start, end time.Time, yearly bool) *Input {
+		in := input(BathroomIgnored, both)
+		in.Closures = []Closure{{RoomID: roomID, StartAt: start, EndAt: end, Yearly: yearly}}
+		return in
+	}
+	cases := []struct {
+		name       string
+		in         *Input
+		start, end time.Time
+		room       *Room
+		err        error
+	}{
+		{"clinic closed", closed(nil, at(0, 0), at(0, 0).AddDate(0, 0, 1), false), at(8, 0), at(9, 0), nil, ErrClosed},
+		{"clinic closed for part of it", closed(nil, at(8, 30), at(10, 0), false), at(8, 0), at(9, 0), nil, ErrClosed},
+		{"clinic closed after it", closed(nil, at(9, 0), at(10, 0), false), at(8, 0), at(9, 0), &roomA, nil},
+		{"room closed", closed(&roomA.ID, at(0, 0), at(0, 0).AddDate(0, 0, 1), false), at(8, 0), at(9, 0), &roomB, nil},
+		{"yearly closure next year", closed(nil, at(0, 0).AddDate(-1, 0, 0), at(0, 0).AddDate(-1, 0, 1), true), at(8, 0), at(9, 0), nil, ErrClosed},
+		{"yearly closure running past new year", closed(nil, time.Date(2024, 12, 31, 0, 0, 0, 0, loc), time.Date(2025, 1, 6, 0, 0, 0, 0, loc), true), at(8, 0), at(9, 0), nil, ErrClosed},
+		{"yearly closure before its first year", closed(nil, at(0, 0).AddDate(1, 0, 0), at(0, 0).AddDate(1, 0, 1), true), at(8, 0), at(9, 0), &roomA, nil},
+	}
+	for _, c := range cases {
+		room, err := c.in.Allocate(c.start, c.end)
+		if err != c.err || !reflect.DeepEqual(room, c.room) {
+			t.Errorf("%s: expected %v %v, got %v %v", c.name, c.room, c.err, room, err)
+		}
+	}
+
+	in := input(BathroomIgnored, []Room{roomA})
+	in.Closures = []Closure{
+		{RoomID: &roomA.ID, StartAt: at(10, 0), EndAt: at(11, 0)},
+		{RoomID: &roomB.ID, StartAt: at(8, 0), EndAt: at(18, 0)},
+		{StartAt: at(15, 0), EndAt: at(20, 0)},
+	}
+	want := []Interval{
+		{at(8, 0), at(10, 0)},
+		{at(11, 0), at(12, 0)},
+		{at(13, 0), at(15, 0)},
+	}
+	got := in.Free(at(0, 0))
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseOpening(t *testing.T) {
+	open, err := ParseOpening([]byte(`{"monday": [{"start": "11:00", "end": "15:00"}, {"start": "16:00", "end": "21:00"}], "Saturday": [{"start": "11:30", "end": "15:00"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(open[time.Monday], mondays[time.Monday]) {
+		t.Fatalf("expected %v, got %v", mondays[time.Monday], open[time.Monday])
+	}
+	if len(open[time.Saturday]) != 1 || open[time.Saturday][0].Start != 11*time.Hour+30*time.Minute {
+		t.Fatalf("unexpected saturday %v", open[time.Saturday])
+	}
+	for _, value := range []string{`{"someday": []}`, `{"monday": [{"start": "8h", "end": "12:00"}]}`, `[]`} {
+		if _, err := ParseOpening([]byte(value)); err == nil {
+			t.Fatalf("%s: expected an error", value)
+		}
+	}
+}
+
+// scenario is a random monday of an institution and a booking to allocate
+type scenario struct {
+	In         *Input
+	Start, End time.Time
+}
+
+// Generate builds bookings on a 10 minutes grid between 07:00 and 19:00, some
+// of them overlapping, so the opening hours and transitions are crossed
+func (scenario) Generate(r *rand.Rand, size int) reflect.Value {
+	grid := func(from, to int) time.Time {
+		return at(7, 0).Add(time.Duration(from+r.Intn(to-from)) * 10 * time.Minute)
+	}
+	doctors := []uuid.UUID{doctor, other, uuid.FromStringOrNil("00000000-0000-0000-0000-00000000d003")}
+	in := input(Bathroom(r.Intn(3)), nil)
+	in.Transition = time.Duration(r.Intn(7)) * 10 * time.Minute
+	for i := 0; i < 1+r.Intn(4); i++ {
+		in.Rooms = append(in.Rooms, Room{
+			ID:          uuid.FromStringOrNil("00000000-0000-0000-0000-0000000a000" + string(rune('0'+i))),
+			HasBathroom: r.Intn(2) == 0,
+		})
+	}
+	for i := 0; i < r.Intn(3*len(in.Rooms)+1); i++ {
+		start := grid(0, 72)
+		in.Booked = append(in.Booked, Booking{
+			DoctID:  doctors[r.Intn(len(doctors))],
+			RoomID:  in.Rooms[r.Intn(len(in.Rooms))].ID,
+			StartAt: start,
+			EndAt:   start.Add(time.Duration(1+r.Intn(18)) * 10 * time.Minute),
+		})
+	}
+	start := grid(0, 72)
+	return reflect.ValueOf(scenario{In: in, Start: start, End: start.Add(time.Duration(1+r.Intn(18)) * 10 * time.Minute)})
+}
+
+func TestAllocateProperties(t *testing.T) {
+	// a booking gets a room exactly when it fits in one of the free hours of the day
+	agreesWithFree := func(s scenario) bool {
+		room, err := s.In.Allocate(s.Start, s.End)
+		inFree := false
+		for _, f := range s.In.Free(s.Start) {
+			if !s.Start.Before(f.StartAt) && !s.End.After(f.EndAt) {
+				inFree = true
+			}
+		}
+		return (err == nil) == inFree && (err == nil) == (room != nil)
+	}
+	// the room given is open, keeps the transitions and has the features required
+	keepsTheRules := func(s scenario) bool {
+		room, err := s.In.Allocate(s.Start, s.End)
+		if err != nil {
+			return true
+		}
+		if s.In.Bathroom == BathroomRequired && !room.HasBathroom {
+			return false
+		}
+		open := false
+		for _, o := range s.In.opening(s.Start) {
+			open = open || (!s.Start.Before(o.StartAt) && !s.End.After(o.EndAt))
+		}
+		for _, b := range s.In.Booked {
+			gap := s.In.Transition
+			if b.DoctID == s.In.DoctID {
+				gap = 0
+			}
+			if b.RoomID == room.ID && s.Start.Before(b.EndAt.Add(gap)) && b.StartAt.Before(s.End.Add(gap)) {
+				return false
+			}
+		}
+		return open
+	}
+	// the reasons are right: without the transition, or the features, a room is
+	// given, and when every room is taken not even the transition frees one
+	reasons := func(s scenario) bool {
+		_, err := s.In.Allocate(s.Start, s.End)
+		relaxed := *s.In
+		switch err {
+		case ErrTransition:
+			relaxed.Transition = 0
+		case ErrNoFeatures:
+			relaxed.Bathroom = BathroomIgnored
+		case ErrNoRoom:
+			relaxed.Transition = 0
+			_, err := relaxed.Allocate(s.Start, s.End)
+			return err != nil
+		default:
+			return err == nil
+		}
+		_, err = relaxed.Allocate(s.Start, s.End)
+		return err == nil
+	}
+	for name, f := range map[string]interface{}{
+		"agrees with free": agreesWithFree,
+		"keeps the rules":  keepsTheRules,
+		"reasons":          reasons,
+	} {
+		if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// week of bookings in 20 rooms, half the opening hours taken
+func benchInput() *Input {
+	r := rand.New(rand.NewSource(1))
+	in := input(BathroomPreferred, nil)
+	for i := 0; i < 20; i++ {
+		in.Rooms = append(in.Rooms, Room{ID: uuid.Must(uuid.NewV4()), HasBathroom: i%3 == 0})
+	}
+	for day := 0; day < 7; day++ {
+		for _, room := range in.Rooms {
+			for h := 8; h < 18; h += 2 {
+				start := at(h, 10*r.Intn(6)).AddDate(0, 0, day)
+				in.Booked = append(in.Booked, Booking{DoctID: other, RoomID: room.ID, StartAt: start, EndAt: start.Add(time.Hour)})
+			}
+		}
+	}
+	return in
+}
+
+func BenchmarkAllocate(b *testing.B) {
+	in := benchInput()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in.Allocate(at(15, 0), at(16, 0))
+	}
+}
+
+func BenchmarkFree(b *testing.B) {
+	in := benchInput()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in.Free(at(0, 0))
+	}
+}
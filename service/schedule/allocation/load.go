@@ -0,0 +1,332 @@
+package allocation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+
+	sq "github.com/elgris/sqrl"
+)
+
+var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Load reads the Input for the doctor of the institution, with the bookings
+// of the days between from and to
+func Load(db service.DB, instID, doctID uuid.UUID, from, to time.Time) (*Input, error) {
+	in := &Input{DoctID: doctID}
+	var err error
+	in.Location, err = Location(db, instID)
+	if err != nil {
+		return nil, err
+	}
+	in.Opening, err = opening(db, instID)
+	if err != nil {
+		return nil, err
+	}
+	in.Transition, err = Transition(db, instID)
+	if err != nil {
+		return nil, err
+	}
+	in.Bathroom, err = bathroom(db, instID, doctID)
+	if err != nil {
+		return nil, err
+	}
+	in.Rooms, err = rooms(db, instID)
+	if err != nil {
+		return nil, err
+	}
+	in.Booked, err = booked(db, instID, from.Add(-24*time.Hour), to.Add(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	in.Closures, err = Closures(db, instID, from.Add(-24*time.Hour), to.Add(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// Location returns the location of the institution from the timezone-local config, UTC when it isn't set
+func Location(db service.DB, instID uuid.UUID) (*time.Location, error) {
+	tz := ""
+	query := psql.Select("value->>'timezone'").
+		From("config").
+		Where(sq.Eq{"key": "timezone-local", "inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get timezone sql")
+	}
+	err = db.Get(&tz, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error get timezone sql")
+		}
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error loading timezone "+tz)
+	}
+	return loc, nil
+}
+
+/* Read the opening spans by weekday of the schedule-hour_config_flex config, none when it isn't set */
+func opening(db service.DB, instID uuid.UUID) (map[time.Weekday][]Span, error) {
+	value := types.JSONText{}
+	query := psql.Select("value").
+		From("config").
+		Where(sq.Eq{"key": "schedule-hour_config_flex", "inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get opening hours sql")
+	}
+	err = db.Get(&value, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error get opening hours sql")
+		}
+		return map[time.Weekday][]Span{}, nil
+	}
+	return ParseOpening(value)
+}
+
+// ParseOpening reads the value of the schedule-hour_config_flex config, like
+// {"monday": [{"start": "11:00", "end": "15:00"}]}
+func ParseOpening(value []byte) (map[time.Weekday][]Span, error) {
+	days := map[string][]struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	}{}
+	err := json.Unmarshal(value, &days)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing opening hours")
+	}
+	open := map[time.Weekday][]Span{}
+	for name, slots := range days {
+		wd, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, errors.New("Unknown day in opening hours " + name)
+		}
+		for _, sl := range slots {
+			start, err := time.Parse("15:04", sl.Start)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error parsing opening hour "+sl.Start)
+			}
+			end, err := time.Parse("15:04", sl.End)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error parsing opening hour "+sl.End)
+			}
+			open[wd] = append(open[wd], Span{
+				Start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+				End:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+			})
+		}
+	}
+	return open, nil
+}
+
+// Transition returns the schedule-transition_time config, 0 when it isn't set
+func Transition(db service.DB, instID uuid.UUID) (time.Duration, error) {
+	value := ""
+	query := psql.Select("COALESCE(value->>'transition_time', '0')").
+		From("config").
+		Where(sq.Eq{"key": "schedule-transition_time", "inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error generating get transition time sql")
+	}
+	err = db.Get(&value, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return 0, errors.Wrap(err, "Error get transition time sql")
+		}
+		return 0, nil
+	}
+	minutes, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error parsing transition time "+value)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+/* Tell how the bathroom is treated for the doctor, from the specialties and the schedule-bathroom_treatment config */
+func bathroom(db service.DB, instID, doctID uuid.UUID) (Bathroom, error) {
+	checkBath := struct {
+		NeedBathroom      bool   `db:"need_bathroom"`
+		BathroomTreatment string `db:"bathroom_treatment"`
+	}{}
+	args := []interface{}{doctID, instID}
+	query := `
+		SELECT COALESCE((
+			SELECT value->>'bathroom_treatment'
+			FROM config
+			WHERE key = 'schedule-bathroom_treatment' AND inst_id = $2
+		), '') AS bathroom_treatment,
+		EXISTS (
+			SELECT 1
+			FROM doctor_specialty ds
+			JOIN specialty spe USING (spec_id)
+			WHERE ds.doct_id = $1 AND (spe.info->>'needBathroom')::BOOL
+		) AS need_bathroom
+	`
+	err := db.Get(&checkBath, query, args...)
+	if err != nil {
+		return BathroomIgnored, errors.Wrap(err, "Error get bathroom treatment sql")
+	}
+	if !checkBath.NeedBathroom {
+		return BathroomIgnored, nil
+	}
+	switch checkBath.BathroomTreatment {
+	case "obligation":
+		return BathroomRequired, nil
+	case "preferencial":
+		return BathroomPreferred, nil
+	}
+	return BathroomIgnored, nil
+}
+
+/* List the active rooms of the institution */
+func rooms(db service.DB, instID uuid.UUID) ([]Room, error) {
+	rows := []struct {
+		RoomID      uuid.UUID `db:"room_id"`
+		HasBathroom bool      `db:"has_bathroom"`
+	}{}
+	query := psql.Select("room_id", "COALESCE((info->>'hasBathroom')::BOOL, FALSE) AS has_bathroom").
+		From("room").
+		Where("inactive_at IS NULL").
+		Where(sq.Eq{"inst_id": instID}).
+		OrderBy("label", "room_id")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list rooms sql")
+	}
+	err = db.Select(&rows, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list rooms sql")
+	}
+	rs := make([]Room, 0, len(rows))
+	for _, r := range rows {
+		rs = append(rs, Room{ID: r.RoomID, HasBathroom: r.HasBathroom})
+	}
+	return rs, nil
+}
+
+/* List the bookings of the institution with a room between from and to */
+func booked(db service.DB, instID uuid.UUID, from, to time.Time) ([]Booking, error) {
+	rows := []struct {
+		ScheID  uuid.UUID `db:"sche_id"`
+		DoctID  uuid.UUID `db:"doct_id"`
+		RoomID  uuid.UUID `db:"room_id"`
+		StartAt time.Time `db:"start_at"`
+		EndAt   time.Time `db:"end_at"`
+	}{}
+	query := psql.Select("sche_id", "doct_id", "room_id", "start_at", "end_at").
+		From("schedule").
+		Where("deleted_at IS NULL AND room_id IS NOT NULL").
+		Where(sq.Eq{"inst_id": instID}).
+		Where(sq.Lt{"start_at": to.UTC()}).
+		Where(sq.Gt{"end_at": from.UTC()})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list bookings sql")
+	}
+	err = db.Select(&rows, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list bookings sql")
+	}
+	bs := make([]Booking, 0, len(rows))
+	for _, r := range rows {
+		bs = append(bs, Booking{ScheID: r.ScheID, DoctID: r.DoctID, RoomID: r.RoomID, StartAt: r.StartAt, EndAt: r.EndAt})
+	}
+	return bs, nil
+}
+
+// Closures lists the closures of the institution that may happen between
+// from and to, the yearly ones are always listed. The maintenance windows
+// of its rooms are closures of the room
+func Closures(db service.DB, instID uuid.UUID, from, to time.Time) ([]Closure, error) {
+	rows := []struct {
+		RoomID  *uuid.UUID `db:"room_id"`
+		StartAt time.Time  `db:"start_at"`
+		EndAt   time.Time  `db:"end_at"`
+		Yearly  bool       `db:"yearly"`
+	}{}
+	query := psql.Select("room_id", "start_at", "end_at", "yearly").
+		From("closure").
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"inst_id": instID}).
+		Where(sq.Or{
+			sq.Eq{"yearly": true},
+			sq.And{sq.Lt{"start_at": to.UTC()}, sq.Gt{"end_at": from.UTC()}},
+		})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list closures sql")
+	}
+	err = db.Select(&rows, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list closures sql")
+	}
+	cs := make([]Closure, 0, len(rows))
+	for _, r := range rows {
+		cs = append(cs, Closure{RoomID: r.RoomID, StartAt: r.StartAt, EndAt: r.EndAt, Yearly: r.Yearly})
+	}
+	maint, err := maintenance(db, instID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(cs, maint...), nil
+}
+
+/* List the maintenance windows of the rooms of the institution between from and to */
+func maintenance(db service.DB, instID uuid.UUID, from, to time.Time) ([]Closure, error) {
+	rows := []struct {
+		RoomID  uuid.UUID `db:"room_id"`
+		StartAt time.Time `db:"start_at"`
+		EndAt   time.Time `db:"end_at"`
+	}{}
+	query := psql.Select("room_id", "start_at", "end_at").
+		From("room_maintenance").
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"inst_id": instID}).
+		Where(sq.Lt{"start_at": to.UTC()}).
+		Where(sq.Gt{"end_at": from.UTC()})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list room maintenance sql")
+	}
+	err = db.Select(&rows, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list room maintenance sql")
+	}
+	cs := make([]Closure, 0, len(rows))
+	for _, r := range rows {
+		roomID := r.RoomID
+		cs = append(cs, Closure{RoomID: &roomID, StartAt: r.StartAt, EndAt: r.EndAt})
+	}
+	return cs, nil
+}
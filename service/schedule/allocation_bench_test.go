@@ -0,0 +1,253 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+)
+
+var psqlInfo = ("host=localhost port=5432 user=postgres password=123 dbname=inovant_test sslmode=disable")
+
+var instID = uuid.FromStringOrNil("00000000-0000-0000-0000-000000000001")
+
+// legacyRoomQuery is the CTE createSchedule used before the allocation
+// engine, kept to compare both. The first row of room_for_insert_flex is the
+// room for the doctor $1 between $2 and $3 in the institution $4
+const legacyRoomQuery = `
+			WITH config_days AS (
+				SELECT value
+				FROM config
+				WHERE KEY = 'schedule-hour_config_flex' AND inst_id = $4
+			),
+			config_timezone AS (
+				SELECT value->>'timezone' AS timezone
+				FROM config
+				WHERE KEY = 'timezone-local' AND inst_id = $4
+			),
+			dates_to_local AS (
+				SELECT (($2::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE cti.timezone) AS start_time,
+				(($3::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE cti.timezone) AS end_time
+				FROM config_timezone cti
+			),
+			config_result_int AS (
+				SELECT row_number() OVER(ORDER BY a."key") AS id,
+				a."key" AS "day",
+				jsonb_array_elements(a.value) AS slot
+				FROM config_days, jsonb_each(config_days.value) a
+			),
+			config_building_timezone AS (
+				SELECT id, "day",
+				(( ((slot->>'start')::TIME) AT TIME ZONE 'UTC') AT TIME ZONE ct.timezone)::TIME AS start_time,
+				(( ((slot->>'end')::TIME) AT TIME ZONE 'UTC') AT TIME ZONE ct.timezone)::TIME AS end_time
+				FROM config_result_int, config_timezone ct
+			),
+			config_result AS (
+				SELECT id, "day", jsonb_build_object('start', substring((start_time::TIME)::TEXT, 0, 6), 'end', substring((end_time::TIME)::TEXT, 0, 6)) AS slot
+				FROM config_building_timezone
+			),
+			slots_by_day AS (
+				SELECT id, "day", slot,
+				EXTRACT(EPOCH FROM (slot->>'start')::TIME)::INT AS start_slot,
+				EXTRACT(EPOCH FROM (slot->>'end')::TIME)::INT AS end_slot
+				FROM config_result
+			),
+			config_transition AS (
+				SELECT value
+				FROM config
+				WHERE KEY = 'schedule-transition_time' AND inst_id = $4
+			),
+			schedule_local AS (
+				SELECT sche_id, doct_id, room_id,
+					(( ((start_at)) AT TIME ZONE 'UTC') AT TIME ZONE ct.timezone) AS start_at,
+					(( ((end_at)) AT TIME ZONE 'UTC') AT TIME ZONE ct.timezone) AS end_at,
+					plan, info, created_at, deleted_at
+				FROM schedule, config_timezone ct
+				WHERE inst_id = $4
+			),
+			scheduled AS (
+				SELECT room_id, start_at::date as id, start_at,
+				CASE
+					WHEN doct_id = $1 THEN end_at
+					ELSE (end_at + (value->>'transition_time' ||' minutes')::INTERVAL)::TIMESTAMP
+				END AS end_at,
+				slot,
+				ROW_NUMBER () OVER (
+					PARTITION BY room_id, start_at::date, slot
+					ORDER BY start_at ASC
+				),
+				doct_id
+				FROM config_transition ct, schedule_local s
+				JOIN slots_by_day sbd ON EXTRACT(EPOCH FROM (s.start_at)::TIME) >= sbd.start_slot
+					AND EXTRACT(EPOCH FROM (s.end_at)::TIME) <= sbd.end_slot
+					AND TRIM(TO_CHAR(s.start_at, 'day'))::TEXT = "day"
+				WHERE deleted_at IS NULL
+				ORDER BY room_id, id
+			),
+			counted AS (
+				SELECT room_id, id, count(*), slot
+				FROM scheduled
+				GROUP BY room_id, id, slot
+				ORDER BY room_id, id
+			),
+			prev AS (
+				SELECT counted.room_id, counted.id, NULL::TIMESTAMP AS start_at,
+				((scheduled.start_at::DATE)::TEXT || ' ' || (counted.slot->>'start')::TEXT || ':00')::TIMESTAMP AS end_at, counted.slot, 0 AS ROW_NUMBER
+				FROM counted
+				JOIN scheduled ON scheduled.room_id = counted.room_id AND scheduled.id = counted.id
+			),
+			nextt AS (
+				SELECT counted.room_id, counted.id,
+				((scheduled.start_at::DATE)::TEXT || ' ' || (counted.slot->>'end')::TEXT || ':00')::TIMESTAMP, NULL::TIMESTAMP, counted.slot, count+1 rn
+				FROM counted
+				JOIN scheduled ON scheduled.room_id = counted.room_id AND scheduled.id = counted.id
+			),
+			joined AS (
+				SELECT * FROM prev
+				UNION
+				SELECT room_id, id, start_at, end_at, slot, ROW_NUMBER FROM scheduled
+				UNION
+				SELECT * FROM nextt
+			),
+			order_joined as (
+				SELECT COALESCE(end_at, start_at) AS ord, *
+				FROM joined
+			),
+			ordered as (
+				SELECT * FROM order_joined
+				ORDER BY room_id, id, ord, ROW_NUMBER
+			),
+			create_sched_date AS (
+				SELECT *, COALESCE(start_at, end_at) AS sched_date
+				FROM ordered
+			),
+			order_sched_date AS (
+				SELECT room_id, id, start_at, end_at, slot, ROW_NUMBER, sched_date
+				FROM create_sched_date
+				ORDER BY room_id, id, sched_date, ROW_NUMBER
+			),
+			slots_free AS (
+				SELECT room_id, id, ROW_NUMBER, "count",
+				order_sched_date.start_at, end_at, counted.slot,
+				LAG(end_at::TIME) OVER (PARTITION BY room_id, sched_date, ROW_NUMBER) AS prev_end_at,
+				CASE
+					WHEN ROW_NUMBER < count THEN jsonb_build_object('start', substring( (LAG(end_at::TIME) OVER (PARTITION BY room_id) )::text, 1, 5) , 'end', substring( (order_sched_date.start_at::TIME)::TEXT, 1, 5))
+					WHEN ROW_NUMBER = count THEN jsonb_build_object('start', substring( (LAG(end_at::TIME) OVER (PARTITION BY room_id) )::text, 1, 5) , 'end', substring( (order_sched_date.start_at::TIME)::TEXT, 1, 5))
+					WHEN ROW_NUMBER > count THEN jsonb_build_object('start', substring( (LAG(end_at::time) OVER (PARTITION BY room_id) )::text, 1, 5) , 'end', counted.slot->>'end')
+				END slot_free
+				FROM order_sched_date
+				JOIN counted USING (room_id, id, slot)
+			),
+			slots_free_by_room AS (
+				SELECT room_id, start_at::DATE AS date_of_month, slot_free
+				FROM slots_free
+				ORDER BY start_at, room_id
+			),
+			generated_dates_by_filter AS (
+				SELECT roo.room_id, generate_series(dtl.start_time, dtl.end_time, '1 day'::INTERVAL) AS days
+				FROM room roo, dates_to_local dtl
+				WHERE roo.inactive_at IS NULL AND roo.inst_id = $4
+				ORDER BY (roo.info->>'hasBathroom')::BOOL
+			),
+			slots_with_days AS (
+				SELECT room_id, days::DATE AS days, slot
+				FROM generated_dates_by_filter ft
+				JOIN config_result cr ON cr."day" = TRIM(TO_CHAR(ft.days, 'day'))::TEXT
+			),
+			slots_not_full_by_day AS (
+				SELECT swd.room_id AS room_id, swd.days AS days,
+				COALESCE(sfbr.slot_free, swd.slot) AS slot
+				FROM slots_with_days swd
+				LEFT JOIN slots_free_by_room sfbr ON sfbr.room_id = swd.room_id AND sfbr.date_of_month = swd.days AND
+				( EXTRACT(EPOCH FROM (sfbr.slot_free->>'start')::TIME)::INT >= EXTRACT(EPOCH FROM (swd.slot->>'start')::TIME)::INT
+				AND
+				EXTRACT(EPOCH FROM (sfbr.slot_free->>'end')::TIME)::INT <= EXTRACT(EPOCH FROM (swd.slot->>'end')::TIME)::INT )
+			),
+			closest_rooms AS (
+				SELECT ABS(EXTRACT(epoch FROM start_at - start_time)) as closest_schedule, room_id
+				FROM schedule_local s
+				JOIN	dates_to_local d on s.start_at::DATE = d.start_time::DATE
+				AND doct_id = $1
+			),
+			ordered_rooms AS (
+				SELECT * FROM closest_rooms
+				UNION SELECT 100000000000, room_id FROM room r where r.inst_id = $4 AND not exists (SELECT room_id FROM closest_rooms c where c.room_id = r.room_id)
+			),
+			slots_not_full_by_day_ordered AS (
+				SELECT *, (SELECT MAX(od.closest_schedule) FROM ordered_rooms od WHERE s.room_id = od.room_id) as ooo
+				FROM slots_not_full_by_day s
+				ORDER BY (
+					SELECT MIN(od.closest_schedule) FROM ordered_rooms od WHERE s.room_id = od.room_id
+				) ASC
+			),
+			invalid_slots AS (
+				SELECT sd.*
+				FROM scheduled s
+				JOIN slots_not_full_by_day sd ON s.id = sd.days AND s.room_id = sd.room_id AND s.start_at::TIME = (sd.slot->>'end')::TIME
+				JOIN  dates_to_local dtl ON 1=1
+				JOIN  config_transition ct ON 1=1
+				WHERE doct_id <> $1
+				AND (dtl.end_time::TIME + (ct.value->>'transition_time' ||' minutes')::INTERVAL) > (sd.slot->>'end')::TIME
+			),
+			valid_slots_with_transition_time AS (
+				SELECT *
+				FROM slots_not_full_by_day_ordered fl
+				WHERE NOT EXISTS(SELECT iv.room_id, * FROM invalid_slots iv WHERE iv.room_id = fl.room_id AND iv.days = fl.days AND iv.slot = fl.slot)
+			),
+			room_for_insert_flex AS (
+				SELECT room_id, days, slot
+				FROM valid_slots_with_transition_time, dates_to_local dtl, config_transition ct
+				WHERE days = (dtl.start_time)::DATE
+				AND EXTRACT(EPOCH FROM (slot->>'start')::TIME) <= EXTRACT(EPOCH FROM (dtl.start_time)::TIME)
+				AND EXTRACT(EPOCH FROM (slot->>'end')::TIME) >= EXTRACT(EPOCH FROM (dtl.end_time)::TIME)
+				AND EXTRACT(EPOCH FROM (slot->>'end')::TIME)::INT - EXTRACT(EPOCH FROM (slot->>'start')::TIME)::INT > 0
+				LIMIT 1
+			)
+` + `
+			SELECT room_id FROM room_for_insert_flex
+`
+
+// benchDB connects to the test database, the benchmarks are skipped without it
+func benchDB(b *testing.B) (*sqlx.DB, uuid.UUID, time.Time, time.Time) {
+	db, err := sqlx.Connect("postgres", psqlInfo)
+	if err != nil {
+		b.Skip("no test database: ", err)
+	}
+	doctID := uuid.UUID{}
+	err = db.Get(&doctID, `SELECT doct_id FROM doctor WHERE inst_id = $1 LIMIT 1`, instID)
+	if err != nil {
+		db.Close()
+		b.Skip("no doctor in the test database: ", err)
+	}
+	startAt := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1).Add(14 * time.Hour)
+	return db, doctID, startAt, startAt.Add(time.Hour)
+}
+
+func BenchmarkRoomSQL(b *testing.B) {
+	db, doctID, startAt, endAt := benchDB(b)
+	defer db.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rooms := []uuid.UUID{}
+		err := db.Select(&rooms, legacyRoomQuery, doctID, startAt, endAt, instID)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRoomEngine(b *testing.B) {
+	db, doctID, startAt, endAt := benchDB(b)
+	defer db.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in, err := allocation.Load(db, instID, doctID, startAt, endAt)
+		if err != nil {
+			b.Fatal(err)
+		}
+		in.Allocate(startAt, endAt)
+	}
+}
@@ -0,0 +1,280 @@
+package schedule
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// Reasons a Schedule can't be cancelled
+const (
+	ReasonAlreadyCancelled  = "already_cancelled"
+	ReasonLateCancelLimit   = "late_cancellation_limit"
+	ReasonWaiveNotPermitted = "waive_not_permitted"
+)
+
+// defaultCancellationLimit of a page of cancellations
+const defaultCancellationLimit = 50
+
+//Canceller service to cancel a Schedule following the cancellation policy of its plan
+type Canceller struct {
+	DB *sqlx.DB
+}
+
+//Run cancels the Schedule and saves the cancellation, a doctor only cancels
+//its own Schedules and can't waive the penalty of a late cancellation
+func (c *Canceller) Run(instID, scheID uuid.UUID, doctID, actorID *uuid.UUID, req m.CancelRequest) (*m.ScheduleCancellation, error) {
+	tx, err := c.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	canc, err := cancelByPolicy(tx, instID, scheID, doctID, actorID, req, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return canc, nil
+}
+
+//CancellationLister service to list the cancellations
+type CancellationLister struct {
+	DB *sqlx.DB
+}
+
+//Run returns the cancellations of the institution by Filter, only the ones
+//of the doctor when doctID is set
+func (l *CancellationLister) Run(instID uuid.UUID, doctID *uuid.UUID, f m.FilterScheduleCancellation) ([]m.ScheduleCancellation, error) {
+	return listCancellations(l.DB, instID, doctID, f)
+}
+
+/* Cancel a Schedule through cancelSchedule with a new cancellation, every service cancelling Schedules goes through it */
+func cancelByPolicy(db service.DB, instID, scheID uuid.UUID, doctID, actorID *uuid.UUID, req m.CancelRequest, now time.Time) (*m.ScheduleCancellation, error) {
+	sccaID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating cancellation uuid")
+	}
+	canc := &m.ScheduleCancellation{
+		SccaID:  sccaID,
+		InstID:  instID,
+		ScheID:  scheID,
+		ActorID: actorID,
+		Reason:  req.Reason,
+	}
+	err = cancelSchedule(db, canc, doctID, req.Waive, now)
+	if err != nil {
+		return nil, err
+	}
+	return canc, nil
+}
+
+/* Cancel the Schedule as of now, a late cancellation is charged the penalty of the policy of its plan unless it's waived, and refused once the doctor reached the limit of the month */
+func cancelSchedule(db service.DB, canc *m.ScheduleCancellation, doctID *uuid.UUID, waive bool, now time.Time) error {
+	if waive && doctID != nil {
+		return &RuleError{
+			Reason:  ReasonWaiveNotPermitted,
+			Message: "Only the clinic can waive the penalty of a late cancellation",
+		}
+	}
+	sch, err := lockSchedule(db, canc.InstID, canc.ScheID, doctID)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{"startAt": sch.StartAt}
+	if sch.DeletedAt.Valid {
+		return &RuleError{
+			Reason:  ReasonAlreadyCancelled,
+			Message: "The schedule is already cancelled",
+			Values:  values,
+		}
+	}
+	if !sch.StartAt.After(now) {
+		return &RuleError{
+			Reason:  ReasonDateInPast,
+			Message: "A schedule can't be cancelled after it starts",
+			Values:  values,
+		}
+	}
+	canc.DoctID = sch.DoctID
+	canc.Plan = sch.Plan
+	canc.StartAt = sch.StartAt
+	canc.EndAt = sch.EndAt
+
+	policy, err := cancellationPolicy(db, canc.InstID, sch.Plan)
+	if err != nil {
+		return err
+	}
+	lateCount := 0
+	if policy != nil && policy.MaxLatePerMonth > 0 && !waive {
+		lateCount, err = lateCancellationsInMonth(db, canc.InstID, canc.DoctID, now)
+		if err != nil {
+			return err
+		}
+	}
+	canc.Late, canc.Fee, canc.CreditMinutes, err = cancellationTerms(policy, sch.StartAt, now, lateCount, waive)
+	if err != nil {
+		return err
+	}
+	canc.Waived = canc.Late && waive
+
+	err = setStatus(db, sch, StatusCancelled, canc.ActorID, canc.Reason, now)
+	if err != nil {
+		return err
+	}
+	canc.Schedule = sch
+
+	ins := psql.Insert("schedule_cancellation").
+		Columns("scca_id", "inst_id", "sche_id", "doct_id", "actor_id", "reason", "plan", "start_at", "end_at", "late", "waived", "fee", "credit_minutes", "cancelled_at").
+		Values(canc.SccaID, canc.InstID, canc.ScheID, canc.DoctID, canc.ActorID, canc.Reason, canc.Plan, canc.StartAt.UTC(), canc.EndAt.UTC(), canc.Late, canc.Waived, canc.Fee, canc.CreditMinutes, now).
+		Suffix("RETURNING *")
+	qSQL, args, err := ins.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating create cancellation sql")
+	}
+	err = db.Get(canc, qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error create cancellation sql")
+	}
+	return nil
+}
+
+/* Tell if cancelling at now a Schedule starting at startAt is late by the policy, and the fee and the credit minutes charged for it. lateCount is the late cancellations charged to the doctor in the month, a late one past the limit is refused unless waived, a waived one is charged nothing */
+func cancellationTerms(policy *m.CancellationPolicy, startAt, now time.Time, lateCount int, waive bool) (bool, float64, int, error) {
+	if policy == nil || startAt.Sub(now) >= time.Duration(policy.CutoffHours*float64(time.Hour)) {
+		return false, 0, 0, nil
+	}
+	if waive {
+		return true, 0, 0, nil
+	}
+	if policy.MaxLatePerMonth > 0 && lateCount >= policy.MaxLatePerMonth {
+		return true, 0, 0, &RuleError{
+			Reason:  ReasonLateCancelLimit,
+			Message: "The limit of late cancellations of the month was reached",
+			Values: map[string]interface{}{
+				"startAt":         startAt,
+				"maxLatePerMonth": policy.MaxLatePerMonth,
+				"cutoffHours":     policy.CutoffHours,
+			},
+		}
+	}
+	return true, policy.LateFee, int(math.Round(policy.CreditHours * 60)), nil
+}
+
+/* Return the cancellation policy of the plan from the schedule-cancellation_policy config, the default one when the plan has none, nil when there is no policy */
+func cancellationPolicy(db service.DB, instID uuid.UUID, plan string) (*m.CancellationPolicy, error) {
+	value := types.JSONText{}
+	query := psql.Select("value").
+		From("config").
+		Where(sq.Eq{"key": "schedule-cancellation_policy", "inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get cancellation policy sql")
+	}
+	err = db.Get(&value, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error get cancellation policy sql")
+		}
+		return nil, nil
+	}
+	return planPolicy(value, plan)
+}
+
+/* Pick the policy of the plan from the schedule-cancellation_policy config value, the default one when the plan has none */
+func planPolicy(value []byte, plan string) (*m.CancellationPolicy, error) {
+	policies := map[string]m.CancellationPolicy{}
+	err := json.Unmarshal(value, &policies)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing cancellation policy")
+	}
+	if p, ok := policies[plan]; ok {
+		return &p, nil
+	}
+	if p, ok := policies["default"]; ok {
+		return &p, nil
+	}
+	return nil, nil
+}
+
+/* Count the late cancellations charged to the doctor in the local month of now */
+func lateCancellationsInMonth(db service.DB, instID, doctID uuid.UUID, now time.Time) (int, error) {
+	loc, err := allocation.Location(db, instID)
+	if err != nil {
+		return 0, err
+	}
+	local := now.In(loc)
+	month := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	count := 0
+	query := psql.Select("count(*)").
+		From("schedule_cancellation").
+		Where(sq.Eq{"inst_id": instID, "doct_id": doctID, "late": true, "waived": false}).
+		Where(sq.GtOrEq{"cancelled_at": month}).
+		Where(sq.Lt{"cancelled_at": month.AddDate(0, 1, 0)})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error generating count late cancellations sql")
+	}
+	err = db.Get(&count, qSQL, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error count late cancellations sql")
+	}
+	return count, nil
+}
+
+/* List the cancellations by filters, newest first */
+func listCancellations(db service.DB, instID uuid.UUID, doctID *uuid.UUID, f m.FilterScheduleCancellation) ([]m.ScheduleCancellation, error) {
+	cancs := []m.ScheduleCancellation{}
+	limit := uint64(defaultCancellationLimit)
+	if f.Limit != nil && *f.Limit > 0 {
+		limit = uint64(*f.Limit)
+	}
+	query := psql.Select("*").
+		From("schedule_cancellation").
+		Where(sq.Eq{"inst_id": instID}).
+		OrderBy("cancelled_at DESC", "scca_id").
+		Limit(limit)
+	if doctID != nil {
+		query = query.Where(sq.Eq{"doct_id": doctID})
+	}
+	if f.DoctID != nil {
+		query = query.Where(sq.Eq{"doct_id": *f.DoctID})
+	}
+	if f.Late != nil {
+		query = query.Where(sq.Eq{"late": *f.Late})
+	}
+	if f.From != nil {
+		query = query.Where(sq.GtOrEq{"cancelled_at": *f.From})
+	}
+	if f.To != nil {
+		query = query.Where(sq.Lt{"cancelled_at": *f.To})
+	}
+	if f.Offset != nil {
+		query = query.Offset(uint64(*f.Offset))
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list cancellations sql")
+	}
+	err = db.Select(&cancs, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list cancellations sql")
+	}
+	return cancs, nil
+}
@@ -0,0 +1,86 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+func TestCancellationTerms(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	policy := &m.CancellationPolicy{CutoffHours: 24, LateFee: 50, CreditHours: 1.5, MaxLatePerMonth: 2}
+	unlimited := &m.CancellationPolicy{CutoffHours: 2, LateFee: 10}
+	cases := []struct {
+		name      string
+		policy    *m.CancellationPolicy
+		startAt   time.Time
+		lateCount int
+		waive     bool
+		late      bool
+		fee       float64
+		credit    int
+		limit     bool
+	}{
+		{"no policy", nil, now.Add(time.Hour), 5, false, false, 0, 0, false},
+		{"before the cutoff", policy, now.Add(25 * time.Hour), 0, false, false, 0, 0, false},
+		// cancelling exactly at the cutoff is still free
+		{"at the cutoff", policy, now.Add(24 * time.Hour), 0, false, false, 0, 0, false},
+		{"after the cutoff", policy, now.Add(24*time.Hour - time.Minute), 0, false, true, 50, 90, false},
+		{"below the limit", policy, now.Add(time.Hour), 1, false, true, 50, 90, false},
+		{"at the limit", policy, now.Add(time.Hour), 2, false, true, 0, 0, true},
+		{"waived at the limit", policy, now.Add(time.Hour), 2, true, true, 0, 0, false},
+		{"waived before the cutoff", policy, now.Add(48 * time.Hour), 0, true, false, 0, 0, false},
+		{"no limit", unlimited, now.Add(time.Hour), 30, false, true, 10, 0, false},
+	}
+	for _, c := range cases {
+		late, fee, credit, err := cancellationTerms(c.policy, c.startAt, now, c.lateCount, c.waive)
+		if c.limit {
+			if rule := RuleBroken(err); rule == nil || rule.Reason != ReasonLateCancelLimit {
+				t.Errorf("%s: got %v, want the late limit", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if late != c.late || fee != c.fee || credit != c.credit {
+			t.Errorf("%s: got late %v fee %v credit %d, want late %v fee %v credit %d", c.name, late, fee, credit, c.late, c.fee, c.credit)
+		}
+	}
+}
+
+func TestPlanPolicy(t *testing.T) {
+	value := []byte(`{"Turn": {"cutoff_hours": 48, "late_fee": 80}, "default": {"cutoff_hours": 24}}`)
+	cases := []struct {
+		value  []byte
+		plan   string
+		cutoff float64
+		none   bool
+	}{
+		{value, "Turn", 48, false},
+		// a plan without a policy falls back to default
+		{value, "Hour", 24, false},
+		{[]byte(`{"Turn": {"cutoff_hours": 48}}`), "Hour", 0, true},
+	}
+	for _, c := range cases {
+		p, err := planPolicy(c.value, c.plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.none {
+			if p != nil {
+				t.Errorf("%s: got %v, want no policy", c.plan, p)
+			}
+			continue
+		}
+		if p == nil || p.CutoffHours != c.cutoff {
+			t.Errorf("%s: got %v, want cutoff %v", c.plan, p, c.cutoff)
+		}
+	}
+	_, err := planPolicy([]byte(`[]`), "Turn")
+	if err == nil {
+		t.Error("a config that isn't an object must fail")
+	}
+}
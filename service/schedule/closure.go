@@ -0,0 +1,347 @@
+package schedule
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+type errInvalidClosure struct {
+	msg string
+}
+
+func (e errInvalidClosure) Error() string {
+	return e.msg
+}
+
+//InvalidClosure verifying type of error
+func InvalidClosure(err error) bool {
+	_, ok := errors.Cause(err).(errInvalidClosure)
+	return ok
+}
+
+//ClosureCreator service to close the clinic, or a room
+type ClosureCreator struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+}
+
+//Run creates the Closure and returns the Schedules it affects, cancelling
+//them and notifying their doctors when asked
+func (c *ClosureCreator) Run(instID uuid.UUID, actorID *uuid.UUID, req m.ClosureRequest) (*m.ClosureReport, error) {
+	closID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating Closure uuid")
+	}
+	loc, err := allocation.Location(c.DB, instID)
+	if err != nil {
+		return nil, err
+	}
+	clo, err := closureFromRequest(loc, req)
+	if err != nil {
+		return nil, err
+	}
+	clo.ClosID = closID
+	clo.InstID = instID
+	clo.CreatedBy = actorID
+
+	tx, err := c.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	report, err := createClosure(tx, loc, clo, req.Cancel)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	if req.Notify {
+		notifyClosure(c.DB, c.Logger, loc, report)
+	}
+	return report, nil
+}
+
+//ClosureLister service to list the Closures
+type ClosureLister struct {
+	DB *sqlx.DB
+}
+
+//Run returns the Closures of the institution by Filter
+func (l *ClosureLister) Run(instID uuid.UUID, f m.FilterClosure) ([]m.Closure, error) {
+	return listClosures(l.DB, instID, f)
+}
+
+//ClosureGetter service to get a Closure
+type ClosureGetter struct {
+	DB *sqlx.DB
+}
+
+//Run returns a Closure by clos_id
+func (g *ClosureGetter) Run(instID, closID uuid.UUID) (*m.Closure, error) {
+	return getClosure(g.DB, instID, closID)
+}
+
+//ClosureDeleter service to reopen the clinic, or a room
+type ClosureDeleter struct {
+	DB *sqlx.DB
+}
+
+//Run soft deletes a Closure, the Schedules it cancelled stay cancelled
+func (d *ClosureDeleter) Run(instID, closID uuid.UUID) (*m.Closure, error) {
+	return deleteClosure(d.DB, instID, closID)
+}
+
+/* Check the request and turn its dates, whole local days, or times into the range of the Closure */
+func closureFromRequest(loc *time.Location, req m.ClosureRequest) (*m.Closure, error) {
+	if len(req.Label) == 0 {
+		return nil, errInvalidClosure{"label is required"}
+	}
+	clo := &m.Closure{
+		RoomID: req.RoomID,
+		Label:  req.Label,
+		Yearly: req.Yearly,
+	}
+	switch {
+	case len(req.FromDate) > 0:
+		if req.StartAt != nil || req.EndAt != nil {
+			return nil, errInvalidClosure{"Either fromDate and toDate or startAt and endAt must be sent"}
+		}
+		from, err := time.ParseInLocation("2006-01-02", req.FromDate, loc)
+		if err != nil {
+			return nil, errInvalidClosure{"fromDate must be a date like 2006-01-02"}
+		}
+		to := from
+		if len(req.ToDate) > 0 {
+			to, err = time.ParseInLocation("2006-01-02", req.ToDate, loc)
+			if err != nil {
+				return nil, errInvalidClosure{"toDate must be a date like 2006-01-02"}
+			}
+		}
+		clo.StartAt = from
+		clo.EndAt = to.AddDate(0, 0, 1)
+	case req.StartAt != nil && req.EndAt != nil:
+		clo.StartAt = *req.StartAt
+		clo.EndAt = *req.EndAt
+	default:
+		return nil, errInvalidClosure{"fromDate, or startAt and endAt, are required"}
+	}
+	if !clo.EndAt.After(clo.StartAt) {
+		return nil, errInvalidClosure{"The closure must end after it starts"}
+	}
+	if clo.Yearly && clo.EndAt.Sub(clo.StartAt) > 366*24*time.Hour {
+		return nil, errInvalidClosure{"A yearly closure can't be longer than a year"}
+	}
+	clo.StartAt = clo.StartAt.UTC()
+	clo.EndAt = clo.EndAt.UTC()
+	return clo, nil
+}
+
+/* Save the Closure and list the Schedules it affects, cancelling them when asked */
+func createClosure(db service.DB, loc *time.Location, clo *m.Closure, cancel bool) (*m.ClosureReport, error) {
+	// no booking lands in the closure while the affected ones are listed
+	err := lockAllocation(db, clo.InstID)
+	if err != nil {
+		return nil, err
+	}
+	if clo.RoomID != nil {
+		exists := false
+		err := db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM room WHERE room_id = $1 AND inst_id = $2)`, clo.RoomID, clo.InstID)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error get room sql")
+		}
+		if !exists {
+			return nil, errInvalidClosure{"No room " + clo.RoomID.String()}
+		}
+	}
+	query := psql.Insert("closure").
+		Columns("clos_id", "inst_id", "room_id", "label", "start_at", "end_at", "yearly", "created_by").
+		Values(clo.ClosID, clo.InstID, clo.RoomID, clo.Label, clo.StartAt, clo.EndAt, clo.Yearly, clo.CreatedBy).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating create Closure sql")
+	}
+	err = db.Get(clo, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error create Closure sql")
+	}
+	affected, err := affectedSchedules(db, loc, clo)
+	if err != nil {
+		return nil, err
+	}
+	if cancel && len(affected) > 0 {
+		now := time.Now()
+		// the clinic closes, so the penalty of a late cancellation is waived
+		req := m.CancelRequest{Reason: clo.Label, Waive: true}
+		for i, a := range affected {
+			_, err := cancelByPolicy(db, clo.InstID, a.ScheID, nil, clo.CreatedBy, req, now)
+			if err != nil {
+				// a Schedule already started stays, the closure is only reported to its doctor
+				if RuleBroken(err) != nil {
+					continue
+				}
+				return nil, err
+			}
+			affected[i].Cancelled = true
+		}
+	}
+	return &m.ClosureReport{Closure: *clo, Affected: affected}, nil
+}
+
+/* List the upcoming Schedules within the Closure, for a year when it's yearly */
+func affectedSchedules(db service.DB, loc *time.Location, clo *m.Closure) ([]m.AffectedSchedule, error) {
+	now := time.Now()
+	until := clo.EndAt
+	if clo.Yearly {
+		until = now.AddDate(1, 0, 0)
+	}
+	scheds := []m.AffectedSchedule{}
+	query := psql.Select("sche_id", "doct_id", "room_id", "start_at", "end_at").
+		From("schedule").
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"inst_id": clo.InstID}).
+		Where(sq.Gt{"end_at": now.UTC()}).
+		Where(sq.Lt{"start_at": until.UTC()}).
+		OrderBy("start_at", "sche_id")
+	if clo.RoomID != nil {
+		query = query.Where(sq.Eq{"room_id": clo.RoomID})
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list affected Schedules sql")
+	}
+	err = db.Select(&scheds, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list affected Schedules sql")
+	}
+	in := allocation.Input{
+		Config:   allocation.Config{Location: loc},
+		Closures: []allocation.Closure{{RoomID: clo.RoomID, StartAt: clo.StartAt, EndAt: clo.EndAt, Yearly: clo.Yearly}},
+	}
+	affected := []m.AffectedSchedule{}
+	for _, s := range scheds {
+		if len(in.Closed(s.RoomID, s.StartAt, s.EndAt)) > 0 {
+			affected = append(affected, s)
+		}
+	}
+	return affected, nil
+}
+
+/* Send a push notification to the doctor of every Schedule the Closure affects */
+func notifyClosure(db service.DB, logger *log.Logger, loc *time.Location, report *m.ClosureReport) {
+	for i, a := range report.Affected {
+		message := "Seu horário de " + a.StartAt.In(loc).Format("02/01 às 15:04")
+		if a.Cancelled {
+			message += " foi cancelado: " + report.Closure.Label
+		} else {
+			message += " coincide com um fechamento: " + report.Closure.Label
+		}
+		err := pushToDoctor(db, a.DoctID, message, map[string]string{
+			"scheID":   a.ScheID.String(),
+			"doctID":   a.DoctID.String(),
+			"closID":   report.Closure.ClosID.String(),
+			"contents": message,
+			"type":     "notification.closure",
+		})
+		if err != nil {
+			if logger != nil && err != sql.ErrNoRows {
+				logger.Println(err)
+			}
+			continue
+		}
+		report.Affected[i].Notified = true
+	}
+}
+
+/* List the Closures of the institution by Filter */
+func listClosures(db service.DB, instID uuid.UUID, f m.FilterClosure) ([]m.Closure, error) {
+	clos := []m.Closure{}
+	query := psql.Select("*").
+		From("closure").
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"inst_id": instID}).
+		OrderBy("start_at", "clos_id")
+	if f.RoomID != nil {
+		query = query.Where(sq.Eq{"room_id": *f.RoomID})
+	}
+	if f.From != nil {
+		query = query.Where(sq.Or{sq.Eq{"yearly": true}, sq.Gt{"end_at": f.From.UTC()}})
+	}
+	if f.To != nil {
+		query = query.Where(sq.Or{sq.Eq{"yearly": true}, sq.Lt{"start_at": f.To.UTC()}})
+	}
+	if f.Limit != nil {
+		query = query.Limit(uint64(*f.Limit))
+	}
+	if f.Offset != nil {
+		query = query.Offset(uint64(*f.Offset))
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list Closures sql")
+	}
+	err = db.Select(&clos, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list Closures sql")
+	}
+	return clos, nil
+}
+
+/* Return a Closure by clos_id */
+func getClosure(db service.DB, instID, closID uuid.UUID) (*m.Closure, error) {
+	clo := m.Closure{}
+	query := psql.Select("*").
+		From("closure").
+		Where(sq.Eq{"clos_id": closID, "inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get Closure sql")
+	}
+	err = db.Get(&clo, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error get Closure sql")
+		}
+		return nil, errInvalidClosure{"No closure " + closID.String()}
+	}
+	return &clo, nil
+}
+
+/* Soft delete a Closure */
+func deleteClosure(db service.DB, instID, closID uuid.UUID) (*m.Closure, error) {
+	clo := m.Closure{}
+	query := psql.Update("closure").
+		Set("deleted_at", time.Now()).
+		Where(sq.Eq{"clos_id": closID, "inst_id": instID}).
+		Where("deleted_at IS NULL").
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating delete Closure sql")
+	}
+	err = db.Get(&clo, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error delete Closure sql")
+		}
+		return nil, errInvalidClosure{"No closure " + closID.String()}
+	}
+	return &clo, nil
+}
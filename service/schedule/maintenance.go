@@ -0,0 +1,237 @@
+package schedule
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// ReasonStarted is given to the Schedules under a new maintenance that have already started
+const ReasonStarted = "already_started"
+
+type errInvalidMaintenance struct {
+	msg string
+}
+
+func (e errInvalidMaintenance) Error() string {
+	return e.msg
+}
+
+//InvalidMaintenance verifying type of error
+func InvalidMaintenance(err error) bool {
+	_, ok := errors.Cause(err).(errInvalidMaintenance)
+	return ok
+}
+
+//MaintenanceCreator service to block a room for maintenance
+type MaintenanceCreator struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+}
+
+//Run blocks the room and moves the Schedules within the maintenance to
+//other rooms, the doctors of the ones moved are notified
+func (c *MaintenanceCreator) Run(instID, roomID uuid.UUID, actorID *uuid.UUID, mai *m.RoomMaintenance) (*m.RoomMaintenanceReport, error) {
+	rmaiID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating room maintenance uuid")
+	}
+	mai.RmaiID = rmaiID
+	mai.InstID = instID
+	mai.RoomID = roomID
+	mai.CreatedBy = actorID
+
+	tx, err := c.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	report, err := createMaintenance(tx, mai)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	notifyMoves(c.DB, c.Logger, instID, report.Moved)
+	return report, nil
+}
+
+//MaintenanceLister service to list the maintenance of a room
+type MaintenanceLister struct {
+	DB *sqlx.DB
+}
+
+//Run returns the maintenance of the room by Filter
+func (l *MaintenanceLister) Run(instID, roomID uuid.UUID, f m.FilterRoomMaintenance) ([]m.RoomMaintenance, error) {
+	return listMaintenance(l.DB, instID, roomID, f)
+}
+
+//MaintenanceDeleter service to end the maintenance of a room
+type MaintenanceDeleter struct {
+	DB *sqlx.DB
+}
+
+//Run soft deletes a maintenance, the Schedules it moved stay in their new rooms
+func (d *MaintenanceDeleter) Run(instID, roomID, rmaiID uuid.UUID) (*m.RoomMaintenance, error) {
+	return deleteMaintenance(d.DB, instID, roomID, rmaiID)
+}
+
+/* Save the maintenance and move the Schedules within it to other rooms, the ones that can't be are reported */
+func createMaintenance(db service.DB, mai *m.RoomMaintenance) (*m.RoomMaintenanceReport, error) {
+	if len(mai.Reason) == 0 {
+		return nil, errInvalidMaintenance{"reason is required"}
+	}
+	if !mai.EndAt.After(mai.StartAt) {
+		return nil, errInvalidMaintenance{"The maintenance must end after it starts"}
+	}
+	err := lockAllocation(db, mai.InstID)
+	if err != nil {
+		return nil, err
+	}
+	exists := false
+	err = db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM room WHERE room_id = $1 AND inst_id = $2 AND inactive_at IS NULL)`, mai.RoomID, mai.InstID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error get room sql")
+	}
+	if !exists {
+		return nil, errInvalidMaintenance{"No active room " + mai.RoomID.String()}
+	}
+	query := psql.Insert("room_maintenance").
+		Columns("rmai_id", "inst_id", "room_id", "reason", "start_at", "end_at", "created_by").
+		Values(mai.RmaiID, mai.InstID, mai.RoomID, mai.Reason, mai.StartAt.UTC(), mai.EndAt.UTC(), mai.CreatedBy).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating create room maintenance sql")
+	}
+	err = db.Get(mai, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error create room maintenance sql")
+	}
+
+	scheds := []m.Schedule{}
+	list := psql.Select("*").
+		From("schedule").
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"room_id": mai.RoomID, "inst_id": mai.InstID}).
+		Where(sq.Lt{"start_at": mai.EndAt}).
+		Where(sq.Gt{"end_at": mai.StartAt}).
+		Where(sq.Gt{"end_at": time.Now().UTC()}).
+		OrderBy("start_at", "sche_id")
+	qSQL, args, err = list.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list Schedules under maintenance sql")
+	}
+	err = db.Select(&scheds, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list Schedules under maintenance sql")
+	}
+
+	report := &m.RoomMaintenanceReport{Maintenance: *mai, Moved: []m.RoomMove{}, Unmoved: []m.UnmovedSchedule{}}
+	for _, s := range scheds {
+		unmoved := m.UnmovedSchedule{ScheID: s.ScheID, DoctID: s.DoctID, StartAt: s.StartAt, EndAt: s.EndAt}
+		if !s.StartAt.After(time.Now()) {
+			unmoved.Reason = ReasonStarted
+			report.Unmoved = append(report.Unmoved, unmoved)
+			continue
+		}
+		// the maintenance is already saved, so the room isn't a candidate
+		in, err := allocation.Load(db, s.InstID, s.DoctID, s.StartAt, s.EndAt)
+		if err != nil {
+			return nil, err
+		}
+		room, err := in.Allocate(s.StartAt, s.EndAt)
+		if err != nil {
+			e := RuleBroken(allocationError(err, &s))
+			if e == nil {
+				return nil, err
+			}
+			unmoved.Reason = e.Reason
+			report.Unmoved = append(report.Unmoved, unmoved)
+			continue
+		}
+		query := psql.Update("schedule").
+			Set("room_id", room.ID).
+			Where(sq.Eq{"sche_id": s.ScheID, "room_id": mai.RoomID})
+
+		qSQL, args, err := query.ToSql()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error generating move Schedule sql")
+		}
+		_, err = db.Exec(qSQL, args...)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error move Schedule sql")
+		}
+		report.Moved = append(report.Moved, m.RoomMove{
+			ScheID:     s.ScheID,
+			DoctID:     s.DoctID,
+			StartAt:    s.StartAt,
+			EndAt:      s.EndAt,
+			FromRoomID: s.RoomID,
+			ToRoomID:   room.ID,
+			Applied:    true,
+		})
+	}
+	return report, nil
+}
+
+/* List the maintenance of a room by Filter */
+func listMaintenance(db service.DB, instID, roomID uuid.UUID, f m.FilterRoomMaintenance) ([]m.RoomMaintenance, error) {
+	mais := []m.RoomMaintenance{}
+	query := psql.Select("*").
+		From("room_maintenance").
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"room_id": roomID, "inst_id": instID}).
+		OrderBy("start_at", "rmai_id")
+	if f.From != nil {
+		query = query.Where(sq.Gt{"end_at": f.From.UTC()})
+	}
+	if f.To != nil {
+		query = query.Where(sq.Lt{"start_at": f.To.UTC()})
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list room maintenance sql")
+	}
+	err = db.Select(&mais, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list room maintenance sql")
+	}
+	return mais, nil
+}
+
+/* Soft delete a maintenance of a room */
+func deleteMaintenance(db service.DB, instID, roomID, rmaiID uuid.UUID) (*m.RoomMaintenance, error) {
+	mai := m.RoomMaintenance{}
+	query := psql.Update("room_maintenance").
+		Set("deleted_at", time.Now()).
+		Where(sq.Eq{"rmai_id": rmaiID, "room_id": roomID, "inst_id": instID}).
+		Where("deleted_at IS NULL").
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating delete room maintenance sql")
+	}
+	err = db.Get(&mai, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error delete room maintenance sql")
+		}
+		return nil, errInvalidMaintenance{"No maintenance " + rmaiID.String()}
+	}
+	return &mai, nil
+}
@@ -0,0 +1,104 @@
+package schedule
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// Reasons of the quote warnings
+const (
+	WarningBathroomPreference = "bathroom_preference_unmet"
+)
+
+//Quoter service to tell the room a Schedule would get without booking it
+type Quoter struct {
+	DB *sqlx.DB
+}
+
+//Run books the Schedule in a transaction that is rolled back, breaking the
+//same rules as Creator
+func (q *Quoter) Run(instID uuid.UUID, sch *m.Schedule) (*m.ScheduleQuote, error) {
+	tx, err := q.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	// nothing quoted is kept
+	defer tx.Rollback()
+
+	cre, err := bookSchedule(tx, instID, sch)
+	if err != nil {
+		return nil, err
+	}
+	return quoteSchedule(tx, cre)
+}
+
+/* Describe the booking of a Schedule just created: its room, the transitions around it and the preferences not met */
+func quoteSchedule(db service.DB, sch *m.Schedule) (*m.ScheduleQuote, error) {
+	label := ""
+	query := psql.Select("label").
+		From("room").
+		Where(sq.Eq{"room_id": sch.RoomID, "inst_id": sch.InstID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get quoted room sql")
+	}
+	err = db.Get(&label, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error get quoted room sql")
+	}
+	in, err := allocation.Load(db, sch.InstID, sch.DoctID, sch.StartAt, sch.EndAt)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &m.ScheduleQuote{
+		RoomID:            *sch.RoomID,
+		Label:             label,
+		StartAt:           sch.StartAt,
+		EndAt:             sch.EndAt,
+		TransitionMinutes: int(in.Transition / time.Minute),
+		Warnings:          []m.QuoteWarning{},
+	}
+	// the previous booking of the room whose transition may reach this one
+	var prev *allocation.Booking
+	followed := false
+	for i, b := range in.Booked {
+		if b.RoomID != *sch.RoomID || b.ScheID == sch.ScheID {
+			continue
+		}
+		if !b.EndAt.After(sch.StartAt) && !b.EndAt.Before(sch.StartAt.Add(-in.Transition)) &&
+			(prev == nil || b.EndAt.After(prev.EndAt)) {
+			prev = &in.Booked[i]
+		}
+		if b.DoctID == sch.DoctID && b.StartAt.Equal(sch.EndAt) {
+			followed = true
+		}
+	}
+	if prev != nil && prev.DoctID != sch.DoctID {
+		q.TransitionBefore = &m.TimeRange{StartAt: prev.EndAt, EndAt: prev.EndAt.Add(in.Transition)}
+	}
+	// no transition is kept before the next booking of the same doctor
+	if !followed {
+		q.TransitionAfter = &m.TimeRange{StartAt: sch.EndAt, EndAt: sch.EndAt.Add(in.Transition)}
+	}
+
+	if in.Bathroom == allocation.BathroomPreferred {
+		for _, r := range in.Rooms {
+			if r.ID == *sch.RoomID && !r.HasBathroom {
+				q.Warnings = append(q.Warnings, m.QuoteWarning{
+					Reason:  WarningBathroomPreference,
+					Message: "No room with a bathroom is free, the booking gets a room without one",
+				})
+			}
+		}
+	}
+	return q, nil
+}
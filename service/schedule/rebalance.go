@@ -0,0 +1,378 @@
+package schedule
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// Sources of a rebalance run
+const (
+	RebalanceSourceJob   = "job"
+	RebalanceSourceAdmin = "admin"
+)
+
+// maxRebalanceDays a run asked through the API can cover
+const maxRebalanceDays = 92
+
+type errInvalidRebalance struct {
+	msg string
+}
+
+func (e errInvalidRebalance) Error() string {
+	return e.msg
+}
+
+//InvalidRebalance verifying type of error
+func InvalidRebalance(err error) bool {
+	_, ok := errors.Cause(err).(errInvalidRebalance)
+	return ok
+}
+
+//Rebalancer service to run the scheduling algorithm for some days of an institution
+type Rebalancer struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+}
+
+//Run moves the Schedules to the rooms the algorithm gives them, or only lists
+//the moves when it's a preview, and returns the report saved
+func (r *Rebalancer) Run(instID uuid.UUID, actorID *uuid.UUID, req m.RebalanceRequest) (*m.RebalanceRun, error) {
+	from, err := time.Parse("2006-01-02", req.FromDate)
+	if err != nil {
+		return nil, errInvalidRebalance{"fromDate must be a date like 2006-01-02"}
+	}
+	to, err := time.Parse("2006-01-02", req.ToDate)
+	if err != nil {
+		return nil, errInvalidRebalance{"toDate must be a date like 2006-01-02"}
+	}
+	if to.Before(from) {
+		return nil, errInvalidRebalance{"toDate must not be before fromDate"}
+	}
+	if to.Sub(from) >= maxRebalanceDays*24*time.Hour {
+		return nil, errInvalidRebalance{"A run can't cover more than " + strconv.Itoa(maxRebalanceDays) + " days"}
+	}
+	run := &m.RebalanceRun{
+		InstID:   instID,
+		Source:   RebalanceSourceAdmin,
+		ActorID:  actorID,
+		Preview:  req.Preview,
+		FromDate: from,
+		ToDate:   to,
+	}
+	err = rebalance(r.DB, r.Logger, run)
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+//RebalanceLister service to list the reports of the runs
+type RebalanceLister struct {
+	DB *sqlx.DB
+}
+
+//Run returns the reports of the institution, newest first
+func (l *RebalanceLister) Run(instID uuid.UUID, f m.FilterRebalanceRun) ([]m.RebalanceRun, error) {
+	return listRebalanceRuns(l.DB, instID, f)
+}
+
+//RebalanceGetter service to get the report of a run
+type RebalanceGetter struct {
+	DB *sqlx.DB
+}
+
+//Run returns a report by reru_id
+func (g *RebalanceGetter) Run(instID, reruID uuid.UUID) (*m.RebalanceRun, error) {
+	return getRebalanceRun(g.DB, instID, reruID)
+}
+
+/* Run the scheduling algorithm for each day of the run, apply and notify the moves unless it's a preview, and save the report. A day that can't be placed is reported and left as it is */
+func rebalance(db *sqlx.DB, logger *log.Logger, run *m.RebalanceRun) error {
+	reruID, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "Error generating rebalance run uuid")
+	}
+	run.ReruID = reruID
+	run.StartedAt = time.Now()
+	run.Moves = m.RoomMoves{}
+	run.Failures = m.RebalanceFailures{}
+	for day := run.FromDate; !day.After(run.ToDate); day = day.AddDate(0, 0, 1) {
+		var moves []m.RoomMove
+		if run.Preview {
+			moves, err = planMoves(db, run.InstID, day)
+		} else {
+			moves, err = applyMoves(db, run.InstID, day)
+		}
+		if err != nil {
+			run.Failures = append(run.Failures, m.RebalanceFailure{Date: day.Format("2006-01-02"), Message: err.Error()})
+			continue
+		}
+		run.Moves = append(run.Moves, moves...)
+	}
+	if !run.Preview {
+		notifyMoves(db, logger, run.InstID, run.Moves)
+	}
+	run.FinishedAt = time.Now()
+	return createRebalanceRun(db, run)
+}
+
+// movableStatuses are the ones of the Schedules a rebalance can move to another room
+var movableStatuses = []string{StatusRequested, StatusConfirmed}
+
+/* Book again, soonest first, the Schedules of the local day that haven't started and can be moved, as the allocation engine books a new Schedule. The others, like the ones in use, keep their rooms taken. A Schedule that can't be booked fails the day */
+func planMoves(db service.DB, instID uuid.UUID, date time.Time) ([]m.RoomMove, error) {
+	loc, err := allocation.Location(db, instID)
+	if err != nil {
+		return nil, err
+	}
+	from := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 0, 1)
+	scheds := []m.Schedule{}
+	query := psql.Select("sche_id", "doct_id", "room_id", "start_at", "end_at").
+		From("schedule").
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"inst_id": instID}).
+		Where(sq.Eq{"status": movableStatuses}).
+		Where(sq.GtOrEq{"start_at": from.UTC()}).
+		Where(sq.Lt{"start_at": to.UTC()}).
+		Where(sq.Gt{"start_at": time.Now().UTC()}).
+		OrderBy("start_at", "sche_id")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list movable Schedules sql")
+	}
+	err = db.Select(&scheds, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list movable Schedules sql")
+	}
+	moves := []m.RoomMove{}
+	if len(scheds) == 0 {
+		return moves, nil
+	}
+	movable := map[uuid.UUID]bool{}
+	for _, s := range scheds {
+		movable[s.ScheID] = true
+	}
+	// the bookings kept, each Schedule placed is added to them
+	var booked []allocation.Booking
+	inputs := map[uuid.UUID]*allocation.Input{}
+	for _, s := range scheds {
+		in, ok := inputs[s.DoctID]
+		if !ok {
+			in, err = allocation.Load(db, instID, s.DoctID, from, to)
+			if err != nil {
+				return nil, err
+			}
+			inputs[s.DoctID] = in
+			if booked == nil {
+				booked = []allocation.Booking{}
+				for _, b := range in.Booked {
+					if !movable[b.ScheID] {
+						booked = append(booked, b)
+					}
+				}
+			}
+		}
+		in.Booked = booked
+		room, err := in.Allocate(s.StartAt, s.EndAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "Schedule "+s.ScheID.String()+" can't be placed")
+		}
+		booked = append(booked, allocation.Booking{ScheID: s.ScheID, DoctID: s.DoctID, RoomID: room.ID, StartAt: s.StartAt, EndAt: s.EndAt})
+		if s.RoomID != nil && *s.RoomID == room.ID {
+			continue
+		}
+		moves = append(moves, m.RoomMove{
+			ScheID:     s.ScheID,
+			DoctID:     s.DoctID,
+			StartAt:    s.StartAt,
+			EndAt:      s.EndAt,
+			FromRoomID: s.RoomID,
+			ToRoomID:   room.ID,
+		})
+	}
+	return moves, nil
+}
+
+/* Plan and move the Schedules of a day in a transaction holding the allocation lock, so no booking lands in between. The moves of a day are one plan, a Schedule changed since it was planned rolls the whole day back */
+func applyMoves(db *sqlx.DB, instID uuid.UUID, date time.Time) ([]m.RoomMove, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	err = lockAllocation(tx, instID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	moves, err := planMoves(tx, instID, date)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for i, mv := range moves {
+		query := psql.Update("schedule").
+			Set("room_id", mv.ToRoomID).
+			Where(sq.Eq{"sche_id": mv.ScheID, "inst_id": instID}).
+			Where(sq.Eq{"status": movableStatuses}).
+			Where("deleted_at IS NULL").
+			Where("room_id IS NOT DISTINCT FROM ?", mv.FromRoomID)
+
+		qSQL, args, err := query.ToSql()
+		if err != nil {
+			tx.Rollback()
+			return nil, errors.Wrap(err, "Error generating move Schedule sql")
+		}
+		res, err := tx.Exec(qSQL, args...)
+		if err != nil {
+			tx.Rollback()
+			return nil, errors.Wrap(err, "Error move Schedule sql")
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if n != 1 {
+			tx.Rollback()
+			return nil, errors.New("Schedule " + mv.ScheID.String() + " changed since it was planned, no move of the day was applied")
+		}
+		moves[i].Applied = true
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+/* Send a push notification to the doctor of every Schedule moved */
+func notifyMoves(db service.DB, logger *log.Logger, instID uuid.UUID, moves []m.RoomMove) {
+	loc, err := allocation.Location(db, instID)
+	if err != nil {
+		if logger != nil {
+			logger.Println(err)
+		}
+		return
+	}
+	for i, mv := range moves {
+		if !mv.Applied {
+			continue
+		}
+		target := struct {
+			Token *string `db:"push_tokens"`
+			Label string  `db:"label"`
+		}{}
+		query := psql.Select("u.push_tokens", "r.label").
+			From("doctor d").
+			Join(`"user" u USING (user_id)`).
+			Join("room r ON r.room_id = ?", mv.ToRoomID).
+			Where(sq.Eq{"d.doct_id": mv.DoctID})
+
+		qSQL, args, err := query.ToSql()
+		if err == nil {
+			err = db.Get(&target, qSQL, args...)
+		}
+		if err != nil {
+			if logger != nil && err != sql.ErrNoRows {
+				logger.Println("Error get doctor push token sql", err)
+			}
+			continue
+		}
+		message := "Seu horário de " + mv.StartAt.In(loc).Format("02/01 às 15:04") + " foi transferido para a sala " + target.Label
+		err = sendPush(target.Token, message, map[string]string{
+			"scheID":   mv.ScheID.String(),
+			"doctID":   mv.DoctID.String(),
+			"roomID":   mv.ToRoomID.String(),
+			"contents": message,
+			"type":     "notification.roomChanged",
+		})
+		if err != nil {
+			if logger != nil {
+				logger.Println(err)
+			}
+			continue
+		}
+		moves[i].Notified = true
+	}
+}
+
+/* Save the report of a run */
+func createRebalanceRun(db service.DB, run *m.RebalanceRun) error {
+	query := psql.Insert("rebalance_run").
+		Columns("reru_id", "inst_id", "source", "actor_id", "preview", "from_date", "to_date", "moves", "failures", "started_at", "finished_at").
+		Values(run.ReruID, run.InstID, run.Source, run.ActorID, run.Preview, run.FromDate.Format("2006-01-02"), run.ToDate.Format("2006-01-02"), run.Moves, run.Failures, run.StartedAt, run.FinishedAt)
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating create rebalance run sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error create rebalance run sql")
+	}
+	return nil
+}
+
+/* List the reports of the institution, newest first */
+func listRebalanceRuns(db service.DB, instID uuid.UUID, f m.FilterRebalanceRun) ([]m.RebalanceRun, error) {
+	runs := []m.RebalanceRun{}
+	limit := uint64(50)
+	if f.Limit != nil && *f.Limit > 0 {
+		limit = uint64(*f.Limit)
+	}
+	query := psql.Select("*").
+		From("rebalance_run").
+		Where(sq.Eq{"inst_id": instID}).
+		OrderBy("started_at DESC").
+		Limit(limit)
+	if f.Source != nil {
+		query = query.Where(sq.Eq{"source": *f.Source})
+	}
+	if f.Preview != nil {
+		query = query.Where(sq.Eq{"preview": *f.Preview})
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list rebalance runs sql")
+	}
+	err = db.Select(&runs, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list rebalance runs sql")
+	}
+	return runs, nil
+}
+
+/* Return a report by reru_id */
+func getRebalanceRun(db service.DB, instID, reruID uuid.UUID) (*m.RebalanceRun, error) {
+	run := m.RebalanceRun{}
+	query := psql.Select("*").
+		From("rebalance_run").
+		Where(sq.Eq{"reru_id": reruID, "inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get rebalance run sql")
+	}
+	err = db.Get(&run, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error get rebalance run sql")
+		}
+		return nil, errInvalidRebalance{"No rebalance run " + reruID.String()}
+	}
+	return &run, nil
+}
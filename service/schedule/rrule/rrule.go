@@ -0,0 +1,367 @@
+// Package rrule parses and expands the subset of the iCalendar (RFC 5545)
+// recurrence rules used by the schedule series: DAILY, WEEKLY and MONTHLY
+// frequencies with INTERVAL, BYDAY, BYMONTHDAY, WKST and a COUNT or UNTIL
+package rrule
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Freq of the rule
+type Freq string
+
+// Supported frequencies
+const (
+	Daily   Freq = "DAILY"
+	Weekly  Freq = "WEEKLY"
+	Monthly Freq = "MONTHLY"
+)
+
+const (
+	untilLayout     = "20060102T150405Z"
+	untilDateLayout = "20060102"
+	// maxPeriods stops rules that never match, like the 31st every 12 months from february
+	maxPeriods = 10000
+)
+
+// ErrUnbounded is returned for rules without COUNT or UNTIL
+var ErrUnbounded = errors.New("The rule must end with COUNT or UNTIL")
+
+// ErrTooMany is returned when the rule expands to more occurrences than allowed
+var ErrTooMany = errors.New("The rule has too many occurrences")
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeekdayNum is a BYDAY entry, N is the ordinal of the weekday in the month,
+// negative counting from the end, 0 for every one
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a parsed RRULE
+type Rule struct {
+	Freq       Freq
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	WeekStart  time.Weekday
+	Count      int
+	// Until is the last instant an occurrence may start, inclusive
+	Until time.Time
+	// UntilDate is set when UNTIL was a date, it ends with that day in the
+	// timezone of the start
+	UntilDate bool
+}
+
+// Parse reads a rule like FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10, the RRULE: prefix is optional
+func Parse(s string) (*Rule, error) {
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if len(s) == 0 {
+		return nil, errors.New("Empty rule")
+	}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || len(kv[1]) == 0 {
+			return nil, errors.New("Invalid rule part: " + part)
+		}
+		key, val := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		if seen[key] {
+			return nil, errors.New("Repeated rule part: " + key)
+		}
+		seen[key] = true
+		var err error
+		switch key {
+		case "FREQ":
+			r.Freq = Freq(val)
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly {
+				return nil, errors.New("Unsupported FREQ: " + val)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(val)
+			if err != nil || r.Interval < 1 {
+				return nil, errors.New("Invalid INTERVAL: " + val)
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(val)
+			if err != nil || r.Count < 1 {
+				return nil, errors.New("Invalid COUNT: " + val)
+			}
+		case "UNTIL":
+			r.Until, err = time.Parse(untilLayout, val)
+			if err != nil {
+				r.Until, err = time.Parse(untilDateLayout, val)
+				r.UntilDate = true
+			}
+			if err != nil {
+				return nil, errors.New("Invalid UNTIL: " + val)
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				wn, err := parseWeekdayNum(d)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wn)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(val, ",") {
+				md, err := strconv.Atoi(d)
+				if err != nil || md == 0 || md < -31 || md > 31 {
+					return nil, errors.New("Invalid BYMONTHDAY: " + d)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, md)
+			}
+		case "WKST":
+			d, ok := weekdays[val]
+			if !ok {
+				return nil, errors.New("Invalid WKST: " + val)
+			}
+			r.WeekStart = d
+		default:
+			return nil, errors.New("Unsupported rule part: " + key)
+		}
+	}
+	err := r.validate()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	if len(s) < 2 {
+		return WeekdayNum{}, errors.New("Invalid BYDAY: " + s)
+	}
+	d, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, errors.New("Invalid BYDAY: " + s)
+	}
+	wn := WeekdayNum{Day: d}
+	if len(s) > 2 {
+		n, err := strconv.Atoi(s[:len(s)-2])
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, errors.New("Invalid BYDAY: " + s)
+		}
+		wn.N = n
+	}
+	return wn, nil
+}
+
+func (r *Rule) validate() error {
+	if len(r.Freq) == 0 {
+		return errors.New("The rule must have a FREQ")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return errors.New("The rule can't have both COUNT and UNTIL")
+	}
+	if r.Count == 0 && r.Until.IsZero() {
+		return ErrUnbounded
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != Monthly {
+		return errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	for _, wn := range r.ByDay {
+		if wn.N != 0 && r.Freq != Monthly {
+			return errors.New("BYDAY ordinals are only supported with FREQ=MONTHLY")
+		}
+	}
+	return nil
+}
+
+// String formats the rule back to its RRULE value
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := []string{}
+		for _, wn := range r.ByDay {
+			d := weekdayName(wn.Day)
+			if wn.N != 0 {
+				d = strconv.Itoa(wn.N) + d
+			}
+			days = append(days, d)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := []string{}
+		for _, md := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(md))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayName(r.WeekStart))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.UntilDate {
+			parts = append(parts, "UNTIL="+r.Until.Format(untilDateLayout))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+func weekdayName(d time.Weekday) string {
+	for k, v := range weekdays {
+		if v == d {
+			return k
+		}
+	}
+	return ""
+}
+
+// All returns the start of every occurrence from dtstart on, at the wall
+// clock time of dtstart in its location. A dtstart not matching the rule
+// isn't an occurrence. It fails with ErrTooMany past max occurrences
+func (r Rule) All(dtstart time.Time, max int) ([]time.Time, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	until := r.Until
+	if r.UntilDate {
+		y, mo, d := r.Until.Date()
+		until = time.Date(y, mo, d, 23, 59, 59, 0, dtstart.Location())
+	}
+	out := []time.Time{}
+	for i := 0; i < maxPeriods; i++ {
+		for _, t := range r.period(dtstart, i*interval) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !until.IsZero() && t.After(until) {
+				return out, nil
+			}
+			if len(out) == max {
+				return nil, ErrTooMany
+			}
+			out = append(out, t)
+			if r.Count > 0 && len(out) == r.Count {
+				return out, nil
+			}
+		}
+	}
+	return out, nil
+}
+
+// period returns the candidates of the n-th period after dtstart, in order
+func (r Rule) period(dtstart time.Time, n int) []time.Time {
+	y, mo, d := dtstart.Date()
+	h, mi, s := dtstart.Clock()
+	loc := dtstart.Location()
+	at := func(y int, mo time.Month, d int) time.Time {
+		return time.Date(y, mo, d, h, mi, s, 0, loc)
+	}
+
+	switch r.Freq {
+	case Daily:
+		t := at(y, mo, d+n)
+		if len(r.ByDay) > 0 && !r.hasWeekday(t.Weekday()) {
+			return nil
+		}
+		return []time.Time{t}
+	case Weekly:
+		days := []time.Weekday{dtstart.Weekday()}
+		if len(r.ByDay) > 0 {
+			days = []time.Weekday{}
+			for _, wn := range r.ByDay {
+				days = append(days, wn.Day)
+			}
+		}
+		offset := func(wd time.Weekday) int { return (int(wd) - int(r.WeekStart) + 7) % 7 }
+		weekStart := d - offset(dtstart.Weekday()) + 7*n
+		out := []time.Time{}
+		for _, wd := range days {
+			out = append(out, at(y, mo, weekStart+offset(wd)))
+		}
+		return sortUnique(out)
+	case Monthly:
+		first := time.Date(y, mo+time.Month(n), 1, 0, 0, 0, 0, loc)
+		daysIn := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, loc).Day()
+		out := []time.Time{}
+		for day := 1; day <= daysIn; day++ {
+			if r.monthDayMatches(first.Weekday(), day, daysIn, d) {
+				out = append(out, at(first.Year(), first.Month(), day))
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func (r Rule) hasWeekday(wd time.Weekday) bool {
+	for _, wn := range r.ByDay {
+		if wn.Day == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// monthDayMatches tells if day of a month starting on firstWeekday is an
+// occurrence, without BYDAY and BYMONTHDAY the day of dtstart is
+func (r Rule) monthDayMatches(firstWeekday time.Weekday, day, daysIn, startDay int) bool {
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		return day == startDay
+	}
+	if len(r.ByMonthDay) > 0 {
+		ok := false
+		for _, md := range r.ByMonthDay {
+			if md == day || daysIn+md+1 == day {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(r.ByDay) > 0 {
+		wd := time.Weekday((int(firstWeekday) + day - 1) % 7)
+		nth, nthLast := (day-1)/7+1, -((daysIn-day)/7 + 1)
+		for _, wn := range r.ByDay {
+			if wn.Day == wd && (wn.N == 0 || wn.N == nth || wn.N == nthLast) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func sortUnique(ts []time.Time) []time.Time {
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Before(ts[j]) })
+	out := []time.Time{}
+	for i, t := range ts {
+		if i == 0 || !t.Equal(ts[i-1]) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
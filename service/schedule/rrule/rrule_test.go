@@ -0,0 +1,98 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAll(t *testing.T) {
+	loc := time.FixedZone("BRT", -3*60*60)
+	// a monday
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, loc)
+	cases := []struct {
+		rule string
+		want []string
+	}{
+		{"FREQ=DAILY;COUNT=3", []string{"2026-01-05", "2026-01-06", "2026-01-07"}},
+		{"FREQ=DAILY;INTERVAL=2;UNTIL=20260111T120000Z", []string{"2026-01-05", "2026-01-07", "2026-01-09", "2026-01-11"}},
+		{"FREQ=DAILY;BYDAY=SA,SU;UNTIL=20260112", []string{"2026-01-10", "2026-01-11"}},
+		{"FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4", []string{"2026-01-05", "2026-01-08", "2026-01-12", "2026-01-15"}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=FR;COUNT=3", []string{"2026-01-09", "2026-01-23", "2026-02-06"}},
+		// the week of a sunday start is the one before it without WKST=SU
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=SU;COUNT=2", []string{"2026-01-11", "2026-01-25"}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=SU;WKST=SU;COUNT=2", []string{"2026-01-18", "2026-02-01"}},
+		{"FREQ=MONTHLY;COUNT=3", []string{"2026-01-05", "2026-02-05", "2026-03-05"}},
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", []string{"2026-01-30", "2026-02-27", "2026-03-27"}},
+		{"FREQ=MONTHLY;BYDAY=2TU;COUNT=2", []string{"2026-01-13", "2026-02-10"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3", []string{"2026-01-31", "2026-03-31", "2026-05-31"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=2", []string{"2026-01-31", "2026-02-28"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=13;BYDAY=FR;COUNT=2", []string{"2026-02-13", "2026-03-13"}},
+	}
+	for _, c := range cases {
+		r, err := Parse(c.rule)
+		if err != nil {
+			t.Fatal(c.rule, err)
+		}
+		got, err := r.All(start, 100)
+		if err != nil {
+			t.Fatal(c.rule, err)
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: expected %v, got %v", c.rule, c.want, got)
+		}
+		for i, g := range got {
+			if g.Format("2006-01-02") != c.want[i] || g.Hour() != 9 || g.Location() != loc {
+				t.Fatalf("%s: expected %v, got %v", c.rule, c.want, got)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"FREQ=WEEKLY",
+		"FREQ=YEARLY;COUNT=2",
+		"FREQ=WEEKLY;COUNT=2;UNTIL=20260101",
+		"FREQ=WEEKLY;COUNT=0",
+		"FREQ=WEEKLY;INTERVAL=0;COUNT=2",
+		"FREQ=WEEKLY;BYDAY=1MO;COUNT=2",
+		"FREQ=WEEKLY;BYMONTHDAY=1;COUNT=2",
+		"FREQ=MONTHLY;BYDAY=6MO;COUNT=2",
+		"FREQ=MONTHLY;BYHOUR=9;COUNT=2",
+		"FREQ=DAILY;COUNT=2;COUNT=3",
+	} {
+		if _, err := Parse(rule); err == nil {
+			t.Fatalf("%q: expected an error", rule)
+		}
+	}
+	if _, err := Parse("FREQ=DAILY"); err != ErrUnbounded {
+		t.Fatalf("expected ErrUnbounded, got %v", err)
+	}
+}
+
+func TestTooMany(t *testing.T) {
+	r, err := Parse("FREQ=DAILY;COUNT=11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.All(time.Now(), 10); err != ErrTooMany {
+		t.Fatalf("expected ErrTooMany, got %v", err)
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, rule := range []string{
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20261231T235959Z",
+		"FREQ=MONTHLY;BYDAY=-1FR;WKST=SU;COUNT=6",
+		"FREQ=MONTHLY;BYMONTHDAY=1,15;UNTIL=20261231",
+	} {
+		r, err := Parse("RRULE:" + rule)
+		if err != nil {
+			t.Fatal(rule, err)
+		}
+		if r.String() != rule {
+			t.Fatalf("expected %s, got %s", rule, r.String())
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
 
 	sq "github.com/elgris/sqrl"
 	m "gitlab.com/falqon/inovantapp/backend/models"
@@ -34,25 +35,63 @@ type detailError struct {
 	SendReport   *string `json:"sendReport,omitempty"`
 }
 
-type errNotFound struct {
-	err error
+// Reasons of the rules a Schedule can break
+const (
+	ReasonMinimumTime         = "minimum_time"
+	ReasonTurnMismatch        = "turn_mismatch"
+	ReasonOutsideHours        = "outside_opening_hours"
+	ReasonDateInPast          = "date_in_past"
+	ReasonDoctorOverlap       = "doctor_overlap"
+	ReasonNoRoomFeatures      = "no_room_with_features"
+	ReasonTransitionCollision = "transition_time_collision"
+	ReasonNoRoom              = "no_room_available"
+	ReasonRoomTaken           = "room_taken"
+	ReasonClinicClosed        = "clinic_closed"
+)
+
+// RuleError is a scheduling rule the Schedule breaks, Reason is stable for
+// the clients and Values holds what broke it
+type RuleError struct {
+	Reason  string
+	Message string
+	Values  map[string]interface{}
+}
+
+func (e *RuleError) Error() string {
+	return e.Message
+}
+
+// Conflict tells if the Schedule is valid but collides with others
+func (e *RuleError) Conflict() bool {
+	switch e.Reason {
+	case ReasonDoctorOverlap, ReasonNoRoomFeatures, ReasonTransitionCollision, ReasonNoRoom, ReasonRoomTaken, ReasonAlreadyCancelled, ReasonInvalidTransition, ReasonNotEditable:
+		return true
+	}
+	return false
 }
 
 //Creator service to create new Schedule
 type Creator struct {
-	DB     service.DB
+	DB     *sqlx.DB
 	Logger *log.Logger
 }
 
 //Run create new Schedule
-func (c *Creator) Run(sch *m.Schedule) (*m.Schedule, error) {
-	scheID, err := uuid.NewV4()
+func (c *Creator) Run(instID uuid.UUID, sch *m.Schedule) (*m.Schedule, error) {
+	tx, err := c.DB.Beginx()
 	if err != nil {
-		return nil, errors.Wrap(err, "Error generating Schedule uuid")
+		return nil, err
 	}
-	sch.ScheID = scheID
-	u, err := createSchedule(c.DB, sch)
-	return u, err
+	u, err := bookSchedule(tx, instID, sch)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit Schedule")
+	}
+	return u, nil
 }
 
 //Lister service to return Schedule
@@ -61,8 +100,8 @@ type Lister struct {
 }
 
 //Run return a list of Schedule by Filter
-func (l *Lister) Run(doctID *uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error) {
-	u, err := listSchedule(l.DB, doctID, f)
+func (l *Lister) Run(instID uuid.UUID, doctID *uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error) {
+	u, err := listSchedule(l.DB, instID, doctID, f)
 	return u, err
 }
 
@@ -72,8 +111,8 @@ type Getter struct {
 }
 
 //Run return a Schedule by sche_id
-func (g *Getter) Run(doctID *uuid.UUID, scheID uuid.UUID) (*m.Schedule, error) {
-	u, err := getSchedule(g.DB, doctID, scheID)
+func (g *Getter) Run(instID uuid.UUID, doctID *uuid.UUID, scheID uuid.UUID) (*m.Schedule, error) {
+	u, err := getSchedule(g.DB, instID, doctID, scheID)
 	return u, err
 }
 
@@ -82,10 +121,33 @@ type UpdateSchedule struct {
 	DB *sqlx.DB
 }
 
-//Run return a Schedule by sche_id
-func (g *UpdateSchedule) Run(sch *m.Schedule) (*m.Schedule, error) {
-	u, err := updateSchedule(g.DB, sch, true)
-	return u, err
+//Run return a Schedule by sche_id, a doctor updates only its own
+func (g *UpdateSchedule) Run(instID uuid.UUID, sch *m.Schedule, doctID *uuid.UUID) (*m.Schedule, error) {
+	sch.InstID = instID
+	tx, err := g.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	err = lockAllocation(tx, instID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	_, err = lockEditable(tx, instID, sch.ScheID, doctID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	u, err := updateSchedule(tx, sch, doctID, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit Schedule")
+	}
+	return u, nil
 }
 
 //Updater service to update Schedule
@@ -95,38 +157,13 @@ type Updater struct {
 	Create Creator
 }
 
-//Run update Schedule data
-func (g *Updater) Run(sch *m.Schedule) (*m.Schedule, error) {
-	s := m.Schedule{
-		EndAt:   sch.EndAt,
-		StartAt: sch.StartAt,
-		DoctID:  sch.DoctID,
-		Plan:    sch.Plan,
-		Info:    sch.Info,
-	}
+//Run update Schedule data, a doctor updates only its own
+func (g *Updater) Run(instID uuid.UUID, sch *m.Schedule, doctID *uuid.UUID) (*m.Schedule, error) {
 	tx, err := g.DB.Beginx()
-	_, err = updateDeleteAtSchedule(tx, sch.ScheID)
 	if err != nil {
-		if g.Logger != nil {
-			g.Logger.Println("Error Updating Schedule:", err)
-		}
-		tx.Rollback()
 		return nil, err
 	}
-	scheC := Creator{DB: tx}
-	cre, err := scheC.Run(&s)
-	if err != nil {
-		if g.Logger != nil {
-			g.Logger.Println("Error Creating Schedule:", err)
-		}
-		tx.Rollback()
-		return nil, err
-	}
-	sch.StartAt = cre.StartAt
-	sch.EndAt = cre.EndAt
-	sch.RoomID = cre.RoomID
-	sch.DeletedAt.Valid = false
-	upd, err := updateSchedule(tx, sch, false)
+	upd, err := replaceSchedule(tx, instID, sch, doctID)
 	if err != nil {
 		if g.Logger != nil {
 			g.Logger.Println("Error Updating Schedule:", err)
@@ -134,15 +171,6 @@ func (g *Updater) Run(sch *m.Schedule) (*m.Schedule, error) {
 		tx.Rollback()
 		return nil, err
 	}
-	scheD := Deleter{DB: tx}
-	_, err = scheD.Run(cre.ScheID, &cre.DoctID)
-	if err != nil {
-		if g.Logger != nil {
-			g.Logger.Println("Error Deleting Schedule:", err)
-		}
-		tx.Rollback()
-		return nil, err
-	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -158,8 +186,8 @@ type Deleter struct {
 }
 
 //Run soft delete Schedule by sche_id
-func (d *Deleter) Run(scheID uuid.UUID, doctID *uuid.UUID) (*m.Schedule, error) {
-	u, err := deleteSchedule(d.DB, scheID, doctID)
+func (d *Deleter) Run(instID, scheID uuid.UUID, doctID *uuid.UUID) (*m.Schedule, error) {
+	u, err := deleteSchedule(d.DB, instID, scheID, doctID)
 	return u, err
 }
 
@@ -169,260 +197,183 @@ type Calendar struct {
 }
 
 //Run service Calendar to list query calendar
-func (c *Calendar) Run(doctID *uuid.UUID, fCalendar m.FilterCalendar) ([]m.Calendar, error) {
-	u, err := listCalendar(c.DB, doctID, fCalendar)
+func (c *Calendar) Run(instID uuid.UUID, doctID *uuid.UUID, fCalendar m.FilterCalendar) ([]m.Calendar, error) {
+	u, err := listCalendar(c.DB, instID, doctID, fCalendar)
 	return u, err
 }
 
-//UpdateDeleter service to soft list calendar view
-type UpdateDeleter struct {
+//Outdoor service to soft list Outdoor view
+type Outdoor struct {
 	DB *sqlx.DB
 }
 
-//Run service Calendar to list query calendar
-func (up *UpdateDeleter) Run(scheID uuid.UUID) (*m.Schedule, error) {
-	u, err := updateDeleteAtSchedule(up.DB, scheID)
+//Run service Outdoor to list query Outdoor
+func (c *Outdoor) Run(instID, roomID uuid.UUID) (*m.Outdoor, error) {
+	u, err := outdoor(c.DB, instID, roomID)
 	return u, err
 }
 
-//Outdoor service to soft list Outdoor view
-type Outdoor struct {
-	DB *sqlx.DB
+/* Lock the rooms of the institution until the transaction ends, so two bookings can't pick the same room. The db must be a transaction */
+func lockAllocation(db service.DB, instID uuid.UUID) error {
+	_, err := db.Exec("SELECT pg_advisory_xact_lock(hashtext('schedule_allocation:' || $1::text))", instID)
+	if err != nil {
+		return errors.Wrap(err, "Error lock Schedule allocation sql")
+	}
+	return nil
 }
 
-//Run service Outdoor to list query Outdoor
-func (c *Outdoor) Run(roomID uuid.UUID) (*m.Outdoor, error) {
-	u, err := outdoor(c.DB, roomID)
-	return u, err
+/* Create a new Schedule with a new sche_id */
+func bookSchedule(db service.DB, instID uuid.UUID, sch *m.Schedule) (*m.Schedule, error) {
+	scheID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating Schedule uuid")
+	}
+	sch.ScheID = scheID
+	sch.InstID = instID
+	return createSchedule(db, sch)
 }
 
-/* Create a new Schedule to database */
+/* Create a new Schedule to database, the db must be a transaction */
 func createSchedule(db service.DB, sch *m.Schedule) (*m.Schedule, error) {
-
-	err := validationsInsertSchedule(db, sch)
+	err := lockAllocation(db, sch.InstID)
 	if err != nil {
 		return nil, err
 	}
 
-	needBathroom, bathroomTreatment, err := needBathroom(db, sch.DoctID)
+	err = validationsInsertSchedule(db, sch)
 	if err != nil {
 		return nil, err
 	}
 
-	args := []interface{}{sch.ScheID, sch.DoctID, sch.StartAt, sch.EndAt, sch.Plan, sch.Info}
+	in, err := allocation.Load(db, sch.InstID, sch.DoctID, sch.StartAt, sch.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	room, err := in.Allocate(sch.StartAt, sch.EndAt)
+	if err != nil {
+		return nil, allocationError(err, sch)
+	}
 
-	filterRooms := filterRooms(needBathroom, bathroomTreatment)
+	// a Schedule asked as requested waits for approval when its plan needs it
+	status, err := initialStatus(db, sch.InstID, sch.Status == StatusRequested, sch.Plan)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	query := psql.Insert("schedule").
+		Columns("sche_id", "doct_id", "room_id", "start_at", "end_at", "plan", "info", "inst_id", "status", "status_at").
+		Values(sch.ScheID, sch.DoctID, room.ID, sch.StartAt.UTC(), sch.EndAt.UTC(), sch.Plan, sch.Info, sch.InstID, status, now).
+		Suffix("RETURNING *")
 
-	query := `
-			WITH config_days AS (
-				SELECT value
-				FROM config
-				WHERE KEY = 'schedule-hour_config_flex'
-			),
-			config_timezone AS (
-				SELECT value->>'timezone' AS timezone
-				FROM config
-				WHERE KEY = 'timezone-local'
-			),
-			dates_to_local AS (
-				SELECT (($3::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE cti.timezone) AS start_time,
-				(($4::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE cti.timezone) AS end_time
-				FROM config_timezone cti
-			),
-			config_result_int AS (
-				SELECT row_number() OVER(ORDER BY a."key") AS id,
-				a."key" AS "day",
-				jsonb_array_elements(a.value) AS slot
-				FROM config_days, jsonb_each(config_days.value) a
-			),
-			config_building_timezone AS (
-				SELECT id, "day",
-				(( ((slot->>'start')::TIME) AT TIME ZONE 'UTC') AT TIME ZONE ct.timezone)::TIME AS start_time,
-				(( ((slot->>'end')::TIME) AT TIME ZONE 'UTC') AT TIME ZONE ct.timezone)::TIME AS end_time
-				FROM config_result_int, config_timezone ct
-			),
-			config_result AS (
-				SELECT id, "day", jsonb_build_object('start', substring((start_time::TIME)::TEXT, 0, 6), 'end', substring((end_time::TIME)::TEXT, 0, 6)) AS slot
-				FROM config_building_timezone
-			),
-			slots_by_day AS (
-				SELECT id, "day", slot,
-				EXTRACT(EPOCH FROM (slot->>'start')::TIME)::INT AS start_slot,
-				EXTRACT(EPOCH FROM (slot->>'end')::TIME)::INT AS end_slot
-				FROM config_result
-			),
-			config_transition AS (
-				SELECT value
-				FROM config
-				WHERE KEY = 'schedule-transition_time'
-			),
-			schedule_local AS (
-				SELECT sche_id, doct_id, room_id,
-					(( ((start_at)) AT TIME ZONE 'UTC') AT TIME ZONE ct.timezone) AS start_at,
-					(( ((end_at)) AT TIME ZONE 'UTC') AT TIME ZONE ct.timezone) AS end_at,
-					plan, info, created_at, deleted_at
-				FROM schedule, config_timezone ct
-			),
-			scheduled AS (
-				SELECT room_id, start_at::date as id, start_at,
-				CASE
-					WHEN doct_id = $2 THEN end_at
-					ELSE (end_at + (value->>'transition_time' ||' minutes')::INTERVAL)::TIMESTAMP
-				END AS end_at,
-				slot,
-				ROW_NUMBER () OVER (
-					PARTITION BY room_id, start_at::date, slot
-					ORDER BY start_at ASC
-				),
-				doct_id
-				FROM config_transition ct, schedule_local s
-				JOIN slots_by_day sbd ON EXTRACT(EPOCH FROM (s.start_at)::TIME) >= sbd.start_slot
-					AND EXTRACT(EPOCH FROM (s.end_at)::TIME) <= sbd.end_slot
-					AND TRIM(TO_CHAR(s.start_at, 'day'))::TEXT = "day"
-				WHERE deleted_at IS NULL
-				ORDER BY room_id, id
-			),
-			counted AS (
-				SELECT room_id, id, count(*), slot
-				FROM scheduled
-				GROUP BY room_id, id, slot
-				ORDER BY room_id, id
-			),
-			prev AS (
-				SELECT counted.room_id, counted.id, NULL::TIMESTAMP AS start_at,
-				((scheduled.start_at::DATE)::TEXT || ' ' || (counted.slot->>'start')::TEXT || ':00')::TIMESTAMP AS end_at, counted.slot, 0 AS ROW_NUMBER
-				FROM counted
-				JOIN scheduled ON scheduled.room_id = counted.room_id AND scheduled.id = counted.id
-			),
-			nextt AS (
-				SELECT counted.room_id, counted.id,
-				((scheduled.start_at::DATE)::TEXT || ' ' || (counted.slot->>'end')::TEXT || ':00')::TIMESTAMP, NULL::TIMESTAMP, counted.slot, count+1 rn
-				FROM counted
-				JOIN scheduled ON scheduled.room_id = counted.room_id AND scheduled.id = counted.id
-			),
-			joined AS (
-				SELECT * FROM prev
-				UNION
-				SELECT room_id, id, start_at, end_at, slot, ROW_NUMBER FROM scheduled
-				UNION
-				SELECT * FROM nextt
-			),
-			order_joined as (
-				SELECT COALESCE(end_at, start_at) AS ord, *
-				FROM joined
-			),
-			ordered as (
-				SELECT * FROM order_joined
-				ORDER BY room_id, id, ord, ROW_NUMBER
-			),
-			create_sched_date AS (
-				SELECT *, COALESCE(start_at, end_at) AS sched_date
-				FROM ordered
-			),
-			order_sched_date AS (
-				SELECT room_id, id, start_at, end_at, slot, ROW_NUMBER, sched_date
-				FROM create_sched_date
-				ORDER BY room_id, id, sched_date, ROW_NUMBER
-			),
-			slots_free AS (
-				SELECT room_id, id, ROW_NUMBER, "count",
-				order_sched_date.start_at, end_at, counted.slot,
-				LAG(end_at::TIME) OVER (PARTITION BY room_id, sched_date, ROW_NUMBER) AS prev_end_at,
-				CASE
-					WHEN ROW_NUMBER < count THEN jsonb_build_object('start', substring( (LAG(end_at::TIME) OVER (PARTITION BY room_id) )::text, 1, 5) , 'end', substring( (order_sched_date.start_at::TIME)::TEXT, 1, 5))
-					WHEN ROW_NUMBER = count THEN jsonb_build_object('start', substring( (LAG(end_at::TIME) OVER (PARTITION BY room_id) )::text, 1, 5) , 'end', substring( (order_sched_date.start_at::TIME)::TEXT, 1, 5))
-					WHEN ROW_NUMBER > count THEN jsonb_build_object('start', substring( (LAG(end_at::time) OVER (PARTITION BY room_id) )::text, 1, 5) , 'end', counted.slot->>'end')
-				END slot_free
-				FROM order_sched_date
-				JOIN counted USING (room_id, id, slot)
-			),
-			slots_free_by_room AS (
-				SELECT room_id, start_at::DATE AS date_of_month, slot_free
-				FROM slots_free
-				ORDER BY start_at, room_id
-			),
-			generated_dates_by_filter AS (
-				SELECT roo.room_id, generate_series(dtl.start_time, dtl.end_time, '1 day'::INTERVAL) AS days
-				FROM room roo, dates_to_local dtl
-				WHERE roo.inactive_at IS NULL
-				` + filterRooms + `
-			),
-			slots_with_days AS (
-				SELECT room_id, days::DATE AS days, slot
-				FROM generated_dates_by_filter ft
-				JOIN config_result cr ON cr."day" = TRIM(TO_CHAR(ft.days, 'day'))::TEXT
-			),
-			slots_not_full_by_day AS (
-				SELECT swd.room_id AS room_id, swd.days AS days,
-				COALESCE(sfbr.slot_free, swd.slot) AS slot
-				FROM slots_with_days swd
-				LEFT JOIN slots_free_by_room sfbr ON sfbr.room_id = swd.room_id AND sfbr.date_of_month = swd.days AND
-				( EXTRACT(EPOCH FROM (sfbr.slot_free->>'start')::TIME)::INT >= EXTRACT(EPOCH FROM (swd.slot->>'start')::TIME)::INT
-				AND
-				EXTRACT(EPOCH FROM (sfbr.slot_free->>'end')::TIME)::INT <= EXTRACT(EPOCH FROM (swd.slot->>'end')::TIME)::INT )
-			),
-			closest_rooms AS (
-				SELECT ABS(EXTRACT(epoch FROM start_at - start_time)) as closest_schedule, room_id
-				FROM schedule_local s
-				JOIN	dates_to_local d on s.start_at::DATE = d.start_time::DATE
-				AND doct_id = $2
-			),
-			ordered_rooms AS (
-				SELECT * FROM closest_rooms
-				UNION SELECT 100000000000, room_id FROM room r where not exists (SELECT room_id FROM closest_rooms c where c.room_id = r.room_id)
-			),
-			slots_not_full_by_day_ordered AS (
-				SELECT *, (SELECT MAX(od.closest_schedule) FROM ordered_rooms od WHERE s.room_id = od.room_id) as ooo
-				FROM slots_not_full_by_day s
-				ORDER BY (
-					SELECT MIN(od.closest_schedule) FROM ordered_rooms od WHERE s.room_id = od.room_id
-				) ASC
-			),
-			invalid_slots AS (
-				SELECT sd.*
-				FROM scheduled s
-				JOIN slots_not_full_by_day sd ON s.id = sd.days AND s.room_id = sd.room_id AND s.start_at::TIME = (sd.slot->>'end')::TIME
-				JOIN  dates_to_local dtl ON 1=1
-				JOIN  config_transition ct ON 1=1
-				WHERE doct_id <> $2
-				AND (dtl.end_time::TIME + (ct.value->>'transition_time' ||' minutes')::INTERVAL) > (sd.slot->>'end')::TIME
-			),
-			valid_slots_with_transition_time AS (
-				SELECT *
-				FROM slots_not_full_by_day_ordered fl
-				WHERE NOT EXISTS(SELECT iv.room_id, * FROM invalid_slots iv WHERE iv.room_id = fl.room_id AND iv.days = fl.days AND iv.slot = fl.slot)
-			),
-			room_for_insert_flex AS (
-				SELECT room_id, days, slot
-				FROM valid_slots_with_transition_time, dates_to_local dtl, config_transition ct
-				WHERE days = (dtl.start_time)::DATE
-				AND EXTRACT(EPOCH FROM (slot->>'start')::TIME) <= EXTRACT(EPOCH FROM (dtl.start_time)::TIME)
-				AND EXTRACT(EPOCH FROM (slot->>'end')::TIME) >= EXTRACT(EPOCH FROM (dtl.end_time)::TIME)
-				AND EXTRACT(EPOCH FROM (slot->>'end')::TIME)::INT - EXTRACT(EPOCH FROM (slot->>'start')::TIME)::INT > 0
-				LIMIT 1
-			)
-			INSERT INTO schedule
-			SELECT $1, $2, room_id, $3, $4, $5, $6
-			FROM room_for_insert_flex
-			join room using (room_id)
-			RETURNING *
-		`
-	err = db.Get(sch, query, args...)
+	qSQL, args, err := query.ToSql()
 	if err != nil {
-		if err != sql.ErrNoRows {
-			return nil, errors.Wrap(err, "Error inserting Schedule in database")
-		}
-		return nil, errNotFound{err: err}
+		return nil, errors.Wrap(err, "Error generating create Schedule sql")
+	}
+	err = db.Get(sch, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error inserting Schedule in database")
+	}
+	err = recordStatus(db, sch.InstID, sch.ScheID, nil, status, nil, "", now)
+	if err != nil {
+		return nil, err
 	}
 	return sch, nil
 }
 
+/* Tell why no room could be booked: the clinic is closed, the free rooms collide with the transition time of another doctor, no room with the features the doctor needs is free, or every room is taken */
+func allocationError(err error, sch *m.Schedule) error {
+	values := map[string]interface{}{"startAt": sch.StartAt, "endAt": sch.EndAt}
+	switch err {
+	case allocation.ErrClosed:
+		return &RuleError{
+			Reason:  ReasonClinicClosed,
+			Message: "The clinic is closed between these hours",
+			Values:  values,
+		}
+	case allocation.ErrTransition:
+		return &RuleError{
+			Reason:  ReasonTransitionCollision,
+			Message: "The free rooms are within the transition time of another schedule",
+			Values:  values,
+		}
+	case allocation.ErrNoFeatures:
+		values["hasBathroom"] = true
+		return &RuleError{
+			Reason:  ReasonNoRoomFeatures,
+			Message: "No room with a bathroom is free between these hours",
+			Values:  values,
+		}
+	case allocation.ErrNoRoom:
+		return &RuleError{
+			Reason:  ReasonNoRoom,
+			Message: "No schedule available",
+			Values:  values,
+		}
+	}
+	return err
+}
+
+/* Move a Schedule to new times keeping its sche_id, the room is chosen as for a new Schedule */
+func replaceSchedule(db service.DB, instID uuid.UUID, sch *m.Schedule, doctID *uuid.UUID) (*m.Schedule, error) {
+	s := m.Schedule{
+		EndAt:   sch.EndAt,
+		StartAt: sch.StartAt,
+		DoctID:  sch.DoctID,
+		Plan:    sch.Plan,
+		Info:    sch.Info,
+	}
+	// taken before the old booking is freed, as every move takes it first
+	err := lockAllocation(db, instID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = lockEditable(db, instID, sch.ScheID, doctID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = updateDeleteAtSchedule(db, instID, sch.ScheID, doctID)
+	if err != nil {
+		return nil, err
+	}
+	cre, err := bookSchedule(db, instID, &s)
+	if err != nil {
+		return nil, err
+	}
+	sch.StartAt = cre.StartAt
+	sch.EndAt = cre.EndAt
+	sch.RoomID = cre.RoomID
+	sch.InstID = instID
+	_, err = updateSchedule(db, sch, doctID, false)
+	if err != nil {
+		return nil, err
+	}
+	upd, err := restoreSchedule(db, instID, sch.ScheID)
+	if err != nil {
+		return nil, err
+	}
+	scheD := Deleter{DB: db}
+	_, err = scheD.Run(instID, cre.ScheID, &cre.DoctID)
+	if err != nil {
+		return nil, err
+	}
+	return upd, nil
+}
+
 /* Return a list of Schedule by filters */
-func listSchedule(db service.DB, doctID *uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error) {
+func listSchedule(db service.DB, instID uuid.UUID, doctID *uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error) {
 	sch := []m.Schedule{}
-	query := psql.Select("sche_id", "doct_id", "room_id", "start_at", "end_at", "plan", "info", "created_at", "deleted_at").
+	query := psql.Select("sche_id", "inst_id", "doct_id", "room_id", "start_at", "end_at", "plan", "info", "created_at", "deleted_at", "sers_id", "sers_start_at", "status", "status_at", "checked_in_at", "checked_out_at", "overstay_minutes", "transition_exceeded").
 		From("schedule").
-		Where("deleted_at IS NULL")
+		Where(sq.Eq{"inst_id": instID})
+	if f.Status != nil {
+		statuses, err := statusFilter(*f.Status)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("status = ANY(?)", statuses)
+	} else {
+		query = query.Where("deleted_at IS NULL")
+	}
 	if doctID != nil {
 		query = query.Where(`doct_id = ?`, doctID)
 	}
@@ -435,6 +386,9 @@ func listSchedule(db service.DB, doctID *uuid.UUID, f m.FilterSchedule) ([]m.Sch
 	if f.RoomID != nil {
 		query = query.Where(`room_id = ?`, f.RoomID)
 	}
+	if f.SersID != nil {
+		query = query.Where(`sers_id = ?`, f.SersID)
+	}
 	if f.StartAt != nil {
 		query = query.Where(sq.GtOrEq{"start_at": f.StartAt})
 	}
@@ -482,13 +436,13 @@ func listSchedule(db service.DB, doctID *uuid.UUID, f m.FilterSchedule) ([]m.Sch
 }
 
 /* Return a Schedule by sche_id */
-func getSchedule(db service.DB, doctID *uuid.UUID, scheID uuid.UUID) (*m.Schedule, error) {
+func getSchedule(db service.DB, instID uuid.UUID, doctID *uuid.UUID, scheID uuid.UUID) (*m.Schedule, error) {
 	sch := m.Schedule{}
-	query := psql.Select("sche_id", "doct_id", "name", "room_id", "label", "start_at", "end_at", "plan", "schedule.info", "schedule.created_at", "deleted_at").
+	query := psql.Select("sche_id", "schedule.inst_id", "doct_id", "name", "room_id", "label", "start_at", "end_at", "plan", "schedule.info", "schedule.created_at", "deleted_at", "sers_id", "sers_start_at", "schedule.status", "schedule.status_at", "checked_in_at", "checked_out_at", "overstay_minutes", "transition_exceeded").
 		From("schedule").
 		LeftJoin("room USING (room_id)").
 		LeftJoin("doctor USING (doct_id)").
-		Where(sq.Eq{"sche_id": scheID})
+		Where(sq.Eq{"sche_id": scheID, "schedule.inst_id": instID})
 
 	if doctID != nil {
 		query = query.Where(`doct_id = ?`, doctID)
@@ -509,7 +463,7 @@ func getSchedule(db service.DB, doctID *uuid.UUID, scheID uuid.UUID) (*m.Schedul
 }
 
 /* Update Schedule to database by sche_id */
-func updateSchedule(db service.DB, sch *m.Schedule, validation bool) (*m.Schedule, error) {
+func updateSchedule(db service.DB, sch *m.Schedule, doctID *uuid.UUID, validation bool) (*m.Schedule, error) {
 
 	if validation {
 		err := validationsUpdateSchedule(db, sch)
@@ -526,9 +480,11 @@ func updateSchedule(db service.DB, sch *m.Schedule, validation bool) (*m.Schedul
 		Set("end_at", sch.EndAt).
 		Set("plan", sch.Plan).
 		Set("info", sch.Info).
-		Set("deleted_at", sch.DeletedAt).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"sche_id": sch.ScheID})
+		Where(sq.Eq{"sche_id": sch.ScheID, "inst_id": sch.InstID})
+	if doctID != nil {
+		query = query.Where(`doct_id = ?`, doctID)
+	}
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -544,11 +500,11 @@ func updateSchedule(db service.DB, sch *m.Schedule, validation bool) (*m.Schedul
 }
 
 /* Delete Schedule to database by sche_id */
-func deleteSchedule(db service.DB, scheID uuid.UUID, doctID *uuid.UUID) (*m.Schedule, error) {
+func deleteSchedule(db service.DB, instID, scheID uuid.UUID, doctID *uuid.UUID) (*m.Schedule, error) {
 	sch := m.Schedule{}
 	query := psql.Delete("schedule").
 		Suffix("RETURNING *").
-		Where(sq.Eq{"sche_id": scheID})
+		Where(sq.Eq{"sche_id": scheID, "inst_id": instID})
 	if doctID != nil {
 		query = query.Where(`doct_id = ?`, doctID)
 	}
@@ -565,12 +521,15 @@ func deleteSchedule(db service.DB, scheID uuid.UUID, doctID *uuid.UUID) (*m.Sche
 }
 
 /* UpdateDeleteAtSchedule Schedule to database by sche_id */
-func updateDeleteAtSchedule(db service.DB, scheID uuid.UUID) (*m.Schedule, error) {
+func updateDeleteAtSchedule(db service.DB, instID, scheID uuid.UUID, doctID *uuid.UUID) (*m.Schedule, error) {
 	sch := m.Schedule{}
 	query := psql.Update("schedule").
 		Set("deleted_at", time.Now()).
-		Where(sq.Eq{"sche_id": scheID}).
+		Where(sq.Eq{"sche_id": scheID, "inst_id": instID}).
 		Suffix("RETURNING *")
+	if doctID != nil {
+		query = query.Where(`doct_id = ?`, doctID)
+	}
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -583,14 +542,29 @@ func updateDeleteAtSchedule(db service.DB, scheID uuid.UUID) (*m.Schedule, error
 	return &sch, nil
 }
 
-func (e errNotFound) Error() string {
-	return "No schedule available"
+/* Clear the deleted_at set by updateDeleteAtSchedule to free the room of a Schedule being moved */
+func restoreSchedule(db service.DB, instID, scheID uuid.UUID) (*m.Schedule, error) {
+	sch := m.Schedule{}
+	query := psql.Update("schedule").
+		Set("deleted_at", nil).
+		Where(sq.Eq{"sche_id": scheID, "inst_id": instID}).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating restore Schedule sql")
+	}
+	err = db.Get(&sch, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error restore Schedule sql")
+	}
+	return &sch, nil
 }
 
 /* List Calendar listing schedules to put at calendar */
-func listCalendar(db service.DB, doctID *uuid.UUID, fCalendar m.FilterCalendar) ([]m.Calendar, error) {
+func listCalendar(db service.DB, instID uuid.UUID, doctID *uuid.UUID, fCalendar m.FilterCalendar) ([]m.Calendar, error) {
 	sch := []m.Calendar{}
-	args := []interface{}{}
+	args := []interface{}{instID}
 	filterDoctor := ""
 	if doctID != nil {
 		args = append(args, doctID)
@@ -605,6 +579,15 @@ func listCalendar(db service.DB, doctID *uuid.UUID, fCalendar m.FilterCalendar)
 		filterPatients = `AND pat.pati_id = $` + strconv.Itoa(len(args)+1)
 		args = append(args, fCalendar.PatiID)
 	}
+	filterStatus := "AND deleted_at IS NULL"
+	if fCalendar.Status != nil {
+		statuses, err := statusFilter(*fCalendar.Status)
+		if err != nil {
+			return nil, err
+		}
+		filterStatus = `AND sche.status = ANY($` + strconv.Itoa(len(args)+1) + `)`
+		args = append(args, statuses)
+	}
 	filterDate := ""
 	if fCalendar.StartAt != nil && fCalendar.EndAt != nil {
 		filterDate = `AND sche.start_at::DATE >= $` + strconv.Itoa(len(args)+1) + ` AND sche.end_at::DATE <= $` + strconv.Itoa(len(args)+2)
@@ -614,36 +597,37 @@ func listCalendar(db service.DB, doctID *uuid.UUID, fCalendar m.FilterCalendar)
 	query :=
 		`WITH inter_calendar AS (
 			SELECT sche.sche_id, sche.room_id, sche.doct_id, doc.name AS doc_name, doc.info->>'treatment' AS doc_treatment ,sche.start_at::DATE AS data_appointment,
-				sche.start_at AS start_hour, sche.end_at AS end_hour,
+				sche.start_at AS start_hour, sche.end_at AS end_hour, sche.status,
 				jsonb_build_object('patientName', pat.name, 'hourAppointment', to_char(app.start_at::TIMESTAMP, 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), 'status', app.status, 'appoID', app.appo_id, 'patiID', pat.pati_id, 'type', app."type", 'startAt', app.start_at) AS arr_patient
 			FROM schedule sche
 			LEFT JOIN doctor doc USING (doct_id)
 			LEFT JOIN appointment app USING(sche_id)
 			LEFT JOIN patient pat USING(pati_id)
-			WHERE deleted_at IS NULL
+			WHERE sche.inst_id = $1
+			` + filterStatus + `
 			` + filterPatients + `
 			` + filterDoctor + `
 			` + filterDate + `
 			ORDER BY sche.start_at::DATE, sche.start_at::TIME, app.start_at::TIME
 		),
 		calendar AS (
-			SELECT sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment, start_hour, end_hour,jsonb_agg(arr_patient) AS patient
+			SELECT sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment, start_hour, end_hour, status, jsonb_agg(arr_patient) AS patient
 			FROM inter_calendar
-			GROUP BY sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment , start_hour, end_hour
+			GROUP BY sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment , start_hour, end_hour, status
 			ORDER BY start_hour
 		),
 		scheduled AS (
 			SELECT sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment,
 				(to_char(start_hour::TIMESTAMP, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')) AS start_hour,
 				(to_char(end_hour::TIMESTAMP, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')) AS end_hour,
-				patient
+				status, patient
 			FROM calendar c
 			ORDER BY data_appointment, start_hour::TIME
 		),
 		config_transition AS (
 			SELECT value
 			FROM config
-			WHERE KEY = 'schedule-transition_time'
+			WHERE KEY = 'schedule-transition_time' AND inst_id = $1
 		),
 		range_calendar AS (
 			SELECT sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment,
@@ -653,7 +637,7 @@ func listCalendar(db service.DB, doctID *uuid.UUID, fCalendar m.FilterCalendar)
 				LEAD (doct_id) OVER (PARTITION BY room_id, doct_id, data_appointment) AS adoct_id,
 				LEAD (room_id) OVER (PARTITION BY room_id, doct_id, data_appointment) AS aroom_id,
 				LEAD (start_hour) OVER (PARTITION BY room_id, doct_id, data_appointment) AS next_start_hour,
-				patient,
+				status, patient,
 				value->>'transition_time' AS transition_time,
 				rank() OVER w
 			FROM scheduled, config_transition
@@ -666,31 +650,32 @@ func listCalendar(db service.DB, doctID *uuid.UUID, fCalendar m.FilterCalendar)
 				THEN 0
 				ELSE transition_time::INT
 			END	AS break_time,
-			patient
+			status, patient
 			FROM range_calendar
 		),
 		interval_calendar AS (
 			SELECT sche_id, room_id, doct_id, doc_name, data_appointment,
 			to_char(end_hour::TIMESTAMP, 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS start_hour,
 			to_char((end_hour::TIMESTAMP + (break_time ||' minutes')::INTERVAL)::TIMESTAMP, 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS end_hour,
+			status,
 			jsonb_build_object('patientName', '', 'hourAppointment', '', 'status', '') AS patient,
 			break_time
 			FROM break_time, config_transition
 		),
 		interval_calendar_agg AS (
-			SELECT sche_id, room_id, doct_id, doc_name, data_appointment, start_hour, end_hour,	jsonb_agg(patient) AS patient
+			SELECT sche_id, room_id, doct_id, doc_name, data_appointment, start_hour, end_hour, status, jsonb_agg(patient) AS patient
 			FROM interval_calendar
-			GROUP BY sche_id, room_id, doct_id, doc_name, data_appointment , start_hour, end_hour
+			GROUP BY sche_id, room_id, doct_id, doc_name, data_appointment , start_hour, end_hour, status
 			ORDER BY data_appointment
 		),
 		union_calendar AS (
-			SELECT sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment, start_hour, end_hour, patient
+			SELECT sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment, start_hour, end_hour, status, patient
 			FROM range_calendar
 			UNION
-			SELECT sche_id, room_id, doct_id, '', '', data_appointment, start_hour, end_hour, patient
+			SELECT sche_id, room_id, doct_id, '', '', data_appointment, start_hour, end_hour, status, patient
 			FROM interval_calendar_agg
 		)
-		SELECT sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment, start_hour, end_hour, patient
+		SELECT sche_id, room_id, doct_id, doc_name, doc_treatment, data_appointment, start_hour, end_hour, status, patient
 		FROM union_calendar
 		WHERE ( EXTRACT(EPOCH FROM (end_hour::TIMESTAMP)::TIME) - EXTRACT(EPOCH FROM (start_hour::TIMESTAMP)::TIME) ) > 0
 		OR start_hour::DATE != end_hour::DATE
@@ -706,24 +691,24 @@ func listCalendar(db service.DB, doctID *uuid.UUID, fCalendar m.FilterCalendar)
 	return sch, nil
 }
 
-//ScheduleUnavailable verifying type of error
-func ScheduleUnavailable(err error) bool {
-	_, ok := err.(errNotFound)
-	return ok
+//RuleBroken returns the rule the error is about, nil for other errors
+func RuleBroken(err error) *RuleError {
+	e, _ := errors.Cause(err).(*RuleError)
+	return e
 }
 
 func validationsInsertSchedule(db service.DB, sch *m.Schedule) error {
-	err := timeMinimum(db, sch.StartAt, sch.EndAt)
+	err := timeMinimum(db, sch.InstID, sch.StartAt, sch.EndAt)
 	if err != nil {
 		return err
 	}
 	if sch.Plan == "Turn" {
-		err := verifyIfTurnIsTrue(db, sch.StartAt, sch.EndAt)
+		err := verifyIfTurnIsTrue(db, sch.InstID, sch.StartAt, sch.EndAt)
 		if err != nil {
 			return err
 		}
 	}
-	err = intervalTime(db, sch.StartAt, sch.EndAt)
+	err = intervalTime(db, sch.InstID, sch.StartAt, sch.EndAt)
 	if err != nil {
 		return err
 	}
@@ -731,7 +716,7 @@ func validationsInsertSchedule(db service.DB, sch *m.Schedule) error {
 	if err != nil {
 		return err
 	}
-	err = doctorAvaliability(db, sch.StartAt, sch.EndAt, sch.DoctID)
+	err = doctorAvaliability(db, sch.InstID, sch.StartAt, sch.EndAt, sch.DoctID)
 	if err != nil {
 		return err
 	}
@@ -739,7 +724,7 @@ func validationsInsertSchedule(db service.DB, sch *m.Schedule) error {
 }
 
 func validationsUpdateSchedule(db service.DB, sch *m.Schedule) error {
-	err := intervalTime(db, sch.StartAt, sch.EndAt)
+	err := intervalTime(db, sch.InstID, sch.StartAt, sch.EndAt)
 	if err != nil {
 		return err
 	}
@@ -757,11 +742,11 @@ func validationsUpdateSchedule(db service.DB, sch *m.Schedule) error {
 	return nil
 }
 
-func timeMinimum(db service.DB, startAt, endAt time.Time) error {
+func timeMinimum(db service.DB, instID uuid.UUID, startAt, endAt time.Time) error {
 	con := m.Config{}
 	query := psql.Select("key", "value").
 		From("config").
-		Where(sq.Eq{"key": "schedule-minimum_time"})
+		Where(sq.Eq{"key": "schedule-minimum_time", "inst_id": instID})
 	qSQL, args, err := query.ToSql()
 	if err != nil {
 		return errors.Wrap(err, "Error generating get Config sql")
@@ -782,21 +767,27 @@ func timeMinimum(db service.DB, startAt, endAt time.Time) error {
 	diff := endAt.Sub(startAt)
 	minTime := int64(mapMinTime["minimum_time"]) - int64(diff.Minutes())
 	if minTime > 0 {
-		return errors.New("Time minimum between hours not respected")
+		return &RuleError{
+			Reason:  ReasonMinimumTime,
+			Message: "Time minimum between hours not respected",
+			Values:  map[string]interface{}{"minimumMinutes": mapMinTime["minimum_time"], "minutes": int64(diff.Minutes())},
+		}
 	}
 	return nil
 }
 
 /* Should have a look to fix it */
-func intervalTime(db service.DB, startAt, endAt time.Time) error {
+func intervalTime(db service.DB, instID uuid.UUID, startAt, endAt time.Time) error {
 	res := struct {
-		Result bool `db:"valid_invalid" json:"validInterval"`
+		Result   bool   `db:"valid_invalid" json:"validInterval"`
+		OpensAt  string `db:"opens_at"`
+		ClosesAt string `db:"closes_at"`
 	}{}
-	args := []interface{}{startAt, endAt}
+	args := []interface{}{startAt, endAt, instID}
 	query := `WITH config_timezone AS (
 				SELECT value->>'timezone' AS timezone
 				FROM config
-				WHERE KEY = 'timezone-local'
+				WHERE KEY = 'timezone-local' AND inst_id = $3
 			),
 			dates_to_local AS (
 				SELECT ((($1)::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE timezone) AS start_at, ((($2)::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE timezone) AS end_at
@@ -814,7 +805,7 @@ func intervalTime(db service.DB, startAt, endAt time.Time) error {
 					ELSE (start_at::DATE || ' ' || ((((value->>'monday'))::jsonb->0)->>'end') || ':00')::TIMESTAMP
 				END AS end_lab
 				FROM config c, dates_to_local
-				WHERE KEY = 'schedule-hour_config_flex'
+				WHERE KEY = 'schedule-hour_config_flex' AND c.inst_id = $3
 			),
 			local_timezone AS (
 				SELECT start_at, end_at,
@@ -826,7 +817,9 @@ func intervalTime(db service.DB, startAt, endAt time.Time) error {
 				CASE
 					WHEN start_at < start_lab OR end_at > end_lab THEN FALSE
 					ELSE TRUE
-				END AS valid_invalid
+				END AS valid_invalid,
+				COALESCE(TO_CHAR(start_lab, 'HH24:MI'), '') AS opens_at,
+				COALESCE(TO_CHAR(end_lab, 'HH24:MI'), '') AS closes_at
 			FROM local_timezone`
 	err := db.Get(&res, query, args...)
 	if err != nil {
@@ -836,20 +829,24 @@ func intervalTime(db service.DB, startAt, endAt time.Time) error {
 		return errors.New("Error Interval Time sql not found")
 	}
 	if !res.Result {
-		return errors.New("Interval Time of Schedule is not respecting hour of start/end")
+		return &RuleError{
+			Reason:  ReasonOutsideHours,
+			Message: "Interval Time of Schedule is not respecting hour of start/end",
+			Values:  map[string]interface{}{"startAt": startAt, "endAt": endAt, "opensAt": res.OpensAt, "closesAt": res.ClosesAt},
+		}
 	}
 	return nil
 }
 
-func verifyIfTurnIsTrue(db service.DB, startAt, endAt time.Time) error {
+func verifyIfTurnIsTrue(db service.DB, instID uuid.UUID, startAt, endAt time.Time) error {
 	res := struct {
 		Result int64 `db:"count" json:"count"`
 	}{}
-	args := []interface{}{startAt, endAt}
+	args := []interface{}{startAt, endAt, instID}
 	query := `WITH config_timezone AS (
 				SELECT value->>'timezone' AS timezone
 				FROM config
-				WHERE KEY = 'timezone-local'
+				WHERE KEY = 'timezone-local' AND inst_id = $3
 			),
 			dates_to_local AS (
 				SELECT (($1::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE cti.timezone) AS start_time,
@@ -859,7 +856,7 @@ func verifyIfTurnIsTrue(db service.DB, startAt, endAt time.Time) error {
 			config_days AS (
 				SELECT value
 				FROM config
-				WHERE KEY = 'schedule-hour_config'
+				WHERE KEY = 'schedule-hour_config' AND inst_id = $3
 			),
 			config_result AS (
 				SELECT row_number() OVER(ORDER BY a."key") AS id,
@@ -891,7 +888,11 @@ func verifyIfTurnIsTrue(db service.DB, startAt, endAt time.Time) error {
 		return errors.New("Error Config sql not found")
 	}
 	if res.Result == 0 {
-		return errors.New("Interval Schedule is not a Turn")
+		return &RuleError{
+			Reason:  ReasonTurnMismatch,
+			Message: "Interval Schedule is not a Turn",
+			Values:  map[string]interface{}{"startAt": startAt, "endAt": endAt},
+		}
 	}
 	return nil
 }
@@ -927,27 +928,35 @@ func dateLessThanToday(db service.DB, startAt time.Time) error {
 		diff := hourRequested.Sub(currentHour)
 		mins := int(diff.Minutes())
 		if mins < 0 {
-			return errors.New("Hour requested less than current hour")
+			return &RuleError{
+				Reason:  ReasonDateInPast,
+				Message: "Hour requested less than current hour",
+				Values:  map[string]interface{}{"startAt": startAt, "now": currentTime},
+			}
 		}
 	}
 
 	days := int(diff.Hours() / 24)
 	if days < 0 {
-		return errors.New("Date requested less than current date")
+		return &RuleError{
+			Reason:  ReasonDateInPast,
+			Message: "Date requested less than current date",
+			Values:  map[string]interface{}{"startAt": startAt, "now": currentTime},
+		}
 	}
 	return nil
 }
 
-func doctorAvaliability(db service.DB, startAt, endAt time.Time, doctID uuid.UUID) error {
+func doctorAvaliability(db service.DB, instID uuid.UUID, startAt, endAt time.Time, doctID uuid.UUID) error {
 	sch := []m.Schedule{}
 	initialDate := startAt.Format("2006-01-02 15:04:05")
 	finalDate := endAt.Format("2006-01-02 15:04:05")
-	args := []interface{}{doctID, startAt, initialDate, finalDate}
+	args := []interface{}{doctID, startAt, initialDate, finalDate, instID}
 	query := `
 		WITH config_timezone AS (
 			SELECT value->>'timezone' AS timezone
 			FROM config
-			WHERE KEY = 'timezone-local'
+			WHERE KEY = 'timezone-local' AND inst_id = $5
 		),
 		dates_to_local AS (
 			SELECT (($3::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE cti.timezone) AS start_time,
@@ -996,12 +1005,16 @@ func doctorAvaliability(db service.DB, startAt, endAt time.Time, doctID uuid.UUI
 		return err
 	}
 	if len(sch) > 0 {
-		return errors.New("Doctor is not avaliable between these hours")
+		return &RuleError{
+			Reason:  ReasonDoctorOverlap,
+			Message: "Doctor is not avaliable between these hours",
+			Values:  map[string]interface{}{"startAt": startAt, "endAt": endAt, "scheIDs": scheIDs(sch)},
+		}
 	}
 	return nil
 }
 
-func outdoor(db service.DB, roomID uuid.UUID) (*m.Outdoor, error) {
+func outdoor(db service.DB, instID, roomID uuid.UUID) (*m.Outdoor, error) {
 	out := m.Outdoor{}
 	query := psql.Select("doct_id", "doct_id", "name", "room_id", "label", "specialties", "avatar", "treatment").
 		From("outdoor").
@@ -1018,7 +1031,7 @@ func outdoor(db service.DB, roomID uuid.UUID) (*m.Outdoor, error) {
 				FROM schedule sch
 				LEFT JOIN doctor doc USING (doct_id)
 				LEFT JOIN room roo USING (room_id)
-				WHERE roo.room_id = $1
+				WHERE roo.room_id = $1 AND sch.inst_id = $2
 				AND NOW() BETWEEN start_at AND end_at
 				LIMIT 1
 			)
@@ -1028,7 +1041,7 @@ func outdoor(db service.DB, roomID uuid.UUID) (*m.Outdoor, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Error generating get Outdoor sql")
 	}
-	args = []interface{}{roomID}
+	args = []interface{}{roomID, instID}
 	err = db.Get(&out, qSQL, args...)
 	if err != nil {
 		if err != sql.ErrNoRows {
@@ -1043,12 +1056,12 @@ func roomAvailableToExtend(db service.DB, sch *m.Schedule) error {
 	sched := []m.Schedule{}
 	initialDate := sch.StartAt.Format("2006-01-02 15:04:05")
 	finalDate := sch.EndAt.Format("2006-01-02 15:04:05")
-	args := []interface{}{sch.ScheID, sch.RoomID, initialDate, finalDate}
+	args := []interface{}{sch.ScheID, sch.RoomID, initialDate, finalDate, sch.InstID}
 	query := `
 		WITH config_timezone AS (
 			SELECT value->>'timezone' AS timezone
 			FROM config
-			WHERE KEY = 'timezone-local'
+			WHERE KEY = 'timezone-local' AND inst_id = $5
 		),
 		dates_to_local AS (
 			SELECT (($3::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE cti.timezone) AS start_time,
@@ -1079,7 +1092,11 @@ func roomAvailableToExtend(db service.DB, sch *m.Schedule) error {
 	}
 
 	if len(sched) > 0 {
-		return errors.New("Room is not available to extend your schedule")
+		return &RuleError{
+			Reason:  ReasonRoomTaken,
+			Message: "Room is not available to extend your schedule",
+			Values:  map[string]interface{}{"roomID": sch.RoomID, "endAt": sch.EndAt, "scheIDs": scheIDs(sched)},
+		}
 	}
 	return nil
 }
@@ -1087,12 +1104,12 @@ func roomAvailableToExtend(db service.DB, sch *m.Schedule) error {
 /* Should have a look to fix it */
 func usingTransitionTimeToExtend(db service.DB, sch *m.Schedule) error {
 	usb := m.UsableTransition{}
-	args := []interface{}{sch.ScheID, sch.EndAt}
+	args := []interface{}{sch.ScheID, sch.EndAt, sch.InstID}
 	query := `
 		WITH config_timezone AS (
 			SELECT value->>'timezone' AS timezone
 			FROM config
-			WHERE "key" = 'timezone-local'
+			WHERE "key" = 'timezone-local' AND inst_id = $3
 		),
 		dates_to_local AS (
 			SELECT (($2::TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE cti.timezone) AS end_time
@@ -1101,17 +1118,17 @@ func usingTransitionTimeToExtend(db service.DB, sch *m.Schedule) error {
 		config_days AS (
 			SELECT value
 			FROM config
-			WHERE "key" = 'schedule-hour_config_flex'
+			WHERE "key" = 'schedule-hour_config_flex' AND inst_id = $3
 		),
 		config_usable AS (
 			SELECT value
 			FROM config
-			WHERE "key" = 'usable-transition_time'
+			WHERE "key" = 'usable-transition_time' AND inst_id = $3
 		),
 		config_transition AS (
 			SELECT value
 			FROM config
-			WHERE "key" = 'schedule-transition_time'
+			WHERE "key" = 'schedule-transition_time' AND inst_id = $3
 		),
 		config_result AS (
 			SELECT row_number() OVER(ORDER BY a."key") AS id,
@@ -1169,64 +1186,21 @@ func usingTransitionTimeToExtend(db service.DB, sch *m.Schedule) error {
 		return err
 	}
 	if !usb.IsAbleToExtend {
-		return errors.New("Schedule is not able to extend")
-	}
-	return nil
-}
-
-func needBathroom(db service.DB, doctID uuid.UUID) (bool, string, error) {
-	checkBath := struct {
-		NeedBathroom      bool   `db:"need_bathroom"`
-		BathroomTreatment string `db:"bathroom_treatment"`
-	}{}
-	args := []interface{}{doctID}
-	query := `
-		WITH config_transition AS (
-			SELECT value->>'bathroom_treatment' AS bathroom_treatment
-			FROM config
-			WHERE KEY = 'schedule-bathroom_treatment'
-		),
-		check_bathroom AS (
-			SELECT doc.doct_id,
-			CASE
-				WHEN array_agg((spe.info->>'needBathroom')::BOOL) <> '{}' THEN array_agg((spe.info->>'needBathroom')::BOOL)
-				ELSE array_agg(FALSE)
-			END
-			AS spec_need_bathroom
-			FROM doctor doc
-			LEFT JOIN doctor_specialty ds USING (doct_id)
-			LEFT JOIN specialty spe USING (spec_id)
-			WHERE doc.doct_id = $1
-			GROUP BY doct_id
-		)
-		SELECT bathroom_treatment,
-			CASE
-				WHEN TRUE = ANY (spec_need_bathroom) THEN TRUE
-				ELSE FALSE
-			END AS need_bathroom
-		FROM check_bathroom, config_transition
-	`
-	err := db.Get(&checkBath, query, args...)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			return checkBath.NeedBathroom, checkBath.BathroomTreatment, err
+		return &RuleError{
+			Reason:  ReasonTransitionCollision,
+			Message: "Schedule is not able to extend",
+			Values:  map[string]interface{}{"endAt": sch.EndAt, "transitionMinutes": usb.TransitionTime},
 		}
-		return checkBath.NeedBathroom, checkBath.BathroomTreatment, err
 	}
-	return checkBath.NeedBathroom, checkBath.BathroomTreatment, nil
+	return nil
 }
 
-func filterRooms(needBathroom bool, bathroomTreatment string) string {
-	whereBathroom := ""
-	if needBathroom == true && bathroomTreatment == "preferencial" {
-		whereBathroom = `ORDER BY (roo.info->>'hasBathroom')::BOOL DESC`
-	}
-	if needBathroom == true && bathroomTreatment == "obligation" {
-		whereBathroom = `AND (roo.info->>'hasBathroom')::BOOL = true`
-	} else {
-		whereBathroom = `ORDER BY (roo.info->>'hasBathroom')::BOOL`
+func scheIDs(sch []m.Schedule) []uuid.UUID {
+	ids := []uuid.UUID{}
+	for _, s := range sch {
+		ids = append(ids, s.ScheID)
 	}
-	return whereBathroom
+	return ids
 }
 
 func buildOrderBy(prefix string, orderBy, order *string) (string, error) {
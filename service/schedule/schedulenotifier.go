@@ -5,8 +5,10 @@ import (
 	"log"
 	"strings"
 
+	"github.com/gofrs/uuid"
 	"github.com/jasonlvhit/gocron"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 	"gitlab.com/falqon/inovantapp/backend/service"
 
 	sq "github.com/elgris/sqrl"
@@ -55,47 +57,75 @@ func (s *ScheduleNotifier) Run() error {
 
 //Send service to run send notification
 func (s *ScheduleNotifier) Send(token *string, schNot m.ScheduleNotifier) {
+	messageNotification := "Faltam apenas 15 minutos para o encerramento do seu horário"
+	err := sendPush(token, messageNotification, map[string]string{
+		"userID":   schNot.UserID.String(),
+		"scheID":   schNot.ScheID.String(),
+		"doctID":   schNot.DoctID.String(),
+		"contents": messageNotification,
+		"type":     "notification.newNotify",
+	})
+	if err != nil {
+		s.Logger.Println(err)
+	}
+}
+
+/* Publish a push notification to the Expo token of an user */
+func sendPush(token *string, body string, data map[string]string) error {
 	if token == nil {
-		s.Logger.Println("Invalid Token")
-		return
+		return errors.New("Invalid Token")
 	}
 	replaceToken := strings.Replace(*token, "{", "", -1)
 	replaceToken = strings.Replace(replaceToken, "}", "", -1)
-	messageNotification := "Faltam apenas 15 minutos para o encerramento do seu horário"
 	//To check the token is valid
 	pushToken, err := expo.NewExponentPushToken(replaceToken)
 	if err != nil {
-		s.Logger.Println("Invalid Expo push token", err)
-		return
+		return errors.Wrap(err, "Invalid Expo push token")
 	}
 	// Create a new Expo SDK client
 	client := expo.NewPushClient(nil)
 	// Publish message
 	response, err := client.Publish(
 		&expo.PushMessage{
-			To:   []expo.ExponentPushToken{pushToken},
-			Body: messageNotification,
-			Data: map[string]string{
-				"userID":   schNot.UserID.String(),
-				"scheID":   schNot.ScheID.String(),
-				"doctID":   schNot.DoctID.String(),
-				"contents": messageNotification,
-				"type":     "notification.newNotify",
-			},
+			To:       []expo.ExponentPushToken{pushToken},
+			Body:     body,
+			Data:     data,
 			Sound:    "default",
 			Priority: expo.DefaultPriority,
 		},
 	)
 	if err != nil {
-		s.Logger.Println("Failed to publish message", err)
-		return
+		return errors.Wrap(err, "Failed to publish message")
 	}
 
 	// Validate responses
 	err = response.ValidateResponse()
 	if err != nil {
-		s.Logger.Println("Invalid response", err)
+		return errors.Wrap(err, "Invalid response")
+	}
+	return nil
+}
+
+/* Publish a push notification to the user of a doctor, sql.ErrNoRows when the doctor has no user */
+func pushToDoctor(db service.DB, doctID uuid.UUID, body string, data map[string]string) error {
+	token := (*string)(nil)
+	query := psql.Select("u.push_tokens").
+		From("doctor d").
+		Join(`"user" u USING (user_id)`).
+		Where(sq.Eq{"d.doct_id": doctID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating get doctor push token sql")
+	}
+	err = db.Get(&token, qSQL, args...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return errors.Wrap(err, "Error get doctor push token sql")
 	}
+	return sendPush(token, body, data)
 }
 
 func lastFifteenMinutes(db service.DB) ([]m.ScheduleNotifier, error) {
@@ -0,0 +1,620 @@
+package schedule
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/rrule"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// maxSeriesOccurrences a series can expand to, about a year of daily bookings
+const maxSeriesOccurrences = 366
+
+// Scopes of a series edit
+const (
+	// ScopeThis edits only the occurrence
+	ScopeThis = "this"
+	// ScopeFollowing splits the series, the occurrence and the next ones
+	// become a new series
+	ScopeFollowing = "following"
+	// ScopeAll edits every occurrence not started yet
+	ScopeAll = "all"
+)
+
+type errInvalidSeries struct {
+	msg string
+}
+
+func (e errInvalidSeries) Error() string {
+	return e.msg
+}
+
+//InvalidSeries verifying type of error
+func InvalidSeries(err error) bool {
+	_, ok := errors.Cause(err).(errInvalidSeries)
+	return ok
+}
+
+//SeriesChange is an edit of a series made from one of its occurrences
+type SeriesChange struct {
+	SersID uuid.UUID
+	ScheID uuid.UUID
+	Scope  string
+	// StartAt and EndAt are the new times of the occurrence, the others
+	// move by the same amount
+	StartAt time.Time
+	EndAt   time.Time
+	// RRule replaces the rule, not allowed for ScopeThis
+	RRule *string
+	// Plan and Info replace the ones of the occurrences when set
+	Plan *string
+	Info types.JSONText
+	// Status asked for the occurrences booked, requested when a doctor edits
+	Status string
+	// ActorID and Waive of the cancellation of the occurrences the change drops
+	ActorID *uuid.UUID
+	Waive   bool
+}
+
+//SeriesCreator service to create a recurring Schedule
+type SeriesCreator struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+}
+
+//Run create the series and book each occurrence as a new Schedule, the
+//ones that can't be booked are reported
+func (c *SeriesCreator) Run(instID uuid.UUID, ser *m.ScheduleSeries) (*m.ScheduleSeriesReport, error) {
+	rule, err := parseSeriesRule(ser.RRule, ser.StartAt, ser.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	sersID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating Schedule Series uuid")
+	}
+	ser.SersID = sersID
+	ser.InstID = instID
+	ser.RRule = rule.String()
+
+	tx, err := c.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	starts, err := seriesStarts(tx, instID, rule, ser.StartAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = createSeries(tx, ser)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	rep := &m.ScheduleSeriesReport{ScheduleSeries: *ser, Placed: []m.Schedule{}, Unplaced: []m.UnplacedOccurrence{}}
+	err = placeOccurrences(tx, rep, nil, starts, ser.EndAt.Sub(ser.StartAt), nil, nil, m.CancelRequest{})
+	if err != nil {
+		if c.Logger != nil {
+			c.Logger.Println("Error Creating Schedule Series:", err)
+		}
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit Schedule Series")
+	}
+	return rep, nil
+}
+
+//SeriesUpdater service to edit an occurrence of a series, the next ones or all of them
+type SeriesUpdater struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+}
+
+//Run apply the change, an occurrence that can't be moved is kept as it was and reported
+func (u *SeriesUpdater) Run(instID uuid.UUID, doctID *uuid.UUID, ch SeriesChange) (*m.ScheduleSeriesReport, error) {
+	if !ch.EndAt.After(ch.StartAt) {
+		return nil, errInvalidSeries{"The end of the occurrence must be after its start"}
+	}
+	tx, err := u.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	rep, err := updateSeries(tx, instID, doctID, ch)
+	if err != nil {
+		if u.Logger != nil && !InvalidSeries(err) {
+			u.Logger.Println("Error Updating Schedule Series:", err)
+		}
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit Schedule Series")
+	}
+	return rep, nil
+}
+
+//SeriesCanceller service to cancel a series
+type SeriesCanceller struct {
+	DB *sqlx.DB
+}
+
+//Run cancel the series and the occurrences not started yet, each one following
+//the cancellation policy of its plan as Canceller
+func (c *SeriesCanceller) Run(instID uuid.UUID, doctID, actorID *uuid.UUID, sersID uuid.UUID, req m.CancelRequest) (*m.ScheduleSeriesReport, error) {
+	tx, err := c.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	ser, err := getSeries(tx, instID, doctID, sersID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if ser.CancelledAt.Valid {
+		tx.Rollback()
+		return nil, errInvalidSeries{"The series is already cancelled"}
+	}
+	now := time.Now()
+	cancelled, err := deleteOccurrencesFrom(tx, instID, sersID, doctID, actorID, req, now)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	ser.CancelledAt.SetValid(now)
+	err = updateSeriesRow(tx, ser)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit Schedule Series")
+	}
+	return &m.ScheduleSeriesReport{ScheduleSeries: *ser, Placed: cancelled, Unplaced: []m.UnplacedOccurrence{}}, nil
+}
+
+//SeriesGetter service to return a series
+type SeriesGetter struct {
+	DB *sqlx.DB
+}
+
+//Run return a series by sers_id
+func (g *SeriesGetter) Run(instID uuid.UUID, doctID *uuid.UUID, sersID uuid.UUID) (*m.ScheduleSeries, error) {
+	return getSeries(g.DB, instID, doctID, sersID)
+}
+
+func parseSeriesRule(s string, startAt, endAt time.Time) (*rrule.Rule, error) {
+	if !endAt.After(startAt) {
+		return nil, errInvalidSeries{"The end of the occurrence must be after its start"}
+	}
+	if endAt.Sub(startAt) > 24*time.Hour {
+		return nil, errInvalidSeries{"An occurrence can't last more than a day"}
+	}
+	rule, err := rrule.Parse(s)
+	if err != nil {
+		return nil, errInvalidSeries{err.Error()}
+	}
+	return rule, nil
+}
+
+/* Expand the rule in the timezone of the institution, so the occurrences keep the local time of day */
+func seriesStarts(db service.DB, instID uuid.UUID, rule *rrule.Rule, startAt time.Time) ([]time.Time, error) {
+	loc, err := allocation.Location(db, instID)
+	if err != nil {
+		return nil, err
+	}
+	starts, err := rule.All(startAt.In(loc), maxSeriesOccurrences)
+	if err != nil {
+		if err == rrule.ErrTooMany {
+			return nil, errInvalidSeries{err.Error()}
+		}
+		return nil, err
+	}
+	if len(starts) == 0 {
+		return nil, errInvalidSeries{"The rule has no occurrence"}
+	}
+	return starts, nil
+}
+
+func updateSeries(tx *sqlx.Tx, instID uuid.UUID, doctID *uuid.UUID, ch SeriesChange) (*m.ScheduleSeriesReport, error) {
+	occ, err := getSchedule(tx, instID, doctID, ch.ScheID)
+	if err != nil {
+		return nil, err
+	}
+	if occ == nil || occ.DeletedAt.Valid || occ.SersID == nil || *occ.SersID != ch.SersID {
+		return nil, errInvalidSeries{"No occurrence " + ch.ScheID.String() + " in the series"}
+	}
+	ser, err := getSeries(tx, instID, doctID, ch.SersID)
+	if err != nil {
+		return nil, err
+	}
+	if ser.CancelledAt.Valid {
+		return nil, errInvalidSeries{"The series is cancelled"}
+	}
+	plan, info := ser.Plan, ser.Info
+	if ch.Plan != nil {
+		plan = *ch.Plan
+	}
+	if ch.Info != nil {
+		info = ch.Info
+	}
+
+	if ch.Scope == ScopeThis {
+		if ch.RRule != nil {
+			return nil, errInvalidSeries{"The rule can't be changed for a single occurrence"}
+		}
+		occ.StartAt = ch.StartAt.UTC()
+		occ.EndAt = ch.EndAt.UTC()
+		if ch.Plan != nil {
+			occ.Plan = *ch.Plan
+		}
+		if ch.Info != nil {
+			occ.Info = ch.Info
+		}
+		upd, err := replaceSchedule(tx, instID, occ, doctID)
+		if err != nil {
+			return nil, err
+		}
+		return &m.ScheduleSeriesReport{ScheduleSeries: *ser, Placed: []m.Schedule{*upd}, Unplaced: []m.UnplacedOccurrence{}}, nil
+	}
+	if ch.Scope != ScopeFollowing && ch.Scope != ScopeAll {
+		return nil, errInvalidSeries{"Invalid scope " + ch.Scope + ", it must be this, following or all"}
+	}
+
+	// the rule start moves as much as the occurrence, from the time the rule gave it
+	occStart := occ.StartAt
+	if occ.SersStartAt.Valid {
+		occStart = occ.SersStartAt.Time
+	}
+	shift := ch.StartAt.Sub(occStart)
+	length := ch.EndAt.Sub(ch.StartAt)
+	oldRule, err := rrule.Parse(ser.RRule)
+	if err != nil {
+		return nil, err
+	}
+	ruleText := ser.RRule
+	if ch.RRule != nil {
+		ruleText = *ch.RRule
+	}
+
+	from := time.Now()
+	target := ser
+	if ch.Scope == ScopeFollowing {
+		from = occStart
+		target, err = splitSeries(tx, ser, oldRule, occStart, ch.RRule == nil)
+		if err != nil {
+			return nil, err
+		}
+		if ch.RRule == nil {
+			ruleText = target.RRule
+		}
+		target.StartAt = ch.StartAt.UTC()
+	} else {
+		target.StartAt = target.StartAt.Add(shift).UTC()
+	}
+	target.EndAt = target.StartAt.Add(length)
+	target.Plan = plan
+	target.Info = info
+	target.Status = ch.Status
+
+	rule, err := parseSeriesRule(ruleText, target.StartAt, target.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	target.RRule = rule.String()
+	starts, err := seriesStarts(tx, instID, rule, target.StartAt)
+	if err != nil {
+		return nil, err
+	}
+	// past occurrences stay as they were, a split series is all ahead
+	next := starts
+	if ch.Scope == ScopeAll {
+		next = []time.Time{}
+		for _, s := range starts {
+			if !s.Before(from) {
+				next = append(next, s)
+			}
+		}
+	}
+	existing, err := listOccurrencesFrom(tx, instID, ser.SersID, from, ch.Scope == ScopeFollowing)
+	if err != nil {
+		return nil, err
+	}
+	if ch.Scope == ScopeFollowing {
+		err = createSeries(tx, target)
+	} else {
+		err = updateSeriesRow(tx, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rep := &m.ScheduleSeriesReport{ScheduleSeries: *target, Placed: []m.Schedule{}, Unplaced: []m.UnplacedOccurrence{}}
+	err = placeOccurrences(tx, rep, existing, next, length, doctID, ch.ActorID, m.CancelRequest{Waive: ch.Waive})
+	if err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// splitSeries ends ser before the occurrence at and returns the series
+// continuing it, not stored yet. When the rule is kept a COUNT is reduced to
+// the occurrences left
+func splitSeries(db service.DB, ser *m.ScheduleSeries, rule *rrule.Rule, at time.Time, keepRule bool) (*m.ScheduleSeries, error) {
+	sersID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating Schedule Series uuid")
+	}
+	next := *ser
+	next.SersID = sersID
+	next.CreatedAt = time.Now()
+
+	rest := *rule
+	if keepRule && rule.Count > 0 {
+		starts, err := seriesStarts(db, ser.InstID, rule, ser.StartAt)
+		if err != nil {
+			return nil, err
+		}
+		before := 0
+		for _, s := range starts {
+			if s.Before(at) {
+				before++
+			}
+		}
+		rest.Count = rule.Count - before
+		if rest.Count < 1 {
+			return nil, errInvalidSeries{"No occurrence left to split the series"}
+		}
+	}
+	next.RRule = rest.String()
+
+	rule.Count = 0
+	rule.Until = at.Add(-time.Second).UTC()
+	rule.UntilDate = false
+	ser.RRule = rule.String()
+	err = updateSeriesRow(db, ser)
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// placeOccurrences books an occurrence of rep at each start, moving the
+// existing occurrence of the same local day when there's one. The existing
+// ones without a start that day are cancelled first to free their rooms, by
+// the doctor of doctID following the cancellation policy, the started ones stay.
+// Each booking runs in a savepoint, the ones breaking a rule are reported as unplaced
+func placeOccurrences(tx service.DB, rep *m.ScheduleSeriesReport, existing []m.Schedule, starts []time.Time, length time.Duration, doctID, actorID *uuid.UUID, cancel m.CancelRequest) error {
+	days := map[string]bool{}
+	for _, start := range starts {
+		days[localDay(start, starts)] = true
+	}
+	byDay := map[string]m.Schedule{}
+	for _, e := range existing {
+		start := e.StartAt
+		if e.SersStartAt.Valid {
+			start = e.SersStartAt.Time
+		}
+		day := localDay(start, starts)
+		if _, dup := byDay[day]; dup || !days[day] {
+			_, err := cancelByPolicy(tx, rep.InstID, e.ScheID, doctID, actorID, cancel, time.Now())
+			if err != nil {
+				if rule := RuleBroken(err); rule == nil || rule.Reason != ReasonDateInPast {
+					return err
+				}
+			}
+			continue
+		}
+		byDay[day] = e
+	}
+	for _, start := range starts {
+		day := localDay(start, starts)
+		sch := m.Schedule{
+			InstID:  rep.InstID,
+			DoctID:  rep.DoctID,
+			StartAt: start.UTC(),
+			EndAt:   start.Add(length).UTC(),
+			Plan:    rep.Plan,
+			Info:    rep.Info,
+			Status:  rep.Status,
+		}
+		old, moving := byDay[day]
+		delete(byDay, day)
+
+		_, err := tx.Exec("SAVEPOINT occurrence")
+		if err != nil {
+			return errors.Wrap(err, "Error creating occurrence savepoint")
+		}
+		var placed *m.Schedule
+		if moving {
+			sch.ScheID = old.ScheID
+			placed, err = replaceSchedule(tx, rep.InstID, &sch, nil)
+		} else {
+			placed, err = bookSchedule(tx, rep.InstID, &sch)
+		}
+		if err == nil {
+			err = linkOccurrence(tx, rep.InstID, placed.ScheID, rep.SersID, start)
+		}
+		if err != nil {
+			rule := RuleBroken(err)
+			if rule == nil {
+				return err
+			}
+			_, err = tx.Exec("ROLLBACK TO SAVEPOINT occurrence")
+			if err != nil {
+				return errors.Wrap(err, "Error rolling back occurrence")
+			}
+			un := m.UnplacedOccurrence{
+				StartAt: sch.StartAt,
+				EndAt:   sch.EndAt,
+				Reason:  rule.Reason,
+				Message: rule.Message,
+				Values:  rule.Values,
+			}
+			if moving {
+				// the occurrence stays at its time, now in this series
+				un.ScheID = &old.ScheID
+				err = linkOccurrence(tx, rep.InstID, old.ScheID, rep.SersID, start)
+				if err != nil {
+					return err
+				}
+			}
+			rep.Unplaced = append(rep.Unplaced, un)
+			continue
+		}
+		_, err = tx.Exec("RELEASE SAVEPOINT occurrence")
+		if err != nil {
+			return errors.Wrap(err, "Error releasing occurrence savepoint")
+		}
+		placed.SersID = &rep.SersID
+		placed.SersStartAt.SetValid(start)
+		rep.Placed = append(rep.Placed, *placed)
+	}
+	return nil
+}
+
+// localDay is the day of t in the location the starts were expanded in
+func localDay(t time.Time, starts []time.Time) string {
+	if len(starts) > 0 {
+		t = t.In(starts[0].Location())
+	}
+	return t.Format("2006-01-02")
+}
+
+/* Create a new Schedule Series to database */
+func createSeries(db service.DB, ser *m.ScheduleSeries) error {
+	query := psql.Insert("schedule_series").
+		Columns("sers_id", "inst_id", "doct_id", "rrule", "start_at", "end_at", "plan", "info").
+		Values(ser.SersID, ser.InstID, ser.DoctID, ser.RRule, ser.StartAt.UTC(), ser.EndAt.UTC(), ser.Plan, ser.Info).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating create Schedule Series sql")
+	}
+	err = db.Get(ser, qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error create Schedule Series sql")
+	}
+	return nil
+}
+
+/* Return a Schedule Series by sers_id */
+func getSeries(db service.DB, instID uuid.UUID, doctID *uuid.UUID, sersID uuid.UUID) (*m.ScheduleSeries, error) {
+	ser := m.ScheduleSeries{}
+	query := psql.Select("*").
+		From("schedule_series").
+		Where(sq.Eq{"sers_id": sersID, "inst_id": instID})
+	if doctID != nil {
+		query = query.Where(`doct_id = ?`, doctID)
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get Schedule Series sql")
+	}
+	err = db.Get(&ser, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error get Schedule Series sql")
+		}
+		return nil, errInvalidSeries{"No series " + sersID.String()}
+	}
+	return &ser, nil
+}
+
+/* Update a Schedule Series to database by sers_id */
+func updateSeriesRow(db service.DB, ser *m.ScheduleSeries) error {
+	query := psql.Update("schedule_series").
+		Set("rrule", ser.RRule).
+		Set("start_at", ser.StartAt.UTC()).
+		Set("end_at", ser.EndAt.UTC()).
+		Set("plan", ser.Plan).
+		Set("info", ser.Info).
+		Set("cancelled_at", ser.CancelledAt).
+		Where(sq.Eq{"sers_id": ser.SersID, "inst_id": ser.InstID}).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating Schedule Series update sql")
+	}
+	err = db.Get(ser, qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error Schedule Series update sql")
+	}
+	return nil
+}
+
+/* Return the live occurrences of a series from a time, by the start the rule gave them or by the current one */
+func listOccurrencesFrom(db service.DB, instID, sersID uuid.UUID, from time.Time, byRule bool) ([]m.Schedule, error) {
+	sch := []m.Schedule{}
+	column := "start_at"
+	if byRule {
+		column = "COALESCE(sers_start_at, start_at)"
+	}
+	query := psql.Select("sche_id", "inst_id", "doct_id", "room_id", "start_at", "end_at", "plan", "info", "created_at", "deleted_at", "sers_id", "sers_start_at", "status", "status_at", "checked_in_at", "checked_out_at", "overstay_minutes", "transition_exceeded").
+		From("schedule").
+		Where("deleted_at IS NULL").
+		Where(sq.Eq{"inst_id": instID, "sers_id": sersID}).
+		Where(column+" >= ?", from.UTC()).
+		OrderBy("start_at")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list occurrences sql")
+	}
+	err = db.Select(&sch, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list occurrences sql")
+	}
+	return sch, nil
+}
+
+/* Cancel the live occurrences of a series starting from a time, each one following the cancellation policy of its plan */
+func deleteOccurrencesFrom(db service.DB, instID, sersID uuid.UUID, doctID, actorID *uuid.UUID, req m.CancelRequest, from time.Time) ([]m.Schedule, error) {
+	sch, err := listOccurrencesFrom(db, instID, sersID, from, false)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range sch {
+		canc, err := cancelByPolicy(db, instID, sch[i].ScheID, doctID, actorID, req, now)
+		if err != nil {
+			return nil, err
+		}
+		sch[i] = *canc.Schedule
+	}
+	return sch, nil
+}
+
+/* Set the series of a Schedule and the start the rule gave it */
+func linkOccurrence(db service.DB, instID, scheID, sersID uuid.UUID, sersStartAt time.Time) error {
+	query := psql.Update("schedule").
+		Set("sers_id", sersID).
+		Set("sers_start_at", sersStartAt.UTC()).
+		Where(sq.Eq{"sche_id": scheID, "inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating link occurrence sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error link occurrence sql")
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+package schedule
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// Statuses of the lifecycle of a Schedule
+const (
+	StatusRequested = "requested"
+	StatusConfirmed = "confirmed"
+	StatusInUse     = "in_use"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusNoShow    = "no_show"
+)
+
+// Reasons of the lifecycle rules a Schedule can break
+const (
+	// ReasonInvalidTransition is given when a Schedule can't go from its status to another
+	ReasonInvalidTransition = "invalid_status_transition"
+	// ReasonNotEditable is given when a Schedule neither requested nor confirmed is changed
+	ReasonNotEditable = "schedule_not_editable"
+)
+
+type errInvalidStatus struct {
+	msg string
+}
+
+func (e errInvalidStatus) Error() string {
+	return e.msg
+}
+
+//InvalidStatus verifying type of error
+func InvalidStatus(err error) bool {
+	_, ok := errors.Cause(err).(errInvalidStatus)
+	return ok
+}
+
+// transitions a Schedule can make from each status, a doctor arriving after
+// the no-show grace period still checks in
+var transitions = map[string][]string{
+	StatusRequested: {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusInUse, StatusCancelled, StatusNoShow},
+	StatusInUse:     {StatusCompleted},
+	StatusNoShow:    {StatusInUse},
+}
+
+//CanTransition tells if a Schedule can go from a status to another
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+//StatusChanger service to move a Schedule through its lifecycle
+type StatusChanger struct {
+	DB *sqlx.DB
+}
+
+//Run changes the status of the Schedule. It can't cancel, that follows the
+//cancellation policy, nor approve, that's for the approval queue
+func (s *StatusChanger) Run(instID, scheID uuid.UUID, actorID *uuid.UUID, req m.StatusChangeRequest) (*m.Schedule, error) {
+	switch req.Status {
+	case StatusInUse, StatusCompleted, StatusNoShow:
+	default:
+		return nil, &RuleError{
+			Reason:  ReasonInvalidTransition,
+			Message: "status must be in_use, completed or no_show",
+			Values:  map[string]interface{}{"status": req.Status},
+		}
+	}
+	return changeStatusTx(s.DB, instID, scheID, req.Status, actorID, req.Note)
+}
+
+//Approver service to approve or reject the requested Schedules
+type Approver struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+}
+
+//Run confirms the requested Schedule, or cancels it when it's rejected, and
+//notifies its doctor
+func (a *Approver) Run(instID, scheID uuid.UUID, actorID *uuid.UUID, approve bool, note string) (*m.Schedule, error) {
+	to := StatusCancelled
+	if approve {
+		to = StatusConfirmed
+	}
+	sch, err := changeStatusTx(a.DB, instID, scheID, to, actorID, note, StatusRequested)
+	if err != nil {
+		return nil, err
+	}
+	notifyApproval(a.DB, a.Logger, sch, approve, note)
+	return sch, nil
+}
+
+//ApprovalQueue service to list the Schedules waiting for approval
+type ApprovalQueue struct {
+	DB *sqlx.DB
+}
+
+//Run returns the requested Schedules that haven't started, soonest first
+func (q *ApprovalQueue) Run(instID uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error) {
+	return listApprovalQueue(q.DB, instID, f)
+}
+
+//StatusHistory service to list the status changes of a Schedule
+type StatusHistory struct {
+	DB *sqlx.DB
+}
+
+//Run returns the status changes of the Schedule, oldest first, only when
+//it's of the doctor when doctID is set
+func (h *StatusHistory) Run(instID uuid.UUID, doctID *uuid.UUID, scheID uuid.UUID) ([]m.ScheduleStatusChange, error) {
+	return listStatusChanges(h.DB, instID, doctID, scheID)
+}
+
+/* Change the status of a Schedule in a transaction, only from one of the statuses given when there are some */
+func changeStatusTx(db *sqlx.DB, instID, scheID uuid.UUID, to string, actorID *uuid.UUID, note string, from ...string) (*m.Schedule, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	sch, err := lockSchedule(tx, instID, scheID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(from) > 0 && !hasStatus(sch.Status, from) {
+		return nil, transitionError(sch.Status, to)
+	}
+	err = setStatus(tx, sch, to, actorID, note, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return sch, nil
+}
+
+/* Get a Schedule locking it until the transaction ends, only when it's of the doctor when doctID is set */
+func lockSchedule(db service.DB, instID, scheID uuid.UUID, doctID *uuid.UUID) (*m.Schedule, error) {
+	sch := m.Schedule{}
+	query := psql.Select("*").
+		From("schedule").
+		Where(sq.Eq{"sche_id": scheID, "inst_id": instID}).
+		Suffix("FOR UPDATE")
+	if doctID != nil {
+		query = query.Where(sq.Eq{"doct_id": doctID})
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get Schedule sql")
+	}
+	err = db.Get(&sch, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error get Schedule sql")
+	}
+	return &sch, nil
+}
+
+/* Lock the Schedule and check it can still be changed, only the requested and confirmed ones can */
+func lockEditable(db service.DB, instID, scheID uuid.UUID, doctID *uuid.UUID) (*m.Schedule, error) {
+	sch, err := lockSchedule(db, instID, scheID, doctID)
+	if err != nil {
+		return nil, err
+	}
+	if sch.Status != StatusRequested && sch.Status != StatusConfirmed {
+		return nil, &RuleError{
+			Reason:  ReasonNotEditable,
+			Message: "A " + sch.Status + " schedule can't be changed",
+			Values:  map[string]interface{}{"status": sch.Status},
+		}
+	}
+	return sch, nil
+}
+
+/* Move the Schedule to a status and record the change. A cancelled Schedule is soft deleted to free its room, in_use is the check-in and completed the check-out, which measures the overstay */
+func setStatus(db service.DB, sch *m.Schedule, to string, actorID *uuid.UUID, note string, now time.Time) error {
+	if !CanTransition(sch.Status, to) {
+		return transitionError(sch.Status, to)
+	}
+	from := sch.Status
+	query := psql.Update("schedule").
+		Set("status", to).
+		Set("status_at", now).
+		Where(sq.Eq{"sche_id": sch.ScheID, "inst_id": sch.InstID}).
+		Suffix("RETURNING *")
+	switch to {
+	case StatusCancelled:
+		query = query.Set("deleted_at", now)
+	case StatusInUse:
+		query = query.Set("checked_in_at", now)
+	case StatusCompleted:
+		minutes, exceeded, err := overstay(db, sch, now)
+		if err != nil {
+			return err
+		}
+		query = query.Set("checked_out_at", now).
+			Set("overstay_minutes", minutes).
+			Set("transition_exceeded", exceeded)
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating update Schedule status sql")
+	}
+	err = db.Get(sch, qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error update Schedule status sql")
+	}
+	return recordStatus(db, sch.InstID, sch.ScheID, &from, to, actorID, note, now)
+}
+
+/* Save a change of status of a Schedule */
+func recordStatus(db service.DB, instID, scheID uuid.UUID, from *string, to string, actorID *uuid.UUID, note string, at time.Time) error {
+	sschID, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "Error generating status change uuid")
+	}
+	query := psql.Insert("schedule_status_change").
+		Columns("ssch_id", "inst_id", "sche_id", "from_status", "to_status", "actor_id", "note", "changed_at").
+		Values(sschID, instID, scheID, from, to, actorID, note, at)
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating create status change sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error create status change sql")
+	}
+	return nil
+}
+
+/* Tell the status a new Schedule starts with: requested when it was asked by its doctor and its plan is in the schedule-approval_plans config, confirmed otherwise */
+func initialStatus(db service.DB, instID uuid.UUID, requested bool, plan string) (string, error) {
+	if !requested {
+		return StatusConfirmed, nil
+	}
+	needs := false
+	qSQL, args, err := approvalPlanQuery(instID, plan).ToSql()
+	if err != nil {
+		return "", errors.Wrap(err, "Error generating get approval plans sql")
+	}
+	err = db.Get(&needs, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return "", errors.Wrap(err, "Error get approval plans sql")
+		}
+		return StatusConfirmed, nil
+	}
+	if needs {
+		return StatusRequested, nil
+	}
+	return StatusConfirmed, nil
+}
+
+/* Whether the plan is in the schedule-approval_plans config, jsonb_exists is the ? operator the placeholders would rewrite */
+func approvalPlanQuery(instID uuid.UUID, plan string) *sq.SelectBuilder {
+	return psql.Select().
+		Column("COALESCE(jsonb_exists(value->'plans', ?), FALSE)", plan).
+		From("config").
+		Where("key = ?", "schedule-approval_plans").
+		Where("inst_id = ?", instID)
+}
+
+/* List the requested Schedules that haven't started, soonest first */
+func listApprovalQueue(db service.DB, instID uuid.UUID, f m.FilterSchedule) ([]m.Schedule, error) {
+	sch := []m.Schedule{}
+	query := psql.Select("*").
+		From("schedule").
+		Where(sq.Eq{"inst_id": instID, "status": StatusRequested}).
+		Where("start_at > NOW() AT TIME ZONE 'UTC'").
+		OrderBy("start_at", "sche_id")
+	if f.DoctID != nil {
+		query = query.Where(sq.Eq{"doct_id": *f.DoctID})
+	}
+	if f.Limit != nil {
+		query = query.Limit(uint64(*f.Limit))
+	}
+	if f.Offset != nil {
+		query = query.Offset(uint64(*f.Offset))
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list approval queue sql")
+	}
+	err = db.Select(&sch, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list approval queue sql")
+	}
+	return sch, nil
+}
+
+/* List the status changes of a Schedule, oldest first */
+func listStatusChanges(db service.DB, instID uuid.UUID, doctID *uuid.UUID, scheID uuid.UUID) ([]m.ScheduleStatusChange, error) {
+	changes := []m.ScheduleStatusChange{}
+	query := psql.Select("ssc.*").
+		From("schedule_status_change ssc").
+		Join("schedule s USING (sche_id)").
+		Where(sq.Eq{"ssc.sche_id": scheID, "ssc.inst_id": instID}).
+		OrderBy("ssc.changed_at", "ssc.ssch_id")
+	if doctID != nil {
+		query = query.Where(sq.Eq{"s.doct_id": doctID})
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list status changes sql")
+	}
+	err = db.Select(&changes, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error list status changes sql")
+	}
+	return changes, nil
+}
+
+/* Send a push notification to the doctor of an approved or rejected Schedule */
+func notifyApproval(db service.DB, logger *log.Logger, sch *m.Schedule, approved bool, note string) {
+	loc, err := allocation.Location(db, sch.InstID)
+	if err != nil {
+		if logger != nil {
+			logger.Println(err)
+		}
+		return
+	}
+	message := "Seu pedido de horário de " + sch.StartAt.In(loc).Format("02/01 às 15:04")
+	if approved {
+		message += " foi aprovado"
+	} else {
+		message += " foi recusado"
+	}
+	if len(note) > 0 {
+		message += ": " + note
+	}
+	err = pushToDoctor(db, sch.DoctID, message, map[string]string{
+		"scheID":   sch.ScheID.String(),
+		"doctID":   sch.DoctID.String(),
+		"status":   sch.Status,
+		"contents": message,
+		"type":     "notification.scheduleApproval",
+	})
+	if err != nil && logger != nil && err != sql.ErrNoRows {
+		logger.Println(err)
+	}
+}
+
+/* Build the filter of a list of statuses split by comma, an unknown status is an error */
+func statusFilter(list string) (pq.StringArray, error) {
+	statuses := pq.StringArray{}
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		switch s {
+		case StatusRequested, StatusConfirmed, StatusInUse, StatusCompleted, StatusCancelled, StatusNoShow:
+			statuses = append(statuses, s)
+		default:
+			return nil, errInvalidStatus{"Unknown status " + s}
+		}
+	}
+	return statuses, nil
+}
+
+func hasStatus(status string, list []string) bool {
+	for _, s := range list {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func transitionError(from, to string) error {
+	return &RuleError{
+		Reason:  ReasonInvalidTransition,
+		Message: "A " + from + " schedule can't be " + to,
+		Values:  map[string]interface{}{"from": from, "to": to},
+	}
+}
@@ -0,0 +1,63 @@
+package schedule
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusRequested, StatusConfirmed, true},
+		{StatusRequested, StatusCancelled, true},
+		{StatusRequested, StatusInUse, false},
+		{StatusConfirmed, StatusInUse, true},
+		{StatusConfirmed, StatusNoShow, true},
+		{StatusConfirmed, StatusCancelled, true},
+		{StatusConfirmed, StatusCompleted, false},
+		{StatusInUse, StatusCompleted, true},
+		{StatusInUse, StatusCancelled, false},
+		// completed and cancelled are final
+		{StatusCompleted, StatusInUse, false},
+		{StatusCancelled, StatusConfirmed, false},
+		{StatusNoShow, StatusConfirmed, false},
+		// a late arrival
+		{StatusNoShow, StatusInUse, true},
+	}
+	for _, c := range cases {
+		if got := CanTransition(c.from, c.to); got != c.want {
+			t.Errorf("%s to %s: got %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestStatusFilter(t *testing.T) {
+	got, err := statusFilter("requested, no_show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != StatusRequested || got[1] != StatusNoShow {
+		t.Errorf("got %v", got)
+	}
+	_, err = statusFilter("confirmed,deleted")
+	if !InvalidStatus(err) {
+		t.Errorf("an unknown status must be invalid, got %v", err)
+	}
+}
+
+func TestApprovalPlanQuery(t *testing.T) {
+	qSQL, args, err := approvalPlanQuery(uuid.Nil, "Turn").ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT COALESCE(jsonb_exists(value->'plans', $1), FALSE) FROM config WHERE key = $2 AND inst_id = $3"
+	if qSQL != want {
+		t.Errorf("got %s, want %s", qSQL, want)
+	}
+	if len(args) != 3 || args[0] != "Turn" {
+		t.Errorf("got args %v", args)
+	}
+}
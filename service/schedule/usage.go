@@ -0,0 +1,419 @@
+package schedule
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jasonlvhit/gocron"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/schedule/allocation"
+
+	sq "github.com/elgris/sqrl"
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// Reasons a Schedule can't be checked in or out
+const (
+	ReasonCheckInTooEarly  = "check_in_too_early"
+	ReasonCheckInAfterEnd  = "check_in_after_end"
+	ReasonNoScheduleInRoom = "no_schedule_in_room"
+)
+
+// Defaults of the schedule-usage config
+const (
+	defaultNoShowGraceMinutes  = 15
+	defaultCheckInEarlyMinutes = 30
+)
+
+// noShowLookback bounds the Schedules the no-show job looks at, the ones
+// booked before the check-in existed stay confirmed
+const noShowLookback = 24 * time.Hour
+
+type errInvalidUsage struct {
+	msg string
+}
+
+func (e errInvalidUsage) Error() string {
+	return e.msg
+}
+
+//InvalidUsage verifying type of error
+func InvalidUsage(err error) bool {
+	_, ok := errors.Cause(err).(errInvalidUsage)
+	return ok
+}
+
+//CheckIn service to start the use of a Schedule
+type CheckIn struct {
+	DB *sqlx.DB
+}
+
+//Run checks in the Schedule, only when it's of the doctor when doctID is set
+func (s *CheckIn) Run(instID, scheID uuid.UUID, doctID, actorID *uuid.UUID) (*m.Schedule, error) {
+	return checkTx(s.DB, func(tx service.DB) (*m.Schedule, error) {
+		sch, err := lockSchedule(tx, instID, scheID, doctID)
+		if err != nil {
+			return nil, err
+		}
+		return sch, checkIn(tx, sch, actorID, "", time.Now())
+	})
+}
+
+//CheckOut service to end the use of a Schedule
+type CheckOut struct {
+	DB *sqlx.DB
+}
+
+//Run checks out the Schedule, only when it's of the doctor when doctID is set
+func (s *CheckOut) Run(instID, scheID uuid.UUID, doctID, actorID *uuid.UUID) (*m.Schedule, error) {
+	return checkTx(s.DB, func(tx service.DB) (*m.Schedule, error) {
+		sch, err := lockSchedule(tx, instID, scheID, doctID)
+		if err != nil {
+			return nil, err
+		}
+		return sch, setStatus(tx, sch, StatusCompleted, actorID, "", time.Now())
+	})
+}
+
+//RoomCheckIn service for the display of a room to check in its current Schedule
+type RoomCheckIn struct {
+	DB *sqlx.DB
+}
+
+//Run checks in the Schedule of the room whose check-in is open, the soonest
+//when there are many
+func (s *RoomCheckIn) Run(instID, roomID uuid.UUID) (*m.Schedule, error) {
+	return checkTx(s.DB, func(tx service.DB) (*m.Schedule, error) {
+		now := time.Now()
+		policy, err := usagePolicy(tx, instID)
+		if err != nil {
+			return nil, err
+		}
+		early := time.Duration(policy.CheckInEarlyMinutes) * time.Minute
+		sch, err := lockRoomSchedule(tx, instID, roomID, []string{StatusConfirmed, StatusNoShow}, now.Add(early), now)
+		if err != nil {
+			return nil, err
+		}
+		return sch, checkIn(tx, sch, nil, "outdoor", now)
+	})
+}
+
+//RoomCheckOut service for the display of a room to check out its current Schedule
+type RoomCheckOut struct {
+	DB *sqlx.DB
+}
+
+//Run checks out the Schedule in use in the room
+func (s *RoomCheckOut) Run(instID, roomID uuid.UUID) (*m.Schedule, error) {
+	return checkTx(s.DB, func(tx service.DB) (*m.Schedule, error) {
+		sch, err := lockRoomSchedule(tx, instID, roomID, []string{StatusInUse}, time.Time{}, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		return sch, setStatus(tx, sch, StatusCompleted, nil, "outdoor", time.Now())
+	})
+}
+
+//NoShowMarker job to mark the confirmed Schedules without check-in after the
+//grace period as no-shows
+type NoShowMarker struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+}
+
+// Start runs the job now and then every minute
+func (n *NoShowMarker) Start() chan bool {
+	n.Run()
+	s := gocron.NewScheduler()
+	s.Every(1).Minute().Do(n.Run)
+	return s.Start()
+}
+
+//Run marks the no-shows of every active institution
+func (n *NoShowMarker) Run() error {
+	insts, err := activeInstitutions(n.DB)
+	if err != nil {
+		if n.Logger != nil {
+			n.Logger.Println(err)
+		}
+		return err
+	}
+	for _, instID := range insts {
+		count, err := markNoShows(n.DB, instID, time.Now())
+		if err != nil {
+			if n.Logger != nil {
+				n.Logger.Println(err)
+			}
+			continue
+		}
+		if n.Logger != nil && count > 0 {
+			n.Logger.Printf("marked %d schedules of %s as no-shows", count, instID)
+		}
+	}
+	return nil
+}
+
+//UsageReporter service to compare the booked and the actual use of the Schedules
+type UsageReporter struct {
+	DB *sqlx.DB
+}
+
+//Run returns the usage of the Schedules starting between the local days of
+//the filter, the current month by default. Only the doctor's when doctID is set
+func (r *UsageReporter) Run(instID uuid.UUID, doctID *uuid.UUID, f m.FilterUsage) (*m.UsageReport, error) {
+	return usageReport(r.DB, instID, doctID, f)
+}
+
+/* Run a check-in or a check-out in a transaction */
+func checkTx(db *sqlx.DB, check func(tx service.DB) (*m.Schedule, error)) (*m.Schedule, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	sch, err := check(tx)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return sch, nil
+}
+
+/* Check in the Schedule from the check-in early minutes before its start until its end */
+func checkIn(db service.DB, sch *m.Schedule, actorID *uuid.UUID, note string, now time.Time) error {
+	policy, err := usagePolicy(db, sch.InstID)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{"startAt": sch.StartAt, "endAt": sch.EndAt}
+	if now.Before(sch.StartAt.Add(-time.Duration(policy.CheckInEarlyMinutes) * time.Minute)) {
+		values["checkInEarlyMinutes"] = policy.CheckInEarlyMinutes
+		return &RuleError{
+			Reason:  ReasonCheckInTooEarly,
+			Message: "The check-in opens " + strconv.Itoa(policy.CheckInEarlyMinutes) + " minutes before the start",
+			Values:  values,
+		}
+	}
+	if !now.Before(sch.EndAt) {
+		return &RuleError{
+			Reason:  ReasonCheckInAfterEnd,
+			Message: "A schedule can't be checked in after it ends",
+			Values:  values,
+		}
+	}
+	return setStatus(db, sch, StatusInUse, actorID, note, now)
+}
+
+/* Get the Schedule of the room in one of the statuses, locking it until the transaction ends. When startBefore is set it must start before it and end after endAfter */
+func lockRoomSchedule(db service.DB, instID, roomID uuid.UUID, statuses []string, startBefore, endAfter time.Time) (*m.Schedule, error) {
+	sch := m.Schedule{}
+	query := psql.Select("*").
+		From("schedule").
+		Where(sq.Eq{"inst_id": instID, "room_id": roomID, "status": statuses}).
+		OrderBy("start_at").
+		Limit(1).
+		Suffix("FOR UPDATE")
+	if !startBefore.IsZero() {
+		query = query.Where(sq.Lt{"start_at": startBefore.UTC()}).
+			Where(sq.Gt{"end_at": endAfter.UTC()})
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get room Schedule sql")
+	}
+	err = db.Get(&sch, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Error get room Schedule sql")
+		}
+		return nil, &RuleError{
+			Reason:  ReasonNoScheduleInRoom,
+			Message: "The room has no schedule to check in or out now",
+			Values:  map[string]interface{}{"roomID": roomID},
+		}
+	}
+	return &sch, nil
+}
+
+/* Tell how many minutes a check-out at now ran past the end of the Schedule, and whether it ran past the transition window too */
+func overstay(db service.DB, sch *m.Schedule, now time.Time) (int, bool, error) {
+	if !now.After(sch.EndAt) {
+		return 0, false, nil
+	}
+	transition, err := allocation.Transition(db, sch.InstID)
+	if err != nil {
+		return 0, false, err
+	}
+	minutes := int(math.Ceil(now.Sub(sch.EndAt).Minutes()))
+	return minutes, now.After(sch.EndAt.Add(transition)), nil
+}
+
+/* Mark as no-shows the confirmed Schedules of the last day not checked in after the grace period, returning how many */
+func markNoShows(db *sqlx.DB, instID uuid.UUID, now time.Time) (int, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	policy, err := usagePolicy(tx, instID)
+	if err != nil {
+		return 0, err
+	}
+	grace := time.Duration(policy.NoShowGraceMinutes) * time.Minute
+	scheds := []m.Schedule{}
+	query := psql.Select("*").
+		From("schedule").
+		Where(sq.Eq{"inst_id": instID, "status": StatusConfirmed}).
+		Where(sq.LtOrEq{"start_at": now.Add(-grace).UTC()}).
+		Where(sq.Gt{"start_at": now.Add(-noShowLookback).UTC()}).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error generating list no-shows sql")
+	}
+	err = tx.Select(&scheds, qSQL, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error list no-shows sql")
+	}
+	note := "No check-in " + strconv.Itoa(policy.NoShowGraceMinutes) + " minutes after the start"
+	for i := range scheds {
+		err = setStatus(tx, &scheds[i], StatusNoShow, nil, note, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return len(scheds), nil
+}
+
+/* Return the schedule-usage config over its defaults */
+func usagePolicy(db service.DB, instID uuid.UUID) (m.UsagePolicy, error) {
+	policy := m.UsagePolicy{
+		NoShowGraceMinutes:  defaultNoShowGraceMinutes,
+		CheckInEarlyMinutes: defaultCheckInEarlyMinutes,
+	}
+	value := types.JSONText{}
+	query := psql.Select("value").
+		From("config").
+		Where(sq.Eq{"key": "schedule-usage", "inst_id": instID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return policy, errors.Wrap(err, "Error generating get usage policy sql")
+	}
+	err = db.Get(&value, qSQL, args...)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return policy, errors.Wrap(err, "Error get usage policy sql")
+		}
+		return policy, nil
+	}
+	err = json.Unmarshal(value, &policy)
+	if err != nil {
+		return policy, errors.Wrap(err, "Error parsing usage policy")
+	}
+	return policy, nil
+}
+
+/* Sum by doctor the booked and the actual use of the Schedules starting between the local days of the filter */
+func usageReport(db service.DB, instID uuid.UUID, doctID *uuid.UUID, f m.FilterUsage) (*m.UsageReport, error) {
+	loc, err := allocation.Location(db, instID)
+	if err != nil {
+		return nil, err
+	}
+	local := time.Now().In(loc)
+	from := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 1, -1)
+	if f.FromDate != nil {
+		from, err = time.ParseInLocation("2006-01-02", *f.FromDate, loc)
+		if err != nil {
+			return nil, errInvalidUsage{"fromDate must be a date like 2006-01-02"}
+		}
+		if f.ToDate == nil {
+			to = from.AddDate(0, 1, -1)
+		}
+	}
+	if f.ToDate != nil {
+		to, err = time.ParseInLocation("2006-01-02", *f.ToDate, loc)
+		if err != nil {
+			return nil, errInvalidUsage{"toDate must be a date like 2006-01-02"}
+		}
+	}
+	if to.Before(from) {
+		return nil, errInvalidUsage{"toDate can't be before fromDate"}
+	}
+
+	rows := []m.ScheduleUsage{}
+	query := psql.Select(
+		"s.doct_id",
+		"d.name AS doc_name",
+		"count(*) AS booked",
+		"count(*) FILTER (WHERE s.status = 'completed') AS used",
+		"count(*) FILTER (WHERE s.status = 'in_use') AS in_use",
+		"count(*) FILTER (WHERE s.status = 'no_show') AS no_shows",
+		"(COALESCE(SUM(EXTRACT(EPOCH FROM s.end_at - s.start_at)), 0)::INT / 60) AS booked_minutes",
+		"(COALESCE(SUM(EXTRACT(EPOCH FROM s.checked_out_at - s.checked_in_at)), 0)::INT / 60) AS used_minutes",
+		"(COALESCE(SUM(GREATEST(EXTRACT(EPOCH FROM s.checked_in_at - (s.start_at AT TIME ZONE 'UTC')), 0)), 0)::INT / 60) AS late_minutes",
+		"count(*) FILTER (WHERE s.overstay_minutes > 0) AS overstays",
+		"COALESCE(SUM(s.overstay_minutes), 0) AS overstay_minutes",
+		"count(*) FILTER (WHERE s.transition_exceeded) AS transition_exceeded").
+		From("schedule s").
+		Join("doctor d ON d.doct_id = s.doct_id").
+		Where(sq.Eq{"s.inst_id": instID, "s.status": []string{StatusConfirmed, StatusInUse, StatusCompleted, StatusNoShow}}).
+		Where(sq.GtOrEq{"s.start_at": from.UTC()}).
+		Where(sq.Lt{"s.start_at": to.AddDate(0, 0, 1).UTC()}).
+		GroupBy("s.doct_id", "d.name").
+		OrderBy("d.name", "s.doct_id")
+	if doctID != nil {
+		query = query.Where(sq.Eq{"s.doct_id": doctID})
+	}
+	if f.DoctID != nil {
+		query = query.Where(sq.Eq{"s.doct_id": *f.DoctID})
+	}
+	if f.RoomID != nil {
+		query = query.Where(sq.Eq{"s.room_id": *f.RoomID})
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating usage report sql")
+	}
+	err = db.Select(&rows, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error usage report sql")
+	}
+	report := &m.UsageReport{
+		FromDate: from.Format("2006-01-02"),
+		ToDate:   to.Format("2006-01-02"),
+		Doctors:  rows,
+	}
+	for _, r := range rows {
+		report.Total.Booked += r.Booked
+		report.Total.Used += r.Used
+		report.Total.InUse += r.InUse
+		report.Total.NoShows += r.NoShows
+		report.Total.BookedMinutes += r.BookedMinutes
+		report.Total.UsedMinutes += r.UsedMinutes
+		report.Total.LateMinutes += r.LateMinutes
+		report.Total.Overstays += r.Overstays
+		report.Total.OverstayMinutes += r.OverstayMinutes
+		report.Total.TransitionExceeded += r.TransitionExceeded
+	}
+	return report, nil
+}
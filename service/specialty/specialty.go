@@ -3,6 +3,7 @@ package specialty
 import (
 	"database/sql"
 
+	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"gitlab.com/falqon/inovantapp/backend/service"
@@ -19,7 +20,8 @@ type Creator struct {
 }
 
 //Run create new Specialty
-func (c *Creator) Run(spe *m.Specialty) (*m.Specialty, error) {
+func (c *Creator) Run(instID uuid.UUID, spe *m.Specialty) (*m.Specialty, error) {
+	spe.InstID = instID
 	u, err := createSpecialty(c.DB, spe)
 	return u, err
 }
@@ -30,8 +32,8 @@ type Lister struct {
 }
 
 //Run return a list of Specialty by Filter
-func (l *Lister) Run(f m.FilterSpecialty) ([]m.Specialty, error) {
-	u, err := listSpecialty(l.DB, f)
+func (l *Lister) Run(instID uuid.UUID, f m.FilterSpecialty) ([]m.Specialty, error) {
+	u, err := listSpecialty(l.DB, instID, f)
 	return u, err
 }
 
@@ -41,8 +43,8 @@ type Getter struct {
 }
 
 //Run return a Specialty by spec_id
-func (g *Getter) Run(specID int64) (*m.Specialty, error) {
-	u, err := getSpecialty(g.DB, specID)
+func (g *Getter) Run(instID uuid.UUID, specID int64) (*m.Specialty, error) {
+	u, err := getSpecialty(g.DB, instID, specID)
 	return u, err
 }
 
@@ -52,7 +54,8 @@ type Updater struct {
 }
 
 //Run update Specialty data
-func (g *Updater) Run(spe *m.Specialty) (*m.Specialty, error) {
+func (g *Updater) Run(instID uuid.UUID, spe *m.Specialty) (*m.Specialty, error) {
+	spe.InstID = instID
 	u, err := updateSpecialty(g.DB, spe)
 	return u, err
 }
@@ -63,16 +66,16 @@ type Deleter struct {
 }
 
 //Run soft delete Specialty by spec_id
-func (d *Deleter) Run(specID int64) (*m.Specialty, error) {
-	u, err := deleteSpecialty(d.DB, specID)
+func (d *Deleter) Run(instID uuid.UUID, specID int64) (*m.Specialty, error) {
+	u, err := deleteSpecialty(d.DB, instID, specID)
 	return u, err
 }
 
 /* Create a new Specialty to database */
 func createSpecialty(db service.DB, spe *m.Specialty) (*m.Specialty, error) {
 	query := psql.Insert("specialty").
-		Columns("name", "description", "info").
-		Values(spe.Name, spe.Description, spe.Info).
+		Columns("inst_id", "name", "description", "info").
+		Values(spe.InstID, spe.Name, spe.Description, spe.Info).
 		Suffix("RETURNING *")
 
 	qSQL, args, err := query.ToSql()
@@ -88,10 +91,11 @@ func createSpecialty(db service.DB, spe *m.Specialty) (*m.Specialty, error) {
 }
 
 /* Return a list of Specialty by filters */
-func listSpecialty(db service.DB, f m.FilterSpecialty) ([]m.Specialty, error) {
+func listSpecialty(db service.DB, instID uuid.UUID, f m.FilterSpecialty) ([]m.Specialty, error) {
 	spe := []m.Specialty{}
-	query := psql.Select("spec_id", "name", "description").
-		From("specialty")
+	query := psql.Select("spec_id", "inst_id", "name", "description").
+		From("specialty").
+		Where(sq.Eq{"inst_id": instID})
 
 	if f.Name != nil {
 		query = query.Where(`name ILIKE ?`, `%`+*f.Name+`%`)
@@ -121,11 +125,11 @@ func listSpecialty(db service.DB, f m.FilterSpecialty) ([]m.Specialty, error) {
 }
 
 /* Return a Specialty by spec_id */
-func getSpecialty(db service.DB, specID int64) (*m.Specialty, error) {
+func getSpecialty(db service.DB, instID uuid.UUID, specID int64) (*m.Specialty, error) {
 	spe := m.Specialty{}
-	query := psql.Select("spec_id", "name", "description", "info").
+	query := psql.Select("spec_id", "inst_id", "name", "description", "info").
 		From("specialty").
-		Where(sq.Eq{"spec_id": specID})
+		Where(sq.Eq{"spec_id": specID, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -148,7 +152,7 @@ func updateSpecialty(db service.DB, spe *m.Specialty) (*m.Specialty, error) {
 		Set("description", spe.Description).
 		Set("info", spe.Info).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"spec_id": spe.SpecID})
+		Where(sq.Eq{"spec_id": spe.SpecID, "inst_id": spe.InstID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -164,11 +168,11 @@ func updateSpecialty(db service.DB, spe *m.Specialty) (*m.Specialty, error) {
 }
 
 /* Delete Specialty to database by spec_id */
-func deleteSpecialty(db service.DB, specID int64) (*m.Specialty, error) {
+func deleteSpecialty(db service.DB, instID uuid.UUID, specID int64) (*m.Specialty, error) {
 	spe := m.Specialty{}
 	query := psql.Delete("specialty").
 		Suffix("RETURNING *").
-		Where(sq.Eq{"spec_id": specID})
+		Where(sq.Eq{"spec_id": specID, "inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -3,12 +3,15 @@ package specialty
 import (
 	"testing"
 
+	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
 	m "gitlab.com/falqon/inovantapp/backend/models"
 )
 
 var psqlInfo = ("host=localhost port=5432 user=postgres password=123 dbname=inovant_test sslmode=disable")
 
+var instID = uuid.FromStringOrNil("00000000-0000-0000-0000-000000000001")
+
 func TestCreateSpecialty(t *testing.T) {
 	db, err := sqlx.Connect("postgres", psqlInfo)
 	if err != nil {
@@ -21,7 +24,7 @@ func TestCreateSpecialty(t *testing.T) {
 	}
 
 	specCre := Creator{DB: db}
-	cre, err := specCre.Run(&sSpecialty)
+	cre, err := specCre.Run(instID, &sSpecialty)
 	if err != nil {
 		t.Errorf("Create Specialty failed, expected struct got %v ", err)
 	} else {
@@ -42,7 +45,7 @@ func TestUpdateSpecialty(t *testing.T) {
 	}
 
 	specUpd := Updater{DB: db}
-	upd, err := specUpd.Run(&sSpecialty)
+	upd, err := specUpd.Run(instID, &sSpecialty)
 	if err != nil {
 		t.Errorf("Update Specialty failed, expected struct got %v ", err)
 	} else {
@@ -59,7 +62,7 @@ func TestDeleteSpecialty(t *testing.T) {
 	sSpecialty := int64(26)
 
 	specDel := Deleter{DB: db}
-	del, err := specDel.Run(sSpecialty)
+	del, err := specDel.Run(instID, sSpecialty)
 	if err != nil {
 		t.Errorf("Delete Specialty failed, expected struct got %v ", err)
 	} else {
@@ -76,7 +79,7 @@ func TestGetSpecialty(t *testing.T) {
 	sSpecialty := int64(22)
 
 	specGet := Getter{DB: db}
-	get, err := specGet.Run(sSpecialty)
+	get, err := specGet.Run(instID, sSpecialty)
 	if err != nil {
 		t.Errorf("Get Specialty failed, expected struct got %v ", err)
 	} else {
@@ -102,7 +105,7 @@ func TestListSpecialty(t *testing.T) {
 	}
 
 	specList := Lister{DB: db}
-	list, err := specList.Run(sSpecialty)
+	list, err := specList.Run(instID, sSpecialty)
 	if err != nil {
 		t.Errorf("List Specialty failed, expected struct got %v ", err)
 	} else {
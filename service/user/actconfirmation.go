@@ -2,11 +2,14 @@ package user
 
 import (
 	"database/sql"
+	"encoding/json"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
@@ -17,6 +20,22 @@ const (
 	vPwd   = confirmationType("password")
 )
 
+// config key holding the per type verification policy, e.g.
+// {"password": {"ttlMinutes": 60, "maxAttempts": 5}}
+const verificationPolicyKey = "action_verification"
+
+// verificationPolicy is how long a verification lives and how many wrong
+// tries it takes before it's invalidated
+type verificationPolicy struct {
+	TTLMinutes  int `json:"ttlMinutes"`
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+var defaultVerificationPolicies = map[confirmationType]verificationPolicy{
+	vPwd:   {TTLMinutes: 60, MaxAttempts: 5},
+	vEmail: {TTLMinutes: 72 * 60, MaxAttempts: 5},
+}
+
 type actionConfirmation struct {
 	InstID       uuid.UUID        `db:"inst_id"`
 	AcveID       uuid.UUID        `db:"acve_id"`
@@ -25,9 +44,11 @@ type actionConfirmation struct {
 	Verification string           `db:"verification"`
 	CreatedAt    time.Time        `db:"created_at"`
 	DeletedAt    *time.Time       `db:"deleted_at"`
+	ExpiresAt    time.Time        `db:"expires_at"`
+	Attempts     int              `db:"attempts"`
 }
 
-func newActConfirmation(u uuid.UUID, t confirmationType) (*actionConfirmation, string, error) {
+func newActConfirmation(instID, u uuid.UUID, t confirmationType) (*actionConfirmation, string, error) {
 	uid, err := uuid.NewV4()
 	if err != nil {
 		return nil, "", err
@@ -43,14 +64,36 @@ func newActConfirmation(u uuid.UUID, t confirmationType) (*actionConfirmation, s
 		return nil, "", err
 	}
 
-	return &actionConfirmation{AcveID: resetUUID, UserID: u, Verification: string(v)}, uid.String(), nil
+	return &actionConfirmation{InstID: instID, AcveID: resetUUID, UserID: u, Type: t, Verification: string(v)}, uid.String(), nil
 }
 
+// confirmationSave stores the verification with the expiration of its type
+// policy, older verifications of the same type stop working
 func confirmationSave(db *sqlx.Tx, u *actionConfirmation) error {
+	p, err := verificationPolicyFor(db, u.InstID, u.Type)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	old := psql.Update("action_verification").
+		Set("deleted_at", now).
+		Where(sq.Eq{"user_id": u.UserID, "type": u.Type, "deleted_at": nil})
+	qSQL, args, err := old.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error invalidating previous verifications")
+	}
+
+	u.CreatedAt = now
+	u.ExpiresAt = now.Add(time.Duration(p.TTLMinutes) * time.Minute)
 	ins := psql.Insert("action_verification").
-		Columns("acve_id", "user_id", "verification", "type", "created_at").
-		Values(u.AcveID, u.UserID, u.Verification, u.Type, time.Now())
-	qSQL, args, err := ins.ToSql()
+		Columns("acve_id", "inst_id", "user_id", "verification", "type", "created_at", "expires_at").
+		Values(u.AcveID, u.InstID, u.UserID, u.Verification, u.Type, u.CreatedAt, u.ExpiresAt)
+	qSQL, args, err = ins.ToSql()
 	if err != nil {
 		return err
 	}
@@ -72,11 +115,14 @@ func confirmationDelete(db *sqlx.Tx, u *actionConfirmation) error {
 	return err
 }
 
-func confirmationFromID(tx *sqlx.Tx, acveID string) (actionConfirmation, error) {
+// confirmationFromID returns an usable verification of the given type
+func confirmationFromID(tx *sqlx.Tx, acveID string, t confirmationType) (actionConfirmation, error) {
 	psrt := actionConfirmation{}
-	query := psql.Select("acve_id", "user_id", "verification", "type", "created_at", "deleted_at").
+	query := psql.Select("acve_id", "inst_id", "user_id", "verification", "type", "created_at", "deleted_at", "expires_at", "attempts").
 		From("action_verification").
-		Where(sq.Eq{"acve_id": acveID, "deleted_at": nil})
+		Where(sq.Eq{"acve_id": acveID, "type": t, "deleted_at": nil}).
+		Where(sq.Gt{"expires_at": time.Now()}).
+		Suffix("FOR UPDATE")
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -94,3 +140,71 @@ func confirmationFromID(tx *sqlx.Tx, acveID string) (actionConfirmation, error)
 	}
 	return psrt, nil
 }
+
+// confirmationCheck compares the verification, a wrong one counts as an
+// attempt and the verification is invalidated once the policy limit is hit.
+// The attempt is persisted, so the caller must commit even on a mismatch.
+func confirmationCheck(tx *sqlx.Tx, u *actionConfirmation, verification string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(u.Verification), []byte(verification))
+	if err == nil {
+		return true, nil
+	}
+
+	p, err := verificationPolicyFor(tx, u.InstID, u.Type)
+	if err != nil {
+		return false, err
+	}
+	upd := psql.Update("action_verification").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Where(sq.Eq{"acve_id": u.AcveID})
+	if p.MaxAttempts > 0 && u.Attempts+1 >= p.MaxAttempts {
+		upd = upd.Set("deleted_at", time.Now())
+	}
+	qSQL, args, err := upd.ToSql()
+	if err != nil {
+		return false, errors.Wrap(err, "Error generating verification attempt sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		return false, errors.Wrap(err, "Error registering verification attempt")
+	}
+	return false, nil
+}
+
+// verificationPolicyFor reads the type policy from config, falling back to the defaults
+func verificationPolicyFor(db service.DB, instID uuid.UUID, t confirmationType) (verificationPolicy, error) {
+	p, ok := defaultVerificationPolicies[t]
+	if !ok {
+		p = defaultVerificationPolicies[vPwd]
+	}
+	var raw []byte
+	query := psql.Select("value").
+		From("config").
+		Where(sq.Eq{"key": verificationPolicyKey, "inst_id": instID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return p, errors.Wrap(err, "Error generating verification policy sql")
+	}
+	err = db.Get(&raw, qSQL, args...)
+	if err == sql.ErrNoRows {
+		return p, nil
+	}
+	if err != nil {
+		return p, errors.Wrap(err, "Error getting verification policy")
+	}
+
+	policies := map[confirmationType]verificationPolicy{}
+	err = json.Unmarshal(raw, &policies)
+	if err != nil {
+		return p, errors.Wrap(err, "Invalid "+verificationPolicyKey+" config")
+	}
+	if c, ok := policies[t]; ok {
+		if c.TTLMinutes > 0 {
+			p.TTLMinutes = c.TTLMinutes
+		}
+		if c.MaxAttempts > 0 {
+			p.MaxAttempts = c.MaxAttempts
+		}
+	}
+	return p, nil
+}
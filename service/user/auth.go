@@ -1,7 +1,9 @@
 package user
 
 import (
+	"database/sql"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -13,6 +15,8 @@ import (
 	"gitlab.com/falqon/inovantapp/backend/service"
 	"gitlab.com/falqon/inovantapp/backend/service/mailer"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/keyring"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 
 	m "gitlab.com/falqon/inovantapp/backend/models"
 
@@ -22,64 +26,155 @@ import (
 // AuthResponse Service Object Authentication
 type AuthResponse struct {
 	m.UserWithDoctor
-	Jwt string
+	Jwt          string
+	RefreshToken string
+	SessID       uuid.UUID
+	// MFAStep is set when the sign in must continue with a second factor,
+	// MFAToken then replaces the JWT
+	MFAStep  string
+	MFAToken string
+	// RecoveryCodes are only returned when two factor authentication is activated
+	RecoveryCodes []string
 }
 
 // Authenticator Object
 type Authenticator struct {
 	DB        *sqlx.DB
 	JWTConfig JWTConfig
+	Lockout   LockoutConfig
+}
+
+// LockoutConfig holds the account lockout policy
+type LockoutConfig struct {
+	// MaxAttempts is the number of consecutive failed sign ins before the
+	// account is locked, zero disables the lockout
+	MaxAttempts int
+	// Duration is how long the account stays locked
+	Duration time.Duration
 }
 
 // JWTConfig Object
 type JWTConfig struct {
-	Secret          string
+	// Keys signs the tokens with the current key and verifies them with any
+	// key not expired
+	Keys *keyring.Keyring
+	// HoursTillExpire is the lifetime of the access tokens
 	HoursTillExpire time.Duration
-	SigningMethod   *jwt.SigningMethodHMAC
+	// RefreshTillExpire is how long a session lives without being refreshed
+	RefreshTillExpire time.Duration
 }
 
 //Run Authenticator User
-func (u *Authenticator) Run(email, password string) (a *AuthResponse, err error) {
+func (u *Authenticator) Run(email, password string, device Device) (a *AuthResponse, err error) {
 
 	usr, err := fromEmail(u.DB, strings.TrimSpace(email))
+	if _, ok := errors.Cause(err).(*auth.UserNotFoundError); ok {
+		// spend the time of a password check, unknown emails must not answer faster
+		bcrypt.CompareHashAndPassword(unknownUserHash(), []byte(password))
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usr.LockedUntil.Valid && usr.LockedUntil.Time.After(time.Now()) {
+		return nil, &auth.AccountLockedError{
+			Message: "Account locked until " + usr.LockedUntil.Time.Format(time.RFC3339),
+			Until:   usr.LockedUntil.Time,
+		}
+	}
+
+	err = bcrypt.CompareHashAndPassword(usr.Password, []byte(password))
+	if err != nil {
+		lockErr := registerFailedAttempt(u.DB, usr.UserID, u.Lockout)
+		if lockErr != nil {
+			return nil, lockErr
+		}
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"password": "Wrong user/password combination"},
+		}
+	}
+	if usr.FailedAttempts > 0 || usr.LockedUntil.Valid {
+		err = clearFailedAttempts(u.DB, usr.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if usr.TotpEnabledAt.Valid || perm.RequiresMFA(usr.Roles) {
+		step := auth.MFAStepVerify
+		if !usr.TotpEnabledAt.Valid {
+			step = auth.MFAStepEnroll
+		}
+		token, err := mfaChallenge(u.DB, usr.UserID, step, u.JWTConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &AuthResponse{UserWithDoctor: *usr, MFAStep: step, MFAToken: token}, nil
+	}
+
+	return signin(u.DB, *usr, device, u.JWTConfig)
+}
+
+var (
+	unknownHashOnce sync.Once
+	unknownHash     []byte
+)
+
+// unknownUserHash is compared against when the email has no account
+func unknownUserHash() []byte {
+	unknownHashOnce.Do(func() {
+		unknownHash, _ = auth.PasswordGen("unknown user")
+	})
+	return unknownHash
+}
+
+// signin opens a session for an authenticated user
+func signin(db *sqlx.DB, usr m.UserWithDoctor, device Device, cfg JWTConfig) (*AuthResponse, error) {
+	sess, refresh, err := createSession(db, usr.UserID, device, cfg.RefreshTillExpire)
 	if err != nil {
 		return nil, err
 	}
-	jwt, err := authenticate(*usr, password, u.JWTConfig)
+	jwt, err := authenticate(db, usr, sess.SessID, cfg)
 	if err != nil {
 		return nil, err
 	}
-	a = &AuthResponse{UserWithDoctor: *usr, Jwt: jwt}
+	return &AuthResponse{UserWithDoctor: usr, Jwt: jwt, RefreshToken: refresh, SessID: sess.SessID}, nil
+}
 
-	return a, err
+func authenticate(db service.DB, usr m.UserWithDoctor, sessID uuid.UUID, cfg JWTConfig) (jwttoken string, err error) {
+	return issueToken(db, usr, sessID, "", time.Now().Add(cfg.HoursTillExpire), cfg)
 }
 
-func authenticate(usr m.UserWithDoctor, password string, cfg JWTConfig) (jwttoken string, err error) {
-	// err = bcrypt.CompareHashAndPassword(usr.Password, []byte(password))
-	// if err != nil {
-	// 	return jwttoken, &auth.ValidationError{
-	// 		Messages: map[string]string{"password": "Wrong user/password combination"},
-	// 	}
-	// }
+// issueToken signs the access token of a session, actorID is set when an
+// admin impersonates the user
+func issueToken(db service.DB, usr m.UserWithDoctor, sessID uuid.UUID, actorID string, expiresAt time.Time, cfg JWTConfig) (string, error) {
+	key, err := userKey(db, usr.UserID)
+	if err != nil {
+		return "", err
+	}
 	doctID := ""
 	if usr.DoctID != nil {
 		doctID = usr.DoctID.String()
 	}
 
 	claims := auth.Claims{
-		InstID: "",
+		InstID: usr.InstID.String(),
 		UserID: usr.UserID.String(),
 		DoctID: doctID,
 		Email:  usr.Email,
+		SessID: sessID.String(),
+		// the API only allows changing the password until it is done, an
+		// admin impersonating the user can't change it
+		PasswordChange: usr.PasswordChangeRequired && len(actorID) == 0,
+		KeyFingerprint: auth.UserKeyFingerprint(key),
+		Actor:          actorID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(cfg.HoursTillExpire).UTC().Unix(),
+			IssuedAt:  time.Now().UTC().Unix(),
+			ExpiresAt: expiresAt.UTC().Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(cfg.SigningMethod, claims)
-	jwttoken, err = token.SignedString([]byte(cfg.Secret))
-
-	return jwttoken, err
+	return cfg.Keys.Sign(claims)
 }
 
 // PwdRecoverer is the service object to recover an User's password
@@ -92,11 +187,15 @@ type PwdRecoverer struct {
 // Run starts an User`s password reset flow
 func (p *PwdRecoverer) Run(email string) error {
 	u, err := fromEmail(p.DB, email)
+	if _, ok := errors.Cause(err).(*auth.UserNotFoundError); ok {
+		// answer as if it was sent, the route must not tell which emails have accounts
+		return nil
+	}
 	if err != nil {
 		return errors.Wrap(err, "Failed to retrieve user for email "+email)
 	}
 
-	ac, ver, err := newActConfirmation(u.UserID, vPwd)
+	ac, ver, err := newActConfirmation(u.InstID, u.UserID, vPwd)
 	if err != nil {
 		return errors.Wrap(err, "Failed to create action confirmation")
 	}
@@ -137,6 +236,19 @@ func (p *PwdRecoverer) Run(email string) error {
 type PwdReseter struct {
 	DB     *sqlx.DB
 	Mailer *mailer.Mailer
+	Policy auth.PasswordPolicy
+}
+
+// PasswordChanger service changes the password of the logged user
+type PasswordChanger struct {
+	DB        *sqlx.DB
+	JWTConfig JWTConfig
+	Policy    auth.PasswordPolicy
+}
+
+// PasswordChangeRequirer service makes an user change the password at next sign in
+type PasswordChangeRequirer struct {
+	DB *sqlx.DB
 }
 
 // Run resets an user's password
@@ -146,20 +258,39 @@ func (p *PwdReseter) Run(acveID, verification, password string) error {
 		return err
 	}
 
-	psrt, err := confirmationFromID(tx, acveID)
+	psrt, err := confirmationFromID(tx, acveID, vPwd)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
 	// validate verification
-	err = bcrypt.CompareHashAndPassword([]byte(psrt.Verification), []byte(verification))
+	ok, err := confirmationCheck(tx, &psrt, verification)
 	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !ok {
+		err = tx.Commit()
+		if err != nil {
+			return errors.Wrap(err, "Failed to commit verification attempt")
+		}
 		return &auth.ValidationError{
 			Messages: map[string]string{"verification": "Invalid verification id"},
 		}
 	}
 
 	// update user password
+	usr, err := fromID(tx, psrt.UserID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = p.Policy.Check(password, usr.Email)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 	passHash, err := auth.PasswordGen(password)
 	if err != nil {
 		tx.Rollback()
@@ -178,6 +309,13 @@ func (p *PwdReseter) Run(acveID, verification, password string) error {
 		return errors.Wrap(err, "Failed to update user password")
 	}
 
+	// sessions opened with the old password are no longer trusted
+	err = revokeSessions(tx, sq.Eq{"user_id": psrt.UserID})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return errors.Wrap(err, "Failed to commit password reset")
@@ -191,9 +329,97 @@ func (p *PwdReseter) Run(acveID, verification, password string) error {
 	return nil
 }
 
+// Run checks the current password and sets the new one, the other sessions
+// of the user are revoked and a new access token is issued for this one
+func (p *PasswordChanger) Run(userID, sessID uuid.UUID, current, password string) (*AuthResponse, error) {
+	tx, err := p.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	usr, err := fromID(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword(usr.Password, []byte(current)) != nil {
+		tx.Rollback()
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"currentPassword": "Wrong current password"},
+		}
+	}
+	if bcrypt.CompareHashAndPassword(usr.Password, []byte(password)) == nil {
+		tx.Rollback()
+		return nil, &auth.WeakPasswordError{
+			Messages: map[string]string{"reused": "New password must differ from the current one"},
+		}
+	}
+	err = p.Policy.Check(password, usr.Email)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	passHash, err := auth.PasswordGen(password)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = updatePassword(tx, userID, passHash)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = revokeSessions(tx, sq.And{
+		sq.Eq{"user_id": userID},
+		sq.NotEq{"sess_id": sessID},
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit password change")
+	}
+
+	uwd, err := withDoctorFromID(p.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	jwt, err := authenticate(p.DB, *uwd, sessID, p.JWTConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResponse{UserWithDoctor: *uwd, Jwt: jwt, SessID: sessID}, nil
+}
+
+// Run flags the user, its tokens carry the flag from the next sign in or refresh
+func (r *PasswordChangeRequirer) Run(instID, userID uuid.UUID) (*m.User, error) {
+	u := m.User{}
+	query := psql.Update(`"user"`).
+		Set("password_change_required", true).
+		Where(sq.Eq{"user_id": userID, "inst_id": instID}).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating require password change sql")
+	}
+	err = r.DB.Get(&u, qSQL, args...)
+	if err == sql.ErrNoRows {
+		return nil, &auth.UserNotFoundError{Message: "No User with id: " + userID.String()}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error requiring password change")
+	}
+	return &u, nil
+}
+
+// updatePassword sets the password, which also fulfills a required change
 func updatePassword(tx *sqlx.Tx, userID uuid.UUID, pass []byte) error {
 	query := psql.Update(`"user"`).
 		Set("password", pass).
+		Set("password_change_required", false).
+		Set("password_changed_at", time.Now()).
 		Where(sq.Eq{"user_id": userID})
 
 	qSQL, args, err := query.ToSql()
@@ -205,5 +431,6 @@ func updatePassword(tx *sqlx.Tx, userID uuid.UUID, pass []byte) error {
 	if err != nil {
 		return errors.Wrap(err, "Error updating user password")
 	}
-	return nil
+	// tokens issued with the old password stop working
+	return rotateUserKey(tx, userID)
 }
@@ -1,10 +1,74 @@
 package auth
 
 import (
+	"fmt"
+	"strings"
+	"unicode"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// PasswordPolicy holds the rules a new password must follow
+type PasswordPolicy struct {
+	MinLength int
+	// MinClasses is how many of lower case, upper case, digits and symbols
+	// the password must mix
+	MinClasses int
+}
+
 // PasswordGen generates the password hash
 func PasswordGen(pass string) ([]byte, error) {
 	return bcrypt.GenerateFromPassword([]byte(pass), 12)
 }
+
+// Check validates a new password of the user with email
+func (p PasswordPolicy) Check(pass, email string) error {
+	msgs := map[string]string{}
+	if len([]rune(pass)) < p.MinLength {
+		msgs["minLength"] = fmt.Sprintf("Password must have at least %d characters", p.MinLength)
+	}
+	if passwordClasses(pass) < p.MinClasses {
+		msgs["classes"] = fmt.Sprintf("Password must mix at least %d of lower case, upper case, digits and symbols", p.MinClasses)
+	}
+	if containsEmail(pass, email) {
+		msgs["email"] = "Password cannot contain the email"
+	}
+	if len(msgs) > 0 {
+		return &WeakPasswordError{Messages: msgs}
+	}
+	return nil
+}
+
+func passwordClasses(pass string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range pass {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// containsEmail checks the password holds the email or its local part
+func containsEmail(pass, email string) bool {
+	pass = strings.ToLower(pass)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) == 0 {
+		return false
+	}
+	if strings.Contains(pass, email) {
+		return true
+	}
+	local := email
+	if i := strings.Index(email, "@"); i >= 0 {
+		local = email[:i]
+	}
+	return len(local) >= 3 && strings.Contains(pass, local)
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	p := PasswordPolicy{MinLength: 10, MinClasses: 3}
+	cases := []struct {
+		pass  string
+		email string
+		fails []string
+	}{
+		{"Corr3ct-horse", "ana@example.com", nil},
+		{"Sh0rt!", "ana@example.com", []string{"minLength"}},
+		{"alllowercaseletters", "ana@example.com", []string{"classes"}},
+		{"Mariana-2020", "mariana@example.com", []string{"email"}},
+		{"X1-ANA@EXAMPLE.COM", "ana@example.com", []string{"email"}},
+		{"ab", "", []string{"minLength", "classes"}},
+	}
+	for _, c := range cases {
+		err := p.Check(c.pass, c.email)
+		if len(c.fails) == 0 {
+			if err != nil {
+				t.Errorf("Check(%q) = %v, want nil", c.pass, err)
+			}
+			continue
+		}
+		e, ok := errors.Cause(err).(*WeakPasswordError)
+		if !ok {
+			t.Fatalf("Check(%q) = %v, want WeakPasswordError", c.pass, err)
+		}
+		if len(e.Messages) != len(c.fails) {
+			t.Errorf("Check(%q) failed %v, want %v", c.pass, e.Messages, c.fails)
+		}
+		for _, f := range c.fails {
+			if _, ok := e.Messages[f]; !ok {
+				t.Errorf("Check(%q) didn't fail %s", c.pass, f)
+			}
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+
 	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 	"strings"
@@ -28,12 +31,60 @@ type Claims struct {
 	UserID      string      `json:"userID"`
 	DoctID      string      `json:"doctID"`
 	Email       string      `json:"email"`
+	SessID      string      `json:"sessID"`
 	Permissions Permissions `json:"permissions"`
+	// PasswordChange is set while the user must change the password
+	PasswordChange bool `json:"pwdChange,omitempty"`
+	// KeyFingerprint is the fingerprint of the user key the token was issued with
+	KeyFingerprint string `json:"ukf"`
+	// Actor is the admin impersonating the user, empty on the user's own tokens
+	Actor string `json:"actor,omitempty"`
 	jwt.StandardClaims
 }
 
-// Valid implement jwt.Claims
+// Valid implement jwt.Claims, checks the token time window and that
+// it was issued for an user session
 func (c Claims) Valid() error {
+	if err := c.StandardClaims.Valid(); err != nil {
+		return err
+	}
+	if c.ExpiresAt == 0 {
+		return errors.New("Token has no expiration")
+	}
+	if len(c.UserID) == 0 || len(c.SessID) == 0 {
+		return errors.New("Token has no user session")
+	}
+	return nil
+}
+
+// Two step sign in stages carried by MFAClaims
+const (
+	// MFAStepVerify the user must send a TOTP or recovery code
+	MFAStepVerify = "verify"
+	// MFAStepEnroll the user must enrol a TOTP device before signing in
+	MFAStepEnroll = "enroll"
+)
+
+// MFAClaims is the claims of the short lived token issued after the password
+// is checked and before the second factor is
+type MFAClaims struct {
+	UserID         string `json:"userID"`
+	Step           string `json:"mfaStep"`
+	KeyFingerprint string `json:"ukf"`
+	jwt.StandardClaims
+}
+
+// Valid implement jwt.Claims
+func (c MFAClaims) Valid() error {
+	if err := c.StandardClaims.Valid(); err != nil {
+		return err
+	}
+	if c.ExpiresAt == 0 || len(c.UserID) == 0 {
+		return errors.New("Invalid two factor token")
+	}
+	if c.Step != MFAStepVerify && c.Step != MFAStepEnroll {
+		return errors.New("Invalid two factor step")
+	}
 	return nil
 }
 
@@ -98,3 +149,10 @@ func FromUnknown(i interface{}) (c Claims, err error) {
 
 	return
 }
+
+// UserKeyFingerprint identifies the key secret of an user without revealing
+// it, the tokens of the user carry it and stop verifying once the key is rotated
+func UserKeyFingerprint(userKey []byte) string {
+	sum := sha256.Sum256(userKey)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 // ValidationError is an error for when a table entry isn't valid
 type ValidationError struct {
 	Messages map[string]string
@@ -15,6 +17,32 @@ type PwdResetInvalidError struct {
 	Message string
 }
 
+// AccountLockedError is an error for when an user account is locked after too many failed sign ins
+type AccountLockedError struct {
+	Message string
+	Until   time.Time
+}
+
+// SessionInvalidError is an error for when a session or refresh token can't be used
+type SessionInvalidError struct {
+	Message string
+}
+
+// InvitationInvalidError is an error for when an invitation is not pending, expired or the link is wrong
+type InvitationInvalidError struct {
+	Message string
+}
+
+// DeviceKeyInvalidError is an error for when a device key is unknown, revoked or not allowed for a room
+type DeviceKeyInvalidError struct {
+	Message string
+}
+
+// WeakPasswordError is an error for when a new password doesn't follow the password policy
+type WeakPasswordError struct {
+	Messages map[string]string
+}
+
 func (e ValidationError) Error() (stringy string) {
 	for _, v := range e.Messages {
 		stringy += v + "\r\n"
@@ -29,3 +57,26 @@ func (e UserNotFoundError) Error() string {
 func (e PwdResetInvalidError) Error() string {
 	return e.Message
 }
+
+func (e AccountLockedError) Error() string {
+	return e.Message
+}
+
+func (e SessionInvalidError) Error() string {
+	return e.Message
+}
+
+func (e InvitationInvalidError) Error() string {
+	return e.Message
+}
+
+func (e DeviceKeyInvalidError) Error() string {
+	return e.Message
+}
+
+func (e WeakPasswordError) Error() (stringy string) {
+	for _, v := range e.Messages {
+		stringy += v + "\r\n"
+	}
+	return
+}
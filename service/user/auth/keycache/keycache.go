@@ -1,25 +1,76 @@
 package keycache
 
 import (
-	"errors"
+	"sync"
+
+	"github.com/pkg/errors"
 )
 
-var keyCache map[string][]byte = map[string][]byte{}
+// Channel is the postgres channel key rotations are notified on, the payload
+// is the user id
+const Channel = "keycache_invalidate"
+
+// KeyCache holds the key secret of each user, loaded on first use and
+// dropped when the key is rotated
+type KeyCache struct {
+	GetUserKey func(userID string) ([]byte, error)
+
+	mu   sync.RWMutex
+	keys map[string][]byte
+	// gen changes on every invalidation, a key loaded before one isn't cached
+	gen uint64
+}
+
+// New creates a KeyCache that loads missing keys with getUserKey
+func New(getUserKey func(userID string) ([]byte, error)) *KeyCache {
+	return &KeyCache{GetUserKey: getUserKey, keys: map[string][]byte{}}
+}
 
-func GetUserKey(uuid string) ([]byte, error) {
-	if val, ok := keyCache[uuid]; ok {
-		return val, nil
+// Get returns an user's key secret
+func (k *KeyCache) Get(userID string) ([]byte, error) {
+	k.mu.RLock()
+	key, ok := k.keys[userID]
+	gen := k.gen
+	k.mu.RUnlock()
+	if ok {
+		return key, nil
 	}
 
-	return nil, errors.New("User has no cached key")
+	key, err := k.GetUserKey(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't GetUserKey for "+userID)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("User has no key: " + userID)
+	}
+	k.mu.Lock()
+	if k.keys == nil {
+		k.keys = map[string][]byte{}
+	}
+	if k.gen == gen {
+		k.keys[userID] = key
+	}
+	k.mu.Unlock()
+	return key, nil
 }
 
-func SetUserKey(uuid string, key []byte) error {
-	keyCache[uuid] = key
+// Invalidate drops an user's key, the next Get reloads it
+func (k *KeyCache) Invalidate(userID string) {
+	k.mu.Lock()
+	delete(k.keys, userID)
+	k.gen++
+	k.mu.Unlock()
+}
 
-	return nil
+// InvalidateAll drops every cached key
+func (k *KeyCache) InvalidateAll() {
+	k.mu.Lock()
+	k.keys = map[string][]byte{}
+	k.gen++
+	k.mu.Unlock()
 }
 
-func Cache() map[string][]byte {
-	return keyCache
+// HandleNotification drops the key of the user in the payload of a Channel notification
+func (k *KeyCache) HandleNotification(payload string) {
+	k.Invalidate(payload)
 }
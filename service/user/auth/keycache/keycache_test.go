@@ -0,0 +1,63 @@
+package keycache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestGetCachesUntilNotified(t *testing.T) {
+	calls := map[string]int{}
+	kc := New(func(userID string) ([]byte, error) {
+		calls[userID]++
+		return []byte(userID + strconv.Itoa(calls[userID])), nil
+	})
+	for _, u := range []string{"a", "b", "a", "b"} {
+		if _, err := kc.Get(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls["a"] != 1 || calls["b"] != 1 {
+		t.Fatalf("keys should be cached, got %v", calls)
+	}
+
+	kc.HandleNotification("a")
+	key, err := kc.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "a2" {
+		t.Fatalf("rotated key should be reloaded, got %q", key)
+	}
+	if _, err := kc.Get("b"); err != nil || calls["b"] != 1 {
+		t.Fatalf("other users keep their key, got %v", calls)
+	}
+}
+
+func TestGetRejectsEmptyKey(t *testing.T) {
+	kc := New(func(userID string) ([]byte, error) { return nil, nil })
+	if _, err := kc.Get("a"); err == nil {
+		t.Fatal("an empty key must not be used")
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	kc := New(func(userID string) ([]byte, error) { return []byte("k"), nil })
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := strconv.Itoa(i % 3)
+			for j := 0; j < 100; j++ {
+				if _, err := kc.Get(u); err != nil {
+					t.Error(err)
+				}
+				if j%10 == 0 {
+					kc.Invalidate(u)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
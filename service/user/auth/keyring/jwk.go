@@ -0,0 +1,115 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// JWK is the public part of a signing key, RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP curve and public key
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document other services verify the tokens with
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK returns the JWK of a public key
+func PublicJWK(alg string, pub crypto.PublicKey) (JWK, error) {
+	enc := base64.RawURLEncoding
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: alg,
+			N:   enc.EncodeToString(p.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(p.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Alg: alg,
+			Crv: "Ed25519",
+			X:   enc.EncodeToString(p),
+		}, nil
+	}
+	return JWK{}, errors.Errorf("Unsupported public key type %T", pub)
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of the public key, used as kid
+func Thumbprint(alg string, pub crypto.PublicKey) (string, error) {
+	jwk, err := PublicJWK(alg, pub)
+	if err != nil {
+		return "", err
+	}
+	// only the required members, in lexicographic order
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKS returns the public keys still verifying tokens, the current one first
+func (k *Keyring) JWKS() (JWKSet, error) {
+	k.mu.RLock()
+	keys := make([]Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	current := k.current
+	k.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i].KID == current) != (keys[j].KID == current) {
+			return keys[i].KID == current
+		}
+		return keys[i].ExpiresAt.After(keys[j].ExpiresAt)
+	})
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range keys {
+		jwk, err := PublicJWK(key.Alg, key.Private.Public())
+		if err != nil {
+			return set, err
+		}
+		jwk.Kid = key.KID
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
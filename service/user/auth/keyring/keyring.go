@@ -0,0 +1,160 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// Channel is the postgres channel new and retired signing keys are notified on
+const Channel = "keyring_reload"
+
+// Algorithms the tokens can be signed with
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// reloadAfter is how long an unknown kid waits to trigger another reload, a
+// key created by another instance may not have been notified yet
+const reloadAfter = 10 * time.Second
+
+// Key is a signing key, the newest one not retired signs the new tokens and
+// every one verifies until it expires
+type Key struct {
+	KID     string
+	Alg     string
+	Private crypto.Signer
+	// Retired keys no longer sign, they verify the tokens they signed
+	Retired bool
+	// ExpiresAt is when the key stops verifying, zero while it's current
+	ExpiresAt time.Time
+}
+
+// Keyring holds the signing keys, loaded from the store and reloaded when
+// notified on Channel
+type Keyring struct {
+	Load func() ([]Key, error)
+
+	mu       sync.RWMutex
+	keys     map[string]Key
+	current  string
+	loadedAt time.Time
+}
+
+// New creates a Keyring that loads the keys with load
+func New(load func() ([]Key, error)) *Keyring {
+	return &Keyring{Load: load, keys: map[string]Key{}}
+}
+
+// Generate creates a private key for alg
+func Generate(alg string) (crypto.Signer, error) {
+	switch alg {
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	return nil, errors.New("Unsupported signing algorithm: " + alg)
+}
+
+// Method returns the jwt signing method of alg
+func Method(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgEdDSA:
+		return SigningMethodEdDSA, nil
+	}
+	return nil, errors.New("Unsupported signing algorithm: " + alg)
+}
+
+// Reload replaces the keys with the ones the store has
+func (k *Keyring) Reload() error {
+	keys, err := k.Load()
+	if err != nil {
+		return errors.Wrap(err, "Couldn't load signing keys")
+	}
+	byKID := map[string]Key{}
+	current := ""
+	// the keys come oldest first, the last one not retired is the current
+	for _, key := range keys {
+		byKID[key.KID] = key
+		if !key.Retired {
+			current = key.KID
+		}
+	}
+	k.mu.Lock()
+	k.keys = byKID
+	k.current = current
+	k.loadedAt = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// HandleNotification reloads the keys when a Channel notification arrives
+func (k *Keyring) HandleNotification(payload string) error {
+	return k.Reload()
+}
+
+// Sign signs claims with the current key, its kid goes in the token header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key, ok := k.keys[k.current]
+	k.mu.RUnlock()
+	if !ok {
+		return "", errors.New("No signing key available")
+	}
+	method, err := Method(key.Alg)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc implements jwt.Keyfunc, it returns the public key of the kid in the
+// token header when the token is signed with the algorithm of the key
+func (k *Keyring) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if len(kid) == 0 {
+		return nil, errors.New("Token has no kid")
+	}
+	key, ok := k.get(kid)
+	if !ok {
+		return nil, errors.New("Unknown signing key: " + kid)
+	}
+	if t.Method.Alg() != key.Alg {
+		return nil, errors.Errorf("Unexpected jwt signing method=%v", t.Header["alg"])
+	}
+	if !key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt) {
+		return nil, errors.New("Signing key expired: " + kid)
+	}
+	return key.Private.Public(), nil
+}
+
+/* get returns the key with kid, reloading once in a while when it's unknown */
+func (k *Keyring) get(kid string) (Key, bool) {
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	stale := time.Since(k.loadedAt) > reloadAfter
+	k.mu.RUnlock()
+	if ok || !stale {
+		return key, ok
+	}
+	if err := k.Reload(); err != nil {
+		return key, false
+	}
+	k.mu.RLock()
+	key, ok = k.keys[kid]
+	k.mu.RUnlock()
+	return key, ok
+}
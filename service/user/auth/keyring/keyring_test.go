@@ -0,0 +1,188 @@
+package keyring
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func newKey(t *testing.T, alg string) Key {
+	priv, err := Generate(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, err := Thumbprint(alg, priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Key{KID: kid, Alg: alg, Private: priv}
+}
+
+func newKeyring(t *testing.T, keys *[]Key) *Keyring {
+	kr := New(func() ([]Key, error) { return *keys, nil })
+	if err := kr.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func claims() jwt.StandardClaims {
+	return jwt.StandardClaims{Subject: "user", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		keys := []Key{newKey(t, alg)}
+		kr := newKeyring(t, &keys)
+		signed, err := kr.Sign(claims())
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		token, err := jwt.ParseWithClaims(signed, &jwt.StandardClaims{}, kr.Keyfunc)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if token.Header["kid"] != keys[0].KID || token.Header["alg"] != alg {
+			t.Fatalf("%s: unexpected header %v", alg, token.Header)
+		}
+	}
+}
+
+func TestRotatedKeyStillVerifies(t *testing.T) {
+	old := newKey(t, AlgRS256)
+	keys := []Key{old}
+	kr := newKeyring(t, &keys)
+	before, err := kr.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old.Retired = true
+	old.ExpiresAt = time.Now().Add(time.Hour)
+	keys = []Key{old, newKey(t, AlgEdDSA)}
+	if err := kr.HandleNotification(""); err != nil {
+		t.Fatal(err)
+	}
+	after, err := kr.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Parse(after, kr.Keyfunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != keys[1].KID {
+		t.Fatalf("new tokens should be signed with the current key, got %v", token.Header["kid"])
+	}
+	if _, err := jwt.Parse(before, kr.Keyfunc); err != nil {
+		t.Fatalf("retired key should verify until it expires: %v", err)
+	}
+
+	keys[0].ExpiresAt = time.Now().Add(-time.Second)
+	if err := kr.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(before, kr.Keyfunc); err == nil {
+		t.Fatal("expired key must not verify")
+	}
+}
+
+func TestKeyfuncRejectsOtherAlgorithms(t *testing.T) {
+	keys := []Key{newKey(t, AlgRS256)}
+	kr := newKeyring(t, &keys)
+
+	// an HMAC token keyed with the public key must not pass as the RSA key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	token.Header["kid"] = keys[0].KID
+	pub := keys[0].Private.Public().(*rsa.PublicKey)
+	signed, err := token.SignedString(pub.N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(signed, kr.Keyfunc); err == nil {
+		t.Fatal("token with another algorithm must be rejected")
+	}
+
+	token = jwt.NewWithClaims(jwt.SigningMethodRS256, claims())
+	signed, err = token.SignedString(keys[0].Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(signed, kr.Keyfunc); err == nil {
+		t.Fatal("token without kid must be rejected")
+	}
+}
+
+func TestSignWithoutKeys(t *testing.T) {
+	keys := []Key{}
+	kr := newKeyring(t, &keys)
+	if _, err := kr.Sign(claims()); err == nil {
+		t.Fatal("signing without a current key must fail")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	retired := newKey(t, AlgRS256)
+	retired.Retired = true
+	retired.ExpiresAt = time.Now().Add(time.Hour)
+	keys := []Key{retired, newKey(t, AlgEdDSA)}
+	kr := newKeyring(t, &keys)
+
+	set, err := kr.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(set.Keys))
+	}
+	cur, old := set.Keys[0], set.Keys[1]
+	if cur.Kid != keys[1].KID || cur.Kty != "OKP" || cur.Crv != "Ed25519" || len(cur.X) == 0 {
+		t.Fatalf("unexpected current key %+v", cur)
+	}
+	if old.Kid != retired.KID || old.Kty != "RSA" || old.E != "AQAB" || len(old.N) == 0 {
+		t.Fatalf("unexpected retired key %+v", old)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 7638 section 3.1 example
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, err := Thumbprint(AlgRS256, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("unexpected thumbprint %s", kid)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		key := newKey(t, alg)
+		sealed, err := Seal("secret", key.Private)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		priv, err := Open("secret", sealed)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		kid, err := Thumbprint(alg, priv.Public())
+		if err != nil || kid != key.KID {
+			t.Fatalf("%s: opened another key %s", alg, kid)
+		}
+		if _, err := Open("other", sealed); err == nil {
+			t.Fatalf("%s: opened with the wrong secret", alg)
+		}
+	}
+	if _, err := Seal("", newKey(t, AlgEdDSA).Private); err == nil {
+		t.Fatal("sealing without a secret must fail")
+	}
+}
@@ -0,0 +1,68 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// Seal encrypts a private key with the server secret to be stored
+func Seal(secret string, priv crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't marshal signing key")
+	}
+	gcm, err := sealer(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't generate nonce")
+	}
+	return gcm.Seal(nonce, nonce, der, nil), nil
+}
+
+// Open decrypts a private key sealed with Seal
+func Open(secret string, sealed []byte) (crypto.Signer, error) {
+	gcm, err := sealer(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("Sealed signing key too short")
+	}
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	der, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open signing key, wrong secret?")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't parse signing key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("Unsupported signing key type %T", key)
+	}
+	return signer, nil
+}
+
+/* AES-GCM keyed with the hash of the secret */
+func sealer(secret string) (cipher.AEAD, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("A secret is required to seal signing keys")
+	}
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
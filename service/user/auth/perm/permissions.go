@@ -9,4 +9,102 @@ var (
 	Config        = "config"
 	StockManager  = "stock_manager"
 	User          = "user"
+	SuperAdmin    = "superadmin"
 )
+
+// MFARequired are the permissions whose users must sign in with a second factor
+var MFARequired = []string{Admin, Secretary, Config}
+
+// RequiresMFA checks if any of the roles makes two factor authentication mandatory
+func RequiresMFA(roles []string) bool {
+	for _, r := range roles {
+		for _, p := range MFARequired {
+			if r == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Granular permissions, in the form resource:action:scope. Roles are mapped
+// to them in the role_permission table, the :own scope is limited to the
+// data of the signed in user or doctor
+var (
+	UserReadAny         = "user:read:any"
+	UserReadOwn         = "user:read:own"
+	UserWriteAny        = "user:write:any"
+	UserWriteOwn        = "user:write:own"
+	UserImpersonate     = "user:impersonate:any"
+	DoctorReadAny       = "doctor:read:any"
+	DoctorReadOwn       = "doctor:read:own"
+	DoctorWriteAny      = "doctor:write:any"
+	DoctorWriteOwn      = "doctor:write:own"
+	ScheduleReadAny     = "schedule:read:any"
+	ScheduleReadOwn     = "schedule:read:own"
+	ScheduleWriteAny    = "schedule:write:any"
+	ScheduleWriteOwn    = "schedule:write:own"
+	ScheduleRebalance   = "schedule:rebalance:any"
+	ScheduleApprove     = "schedule:approve:any"
+	ScheduleCheckIn     = "schedule:checkin:any"
+	ClosureRead         = "closure:read:any"
+	ClosureWrite        = "closure:write:any"
+	AppointmentReadAny  = "appointment:read:any"
+	AppointmentReadOwn  = "appointment:read:own"
+	AppointmentWriteAny = "appointment:write:any"
+	AppointmentWriteOwn = "appointment:write:own"
+	PatientReadAny      = "patient:read:any"
+	PatientReadOwn      = "patient:read:own"
+	PatientWriteAny     = "patient:write:any"
+	PatientWriteOwn     = "patient:write:own"
+	DashboardReadAny    = "dashboard:read:any"
+	DashboardReadOwn    = "dashboard:read:own"
+	RoomRead            = "room:read:any"
+	RoomWrite           = "room:write:any"
+	SpecialtyRead       = "specialty:read:any"
+	SpecialtyWrite      = "specialty:write:any"
+	ConfigRead          = "config:read:any"
+	ConfigWrite         = "config:write:any"
+	VerificationRead    = "verification:read:any"
+	VerificationWrite   = "verification:write:any"
+	InvitationWrite     = "invitation:write:any"
+	OutdoorRead         = "outdoor:read:any"
+	RoleRead            = "role:read:any"
+	RoleWrite           = "role:write:any"
+	DeviceRead          = "device:read:any"
+	DeviceWrite         = "device:write:any"
+	AuditRead           = "audit:read:any"
+	InstitutionRead     = "institution:read:any"
+	InstitutionWrite    = "institution:write:any"
+)
+
+// All are the granular permissions a role can be given
+var All = []string{
+	UserReadAny, UserReadOwn, UserWriteAny, UserWriteOwn, UserImpersonate,
+	DoctorReadAny, DoctorReadOwn, DoctorWriteAny, DoctorWriteOwn,
+	ScheduleReadAny, ScheduleReadOwn, ScheduleWriteAny, ScheduleWriteOwn, ScheduleRebalance, ScheduleApprove, ScheduleCheckIn,
+	ClosureRead, ClosureWrite,
+	AppointmentReadAny, AppointmentReadOwn, AppointmentWriteAny, AppointmentWriteOwn,
+	PatientReadAny, PatientReadOwn, PatientWriteAny, PatientWriteOwn,
+	DashboardReadAny, DashboardReadOwn,
+	RoomRead, RoomWrite,
+	SpecialtyRead, SpecialtyWrite,
+	ConfigRead, ConfigWrite,
+	VerificationRead, VerificationWrite,
+	InvitationWrite,
+	OutdoorRead,
+	RoleRead, RoleWrite,
+	DeviceRead, DeviceWrite,
+	AuditRead,
+	InstitutionRead, InstitutionWrite,
+}
+
+// Known checks if p is one of the granular permissions
+func Known(p string) bool {
+	for _, k := range All {
+		if k == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/rolecache"
+)
+
+// Owner tells if the request targets data of the signed in user
+type Owner func(c echo.Context, claims *auth.Claims) bool
+
+// Guard checks the permissions each route declares, against the
+// permissions the role cache resolves for the signed in user
+type Guard struct {
+	Roles  *rolecache.RoleCache
+	Config JWTConfig
+	// Denied writes the response when a permission is missing
+	Denied echo.HandlerFunc
+}
+
+// Require lets the request through if the user has any of the permissions
+func (g *Guard) Require(perms ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			_, p, err := g.permissions(c)
+			if err != nil {
+				return err
+			}
+			for _, r := range perms {
+				if p.Can(r) {
+					return next(c)
+				}
+			}
+			return g.Denied(c)
+		}
+	}
+}
+
+// RequireOwn lets the request through with anyPerm, or with ownPerm when
+// owner tells the data belongs to the user
+func (g *Guard) RequireOwn(anyPerm, ownPerm string, owner Owner) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, p, err := g.permissions(c)
+			if err != nil {
+				return err
+			}
+			if p.Can(anyPerm) || (p.Can(ownPerm) && owner(c, claims)) {
+				return next(c)
+			}
+			return g.Denied(c)
+		}
+	}
+}
+
+func (g *Guard) permissions(c echo.Context) (*auth.Claims, auth.Permissions, error) {
+	claims, err := auth.Extract(c.Get(g.Config.TokenCtxKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := g.Roles.GetRoles(claims.UserID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error retrieving roles for user "+claims.UserID)
+	}
+	return claims, auth.Permissions(r), nil
+}
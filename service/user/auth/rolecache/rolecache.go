@@ -2,14 +2,26 @@ package rolecache
 
 import (
 	"encoding/json"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/tidwall/buntdb"
 )
 
+// Channel is the postgres channel role changes are notified on, the payload
+// is the user id or AllUsers
+const Channel = "rolecache_invalidate"
+
+// AllUsers is the payload that drops the roles of every user
+const AllUsers = "*"
+
 // RoleCache is a cache for user roles
 type RoleCache struct {
 	GetUserRoles func(userID string) ([]string, error)
 	DB           *buntdb.DB
+	// TTL bounds how long roles are cached in case a notification is
+	// missed, zero keeps them until invalidated
+	TTL time.Duration
 }
 
 func makeKey(userID string) string {
@@ -70,9 +82,28 @@ func (r *RoleCache) updateRoles(userID string, roles []string) error {
 	}
 
 	err = r.DB.Update(func(tx *buntdb.Tx) error {
-		_, _, err := tx.Set(key, string(byteVal), nil)
+		var opts *buntdb.SetOptions
+		if r.TTL > 0 {
+			opts = &buntdb.SetOptions{Expires: true, TTL: r.TTL}
+		}
+		_, _, err := tx.Set(key, string(byteVal), opts)
 		return err
 	})
 
 	return err
 }
+
+// InvalidateAll drops every cached entry, used when the permissions of a role change
+func (r *RoleCache) InvalidateAll() error {
+	return r.DB.Update(func(tx *buntdb.Tx) error {
+		return tx.DeleteAll()
+	})
+}
+
+// HandleNotification invalidates the user in the payload of a Channel notification
+func (r *RoleCache) HandleNotification(payload string) error {
+	if payload == AllUsers {
+		return r.InvalidateAll()
+	}
+	return r.Invalidate(payload)
+}
@@ -0,0 +1,70 @@
+package rolecache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func newCache(t *testing.T, ttl time.Duration, calls map[string]int) *RoleCache {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &RoleCache{
+		DB:  db,
+		TTL: ttl,
+		GetUserRoles: func(userID string) ([]string, error) {
+			calls[userID]++
+			return []string{"admin"}, nil
+		},
+	}
+}
+
+func TestHandleNotification(t *testing.T) {
+	calls := map[string]int{}
+	rc := newCache(t, 0, calls)
+	for _, u := range []string{"a", "b", "a", "b"} {
+		if _, err := rc.GetRoles(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls["a"] != 1 || calls["b"] != 1 {
+		t.Fatalf("roles should be cached, got %v", calls)
+	}
+
+	if err := rc.HandleNotification("a"); err != nil {
+		t.Fatal(err)
+	}
+	rc.GetRoles("a")
+	rc.GetRoles("b")
+	if calls["a"] != 2 || calls["b"] != 1 {
+		t.Fatalf("only a should be invalidated, got %v", calls)
+	}
+
+	if err := rc.HandleNotification(AllUsers); err != nil {
+		t.Fatal(err)
+	}
+	rc.GetRoles("a")
+	rc.GetRoles("b")
+	if calls["a"] != 3 || calls["b"] != 2 {
+		t.Fatalf("every user should be invalidated, got %v", calls)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	calls := map[string]int{}
+	rc := newCache(t, 50*time.Millisecond, calls)
+	rc.GetRoles("a")
+	rc.GetRoles("a")
+	if calls["a"] != 1 {
+		t.Fatalf("roles should be cached, got %d calls", calls["a"])
+	}
+	time.Sleep(100 * time.Millisecond)
+	rc.GetRoles("a")
+	if calls["a"] != 2 {
+		t.Fatalf("roles should expire, got %d calls", calls["a"])
+	}
+}
@@ -0,0 +1,116 @@
+// Package totp implements time-based one-time passwords (RFC 6238) compatible
+// with the common authenticator apps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is the time step of a code
+	Period = 30
+	// Digits is the length of a code
+	Digits = 6
+	// Skew is the number of steps before and after the current one that are accepted
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random base32 encoded secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URI returns the otpauth provisioning uri, usually shown as a QR code
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", "6")
+	v.Set("period", "30")
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// Code returns the code for the secret at the given time
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, Counter(t), Digits), nil
+}
+
+// Counter returns the time step of t
+func Counter(t time.Time) uint64 {
+	return uint64(t.Unix() / Period)
+}
+
+// Validate checks the code against the secret at the given time, allowing for
+// clock drift. It returns the matched counter so callers can reject a replay.
+func Validate(secret, passcode string, t time.Time) (uint64, bool) {
+	passcode = strings.TrimSpace(passcode)
+	if len(passcode) != Digits {
+		return 0, false
+	}
+	key, err := decode(secret)
+	if err != nil {
+		return 0, false
+	}
+	counter := Counter(t)
+	for i := -Skew; i <= Skew; i++ {
+		c := uint64(int64(counter) + int64(i))
+		if hmac.Equal([]byte(code(key, c, Digits)), []byte(passcode)) {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+func decode(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	return encoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// code is the HOTP value (RFC 4226) for the counter
+func code(key []byte, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	s := make([]byte, digits)
+	value = value % mod
+	for i := digits - 1; i >= 0; i-- {
+		s[i] = byte('0' + value%10)
+		value /= 10
+	}
+	return string(s)
+}
@@ -0,0 +1,53 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 vectors
+func TestCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		got := code(key, Counter(time.Unix(v.unix, 0)), 8)
+		if got != v.code {
+			t.Errorf("code at %d, expected %s got %s", v.unix, v.code, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	c, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := Validate(secret, c, now); !ok {
+		t.Errorf("expected current code to be valid")
+	}
+	if _, ok := Validate(secret, c, now.Add(Period*time.Second)); !ok {
+		t.Errorf("expected code from previous step to be valid")
+	}
+	if _, ok := Validate(secret, c, now.Add(3*Period*time.Second)); ok {
+		t.Errorf("expected code outside the skew window to be invalid")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Errorf("expected short code to be invalid")
+	}
+}
@@ -0,0 +1,228 @@
+package user
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// how often last_used_at is written for a key in use, displays poll often
+const deviceKeyUsageInterval = time.Minute
+
+// DeviceKeyCreator service creates an API key for a room display
+type DeviceKeyCreator struct {
+	DB *sqlx.DB
+}
+
+// DeviceKeyRotator service replaces the key of a device, the old one stops working
+type DeviceKeyRotator struct {
+	DB *sqlx.DB
+}
+
+// DeviceKeyRevoker service disables a device key
+type DeviceKeyRevoker struct {
+	DB *sqlx.DB
+}
+
+// DeviceKeyLister service lists the device keys
+type DeviceKeyLister struct {
+	DB *sqlx.DB
+}
+
+// DeviceKeyChecker service checks a device key and records its use
+type DeviceKeyChecker struct {
+	DB *sqlx.DB
+}
+
+// Run creates the key bound to the rooms, the key is only returned here and on rotation
+func (c *DeviceKeyCreator) Run(instID uuid.UUID, k *m.DeviceKey, actorID uuid.UUID) (*m.DeviceKeySecret, error) {
+	k.Name = strings.TrimSpace(k.Name)
+	if len(k.Name) == 0 {
+		return nil, &auth.ValidationError{Messages: map[string]string{
+			"name": "Name cannot be empty",
+		}}
+	}
+	err := checkRooms(c.DB, instID, k.RoomIDs)
+	if err != nil {
+		return nil, err
+	}
+	k.DekeID, err = uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newSessionSecret()
+	if err != nil {
+		return nil, err
+	}
+	k.KeyHash = hashSecret(secret)
+	if actorID != uuid.Nil {
+		k.CreatedBy = &actorID
+	}
+
+	dk := m.DeviceKey{}
+	query := psql.Insert("device_key").
+		Columns("deke_id", "inst_id", "name", "room_ids", "key_hash", "created_by", "created_at").
+		Values(k.DekeID, instID, k.Name, k.RoomIDs, k.KeyHash, k.CreatedBy, time.Now()).
+		Suffix("RETURNING *")
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating device key insert sql")
+	}
+	err = c.DB.Get(&dk, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating device key")
+	}
+	return &m.DeviceKeySecret{DeviceKey: dk, Key: joinRefreshToken(dk.DekeID, secret)}, nil
+}
+
+// Run sets a new key for the device
+func (r *DeviceKeyRotator) Run(instID, dekeID uuid.UUID) (*m.DeviceKeySecret, error) {
+	secret, err := newSessionSecret()
+	if err != nil {
+		return nil, err
+	}
+	dk, err := updateDeviceKey(r.DB, instID, dekeID, map[string]interface{}{
+		"key_hash":   hashSecret(secret),
+		"rotated_at": time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &m.DeviceKeySecret{DeviceKey: *dk, Key: joinRefreshToken(dk.DekeID, secret)}, nil
+}
+
+// Run revokes the key
+func (r *DeviceKeyRevoker) Run(instID, dekeID uuid.UUID) (*m.DeviceKey, error) {
+	return updateDeviceKey(r.DB, instID, dekeID, map[string]interface{}{
+		"revoked_at": time.Now(),
+	})
+}
+
+// Run returns the keys, revoked ones included
+func (l *DeviceKeyLister) Run(instID uuid.UUID) ([]m.DeviceKey, error) {
+	ks := []m.DeviceKey{}
+	query := psql.Select("*").
+		From("device_key").
+		Where(sq.Eq{"inst_id": instID}).
+		OrderBy("created_at DESC")
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating device key list sql")
+	}
+	err = l.DB.Select(&ks, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing device keys")
+	}
+	return ks, nil
+}
+
+// Run returns the institution and the rooms the key can read, ip is recorded as the last use
+func (c *DeviceKeyChecker) Run(key, ip string) (uuid.UUID, []string, error) {
+	dekeID, secret, err := splitRefreshToken(key)
+	if err != nil {
+		return uuid.Nil, nil, &auth.DeviceKeyInvalidError{Message: "Invalid device key"}
+	}
+	dk := m.DeviceKey{}
+	query := psql.Select("*").
+		From("device_key").
+		Where(sq.Eq{"deke_id": dekeID, "revoked_at": nil})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return uuid.Nil, nil, errors.Wrap(err, "Error generating device key sql")
+	}
+	err = c.DB.Get(&dk, qSQL, args...)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil, &auth.DeviceKeyInvalidError{Message: "Invalid device key"}
+	}
+	if err != nil {
+		return uuid.Nil, nil, errors.Wrap(err, "Error getting device key")
+	}
+	if subtle.ConstantTimeCompare([]byte(dk.KeyHash), []byte(hashSecret(secret))) != 1 {
+		return uuid.Nil, nil, &auth.DeviceKeyInvalidError{Message: "Invalid device key"}
+	}
+
+	now := time.Now()
+	if !dk.LastUsedAt.Valid || now.Sub(dk.LastUsedAt.Time) > deviceKeyUsageInterval || dk.LastUsedIP.String != ip {
+		upd := psql.Update("device_key").
+			Set("last_used_at", now).
+			Set("last_used_ip", ip).
+			Where(sq.Eq{"deke_id": dk.DekeID})
+		qSQL, args, err = upd.ToSql()
+		if err != nil {
+			return uuid.Nil, nil, errors.Wrap(err, "Error generating device key usage sql")
+		}
+		_, err = c.DB.Exec(qSQL, args...)
+		if err != nil {
+			return uuid.Nil, nil, errors.Wrap(err, "Error recording device key usage")
+		}
+	}
+	return dk.InstID, dk.RoomIDs, nil
+}
+
+/* updateDeviceKey sets the columns of a key that is not revoked */
+func updateDeviceKey(db service.DB, instID, dekeID uuid.UUID, set map[string]interface{}) (*m.DeviceKey, error) {
+	dk := m.DeviceKey{}
+	query := psql.Update("device_key").
+		SetMap(set).
+		Where(sq.Eq{"deke_id": dekeID, "inst_id": instID, "revoked_at": nil}).
+		Suffix("RETURNING *")
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating device key update sql")
+	}
+	err = db.Get(&dk, qSQL, args...)
+	if err == sql.ErrNoRows {
+		return nil, &auth.DeviceKeyInvalidError{Message: "No such device key: " + dekeID.String()}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error updating device key")
+	}
+	return &dk, nil
+}
+
+/* checkRooms validates the key is bound to existing rooms of the institution */
+func checkRooms(db service.DB, instID uuid.UUID, roomIDs pq.StringArray) error {
+	if len(roomIDs) == 0 {
+		return &auth.ValidationError{Messages: map[string]string{
+			"roomIDs": "The key must be bound to at least one room",
+		}}
+	}
+	for _, id := range roomIDs {
+		if _, err := uuid.FromString(id); err != nil {
+			return &auth.ValidationError{Messages: map[string]string{
+				"roomIDs": "Invalid room id: " + id,
+			}}
+		}
+	}
+	n := 0
+	query := psql.Select("count(*)").
+		From("room").
+		Where(sq.Expr("room_id = ANY(?::uuid[])", roomIDs)).
+		Where(sq.Eq{"inst_id": instID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating rooms sql")
+	}
+	err = db.Get(&n, qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error checking rooms")
+	}
+	if n != len(roomIDs) {
+		return &auth.ValidationError{Messages: map[string]string{
+			"roomIDs": "Some rooms don't exist",
+		}}
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	"gitlab.com/falqon/inovantapp/backend/service"
 	"gitlab.com/falqon/inovantapp/backend/service/mailer"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
 
 	sq "github.com/elgris/sqrl"
 	m "gitlab.com/falqon/inovantapp/backend/models"
@@ -24,11 +25,17 @@ type DoctorCreator struct {
 	Logger *log.Logger
 	Mailer *mailer.Mailer
 	Config *service.ServicesConfig
+	Policy auth.PasswordPolicy
 }
 
 //Run create new Doctor
-func (c *DoctorCreator) Run(doc *m.Doctor) (*m.Doctor, error) {
+func (c *DoctorCreator) Run(instID uuid.UUID, doc *m.Doctor) (*m.Doctor, error) {
+	err := c.Policy.Check(string(doc.User.Password), doc.User.Email)
+	if err != nil {
+		return nil, err
+	}
 	tx, err := c.DB.Beginx()
+	doc.User.InstID = instID
 	user, err := newUser(&doc.User, string(doc.User.Password))
 	if err != nil {
 		if c.Logger != nil {
@@ -43,7 +50,7 @@ func (c *DoctorCreator) Run(doc *m.Doctor) (*m.Doctor, error) {
 		return nil, err
 	}
 
-	ac, ver, err := newActConfirmation(userSaved.UserID, vPwd)
+	ac, ver, err := newActConfirmation(instID, userSaved.UserID, vPwd)
 	if err != nil {
 		tx.Rollback()
 		return nil, errors.Wrap(err, "Failed to create action confirmation")
@@ -69,7 +76,7 @@ func (c *DoctorCreator) Run(doc *m.Doctor) (*m.Doctor, error) {
 			c.Logger.Println("Doctor Create:", err)
 		}
 	}
-	err = addDoctorSpecialties(tx, u.DoctID, doc.Specialties)
+	err = addDoctorSpecialties(tx, instID, u.DoctID, doc.Specialties)
 	if err != nil {
 		if c.Logger != nil {
 			c.Logger.Println("Doctor Create Specialties:", err)
@@ -101,8 +108,8 @@ type DoctorLister struct {
 }
 
 //Run return a list of Production Orders by Filter
-func (l *DoctorLister) Run(doctID *uuid.UUID, f m.FilterDoctor) ([]m.Doctor, error) {
-	u, err := listDoctor(l.DB, doctID, f)
+func (l *DoctorLister) Run(instID uuid.UUID, doctID *uuid.UUID, f m.FilterDoctor) ([]m.Doctor, error) {
+	u, err := listDoctor(l.DB, instID, doctID, f)
 	return u, err
 }
 
@@ -112,8 +119,8 @@ type DoctorGetter struct {
 }
 
 //Run return a doctor of Production Orders by doct_id
-func (g *DoctorGetter) Run(doctID uuid.UUID) (*m.Doctor, error) {
-	u, err := getDoctor(g.DB, doctID)
+func (g *DoctorGetter) Run(instID, doctID uuid.UUID) (*m.Doctor, error) {
+	u, err := getDoctor(g.DB, instID, doctID)
 	return u, err
 }
 
@@ -124,8 +131,9 @@ type DoctorUpdater struct {
 }
 
 //Run update Doctor data
-func (g *DoctorUpdater) Run(doc *m.Doctor) (*m.Doctor, error) {
+func (g *DoctorUpdater) Run(instID uuid.UUID, doc *m.Doctor) (*m.Doctor, error) {
 	tx, err := g.DB.Beginx()
+	doc.User.InstID = instID
 	u, err := updateDoctor(g.DB, doc)
 	if err != nil {
 		if g.Logger != nil {
@@ -133,6 +141,7 @@ func (g *DoctorUpdater) Run(doc *m.Doctor) (*m.Doctor, error) {
 		}
 	}
 	user := m.User{
+		InstID:     instID,
 		UserID:     doc.UserID,
 		Email:      doc.User.Email,
 		Roles:      doc.User.Roles,
@@ -145,7 +154,7 @@ func (g *DoctorUpdater) Run(doc *m.Doctor) (*m.Doctor, error) {
 		}
 	}
 
-	err = delDoctorSpecialties(tx, u.DoctID, doc.Specialties)
+	err = delDoctorSpecialties(tx, instID, u.DoctID, doc.Specialties)
 	if err != nil {
 		if g.Logger != nil {
 			g.Logger.Println("Doctor Update Specialties:", err)
@@ -166,9 +175,9 @@ type DoctorDeleter struct {
 }
 
 //Run soft delete Doctor by doct_id
-func (d *DoctorDeleter) Run(doctID uuid.UUID) (*m.Doctor, error) {
+func (d *DoctorDeleter) Run(instID, doctID uuid.UUID) (*m.Doctor, error) {
 	tx, err := d.DB.Beginx()
-	u, err := deleteDoctor(tx, doctID)
+	u, err := deleteDoctor(tx, instID, doctID)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -194,8 +203,8 @@ func (d *DoctorDeleter) Run(doctID uuid.UUID) (*m.Doctor, error) {
 /* Create a new Doctor to database */
 func createDoctor(db service.DB, doc *m.Doctor) (*m.Doctor, error) {
 	query := psql.Insert("doctor").
-		Columns("doct_id", "user_id", "name", "info").
-		Values(doc.DoctID, doc.UserID, doc.Name, doc.Info).
+		Columns("doct_id", "inst_id", "user_id", "name", "info").
+		Values(doc.DoctID, doc.User.InstID, doc.UserID, doc.Name, doc.Info).
 		Suffix("RETURNING *")
 
 	qSQL, args, err := query.ToSql()
@@ -210,15 +219,17 @@ func createDoctor(db service.DB, doc *m.Doctor) (*m.Doctor, error) {
 	return doc, nil
 }
 
-func addDoctorSpecialties(db service.DB, doctID uuid.UUID, specialties *pq.StringArray) error {
+func addDoctorSpecialties(db service.DB, instID, doctID uuid.UUID, specialties *pq.StringArray) error {
 	docSpe := m.DoctorSpecialty{}
-	args := []interface{}{specialties, doctID}
+	args := []interface{}{specialties, doctID, instID}
 	query := `
 		WITH insert_doc_spe AS (
 			SELECT UNNEST($1::int[]) AS spec_id
 		)
 		INSERT INTO doctor_specialty (doct_id, spec_id)
 		SELECT $2::UUID, spec_id::INT FROM insert_doc_spe
+		JOIN specialty USING (spec_id)
+		WHERE specialty.inst_id = $3
 	`
 	err := db.Get(&docSpe, query, args...)
 	if err != nil {
@@ -227,9 +238,9 @@ func addDoctorSpecialties(db service.DB, doctID uuid.UUID, specialties *pq.Strin
 	return nil
 }
 
-func delDoctorSpecialties(db service.DB, doctID uuid.UUID, specialties *pq.StringArray) error {
+func delDoctorSpecialties(db service.DB, instID, doctID uuid.UUID, specialties *pq.StringArray) error {
 	docSpe := m.DoctorSpecialty{}
-	args := []interface{}{specialties, doctID}
+	args := []interface{}{specialties, doctID, instID}
 	query := `
 		WITH del_doctor_specialty AS (
 			DELETE FROM doctor_specialty
@@ -240,6 +251,8 @@ func delDoctorSpecialties(db service.DB, doctID uuid.UUID, specialties *pq.Strin
 		)
 		INSERT INTO doctor_specialty (doct_id, spec_id)
 		SELECT $2::UUID, spec_id::INT FROM insert_doc_spe
+		JOIN specialty USING (spec_id)
+		WHERE specialty.inst_id = $3
 	`
 	err := db.Get(&docSpe, query, args...)
 	if err != nil {
@@ -249,14 +262,15 @@ func delDoctorSpecialties(db service.DB, doctID uuid.UUID, specialties *pq.Strin
 }
 
 /* Return a list of Doctor by filters */
-func listDoctor(db service.DB, doctID *uuid.UUID, f m.FilterDoctor) ([]m.Doctor, error) {
+func listDoctor(db service.DB, instID uuid.UUID, doctID *uuid.UUID, f m.FilterDoctor) ([]m.Doctor, error) {
 	doc := []m.Doctor{}
-	query := psql.Select("doc.doct_id", "doc.user_id", "doc.name", "u.email", "u.roles", "doc.info", "doc.created_at", "u.inactive_at", "array_remove(array_agg(spe.spec_id), NULL) AS specialties").
+	query := psql.Select("doc.doct_id", "doc.inst_id", "doc.user_id", "doc.name", "u.email", "u.roles", "doc.info", "doc.created_at", "u.inactive_at", "array_remove(array_agg(spe.spec_id), NULL) AS specialties").
 		From("doctor doc").
 		Join(`"user" u USING (user_id)`).
 		LeftJoin("doctor_specialty doc_spe USING (doct_id)").
 		LeftJoin("specialty spe USING (spec_id)").
-		GroupBy("doc.doct_id, doc.user_id, doc.name, u.email, u.roles, doc.info, doc.created_at, u.inactive_at").
+		Where(sq.Eq{"doc.inst_id": instID}).
+		GroupBy("doc.doct_id, doc.inst_id, doc.user_id, doc.name, u.email, u.roles, doc.info, doc.created_at, u.inactive_at").
 		OrderBy("doc.name ASC")
 
 	if doctID != nil {
@@ -293,15 +307,15 @@ func listDoctor(db service.DB, doctID *uuid.UUID, f m.FilterDoctor) ([]m.Doctor,
 }
 
 /* Return a Doctor by doct_id */
-func getDoctor(db service.DB, doctID uuid.UUID) (*m.Doctor, error) {
+func getDoctor(db service.DB, instID, doctID uuid.UUID) (*m.Doctor, error) {
 	doc := m.Doctor{}
-	query := psql.Select("doc.doct_id", "doc.user_id", "doc.name", "u.email", "u.roles", "doc.info", "doc.created_at", "u.inactive_at", "array_remove(array_agg(spe.spec_id), NULL) AS specialties").
+	query := psql.Select("doc.doct_id", "doc.inst_id", "doc.user_id", "doc.name", "u.email", "u.roles", "doc.info", "doc.created_at", "u.inactive_at", "array_remove(array_agg(spe.spec_id), NULL) AS specialties").
 		From("doctor doc").
 		Join(`"user" u USING (user_id)`).
 		LeftJoin("doctor_specialty doc_spe USING (doct_id)").
 		LeftJoin("specialty spe USING (spec_id)").
-		Where(sq.Eq{"doc.doct_id": doctID}).
-		GroupBy("doc.doct_id, doc.user_id, doc.name, u.email, u.roles, doc.info, doc.created_at, u.inactive_at")
+		Where(sq.Eq{"doc.doct_id": doctID, "doc.inst_id": instID}).
+		GroupBy("doc.doct_id, doc.inst_id, doc.user_id, doc.name, u.email, u.roles, doc.info, doc.created_at, u.inactive_at")
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -324,7 +338,7 @@ func updateDoctor(db service.DB, doc *m.Doctor) (*m.Doctor, error) {
 		Set("info", doc.Info).
 		Set("update_at", time.Now()).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"doct_id": doc.DoctID})
+		Where(sq.Eq{"doct_id": doc.DoctID, "inst_id": doc.User.InstID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -340,14 +354,14 @@ func updateDoctor(db service.DB, doc *m.Doctor) (*m.Doctor, error) {
 }
 
 /* Delete Doctor to database by doct_id */
-func deleteDoctor(db service.DB, doctID uuid.UUID) (*m.Doctor, error) {
+func deleteDoctor(db service.DB, instID, doctID uuid.UUID) (*m.Doctor, error) {
 	doc := m.Doctor{}
 	query := psqlx.Update(`"user"`).
 		Set(`inactive_at`, time.Now()).
 		From("doctor doc").
 		Where(`"user".user_id = doc.user_id`).
 		Suffix("RETURNING *").
-		Where(sq.Eq{"doc.doct_id": doctID})
+		Where(sq.Eq{"doc.doct_id": doctID, "doc.inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -380,18 +394,39 @@ func cancelAppoitments(db service.DB, doctID uuid.UUID) error {
 }
 
 func cancelSchedules(db service.DB, doctID uuid.UUID) error {
-	query := psqlx.Update("schedule").
-		Set("deleted_at", time.Now()).
-		Suffix("RETURNING *").
-		Where(sq.Eq{"doct_id": doctID}).
-		Where(sq.GtOrEq{"start_at": time.Now()})
+	now := time.Now()
+	cancelled := []struct {
+		ScheID     uuid.UUID `db:"sche_id"`
+		InstID     uuid.UUID `db:"inst_id"`
+		FromStatus string    `db:"from_status"`
+	}{}
+	query := psqlx.Update("schedule s").
+		Set("deleted_at", now).
+		Set("status", "cancelled").
+		Set("status_at", now).
+		From("schedule old").
+		Where("old.sche_id = s.sche_id").
+		Suffix("RETURNING s.sche_id, s.inst_id, old.status AS from_status").
+		Where(sq.Eq{"s.doct_id": doctID, "s.status": []string{"requested", "confirmed"}}).
+		Where(sq.GtOrEq{"s.start_at": now})
 	qSQL, args, err := query.ToSql()
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(qSQL, args...)
+	err = db.Select(&cancelled, qSQL, args...)
 	if err != nil {
 		return err
 	}
+	for _, c := range cancelled {
+		sschID, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`INSERT INTO schedule_status_change (ssch_id, inst_id, sche_id, from_status, to_status, note, changed_at) VALUES ($1, $2, $3, $4, 'cancelled', 'doctor deactivated', $5)`,
+			sschID, c.InstID, c.ScheID, c.FromStatus, now)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,137 @@
+package user
+
+import (
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
+)
+
+// Impersonator service opens a session of an user for an admin, the token
+// carries the admin as actor and the session can't be refreshed
+type Impersonator struct {
+	DB        *sqlx.DB
+	JWTConfig JWTConfig
+	// TTL is how long the impersonation lasts
+	TTL time.Duration
+}
+
+// Impersonation is the token of an impersonation session
+type Impersonation struct {
+	AuthResponse
+	ActorID   uuid.UUID
+	ExpiresAt time.Time
+}
+
+// ImpersonationRequest identifies the admin, the session the impersonation
+// depends on and the user to act as
+type ImpersonationRequest struct {
+	InstID      uuid.UUID
+	ActorID     uuid.UUID
+	ActorSessID uuid.UUID
+	UserID      uuid.UUID
+	Reason      string
+	Device      Device
+}
+
+// Run opens the impersonation session, the user must be of the institution
+// and have no permission the admin lacks
+func (i *Impersonator) Run(r ImpersonationRequest) (*Impersonation, error) {
+	if r.ActorID == r.UserID {
+		return nil, &auth.ValidationError{Messages: map[string]string{
+			"userID": "An user can't impersonate itself",
+		}}
+	}
+	usr, err := withDoctorFromID(i.DB, r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if usr.InstID != r.InstID {
+		return nil, &auth.UserNotFoundError{Message: "No User with id: " + r.UserID.String()}
+	}
+	pr := &PermissionResolver{DB: i.DB}
+	actorPerms, err := pr.Run(r.ActorID.String())
+	if err != nil {
+		return nil, err
+	}
+	userPerms, err := pr.Run(r.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := uncovered(actorPerms, userPerms); !ok {
+		return nil, &auth.ValidationError{Messages: map[string]string{
+			"permissions": "The user has the permission " + p + " the actor doesn't",
+		}}
+	}
+
+	tx, err := i.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	sess, _, err := createSession(tx, r.UserID, r.Device, i.TTL)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = markImpersonation(tx, sess.SessID, r.ActorID, r.ActorSessID, strings.TrimSpace(r.Reason))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	jwt, err := issueToken(tx, *usr, sess.SessID, r.ActorID.String(), sess.ExpiresAt, i.JWTConfig)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit impersonation")
+	}
+	// no refresh token, the impersonation ends when the token expires
+	return &Impersonation{
+		AuthResponse: AuthResponse{UserWithDoctor: *usr, Jwt: jwt, SessID: sess.SessID},
+		ActorID:      r.ActorID,
+		ExpiresAt:    sess.ExpiresAt,
+	}, nil
+}
+
+// uncovered returns the first granular permission of user that actor lacks,
+// an :any permission covers its :own counterpart
+func uncovered(actor, user []string) (string, bool) {
+	for _, p := range user {
+		if !perm.Known(p) || contains(actor, p) {
+			continue
+		}
+		if strings.HasSuffix(p, ":own") && contains(actor, strings.TrimSuffix(p, ":own")+":any") {
+			continue
+		}
+		return p, false
+	}
+	return "", true
+}
+
+/* Mark a session as opened by an admin impersonating its user */
+func markImpersonation(db service.DB, sessID, actorID, actorSessID uuid.UUID, reason string) error {
+	query := psql.Update("user_session").
+		Set("actor_id", actorID).
+		Set("actor_sess_id", actorSessID).
+		Set("reason", reason).
+		Where(sq.Eq{"sess_id": sessID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating impersonation sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error saving impersonation")
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package user
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/mailer"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// Inviter service invites a new user by email
+type Inviter struct {
+	DB     *sqlx.DB
+	Mailer *mailer.Mailer
+	Config *service.ServicesConfig
+	// TTL is how long the invitation link is valid
+	TTL time.Duration
+}
+
+// DoctorInviter service invites a new doctor by email
+type DoctorInviter struct {
+	DB     *sqlx.DB
+	Mailer *mailer.Mailer
+	Config *service.ServicesConfig
+	TTL    time.Duration
+}
+
+// InvitationLister service lists the pending invitations
+type InvitationLister struct {
+	DB *sqlx.DB
+}
+
+// InvitationResender service sends a pending invitation again with a new link
+type InvitationResender struct {
+	DB     *sqlx.DB
+	Mailer *mailer.Mailer
+	Config *service.ServicesConfig
+	TTL    time.Duration
+}
+
+// InvitationRevoker service cancels a pending invitation
+type InvitationRevoker struct {
+	DB *sqlx.DB
+}
+
+// InvitationAccepter service sets the invited user password and activates the account
+type InvitationAccepter struct {
+	DB     *sqlx.DB
+	Policy auth.PasswordPolicy
+}
+
+// Run creates the inactive user and emails the invitation, actorID is the admin inviting
+func (i *Inviter) Run(instID uuid.UUID, u *m.User, actorID uuid.UUID) (*m.Invitation, error) {
+	tx, err := i.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	u.InstID = instID
+	usr, err := saveInvitedUser(tx, u)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	inv, secret, err := saveInvitation(tx, usr, actorID, i.TTL)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = sendInvitation(i.Mailer, i.Config, inv, nil, secret)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit invitation")
+	}
+	return inv, nil
+}
+
+// Run creates the inactive doctor and emails the invitation, actorID is the admin inviting
+func (i *DoctorInviter) Run(instID uuid.UUID, doc *m.Doctor, actorID uuid.UUID) (*m.Invitation, error) {
+	tx, err := i.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	doc.User.InstID = instID
+	usr, err := saveInvitedUser(tx, &doc.User)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	doc.User = *usr
+	doc.DoctID, err = uuid.NewV4()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	_, err = createDoctor(tx, doc)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Failed to create doctor")
+	}
+	if doc.Specialties != nil && len(*doc.Specialties) > 0 {
+		err = addDoctorSpecialties(tx, instID, doc.DoctID, doc.Specialties)
+		if err != nil && err != sql.ErrNoRows {
+			tx.Rollback()
+			return nil, errors.Wrap(err, "Failed to add doctor specialties")
+		}
+	}
+	inv, secret, err := saveInvitation(tx, usr, actorID, i.TTL)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = sendInvitation(i.Mailer, i.Config, inv, &doc.Name, secret)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit invitation")
+	}
+	return inv, nil
+}
+
+// Run returns the invitations not yet accepted or revoked, newest first
+func (l *InvitationLister) Run(instID uuid.UUID) ([]m.Invitation, error) {
+	inv := []m.Invitation{}
+	query := psql.Select("*").
+		From("user_invitation").
+		Where(sq.Eq{"inst_id": instID, "accepted_at": nil, "revoked_at": nil}).
+		OrderBy("created_at DESC")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list invitations sql")
+	}
+	err = l.DB.Select(&inv, qSQL, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "Error listing invitations")
+	}
+	return inv, nil
+}
+
+// Run replaces the invitation link, the previous one stops working
+func (r *InvitationResender) Run(instID, inviID uuid.UUID) (*m.Invitation, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	inv, err := pendingInstInvitation(tx, instID, inviID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	secret, err := newSessionSecret()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	now := time.Now()
+	query := psql.Update("user_invitation").
+		Set("token_hash", hashSecret(secret)).
+		Set("expires_at", now.Add(r.TTL)).
+		Set("sent_at", now).
+		Where(sq.Eq{"invi_id": inv.InviID}).
+		Suffix("RETURNING *")
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating resend invitation sql")
+	}
+	err = tx.Get(inv, qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error updating invitation")
+	}
+	usr, err := withDoctor(tx, inv.UserID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = sendInvitation(r.Mailer, r.Config, inv, usr.DoctName, secret)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit invitation resend")
+	}
+	return inv, nil
+}
+
+// Run revokes the invitation, the invited account stays inactive
+func (r *InvitationRevoker) Run(instID, inviID uuid.UUID) (*m.Invitation, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	inv, err := pendingInstInvitation(tx, instID, inviID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	query := psql.Update("user_invitation").
+		Set("revoked_at", time.Now()).
+		Where(sq.Eq{"invi_id": inv.InviID}).
+		Suffix("RETURNING *")
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating revoke invitation sql")
+	}
+	err = tx.Get(inv, qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error revoking invitation")
+	}
+	err = tx.Commit()
+	return inv, err
+}
+
+// Run checks the link secret, sets the password and activates the user
+func (a *InvitationAccepter) Run(inviID uuid.UUID, secret, password string) (*m.User, error) {
+	tx, err := a.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	inv, err := pendingInvitation(tx, inviID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if inv.ExpiresAt.Before(time.Now()) {
+		tx.Rollback()
+		return nil, &auth.InvitationInvalidError{Message: "Invitation expired"}
+	}
+	if subtle.ConstantTimeCompare([]byte(inv.TokenHash), []byte(hashSecret(secret))) != 1 {
+		tx.Rollback()
+		return nil, &auth.InvitationInvalidError{Message: "Invalid invitation"}
+	}
+
+	err = a.Policy.Check(password, inv.Email)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	passHash, err := auth.PasswordGen(password)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = updatePassword(tx, inv.UserID, passHash)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	usr, err := activeUser(tx, inv.InstID, inv.UserID)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Failed to activate user")
+	}
+
+	query := psql.Update("user_invitation").
+		Set("accepted_at", time.Now()).
+		Where(sq.Eq{"invi_id": inv.InviID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating accept invitation sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error accepting invitation")
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit invitation accept")
+	}
+	return usr, nil
+}
+
+// saveInvitedUser creates the user inactive and with an unusable password
+func saveInvitedUser(tx service.DB, u *m.User) (*m.User, error) {
+	if err := checkAssignable(u.Roles); err != nil {
+		return nil, err
+	}
+	secret, err := newSessionSecret()
+	if err != nil {
+		return nil, err
+	}
+	usr, err := newUser(u, secret)
+	if err != nil {
+		return nil, err
+	}
+	usr, err = saveUser(tx, usr)
+	if err != nil {
+		return nil, err
+	}
+	return inactiveUser(tx, usr.InstID, usr.UserID)
+}
+
+func saveInvitation(tx service.DB, usr *m.User, actorID uuid.UUID, ttl time.Duration) (*m.Invitation, string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error generating invitation uuid")
+	}
+	secret, err := newSessionSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	inv := m.Invitation{}
+	query := psql.Insert("user_invitation").
+		Columns("invi_id", "inst_id", "user_id", "email", "invited_by", "token_hash", "expires_at", "sent_at", "created_at").
+		Values(id, usr.InstID, usr.UserID, usr.Email, actorID, hashSecret(secret), now.Add(ttl), now, now).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error generating invitation sql")
+	}
+	err = tx.Get(&inv, qSQL, args...)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error inserting invitation")
+	}
+	return &inv, secret, nil
+}
+
+func pendingInvitation(tx service.DB, inviID uuid.UUID) (*m.Invitation, error) {
+	inv := m.Invitation{}
+	query := psql.Select("*").
+		From("user_invitation").
+		Where(sq.Eq{"invi_id": inviID, "accepted_at": nil, "revoked_at": nil}).
+		Suffix("FOR UPDATE")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get invitation sql")
+	}
+	err = tx.Get(&inv, qSQL, args...)
+	if err == sql.ErrNoRows {
+		return nil, &auth.InvitationInvalidError{Message: "No pending invitation: " + inviID.String()}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting invitation")
+	}
+	return &inv, nil
+}
+
+// pendingInstInvitation is pendingInvitation for the admins of an institution
+func pendingInstInvitation(tx service.DB, instID, inviID uuid.UUID) (*m.Invitation, error) {
+	inv, err := pendingInvitation(tx, inviID)
+	if err != nil {
+		return nil, err
+	}
+	if inv.InstID != instID {
+		return nil, &auth.InvitationInvalidError{Message: "No pending invitation: " + inviID.String()}
+	}
+	return inv, nil
+}
+
+// withDoctor returns the user with its doctor name, active or not
+func withDoctor(db service.DB, userID uuid.UUID) (*m.UserWithDoctor, error) {
+	usr := m.UserWithDoctor{}
+	query := psql.Select("u.user_id", "doc.doct_id", "doc.name as doct_name", "u.email").
+		From(`"user" u`).
+		LeftJoin("doctor doc USING (user_id)").
+		Where(sq.Eq{"u.user_id": userID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get user sql")
+	}
+	err = db.Get(&usr, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting user")
+	}
+	return &usr, nil
+}
+
+func sendInvitation(ml *mailer.Mailer, cfg *service.ServicesConfig, inv *m.Invitation, name *string, secret string) error {
+	cac := m.CreateAccountConfirm{
+		Name:            name,
+		Email:           inv.Email,
+		City:            "Salvador - Bahia",
+		ConfirmationURL: cfg.APPURL + "/invitation/" + inv.InviID.String() + "/" + secret,
+	}
+	err := ml.SendConfirmationAccount(&cac)
+	if err != nil {
+		return errors.Wrap(err, "Failed to send invitation email")
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package user
+
+import (
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+const (
+	lockoutLocked   = "locked"
+	lockoutUnlocked = "unlocked"
+)
+
+// Unlocker service to unlock an user account locked by failed sign ins
+type Unlocker struct {
+	DB *sqlx.DB
+}
+
+// LockoutLister service to list the lock/unlock events of an user
+type LockoutLister struct {
+	DB *sqlx.DB
+}
+
+// Run unlocks the user account, actorID is the admin doing it
+func (u *Unlocker) Run(instID, userID, actorID uuid.UUID) (*m.User, error) {
+	tx, err := u.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	usr := m.User{}
+	query := psql.Update(`"user"`).
+		Set("failed_attempts", 0).
+		Set("locked_until", nil).
+		Where(sq.Eq{"user_id": userID, "inst_id": instID}).
+		Suffix("RETURNING *")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating user unlock sql")
+	}
+	err = tx.Get(&usr, qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error unlocking user")
+	}
+
+	err = saveLockout(tx, m.UserLockout{UserID: userID, Type: lockoutUnlocked, ActorID: &actorID})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	return &usr, err
+}
+
+// Run returns the lock/unlock events of an user, newest first
+func (l *LockoutLister) Run(instID, userID uuid.UUID) ([]m.UserLockout, error) {
+	lo := []m.UserLockout{}
+	query := psql.Select("uslo_id", "user_id", "type", "actor_id", "locked_until", "created_at").
+		From("user_lockout").
+		Where(sq.Eq{"user_id": userID}).
+		Where(`user_id IN (SELECT user_id FROM "user" WHERE inst_id = ?)`, instID).
+		OrderBy("created_at DESC")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list user lockouts sql")
+	}
+	err = l.DB.Select(&lo, qSQL, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "Error listing user lockouts")
+	}
+	return lo, nil
+}
+
+// registerFailedAttempt counts a failed sign in and locks the account once
+// the policy limit is reached. It returns an AccountLockedError when the
+// account got locked by this attempt.
+func registerFailedAttempt(db *sqlx.DB, userID uuid.UUID, cfg LockoutConfig) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	attempts := 0
+	query := psql.Update(`"user"`).
+		Set("failed_attempts", sq.Expr("failed_attempts + 1")).
+		Where(sq.Eq{"user_id": userID}).
+		Suffix("RETURNING failed_attempts")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error generating failed attempt sql")
+	}
+	err = tx.Get(&attempts, qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error registering failed attempt")
+	}
+
+	if cfg.MaxAttempts <= 0 || attempts < cfg.MaxAttempts {
+		return tx.Commit()
+	}
+
+	until := time.Now().Add(cfg.Duration)
+	lock := psql.Update(`"user"`).
+		Set("failed_attempts", 0).
+		Set("locked_until", until).
+		Where(sq.Eq{"user_id": userID})
+
+	qSQL, args, err = lock.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error generating user lock sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error locking user")
+	}
+
+	err = saveLockout(tx, m.UserLockout{UserID: userID, Type: lockoutLocked, LockedUntil: null.TimeFrom(until)})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "Failed to commit user lock")
+	}
+	return &auth.AccountLockedError{
+		Message: "Too many failed attempts, account locked until " + until.Format(time.RFC3339),
+		Until:   until,
+	}
+}
+
+// clearFailedAttempts resets the counter after a successful sign in
+func clearFailedAttempts(db service.DB, userID uuid.UUID) error {
+	query := psql.Update(`"user"`).
+		Set("failed_attempts", 0).
+		Set("locked_until", nil).
+		Where(sq.Eq{"user_id": userID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating clear failed attempts sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error clearing failed attempts")
+	}
+	return nil
+}
+
+func saveLockout(db service.DB, lo m.UserLockout) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "Error generating user lockout uuid")
+	}
+	query := psql.Insert("user_lockout").
+		Columns("uslo_id", "user_id", "type", "actor_id", "locked_until", "created_at").
+		Values(id, lo.UserID, lo.Type, lo.ActorID, lo.LockedUntil, time.Now())
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating user lockout sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error inserting user lockout")
+	}
+	return nil
+}
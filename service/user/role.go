@@ -0,0 +1,330 @@
+package user
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/rolecache"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// RoleLister service lists the roles and their permissions
+type RoleLister struct {
+	DB *sqlx.DB
+}
+
+// RoleGetter service returns a role and its permissions
+type RoleGetter struct {
+	DB *sqlx.DB
+}
+
+// RoleSaver service creates a role or replaces its description and permissions
+type RoleSaver struct {
+	DB *sqlx.DB
+}
+
+// RoleDeleter service removes a role no user has
+type RoleDeleter struct {
+	DB *sqlx.DB
+}
+
+// PermissionResolver service returns the roles of an user followed by the
+// permissions they grant, plus the permissions of the base role
+type PermissionResolver struct {
+	DB *sqlx.DB
+}
+
+// Run returns all roles
+func (l *RoleLister) Run() ([]m.Role, error) {
+	return listRoles(l.DB, nil)
+}
+
+// Run returns the role
+func (g *RoleGetter) Run(roleID string) (*m.Role, error) {
+	rs, err := listRoles(g.DB, sq.Eq{"r.role_id": roleID})
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, &auth.ValidationError{Messages: map[string]string{
+			"roleNotFound": "No such role: " + roleID,
+		}}
+	}
+	return &rs[0], nil
+}
+
+// Run validates the permissions and saves the role
+func (s *RoleSaver) Run(r *m.Role) (*m.Role, error) {
+	r.RoleID = strings.TrimSpace(r.RoleID)
+	if len(r.RoleID) == 0 {
+		return nil, &auth.ValidationError{Messages: map[string]string{
+			"roleID": "Role id cannot be empty",
+		}}
+	}
+	for _, p := range r.Permissions {
+		if !perm.Known(p) {
+			return nil, &auth.ValidationError{Messages: map[string]string{
+				"unknownPermission": "No such permission: " + p,
+			}}
+		}
+	}
+	if r.RoleID == perm.SuperAdmin && !contains(r.Permissions, perm.RoleWrite) {
+		return nil, &auth.ValidationError{Messages: map[string]string{
+			"superadminRoleWrite": "The superadmin role can't lose " + perm.RoleWrite,
+		}}
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	err = saveRole(tx, r)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = notifyRoleChange(tx, rolecache.AllUsers)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit role")
+	}
+	rs, err := listRoles(s.DB, sq.Eq{"r.role_id": r.RoleID})
+	if err != nil {
+		return nil, err
+	}
+	return &rs[0], nil
+}
+
+// Run deletes the role, built in roles and roles in use can't be deleted
+func (d *RoleDeleter) Run(roleID string) (*m.Role, error) {
+	if roleID == perm.Admin || roleID == perm.User || roleID == perm.SuperAdmin {
+		return nil, &auth.ValidationError{Messages: map[string]string{
+			"builtinRole": "The " + roleID + " role can't be deleted",
+		}}
+	}
+	tx, err := d.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	query := psql.Select("count(*)").
+		From(`"user"`).
+		Where(sq.Expr("? = ANY(roles)", roleID))
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating role usage sql")
+	}
+	err = tx.Get(&n, qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error counting role users")
+	}
+	if n > 0 {
+		tx.Rollback()
+		return nil, &auth.ValidationError{Messages: map[string]string{
+			"roleInUse": "The " + roleID + " role is given to users",
+		}}
+	}
+
+	r := m.Role{}
+	del := psql.Delete("role").
+		Where(sq.Eq{"role_id": roleID}).
+		Suffix("RETURNING role_id, description, created_at, updated_at")
+	qSQL, args, err = del.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating role delete sql")
+	}
+	err = tx.Get(&r, qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, &auth.ValidationError{Messages: map[string]string{
+				"roleNotFound": "No such role: " + roleID,
+			}}
+		}
+		return nil, errors.Wrap(err, "Error deleting role")
+	}
+	err = notifyRoleChange(tx, rolecache.AllUsers)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit role delete")
+	}
+	return &r, nil
+}
+
+// Run returns the effective permissions of the user, role names are kept so
+// checks against them still work
+func (p *PermissionResolver) Run(userID string) ([]string, error) {
+	roles := []string{}
+	UID, err := uuid.FromString(userID)
+	if err != nil {
+		return roles, err
+	}
+	tx, err := p.DB.Beginx()
+	if err != nil {
+		return roles, err
+	}
+	defer tx.Rollback()
+	usr, err := fromID(tx, UID)
+	if err != nil {
+		return roles, err
+	}
+	roles = append(roles, usr.Roles...)
+	perms, err := rolePermissions(tx, append([]string{perm.User}, usr.Roles...))
+	if err != nil {
+		return roles, err
+	}
+	for _, p := range perms {
+		if !contains(roles, p) {
+			roles = append(roles, p)
+		}
+	}
+	return roles, nil
+}
+
+// notifyRoleChange tells every instance to drop the cached permissions of the
+// user, or of everyone with rolecache.AllUsers. Postgres delivers it on commit
+func notifyRoleChange(db service.DB, userID string) error {
+	_, err := db.Exec("SELECT pg_notify($1, $2)", rolecache.Channel, userID)
+	if err != nil {
+		return errors.Wrap(err, "Error notifying role change")
+	}
+	return nil
+}
+
+/* listRoles returns the roles matching the filter with their permissions */
+func listRoles(db service.DB, where sq.Sqlizer) ([]m.Role, error) {
+	rs := []m.Role{}
+	query := psql.Select("r.role_id", "r.description", "r.created_at", "r.updated_at",
+		"COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}') AS permissions").
+		From("role r").
+		LeftJoin("role_permission rp USING (role_id)").
+		GroupBy("r.role_id").
+		OrderBy("r.role_id")
+	if where != nil {
+		query = query.Where(where)
+	}
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating role list sql")
+	}
+	err = db.Select(&rs, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing roles")
+	}
+	return rs, nil
+}
+
+/* saveRole upserts the role and replaces its permissions */
+func saveRole(tx *sqlx.Tx, r *m.Role) error {
+	now := time.Now()
+	ins := psql.Insert("role").
+		Columns("role_id", "description", "created_at", "updated_at").
+		Values(r.RoleID, r.Description, now, now).
+		Suffix("ON CONFLICT (role_id) DO UPDATE SET description = EXCLUDED.description, updated_at = EXCLUDED.updated_at")
+	qSQL, args, err := ins.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating role save sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error saving role")
+	}
+
+	del := psql.Delete("role_permission").Where(sq.Eq{"role_id": r.RoleID})
+	qSQL, args, err = del.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating role permissions delete sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error clearing role permissions")
+	}
+	if len(r.Permissions) == 0 {
+		return nil
+	}
+	insP := psql.Insert("role_permission").Columns("role_id", "permission")
+	for _, p := range r.Permissions {
+		insP = insP.Values(r.RoleID, p)
+	}
+	qSQL, args, err = insP.Suffix("ON CONFLICT DO NOTHING").ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating role permissions sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error saving role permissions")
+	}
+	return nil
+}
+
+/* rolePermissions returns the distinct permissions granted by the roles */
+func rolePermissions(db service.DB, roles []string) ([]string, error) {
+	perms := []string{}
+	query := psql.Select("DISTINCT permission").
+		From("role_permission").
+		Where(sq.Expr("role_id = ANY(?)", pq.StringArray(roles))).
+		OrderBy("permission")
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating role permissions sql")
+	}
+	err = db.Select(&perms, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting role permissions")
+	}
+	return perms, nil
+}
+
+// checkAssignable refuses the superadmin role, it spans every institution so
+// it isn't given through the API
+func checkAssignable(roles []string) error {
+	if contains(roles, perm.SuperAdmin) {
+		return &auth.ValidationError{Messages: map[string]string{
+			"superadminRole": "The " + perm.SuperAdmin + " role can't be assigned",
+		}}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sameRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, r := range a {
+		if !contains(b, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,355 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+// Device identifies the client a session was opened from
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// Refresher service exchanges a refresh token for a new token pair
+type Refresher struct {
+	DB        *sqlx.DB
+	JWTConfig JWTConfig
+}
+
+// Logouter service revokes the session of a refresh token
+type Logouter struct {
+	DB *sqlx.DB
+}
+
+// LogoutAller service revokes every session of an user
+type LogoutAller struct {
+	DB *sqlx.DB
+}
+
+// SessionLister service lists the active sessions of an user
+type SessionLister struct {
+	DB *sqlx.DB
+}
+
+// SessionRevoker service revokes one session of an user
+type SessionRevoker struct {
+	DB *sqlx.DB
+}
+
+// SessionChecker service checks a session is still usable
+type SessionChecker struct {
+	DB *sqlx.DB
+}
+
+// Run rotates the refresh token and issues a new access token. Presenting an
+// already rotated refresh token revokes the session, as it was likely leaked.
+func (r *Refresher) Run(refreshToken string, device Device) (*AuthResponse, error) {
+	sessID, secret, err := splitRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := sessionFromID(tx, sessID, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := sessionUsable(sess); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if sess.ActorID != nil {
+		tx.Rollback()
+		return nil, &auth.SessionInvalidError{Message: "Impersonation sessions can't be refreshed"}
+	}
+	if subtle.ConstantTimeCompare([]byte(sess.RefreshHash), []byte(hashSecret(secret))) != 1 {
+		err = revokeSessions(tx, sq.Eq{"sess_id": sess.SessID})
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to commit session revoke")
+		}
+		return nil, &auth.SessionInvalidError{Message: "Refresh token reused, session revoked"}
+	}
+
+	newSecret, err := newSessionSecret()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	now := time.Now()
+	query := psql.Update("user_session").
+		Set("refresh_hash", hashSecret(newSecret)).
+		Set("last_used_at", now).
+		Set("expires_at", now.Add(r.JWTConfig.RefreshTillExpire)).
+		Set("user_agent", device.UserAgent).
+		Set("ip", device.IP).
+		Where(sq.Eq{"sess_id": sess.SessID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating session refresh sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error refreshing session")
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit session refresh")
+	}
+
+	usr, err := withDoctorFromID(r.DB, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+	jwt, err := authenticate(r.DB, *usr, sess.SessID, r.JWTConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResponse{
+		UserWithDoctor: *usr,
+		Jwt:            jwt,
+		RefreshToken:   joinRefreshToken(sess.SessID, newSecret),
+		SessID:         sess.SessID,
+	}, nil
+}
+
+// Run revokes the session the refresh token belongs to
+func (l *Logouter) Run(refreshToken string) error {
+	sessID, secret, err := splitRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	sess, err := sessionFromID(l.DB, sessID, false)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(sess.RefreshHash), []byte(hashSecret(secret))) != 1 {
+		return &auth.SessionInvalidError{Message: "Invalid refresh token"}
+	}
+	return revokeSessions(l.DB, sq.Eq{"sess_id": sess.SessID})
+}
+
+// Run revokes all the sessions of the user
+func (l *LogoutAller) Run(userID uuid.UUID) error {
+	tx, err := l.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	err = revokeSessions(tx, sq.Eq{"user_id": userID})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = rotateUserKey(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Run returns the active sessions of an user, most recently used first
+func (l *SessionLister) Run(userID uuid.UUID) ([]m.Session, error) {
+	sess := []m.Session{}
+	query := psql.Select("*").
+		From("user_session").
+		Where(sq.Eq{"user_id": userID, "revoked_at": nil}).
+		Where(sq.Gt{"expires_at": time.Now()}).
+		OrderBy("last_used_at DESC")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list sessions sql")
+	}
+	err = l.DB.Select(&sess, qSQL, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "Error listing sessions")
+	}
+	return sess, nil
+}
+
+// Run revokes the session, it must belong to the user
+func (r *SessionRevoker) Run(userID, sessID uuid.UUID) error {
+	sess, err := sessionFromID(r.DB, sessID, false)
+	if err != nil {
+		return err
+	}
+	if sess.UserID != userID {
+		return &auth.SessionInvalidError{Message: "Session not found"}
+	}
+	return revokeSessions(r.DB, sq.Eq{"sess_id": sessID})
+}
+
+// Run returns an error when the session is revoked, expired or from another user
+func (s *SessionChecker) Run(userID, sessID string) error {
+	sid, err := uuid.FromString(sessID)
+	if err != nil {
+		return &auth.SessionInvalidError{Message: "Invalid session"}
+	}
+	sess, err := sessionFromID(s.DB, sid, false)
+	if err != nil {
+		return err
+	}
+	if sess.UserID.String() != userID {
+		return &auth.SessionInvalidError{Message: "Invalid session"}
+	}
+	err = sessionUsable(sess)
+	if err != nil || sess.ActorSessID == nil {
+		return err
+	}
+	// an impersonation ends with the session of the admin
+	actorSess, err := sessionFromID(s.DB, *sess.ActorSessID, false)
+	if err != nil {
+		return err
+	}
+	return sessionUsable(actorSess)
+}
+
+// createSession opens a session for the user and returns it with the
+// refresh token to hand to the client
+func createSession(db service.DB, userID uuid.UUID, device Device, ttl time.Duration) (*m.Session, string, error) {
+	sessID, err := uuid.NewV4()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error generating session uuid")
+	}
+	secret, err := newSessionSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	sess := m.Session{
+		SessID:      sessID,
+		UserID:      userID,
+		RefreshHash: hashSecret(secret),
+		UserAgent:   device.UserAgent,
+		IP:          device.IP,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	query := psql.Insert("user_session").
+		Columns("sess_id", "user_id", "refresh_hash", "user_agent", "ip", "created_at", "last_used_at", "expires_at").
+		Values(sess.SessID, sess.UserID, sess.RefreshHash, sess.UserAgent, sess.IP, sess.CreatedAt, sess.LastUsedAt, sess.ExpiresAt)
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error generating session insert sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error inserting session")
+	}
+	return &sess, joinRefreshToken(sessID, secret), nil
+}
+
+/*
+ *	session queries
+ */
+
+func sessionFromID(db service.DB, sessID uuid.UUID, forUpdate bool) (*m.Session, error) {
+	sess := m.Session{}
+	query := psql.Select("*").
+		From("user_session").
+		Where(sq.Eq{"sess_id": sessID})
+	if forUpdate {
+		query = query.Suffix("FOR UPDATE")
+	}
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating get session sql")
+	}
+	err = db.Get(&sess, qSQL, args...)
+	if err == sql.ErrNoRows {
+		return nil, &auth.SessionInvalidError{Message: "Session not found"}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting session")
+	}
+	return &sess, nil
+}
+
+func revokeSessions(db service.DB, where sq.Sqlizer) error {
+	query := psql.Update("user_session").
+		Set("revoked_at", time.Now()).
+		Where(where).
+		Where(sq.Eq{"revoked_at": nil})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating revoke session sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error revoking session")
+	}
+	return nil
+}
+
+func sessionUsable(sess *m.Session) error {
+	if sess.RevokedAt.Valid {
+		return &auth.SessionInvalidError{Message: "Session revoked"}
+	}
+	if sess.ExpiresAt.Before(time.Now()) {
+		return &auth.SessionInvalidError{Message: "Session expired"}
+	}
+	return nil
+}
+
+func newSessionSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "Error generating session secret")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// refresh tokens are sent as "<sessID>.<secret>"
+func joinRefreshToken(sessID uuid.UUID, secret string) string {
+	return sessID.String() + "." + secret
+}
+
+func splitRefreshToken(token string) (uuid.UUID, string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return uuid.Nil, "", &auth.SessionInvalidError{Message: "Invalid refresh token"}
+	}
+	sessID, err := uuid.FromString(parts[0])
+	if err != nil {
+		return uuid.Nil, "", &auth.SessionInvalidError{Message: "Invalid refresh token"}
+	}
+	return sessID, parts[1], nil
+}
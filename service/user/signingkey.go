@@ -0,0 +1,249 @@
+package user
+
+import (
+	"log"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jasonlvhit/gocron"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/keyring"
+)
+
+// signingKey is a row of signing_key, the private key sealed with the secret
+type signingKey struct {
+	KID        string    `db:"kid"`
+	Alg        string    `db:"alg"`
+	PrivateKey []byte    `db:"private_key"`
+	CreatedAt  time.Time `db:"created_at"`
+	RetiredAt  null.Time `db:"retired_at"`
+	ExpiresAt  null.Time `db:"expires_at"`
+}
+
+// SigningKeyLoader service returns the signing keys not expired, it loads the keyring
+type SigningKeyLoader struct {
+	DB *sqlx.DB
+	// Secret the private keys are sealed with
+	Secret string
+}
+
+// Run returns the signing keys oldest first
+func (l *SigningKeyLoader) Run() ([]keyring.Key, error) {
+	rows, err := listSigningKeys(l.DB, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	keys := []keyring.Key{}
+	for _, r := range rows {
+		priv, err := keyring.Open(l.Secret, r.PrivateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error opening signing key "+r.KID)
+		}
+		keys = append(keys, keyring.Key{
+			KID:       r.KID,
+			Alg:       r.Alg,
+			Private:   priv,
+			Retired:   r.RetiredAt.Valid,
+			ExpiresAt: r.ExpiresAt.Time,
+		})
+	}
+	return keys, nil
+}
+
+// SigningKeyRotator service replaces the current signing key once it's old
+// enough or of another algorithm, the instances reload the keys when notified
+type SigningKeyRotator struct {
+	DB     *sqlx.DB
+	Logger *log.Logger
+	// Secret the private keys are sealed with
+	Secret string
+	// Alg new keys are created with, RS256 or EdDSA
+	Alg string
+	// RotateEvery is how long a key signs before being replaced
+	RotateEvery time.Duration
+	// VerifyFor is how long a replaced key still verifies, it must outlive
+	// the tokens it signed
+	VerifyFor time.Duration
+}
+
+// Start checks the current key every hour
+func (r *SigningKeyRotator) Start() chan bool {
+	s := gocron.NewScheduler()
+	s.Every(1).Hour().Do(r.Run)
+	return s.Start()
+}
+
+// Run creates a new signing key when there's none or the current one is due,
+// retiring the previous and deleting the expired ones
+func (r *SigningKeyRotator) Run() error {
+	err := r.rotate()
+	if err != nil && r.Logger != nil {
+		r.Logger.Println(err)
+	}
+	return err
+}
+
+func (r *SigningKeyRotator) rotate() error {
+	now := time.Now()
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	// every instance runs the rotation, only one creates the key
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock(hashtext('signing_key'))")
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error locking signing keys")
+	}
+	cur, err := currentSigningKey(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	due := cur == nil || cur.Alg != r.Alg || cur.CreatedAt.Add(r.RotateEvery).Before(now)
+	if due {
+		kid, err := createSigningKey(tx, r.Secret, r.Alg)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = retireSigningKeys(tx, kid, now, now.Add(r.VerifyFor))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if r.Logger != nil {
+			r.Logger.Printf("rotated signing key, kid %s %s", kid, r.Alg)
+		}
+	}
+	n, err := deleteExpiredSigningKeys(tx, now)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if due || n > 0 {
+		_, err = tx.Exec("SELECT pg_notify($1, '')", keyring.Channel)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "Error notifying signing keys")
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "Failed to commit signing keys")
+	}
+	return nil
+}
+
+/* Return the signing keys not expired at the given time, oldest first */
+func listSigningKeys(db service.DB, at time.Time) ([]signingKey, error) {
+	keys := []signingKey{}
+	query := psql.Select("kid", "alg", "private_key", "created_at", "retired_at", "expires_at").
+		From("signing_key").
+		Where(sq.Or{
+			sq.Eq{"expires_at": nil},
+			sq.Gt{"expires_at": at},
+		}).
+		OrderBy("created_at")
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating list signing keys sql")
+	}
+	err = db.Select(&keys, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing signing keys")
+	}
+	return keys, nil
+}
+
+/* Return the key signing the new tokens, nil when there's none */
+func currentSigningKey(db service.DB) (*signingKey, error) {
+	keys := []signingKey{}
+	query := psql.Select("kid", "alg", "private_key", "created_at", "retired_at", "expires_at").
+		From("signing_key").
+		Where(sq.Eq{"retired_at": nil}).
+		OrderBy("created_at DESC").
+		Limit(1)
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating current signing key sql")
+	}
+	err = db.Select(&keys, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting current signing key")
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return &keys[0], nil
+}
+
+/* Generate and store a new signing key, returns its kid */
+func createSigningKey(db service.DB, secret, alg string) (string, error) {
+	priv, err := keyring.Generate(alg)
+	if err != nil {
+		return "", err
+	}
+	kid, err := keyring.Thumbprint(alg, priv.Public())
+	if err != nil {
+		return "", err
+	}
+	sealed, err := keyring.Seal(secret, priv)
+	if err != nil {
+		return "", err
+	}
+	query := psql.Insert("signing_key").
+		Columns("kid", "alg", "private_key").
+		Values(kid, alg, sealed)
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return "", errors.Wrap(err, "Error generating create signing key sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return "", errors.Wrap(err, "Error creating signing key")
+	}
+	return kid, nil
+}
+
+/* Retire every key but kid, they verify until expiresAt */
+func retireSigningKeys(db service.DB, kid string, at, expiresAt time.Time) error {
+	query := psql.Update("signing_key").
+		Set("retired_at", at).
+		Set("expires_at", expiresAt).
+		Where(sq.Eq{"retired_at": nil}).
+		Where(sq.NotEq{"kid": kid})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating retire signing keys sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error retiring signing keys")
+	}
+	return nil
+}
+
+/* Delete the keys expired before the given time */
+func deleteExpiredSigningKeys(db service.DB, before time.Time) (int64, error) {
+	query := psql.Delete("signing_key").
+		Where(sq.Lt{"expires_at": before})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error generating delete signing keys sql")
+	}
+	res, err := db.Exec(qSQL, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error deleting signing keys")
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,518 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/totp"
+
+	m "gitlab.com/falqon/inovantapp/backend/models"
+)
+
+const (
+	// how long the user has to complete the second sign in step
+	mfaChallengeTTL = 5 * time.Minute
+	// recovery codes handed on activation
+	recoveryCodeCount = 10
+)
+
+// MFAVerifier service completes a two step sign in with a TOTP or recovery code
+type MFAVerifier struct {
+	DB        *sqlx.DB
+	JWTConfig JWTConfig
+	Lockout   LockoutConfig
+}
+
+// MFAEnroller service starts the TOTP enrolment for a sign in that requires it
+type MFAEnroller struct {
+	DB        *sqlx.DB
+	JWTConfig JWTConfig
+	Issuer    string
+}
+
+// MFAActivator service finishes the enrolment started on sign in and signs the user in
+type MFAActivator struct {
+	DB        *sqlx.DB
+	JWTConfig JWTConfig
+}
+
+// TwoFactorEnroller service starts the TOTP enrolment of a logged user
+type TwoFactorEnroller struct {
+	DB     *sqlx.DB
+	Issuer string
+}
+
+// TwoFactorActivator service enables TOTP for a logged user
+type TwoFactorActivator struct {
+	DB *sqlx.DB
+}
+
+// TwoFactorDisabler service disables TOTP for a logged user
+type TwoFactorDisabler struct {
+	DB *sqlx.DB
+}
+
+// RecoveryCodesRenewer service replaces the recovery codes of a logged user
+type RecoveryCodesRenewer struct {
+	DB *sqlx.DB
+}
+
+// Run checks the second factor and opens the session
+func (v *MFAVerifier) Run(mfaToken, code string, device Device) (*AuthResponse, error) {
+	userID, err := parseMFAChallenge(v.DB, mfaToken, auth.MFAStepVerify, v.JWTConfig)
+	if err != nil {
+		return nil, err
+	}
+	usr, err := withDoctorFromID(v.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	if usr.LockedUntil.Valid && usr.LockedUntil.Time.After(time.Now()) {
+		return nil, &auth.AccountLockedError{
+			Message: "Account locked until " + usr.LockedUntil.Time.Format(time.RFC3339),
+			Until:   usr.LockedUntil.Time,
+		}
+	}
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := checkSecondFactor(tx, &usr.User, code)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit second factor check")
+	}
+	if !ok {
+		lockErr := registerFailedAttempt(v.DB, usr.UserID, v.Lockout)
+		if lockErr != nil {
+			return nil, lockErr
+		}
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"code": "Invalid two factor code"},
+		}
+	}
+
+	return signin(v.DB, *usr, device, v.JWTConfig)
+}
+
+// Run returns a new TOTP secret for the user of the sign in challenge
+func (e *MFAEnroller) Run(mfaToken string) (*m.TOTPEnrollment, error) {
+	userID, err := parseMFAChallenge(e.DB, mfaToken, auth.MFAStepEnroll, e.JWTConfig)
+	if err != nil {
+		return nil, err
+	}
+	return enrollTOTP(e.DB, userID, e.Issuer)
+}
+
+// Run enables TOTP and signs the user in, the response carries the recovery codes
+func (a *MFAActivator) Run(mfaToken, code string, device Device) (*AuthResponse, error) {
+	userID, err := parseMFAChallenge(a.DB, mfaToken, auth.MFAStepEnroll, a.JWTConfig)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := activateTOTP(a.DB, userID, code)
+	if err != nil {
+		return nil, err
+	}
+	usr, err := withDoctorFromID(a.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	r, err := signin(a.DB, *usr, device, a.JWTConfig)
+	if err != nil {
+		return nil, err
+	}
+	r.RecoveryCodes = codes
+	return r, nil
+}
+
+// Run returns a new TOTP secret for the user
+func (e *TwoFactorEnroller) Run(userID uuid.UUID) (*m.TOTPEnrollment, error) {
+	return enrollTOTP(e.DB, userID, e.Issuer)
+}
+
+// Run enables TOTP once the user proves the authenticator works, returns the recovery codes
+func (a *TwoFactorActivator) Run(userID uuid.UUID, code string) ([]string, error) {
+	return activateTOTP(a.DB, userID, code)
+}
+
+// Run disables TOTP, not allowed when the user roles require it
+func (d *TwoFactorDisabler) Run(userID uuid.UUID, code string) error {
+	tx, err := d.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	usr, err := fromID(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if perm.RequiresMFA(usr.Roles) {
+		tx.Rollback()
+		return &auth.ValidationError{
+			Messages: map[string]string{"totp": "Two factor authentication is mandatory for this account"},
+		}
+	}
+	if !usr.TotpEnabledAt.Valid {
+		tx.Rollback()
+		return &auth.ValidationError{
+			Messages: map[string]string{"totp": "Two factor authentication is not enabled"},
+		}
+	}
+	ok, err := checkSecondFactor(tx, usr, code)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !ok {
+		tx.Rollback()
+		return &auth.ValidationError{
+			Messages: map[string]string{"code": "Invalid two factor code"},
+		}
+	}
+
+	query := psql.Update(`"user"`).
+		Set("totp_secret", nil).
+		Set("totp_enabled_at", nil).
+		Set("totp_last_counter", 0).
+		Where(sq.Eq{"user_id": userID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error generating disable totp sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error disabling totp")
+	}
+	err = deleteRecoveryCodes(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Run checks a TOTP code and replaces the recovery codes
+func (r *RecoveryCodesRenewer) Run(userID uuid.UUID, code string) ([]string, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	usr, err := fromID(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !usr.TotpEnabledAt.Valid {
+		tx.Rollback()
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"totp": "Two factor authentication is not enabled"},
+		}
+	}
+	ok, err := verifyTOTP(tx, usr, code)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !ok {
+		tx.Rollback()
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"code": "Invalid two factor code"},
+		}
+	}
+	codes, err := newRecoveryCodes(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit recovery codes")
+	}
+	return codes, nil
+}
+
+// mfaChallenge signs the token that links the password step to the second factor step
+func mfaChallenge(db service.DB, userID uuid.UUID, step string, cfg JWTConfig) (string, error) {
+	key, err := userKey(db, userID)
+	if err != nil {
+		return "", err
+	}
+	claims := auth.MFAClaims{
+		UserID:         userID.String(),
+		Step:           step,
+		KeyFingerprint: auth.UserKeyFingerprint(key),
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().UTC().Unix(),
+			ExpiresAt: time.Now().Add(mfaChallengeTTL).UTC().Unix(),
+		},
+	}
+	return cfg.Keys.Sign(claims)
+}
+
+func parseMFAChallenge(db service.DB, mfaToken, step string, cfg JWTConfig) (uuid.UUID, error) {
+	claims := auth.MFAClaims{}
+	_, err := jwt.ParseWithClaims(mfaToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		userID, err := uuid.FromString(claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		key, err := userKey(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare([]byte(claims.KeyFingerprint), []byte(auth.UserKeyFingerprint(key))) != 1 {
+			return nil, errors.New("User key rotated")
+		}
+		return cfg.Keys.Keyfunc(t)
+	})
+	if err != nil || claims.Step != step {
+		return uuid.Nil, &auth.SessionInvalidError{Message: "Invalid or expired two factor token"}
+	}
+	userID, err := uuid.FromString(claims.UserID)
+	if err != nil {
+		return uuid.Nil, &auth.SessionInvalidError{Message: "Invalid or expired two factor token"}
+	}
+	return userID, nil
+}
+
+func enrollTOTP(db *sqlx.DB, userID uuid.UUID, issuer string) (*m.TOTPEnrollment, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	usr, err := fromID(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if usr.TotpEnabledAt.Valid {
+		tx.Rollback()
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"totp": "Two factor authentication already enabled"},
+		}
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating totp secret")
+	}
+
+	query := psql.Update(`"user"`).
+		Set("totp_secret", secret).
+		Set("totp_last_counter", 0).
+		Where(sq.Eq{"user_id": userID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating enroll totp sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error enrolling totp")
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit totp enrolment")
+	}
+	return &m.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(issuer, usr.Email, secret),
+	}, nil
+}
+
+func activateTOTP(db *sqlx.DB, userID uuid.UUID, code string) ([]string, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	usr, err := fromID(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if usr.TotpEnabledAt.Valid {
+		tx.Rollback()
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"totp": "Two factor authentication already enabled"},
+		}
+	}
+	if !usr.TotpSecret.Valid {
+		tx.Rollback()
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"totp": "Two factor enrolment not started"},
+		}
+	}
+	ok, err := verifyTOTP(tx, usr, code)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !ok {
+		tx.Rollback()
+		return nil, &auth.ValidationError{
+			Messages: map[string]string{"code": "Invalid two factor code"},
+		}
+	}
+
+	query := psql.Update(`"user"`).
+		Set("totp_enabled_at", time.Now()).
+		Where(sq.Eq{"user_id": userID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error generating activate totp sql")
+	}
+	_, err = tx.Exec(qSQL, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "Error activating totp")
+	}
+	codes, err := newRecoveryCodes(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to commit totp activation")
+	}
+	return codes, nil
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code
+func checkSecondFactor(db service.DB, usr *m.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return verifyTOTP(db, usr, code)
+	}
+	return useRecoveryCode(db, usr.UserID, code)
+}
+
+// verifyTOTP checks the code and records its time step so it can't be replayed
+func verifyTOTP(db service.DB, usr *m.User, code string) (bool, error) {
+	if !usr.TotpSecret.Valid {
+		return false, nil
+	}
+	counter, ok := totp.Validate(usr.TotpSecret.String, code, time.Now())
+	if !ok || int64(counter) <= usr.TotpLastCounter {
+		return false, nil
+	}
+
+	query := psql.Update(`"user"`).
+		Set("totp_last_counter", int64(counter)).
+		Where(sq.Eq{"user_id": usr.UserID}).
+		Where(sq.Lt{"totp_last_counter": int64(counter)})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return false, errors.Wrap(err, "Error generating totp counter sql")
+	}
+	res, err := db.Exec(qSQL, args...)
+	if err != nil {
+		return false, errors.Wrap(err, "Error updating totp counter")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Error updating totp counter")
+	}
+	return n == 1, nil
+}
+
+func useRecoveryCode(db service.DB, userID uuid.UUID, code string) (bool, error) {
+	query := psql.Update("user_recovery_code").
+		Set("used_at", time.Now()).
+		Where(sq.Eq{
+			"user_id":   userID,
+			"code_hash": hashSecret(normalizeRecoveryCode(code)),
+			"used_at":   nil,
+		})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return false, errors.Wrap(err, "Error generating use recovery code sql")
+	}
+	res, err := db.Exec(qSQL, args...)
+	if err != nil {
+		return false, errors.Wrap(err, "Error using recovery code")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Error using recovery code")
+	}
+	return n == 1, nil
+}
+
+// newRecoveryCodes replaces the user recovery codes, only their hashes are stored
+func newRecoveryCodes(db service.DB, userID uuid.UUID) ([]string, error) {
+	err := deleteRecoveryCodes(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	ins := psql.Insert("user_recovery_code").
+		Columns("reco_id", "user_id", "code_hash", "created_at")
+	now := time.Now()
+	for i := range codes {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error generating recovery code")
+		}
+		c := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = c[:4] + "-" + c[4:]
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error generating recovery code uuid")
+		}
+		ins = ins.Values(id, userID, hashSecret(c), now)
+	}
+
+	qSQL, args, err := ins.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating recovery codes sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error inserting recovery codes")
+	}
+	return codes, nil
+}
+
+func deleteRecoveryCodes(db service.DB, userID uuid.UUID) error {
+	query := psql.Delete("user_recovery_code").
+		Where(sq.Eq{"user_id": userID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating delete recovery codes sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error deleting recovery codes")
+	}
+	return nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.Replace(code, "-", "", -1), " ", "", -1))
+}
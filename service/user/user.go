@@ -13,6 +13,7 @@ import (
 	"gitlab.com/falqon/inovantapp/backend/service"
 	"gitlab.com/falqon/inovantapp/backend/service/mailer"
 	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/perm"
 
 	sq "github.com/Masterminds/squirrel"
 	m "gitlab.com/falqon/inovantapp/backend/models"
@@ -40,6 +41,7 @@ type Creator struct {
 	DB     *sqlx.DB
 	Mailer *mailer.Mailer
 	Config *service.ServicesConfig
+	Policy auth.PasswordPolicy
 }
 
 // Getter service to return user
@@ -71,12 +73,12 @@ type UserCreateModel struct {
 }
 
 // Run return user from id
-func (g *Lister) Run() ([]m.User, error) {
+func (g *Lister) Run(instID uuid.UUID) ([]m.User, error) {
 	tx, err := g.DB.Beginx()
 	if err != nil {
 		return nil, err
 	}
-	u, err := listAll(tx)
+	u, err := listAll(tx, instID)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -86,11 +88,17 @@ func (g *Lister) Run() ([]m.User, error) {
 }
 
 // Run create new user
-func (u *Creator) Run(i *m.User, password string) (*m.User, error) {
+func (u *Creator) Run(instID uuid.UUID, i *m.User, password string) (*m.User, error) {
 	tx, err := u.DB.Beginx()
 	if err != nil {
 		return nil, err
 	}
+	err = u.Policy.Check(password, i.Email)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	i.InstID = instID
 	user, err := newUser(i, password)
 	if err != nil {
 		tx.Rollback()
@@ -129,12 +137,15 @@ func (u *Creator) Run(i *m.User, password string) (*m.User, error) {
 }
 
 // Run return user from id
-func (g *Getter) Run(userID uuid.UUID) (*m.User, error) {
+func (g *Getter) Run(instID, userID uuid.UUID) (*m.User, error) {
 	tx, err := g.DB.Beginx()
 	if err != nil {
 		return nil, err
 	}
 	u, err := fromID(tx, userID)
+	if err == nil && u.InstID != instID {
+		err = errors.Wrap(sql.ErrNoRows, "Error get User sql")
+	}
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -144,11 +155,12 @@ func (g *Getter) Run(userID uuid.UUID) (*m.User, error) {
 }
 
 // Run update user data
-func (g *Updater) Run(user *m.User) (*m.User, error) {
+func (g *Updater) Run(instID uuid.UUID, user *m.User) (*m.User, error) {
 	tx, err := g.DB.Beginx()
 	if err != nil {
 		return nil, err
 	}
+	user.InstID = instID
 	u, err := updateUser(tx, user)
 	if err != nil {
 		tx.Rollback()
@@ -159,12 +171,22 @@ func (g *Updater) Run(user *m.User) (*m.User, error) {
 }
 
 // Run inactive user from user_id
-func (g *Inactiver) Run(userID uuid.UUID) (*m.User, error) {
+func (g *Inactiver) Run(instID, userID uuid.UUID) (*m.User, error) {
 	tx, err := g.DB.Beginx()
 	if err != nil {
 		return nil, err
 	}
-	u, err := inactiveUser(tx, userID)
+	u, err := inactiveUser(tx, instID, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = revokeSessions(tx, sq.Eq{"user_id": userID})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = rotateUserKey(tx, userID)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -174,12 +196,12 @@ func (g *Inactiver) Run(userID uuid.UUID) (*m.User, error) {
 }
 
 // Run active user from user_id
-func (g *Activer) Run(userID uuid.UUID) (*m.User, error) {
+func (g *Activer) Run(instID, userID uuid.UUID) (*m.User, error) {
 	tx, err := g.DB.Beginx()
 	if err != nil {
 		return nil, err
 	}
-	u, err := activeUser(tx, userID)
+	u, err := activeUser(tx, instID, userID)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -225,10 +247,13 @@ func newUser(u *m.User, password string) (*m.User, error) {
 
 // Save a user in the database
 func saveUser(tx service.DB, u *m.User) (*m.User, error) {
+	if err := checkAssignable(u.Roles); err != nil {
+		return nil, err
+	}
 	newUser := m.User{}
 	query := psql.Insert(`"user"`).
-		Columns("user_id", "email", "password", "roles", "push_tokens").
-		Values(u.UserID, u.Email, u.Password, u.Roles, u.Token).
+		Columns("user_id", "inst_id", "email", "password", "roles", "push_tokens").
+		Values(u.UserID, u.InstID, u.Email, u.Password, u.Roles, u.Token).
 		Suffix("RETURNING *")
 
 	qSQL, args, err := query.ToSql()
@@ -249,15 +274,34 @@ func saveUser(tx service.DB, u *m.User) (*m.User, error) {
 
 // Update updates a user in the database
 func updateUser(tx *sqlx.Tx, u *m.User) (*m.User, error) {
+	old := m.UserRole{}
+	cur := psql.Select("roles").
+		From(`"user"`).
+		Where(sq.Eq{"user_id": u.UserID, "inst_id": u.InstID}).
+		Suffix("FOR UPDATE")
+	qSQL, args, err := cur.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating user roles sql")
+	}
+	err = tx.Get(&old, qSQL, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting user roles")
+	}
+	if !contains(old, perm.SuperAdmin) {
+		if err := checkAssignable(u.Roles); err != nil {
+			return nil, err
+		}
+	}
+
 	query := psql.Update(`"user"`).
 		Set("email", u.Email).
 		Set("roles", u.Roles).
 		Set("inactive_at", u.InactiveAt).
 		Suffix("RETURNING *")
 
-	query = query.Where(sq.Eq{"user_id": u.UserID})
+	query = query.Where(sq.Eq{"user_id": u.UserID, "inst_id": u.InstID})
 
-	qSQL, args, err := query.ToSql()
+	qSQL, args, err = query.ToSql()
 	if err != nil {
 		return nil, errors.Wrap(err, "Error generating user update sql")
 	}
@@ -267,16 +311,22 @@ func updateUser(tx *sqlx.Tx, u *m.User) (*m.User, error) {
 		return nil, errors.Wrap(err, "Error user update sql")
 	}
 
+	if !sameRoles(old, u.Roles) {
+		err = notifyRoleChange(tx, u.UserID.String())
+		if err != nil {
+			return nil, err
+		}
+	}
 	return u, nil
 }
 
 // listAll returns users
-func listAll(tx *sqlx.Tx) ([]m.User, error) {
+func listAll(tx *sqlx.Tx, instID uuid.UUID) ([]m.User, error) {
 	u := []m.User{}
-	query := psql.Select("u.user_id", "u.email", "u.password", "u.roles", "u.created_at", "u.inactive_at", "u.push_tokens").
+	query := psql.Select("u.inst_id", "u.user_id", "u.email", "u.password", "u.roles", "u.created_at", "u.inactive_at", "u.push_tokens", "u.failed_attempts", "u.locked_until", "u.totp_enabled_at", "u.password_change_required", "u.password_changed_at").
 		From(`"user" u`).
 		LeftJoin(`doctor doc USING (user_id)`).
-		Where(sq.Eq{"doc.user_id": nil})
+		Where(sq.Eq{"doc.user_id": nil, "u.inst_id": instID})
 
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -295,7 +345,7 @@ func listAll(tx *sqlx.Tx) ([]m.User, error) {
 // fromID returns an user from user_id
 func fromID(tx *sqlx.Tx, userID uuid.UUID) (*m.User, error) {
 	u := m.User{}
-	query := psql.Select("user_id", "email", "password", "roles", "created_at", "inactive_at", "push_tokens").
+	query := psql.Select("inst_id", "user_id", "email", "password", "roles", "created_at", "inactive_at", "push_tokens", "failed_attempts", "locked_until", "totp_secret", "totp_enabled_at", "totp_last_counter", "password_change_required", "password_changed_at").
 		From(`"user"`).
 		Where(sq.Eq{"user_id": userID})
 
@@ -311,11 +361,11 @@ func fromID(tx *sqlx.Tx, userID uuid.UUID) (*m.User, error) {
 }
 
 // inactiveUser soft inactive user from user_id
-func inactiveUser(tx service.DB, userID uuid.UUID) (*m.User, error) {
+func inactiveUser(tx service.DB, instID, userID uuid.UUID) (*m.User, error) {
 	u := m.User{}
 	query := psql.Update(`"user"`).
 		Set("inactive_at", time.Now()).
-		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Eq{"user_id": userID, "inst_id": instID}).
 		Suffix("RETURNING *")
 
 	qSQL, args, err := query.ToSql()
@@ -330,11 +380,11 @@ func inactiveUser(tx service.DB, userID uuid.UUID) (*m.User, error) {
 }
 
 // activeUser soft active user from user_id
-func activeUser(tx service.DB, userID uuid.UUID) (*m.User, error) {
+func activeUser(tx service.DB, instID, userID uuid.UUID) (*m.User, error) {
 	u := m.User{}
 	query := psql.Update(`"user"`).
 		Set("inactive_at", nil).
-		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Eq{"user_id": userID, "inst_id": instID}).
 		Suffix("RETURNING *")
 
 	qSQL, args, err := query.ToSql()
@@ -348,13 +398,14 @@ func activeUser(tx service.DB, userID uuid.UUID) (*m.User, error) {
 	return &u, nil
 }
 
-// fromEmail return User from email
+// fromEmail return User from email, users of deactivated institutions are not found
 func fromEmail(db *sqlx.DB, email string) (usr *m.UserWithDoctor, err error) {
 	usr = &m.UserWithDoctor{}
-	query := psql.Select("u.user_id", "doc.doct_id", "doc.name as doct_name", "u.email", "u.password", "u.created_at", "u.inactive_at").
+	query := psql.Select("u.inst_id", "u.user_id", "doc.doct_id", "doc.name as doct_name", "u.email", "u.password", "u.roles", "u.created_at", "u.inactive_at", "u.failed_attempts", "u.locked_until", "u.totp_secret", "u.totp_enabled_at", "u.totp_last_counter", "u.password_change_required", "u.password_changed_at").
 		From(`"user" u`).
+		Join("institution inst ON inst.inst_id = u.inst_id").
 		LeftJoin("doctor doc USING (user_id)").
-		Where(sq.Eq{"u.inactive_at": nil}).
+		Where(sq.Eq{"u.inactive_at": nil, "inst.inactive_at": nil}).
 		Where("u.email ILIKE ?", strings.TrimSpace(email))
 	qSQL, args, err := query.ToSql()
 	if err != nil {
@@ -371,3 +422,27 @@ func fromEmail(db *sqlx.DB, email string) (usr *m.UserWithDoctor, err error) {
 	}
 	return usr, err
 }
+
+// withDoctorFromID return an active User with its doctor from user_id
+func withDoctorFromID(db service.DB, userID uuid.UUID) (usr *m.UserWithDoctor, err error) {
+	usr = &m.UserWithDoctor{}
+	query := psql.Select("u.inst_id", "u.user_id", "doc.doct_id", "doc.name as doct_name", "u.email", "u.password", "u.roles", "u.created_at", "u.inactive_at", "u.failed_attempts", "u.locked_until", "u.totp_secret", "u.totp_enabled_at", "u.totp_last_counter", "u.password_change_required", "u.password_changed_at").
+		From(`"user" u`).
+		LeftJoin("doctor doc USING (user_id)").
+		Where(sq.Eq{"u.inactive_at": nil}).
+		Where(sq.Eq{"u.user_id": userID})
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return usr, err
+	}
+	err = db.Get(usr, qSQL, args...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return usr, &auth.UserNotFoundError{
+				Message: "No active User with id: " + userID.String(),
+			}
+		}
+		return usr, err
+	}
+	return usr, err
+}
@@ -0,0 +1,110 @@
+package user
+
+import (
+	"crypto/rand"
+	"database/sql"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"gitlab.com/falqon/inovantapp/backend/service"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth"
+	"gitlab.com/falqon/inovantapp/backend/service/user/auth/keycache"
+)
+
+// UserKeyGetter service returns the key secret of an user, it loads the key cache
+type UserKeyGetter struct {
+	DB *sqlx.DB
+}
+
+// UserKeyRotator service rotates the key secret of an user, every token of
+// the user stops working
+type UserKeyRotator struct {
+	DB *sqlx.DB
+}
+
+// Run returns the key secret of the user
+func (g *UserKeyGetter) Run(userID string) ([]byte, error) {
+	id, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid user id")
+	}
+	return userKey(g.DB, id)
+}
+
+// Run rotates the key secret of an user of the institution
+func (r *UserKeyRotator) Run(instID, userID uuid.UUID) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	n := 0
+	err = tx.Get(&n, `SELECT count(*) FROM "user" WHERE user_id = $1 AND inst_id = $2`, userID, instID)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "Error getting user")
+	}
+	if n == 0 {
+		tx.Rollback()
+		return &auth.UserNotFoundError{Message: "No User with id: " + userID.String()}
+	}
+	err = rotateUserKey(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "Failed to commit user key")
+	}
+	return nil
+}
+
+/* userKey returns the key secret of an user */
+func userKey(db service.DB, userID uuid.UUID) ([]byte, error) {
+	key := []byte{}
+	query := psql.Select("key_secret").
+		From(`"user"`).
+		Where(sq.Eq{"user_id": userID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating user key sql")
+	}
+	err = db.Get(&key, qSQL, args...)
+	if err == sql.ErrNoRows {
+		return nil, &auth.UserNotFoundError{Message: "No User with id: " + userID.String()}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting user key")
+	}
+	return key, nil
+}
+
+/* Set a new key secret, instances drop the cached key once the tx commits */
+func rotateUserKey(db service.DB, userID uuid.UUID) error {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return errors.Wrap(err, "Error generating user key")
+	}
+	query := psql.Update(`"user"`).
+		Set("key_secret", key).
+		Where(sq.Eq{"user_id": userID})
+
+	qSQL, args, err := query.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "Error generating rotate user key sql")
+	}
+	_, err = db.Exec(qSQL, args...)
+	if err != nil {
+		return errors.Wrap(err, "Error rotating user key")
+	}
+	_, err = db.Exec("SELECT pg_notify($1, $2)", keycache.Channel, userID.String())
+	if err != nil {
+		return errors.Wrap(err, "Error notifying user key rotation")
+	}
+	return nil
+}